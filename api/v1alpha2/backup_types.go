@@ -26,16 +26,161 @@ type BackupSpec struct {
 	JenkinsRef      string `json:"jenkinsRef,omitempty"`
 	StrategyRef     string `json:"strategyRef,omitempty"`
 	BackupVolumeRef string `json:"backupVolumeRef,omitempty"`
+	// DeletionPolicy tells whether the data of the Backup is deleted from the BackupVolume along with the Backup,
+	// defaults to Delete. It is set to Retain on the Backups adopted from a BackupVolume and on those which ran before
+	// the data of the Backups was deleted with them.
+	// +optional
+	DeletionPolicy BackupDeletionPolicy `json:"deletionPolicy,omitempty"`
+	// Cancel stops the Backup, which fails once Jenkins is taken out of quiet down mode
+	// +optional
+	Cancel bool `json:"cancel,omitempty"`
+}
+
+// BackupDeletionPolicy tells what happens to the data of a Backup when the Backup is deleted
+// +kubebuilder:validation:Enum=Delete;Retain
+type BackupDeletionPolicy string
+
+const (
+	// BackupDeletionPolicyDelete deletes the data of the Backup from the BackupVolume
+	BackupDeletionPolicyDelete BackupDeletionPolicy = "Delete"
+	// BackupDeletionPolicyRetain keeps the data of the Backup on the BackupVolume
+	BackupDeletionPolicyRetain BackupDeletionPolicy = "Retain"
+)
+
+// BackupPhase is a label for the condition of a Backup at the current time
+type BackupPhase string
+
+const (
+	// BackupPending means the Backup has been accepted but has not started yet
+	BackupPending BackupPhase = "Pending"
+	// BackupQueued means the Backup waits for another Backup or Restore of its Jenkins to complete
+	BackupQueued BackupPhase = "Queued"
+	// BackupRunning means the archive of the Backup is being created
+	BackupRunning BackupPhase = "Running"
+	// BackupSucceeded means the archive of the Backup has been stored on the BackupVolume
+	BackupSucceeded BackupPhase = "Succeeded"
+	// BackupFailed means the Backup has failed, the error is given in the message
+	BackupFailed BackupPhase = "Failed"
+)
+
+// BackupStep is a step of a running Backup, persisted before it runs so that a Backup interrupted by a restart of
+// the Operator resumes from it
+type BackupStep string
+
+const (
+	// BackupStepPreBackupHooks runs the PreBackup hooks
+	BackupStepPreBackupHooks BackupStep = "PreBackupHooks"
+	// BackupStepQuietDown puts Jenkins in quiet down mode
+	BackupStepQuietDown BackupStep = "QuietDown"
+	// BackupStepDrain waits for the running builds
+	BackupStepDrain BackupStep = "Drain"
+	// BackupStepBackup creates the archive or the VolumeSnapshot
+	BackupStepBackup BackupStep = "Backup"
+	// BackupStepCancelQuietDown cancels the quiet down mode
+	BackupStepCancelQuietDown BackupStep = "CancelQuietDown"
+	// BackupStepPostBackupHooks runs the PostBackup hooks
+	BackupStepPostBackupHooks BackupStep = "PostBackupHooks"
+	// BackupStepReplicate copies the archive to the replicas of the BackupStrategy
+	BackupStepReplicate BackupStep = "Replicate"
+)
+
+// GitExportStatus is the commit of the configurations exported by a Backup to a Git repository
+type GitExportStatus struct {
+	// URL of the repository
+	URL string `json:"url"`
+	// Branch to which the configurations were committed
+	Branch string `json:"branch"`
+	// Commit is the hash of the commit, empty if the configurations didn't change since the previous export
+	// +optional
+	Commit string `json:"commit,omitempty"`
+	// Changes are the changed files of the commit, as "<status>\t<path>" with the status A for added, M for modified
+	// and D for deleted
+	// +optional
+	Changes []string `json:"changes,omitempty"`
 }
 
 // BackupStatus defines the observed state of Backup
 type BackupStatus struct {
 	// Conditions represent the latest available observations of an object's state
 	Conditions status.Conditions `json:"conditions"`
+	// Phase is a simple, high-level summary of where the Backup is in its lifecycle
+	// +optional
+	Phase BackupPhase `json:"phase,omitempty"`
+	// Step is the step the Backup is running, or the last step it ran once it is complete.
+	// A running Backup resumes from it after a restart of the Operator.
+	// +optional
+	Step BackupStep `json:"step,omitempty"`
+	// Message is a human readable message indicating why the Backup failed
+	// +optional
+	Message string `json:"message,omitempty"`
+	// StartTime is the time at which the Backup started
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+	// CompletionTime is the time at which the Backup succeeded or failed
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	// Size is the size in bytes of the Backup archive
+	// +optional
+	Size int64 `json:"size,omitempty"`
+	// FileCount is the number of files in the Backup archive
+	// +optional
+	FileCount int64 `json:"fileCount,omitempty"`
+	// Path is the location of the Backup on the BackupVolume
+	// +optional
+	Path string `json:"path,omitempty"`
+	// JenkinsPod is the name of the Jenkins Pod which was backed up
+	// +optional
+	JenkinsPod string `json:"jenkinsPod,omitempty"`
+	// JenkinsVersion is the version of Jenkins which was backed up
+	// +optional
+	JenkinsVersion string `json:"jenkinsVersion,omitempty"`
+	// Plugins are the plugins installed in the Jenkins which was backed up, compared with the target Jenkins of a Restore
+	// +optional
+	Plugins []Plugin `json:"plugins,omitempty"`
+	// VolumeSnapshot is the name of the CSI VolumeSnapshot of the Jenkins Home holding the Backup,
+	// set when the BackupStrategy takes VolumeSnapshots
+	// +optional
+	VolumeSnapshot string `json:"volumeSnapshot,omitempty"`
+	// GitExport is the commit of the configurations exported by a Backup of a GitExport BackupStrategy
+	// +optional
+	GitExport *GitExportStatus `json:"gitExport,omitempty"`
+	// Job is the name of the Job which ran the Backup when the BackupStrategy runner is Job, its Pod holds the logs
+	// +optional
+	Job string `json:"job,omitempty"`
+	// Hooks are the outcomes of the hook scripts of the BackupStrategy
+	// +optional
+	Hooks []HookResult `json:"hooks,omitempty"`
+	// Replicas are the outcomes of the copies of the Backup to the replicas of the BackupStrategy
+	// +optional
+	Replicas []BackupReplica `json:"replicas,omitempty"`
+}
+
+// BackupReplica is the outcome of the copy of a Backup to a replica BackupVolume
+type BackupReplica struct {
+	// BackupVolume is the name of the replica BackupVolume
+	BackupVolume string `json:"backupVolume"`
+	// Succeeded is true once the archive and the manifest of the Backup are copied to the replica
+	Succeeded bool `json:"succeeded"`
+	// Path is the location of the copy on the replica BackupVolume
+	// +optional
+	Path string `json:"path,omitempty"`
+	// Message is the reason why the copy failed
+	// +optional
+	Message string `json:"message,omitempty"`
+	// CompletionTime is the time at which the copy succeeded or failed
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Jenkins",type="string",JSONPath=".spec.jenkinsRef"
+// +kubebuilder:printcolumn:name="Volume",type="string",JSONPath=".spec.backupVolumeRef"
+// +kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase"
+// +kubebuilder:printcolumn:name="Size",type="integer",JSONPath=".status.size"
+// +kubebuilder:printcolumn:name="Files",type="integer",JSONPath=".status.fileCount"
+// +kubebuilder:printcolumn:name="Completed",type="date",JSONPath=".status.completionTime"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 
 // Backup is the Schema for the backups API
 type Backup struct {
@@ -0,0 +1,83 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha2
+
+import (
+	"github.com/operator-framework/operator-lib/status"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// BackupScheduleSpec defines the desired state of BackupSchedule
+type BackupScheduleSpec struct {
+	// Schedule is the cron expression (standard 5 fields format) at which Backups are created
+	Schedule string `json:"schedule"`
+	// JenkinsRef is the Jenkins instance to backup
+	JenkinsRef string `json:"jenkinsRef"`
+	// StrategyRef is the BackupStrategy used by the created Backups
+	StrategyRef string `json:"strategyRef,omitempty"`
+	// BackupVolumeRef is the BackupVolume where the created Backups are stored, it is not used by the Backups of a
+	// GitExport BackupStrategy
+	// +optional
+	BackupVolumeRef string `json:"backupVolumeRef,omitempty"`
+	// DeletionPolicy is the deletion policy of the created Backups, defaults to Delete
+	// +optional
+	DeletionPolicy BackupDeletionPolicy `json:"deletionPolicy,omitempty"`
+	// Suspend stops the creation of new Backups, Backups already created are not affected
+	Suspend bool `json:"suspend,omitempty"`
+	// StartingDeadlineSeconds is the deadline in seconds for creating a Backup which missed its scheduled time.
+	// Backups which can not be created before this deadline are counted as missed runs
+	// +optional
+	StartingDeadlineSeconds *int64 `json:"startingDeadlineSeconds,omitempty"`
+}
+
+// BackupScheduleStatus defines the observed state of BackupSchedule
+type BackupScheduleStatus struct {
+	// LastScheduleTime is the last time a Backup was scheduled
+	LastScheduleTime *metav1.Time `json:"lastScheduleTime,omitempty"`
+	// LastSuccessfulBackup is the name of the last Backup created by this schedule which has completed
+	LastSuccessfulBackup string `json:"lastSuccessfulBackup,omitempty"`
+	// MissedRuns is the number of scheduled runs for which no Backup has been created, at most 100 missed runs are
+	// counted after the Operator or the schedule was stopped for a long time
+	MissedRuns int32 `json:"missedRuns,omitempty"`
+	// Conditions represent the latest available observations of an object's state
+	Conditions status.Conditions `json:"conditions,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+
+// BackupSchedule is the Schema for the backupschedules API
+type BackupSchedule struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   BackupScheduleSpec   `json:"spec,omitempty"`
+	Status BackupScheduleStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// BackupScheduleList contains a list of BackupSchedule
+type BackupScheduleList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []BackupSchedule `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&BackupSchedule{}, &BackupScheduleList{})
+}
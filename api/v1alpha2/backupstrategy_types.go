@@ -25,16 +25,125 @@ import (
 
 // BackupStrategySpec defines the desired state of BackupStrategy
 type BackupStrategySpec struct {
+	// Type is how the Backups of the BackupStrategy are taken: Archive, the default, archives the Jenkins Home on the
+	// BackupVolume of the Backup, GitExport commits the configurations of Jenkins, of its jobs and of its folders to the
+	// Git repository of gitExport
+	// +optional
+	Type BackupStrategyType `json:"type,omitempty"`
+	// GitExport is the Git repository to which the Backups of a GitExport BackupStrategy commit the configurations.
+	// Only QuietDownDuringBackup, Drain, Hooks and ActiveDeadlineSeconds apply to a GitExport BackupStrategy.
+	// +optional
+	GitExport *GitExportConfig `json:"gitExport,omitempty"`
 	// QuietDownDuringBackup will put the Jenkins instance in a QuietDown mode which prevents any new builds from taking place
 	QuietDownDuringBackup bool `json:"quietDownDuringBackup,omitempty"`
+	// Drain waits for the running builds to complete before backing up, best used with QuietDownDuringBackup
+	// +optional
+	Drain *DrainConfig `json:"drain,omitempty"`
 	// Options specifies the options provided to user to backup between. default BackupStrategy sets all to true
 	Options BackupOptions `json:"backupOptions"`
+	// Preset selects a predefined set of paths of the Jenkins Home, in addition to Options and Includes
+	// +optional
+	Preset BackupPreset `json:"preset,omitempty"`
+	// Includes are glob patterns of paths relative to the Jenkins Home to back up, e.g. "secrets" or "jobs/**/config.xml".
+	// A pattern matching a directory includes its whole content, "**" matches any number of directories.
+	// +optional
+	Includes []string `json:"includes,omitempty"`
+	// Excludes are glob patterns of paths relative to the Jenkins Home not to back up, e.g. "jobs/**/builds".
+	// Excludes take precedence over Includes.
+	// +optional
+	Excludes []string `json:"excludes,omitempty"`
 	// RestartAfterRestore will restart the Jenkins instance after a Restore
 	RestartAfterRestore RestartConfig `json:"restartAfterRestore"`
+	// Hooks are Groovy scripts run through the Jenkins script console before and after a Backup or a Restore
+	// +optional
+	Hooks *BackupHooks `json:"hooks,omitempty"`
+	// Runner is where the archives are created and extracted: Sidecar, the default, streams them through the backup
+	// sidecar of the Jenkins Pod, Job runs each Backup and Restore in a Job mounting the Jenkins Home and the BackupVolume
+	// +optional
+	Runner BackupRunner `json:"runner,omitempty"`
+	// VolumeSnapshot backs up the Jenkins Home by taking a CSI VolumeSnapshot of its PersistentVolumeClaim instead of
+	// archiving its files, the Jenkins must have persistentSpec enabled. Options, Preset, Includes, Excludes and
+	// Encryption don't apply to VolumeSnapshots.
+	// +optional
+	VolumeSnapshot *VolumeSnapshotConfig `json:"volumeSnapshot,omitempty"`
+	// Encryption encrypts the Backup archives with a key held in a Secret, they are decrypted when restored
+	// +optional
+	Encryption *BackupEncryption `json:"encryption,omitempty"`
+	// ActiveDeadlineSeconds is how long a Backup or a Restore may run, from its start, before it is stopped and fails.
+	// Jenkins is taken out of quiet down mode when a Backup is stopped.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	ActiveDeadlineSeconds *int64 `json:"activeDeadlineSeconds,omitempty"`
+	// Replicas are BackupVolumes, in the namespace of the Backup, to which the archive and the manifest of a succeeded
+	// Backup are copied. A replica stored in a PersistentVolumeClaim must be mounted in the backup sidecar of the
+	// Jenkins, as well as the BackupVolume of the Backup. Replicas don't apply to VolumeSnapshots.
+	// +optional
+	Replicas []string `json:"replicas,omitempty"`
 	// Mount Configmap containing script
-	// Scheduling Backup using the BackupStrategy, will create CronJob
+	// Scheduling Backups using this BackupStrategy is done with a BackupSchedule
 }
 
+// BackupPreset is a predefined set of paths of the Jenkins Home to back up
+// +kubebuilder:validation:Enum=config-only;full-without-builds;full
+type BackupPreset string
+
+const (
+	// BackupPresetConfigOnly backs up the global, jobs, users and nodes configurations with the secrets
+	BackupPresetConfigOnly BackupPreset = "config-only"
+	// BackupPresetFullWithoutBuilds backs up everything but the build history of jobs
+	BackupPresetFullWithoutBuilds BackupPreset = "full-without-builds"
+	// BackupPresetFull backs up the configurations, secrets, jobs with their builds, plugins and user content
+	BackupPresetFull BackupPreset = "full"
+)
+
+// BackupStrategyType is how the Backups of a BackupStrategy are taken
+// +kubebuilder:validation:Enum=Archive;GitExport
+type BackupStrategyType string
+
+const (
+	// BackupStrategyArchive archives the files of the Jenkins Home, or takes a VolumeSnapshot of it
+	BackupStrategyArchive BackupStrategyType = "Archive"
+	// BackupStrategyGitExport commits the config.xml files of Jenkins, of its jobs and of its folders to a Git repository
+	BackupStrategyGitExport BackupStrategyType = "GitExport"
+)
+
+// GitExportConfig is the Git repository to which the configurations are committed, each Backup commits the changes
+// since the previous one
+type GitExportConfig struct {
+	// URL of the repository, such as https://github.com/example/jenkins-config.git or
+	// git@github.com:example/jenkins-config.git, reachable from the git export Job
+	URL string `json:"url"`
+	// Branch to which the configurations are committed, created if it doesn't exist, defaults to main
+	// +optional
+	Branch string `json:"branch,omitempty"`
+	// Directory of the repository to which the configurations are exported, defaults to <namespace>/<jenkins name>.
+	// The files of the directory which are not exported anymore, such as the configurations of deleted jobs, are deleted.
+	// +optional
+	Directory string `json:"directory,omitempty"`
+	// CredentialsSecretRef is the name of the Secret, in the namespace of the BackupStrategy, authenticating to the
+	// repository with the username and password keys over HTTPS, or with the ssh-privatekey key over SSH, the host keys
+	// of the SSH server being checked against the known_hosts key which is then required
+	// +optional
+	CredentialsSecretRef string `json:"credentialsSecretRef,omitempty"`
+	// AuthorName is the author of the commits, defaults to Jenkins Operator
+	// +optional
+	AuthorName string `json:"authorName,omitempty"`
+	// AuthorEmail is the email of the author of the commits, defaults to jenkins-operator@<namespace>
+	// +optional
+	AuthorEmail string `json:"authorEmail,omitempty"`
+}
+
+// BackupRunner is where the archives of the Backups and Restores are created and extracted
+// +kubebuilder:validation:Enum=Sidecar;Job
+type BackupRunner string
+
+const (
+	// BackupRunnerSidecar runs the archiving commands in the backup sidecar of the Jenkins Pod
+	BackupRunnerSidecar BackupRunner = "Sidecar"
+	// BackupRunnerJob runs each Backup and Restore in a Job of the Operator image, the Jenkins Pod needs no backup sidecar
+	BackupRunnerJob BackupRunner = "Job"
+)
+
 // BackupOptions specifies the options provided to user to backup between. default BackupStrategy sets all to true
 type BackupOptions struct {
 	Jobs    bool `json:"jobs"`
@@ -46,6 +155,104 @@ type BackupOptions struct {
 type RestartConfig struct {
 	Enabled bool `json:"enabled"`
 	Safe    bool `json:"safe,omitempty"`
+	// HealthCheckTimeout is how long Jenkins is waited for after the restart before the Restore is rolled back,
+	// defaults to 10m
+	// +optional
+	HealthCheckTimeout *metav1.Duration `json:"healthCheckTimeout,omitempty"`
+}
+
+// DrainConfig configures how long a Backup waits for the executors of Jenkins to be idle
+type DrainConfig struct {
+	// Timeout is the maximal duration of the wait, defaults to 10m
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+	// PollInterval is the interval between two checks of the executors, defaults to 10s
+	// +optional
+	PollInterval *metav1.Duration `json:"pollInterval,omitempty"`
+	// OnTimeout is what happens when builds are still running after the timeout, defaults to BackupAnyway
+	// +optional
+	OnTimeout DrainTimeoutPolicy `json:"onTimeout,omitempty"`
+}
+
+// DrainTimeoutPolicy is what happens when builds are still running after the drain timeout.
+// There is no separate policy to snapshot anyway: BackupAnyway performs the Backup of the BackupStrategy whatever its
+// kind, so with a VolumeSnapshot BackupStrategy it takes the snapshot while the builds are running.
+// +kubebuilder:validation:Enum=Fail;BackupAnyway
+type DrainTimeoutPolicy string
+
+const (
+	// DrainTimeoutFail fails the Backup without backing up
+	DrainTimeoutFail DrainTimeoutPolicy = "Fail"
+	// DrainTimeoutBackupAnyway backs up while the builds are still running, with an archive, a VolumeSnapshot or a Git
+	// export according to the BackupStrategy
+	DrainTimeoutBackupAnyway DrainTimeoutPolicy = "BackupAnyway"
+)
+
+// BackupHooks references the ConfigMaps holding the Groovy scripts run before and after a Backup or a Restore.
+// Each key of a ConfigMap is a script, the scripts are run in the order of the ConfigMaps then of their keys.
+type BackupHooks struct {
+	// PreBackup scripts are run before the Backup, a failing script aborts the Backup
+	// +optional
+	PreBackup []ConfigMapRef `json:"preBackup,omitempty"`
+	// PostBackup scripts are run after the Backup, even if it failed
+	// +optional
+	PostBackup []ConfigMapRef `json:"postBackup,omitempty"`
+	// PreRestore scripts are run before the Restore, a failing script aborts the Restore
+	// +optional
+	PreRestore []ConfigMapRef `json:"preRestore,omitempty"`
+	// PostRestore scripts are run once the Restore succeeded, before Jenkins is restarted
+	// +optional
+	PostRestore []ConfigMapRef `json:"postRestore,omitempty"`
+}
+
+// VolumeSnapshotConfig configures the CSI VolumeSnapshots of the Jenkins Home
+type VolumeSnapshotConfig struct {
+	// VolumeSnapshotClassName is the class of the VolumeSnapshots, defaults to the default class of the cluster
+	// +optional
+	VolumeSnapshotClassName string `json:"volumeSnapshotClassName,omitempty"`
+	// Timeout is how long a VolumeSnapshot is waited for to be ready to use, defaults to 10m
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+}
+
+// BackupEncryption references the Secret holding the key encrypting the Backup archives with AES-256-GCM
+type BackupEncryption struct {
+	// SecretRef is the name of the Secret, in the namespace of the BackupStrategy, holding the encryption key
+	SecretRef string `json:"secretRef"`
+	// Key is the key of the encryption key in the Secret, defaults to "key".
+	// The encryption key must be random and at least 32 bytes long.
+	// +optional
+	Key string `json:"key,omitempty"`
+}
+
+// HookStage is the stage of a Backup or a Restore at which a hook is run
+type HookStage string
+
+const (
+	// PreBackupHook is run before a Backup
+	PreBackupHook HookStage = "PreBackup"
+	// PostBackupHook is run after a Backup
+	PostBackupHook HookStage = "PostBackup"
+	// PreRestoreHook is run before a Restore
+	PreRestoreHook HookStage = "PreRestore"
+	// PostRestoreHook is run after a Restore
+	PostRestoreHook HookStage = "PostRestore"
+)
+
+// HookResult is the outcome of a hook script
+type HookResult struct {
+	// Stage is the stage at which the script was run
+	Stage HookStage `json:"stage"`
+	// Script is the ConfigMap and the key of the script, as <configmap>/<key>
+	Script string `json:"script"`
+	// Succeeded is true if the script ran successfully
+	Succeeded bool `json:"succeeded"`
+	// Output is the end of the output of the script
+	// +optional
+	Output string `json:"output,omitempty"`
+	// Message is the reason why the script failed
+	// +optional
+	Message string `json:"message,omitempty"`
 }
 
 // BackupStrategyStatus defines the observed state of BackupStrategy
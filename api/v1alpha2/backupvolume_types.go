@@ -18,6 +18,7 @@ package v1alpha2
 
 import (
 	"github.com/operator-framework/operator-lib/status"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -26,15 +27,110 @@ type BackupVolumeSpec struct {
 	PersistentVolumeClaimName string `json:"pvcName,omitempty"`
 	StorageClassName          string `json:"storageClassName,omitempty"`
 	Size                      string `json:"size,omitempty"`
+	// Retention defines which completed Backups stored on this volume are kept, the others are pruned along with their data
+	// +optional
+	Retention *BackupRetention `json:"retention,omitempty"`
+	// S3 stores the Backups as archives in a bucket of an S3 compatible object storage instead of the PersistentVolumeClaim
+	// +optional
+	S3 *S3Storage `json:"s3,omitempty"`
+	// AdoptBackups creates a Backup for each Backup found on the volume without one, such as the Backups of a previous
+	// installation of the Operator or of a deleted namespace, so that they can be restored
+	// +optional
+	AdoptBackups bool `json:"adoptBackups,omitempty"`
+	// UsageThresholdPercent is the percentage of the capacity of the PersistentVolumeClaim above which the
+	// UsageThresholdExceeded condition is set, defaults to 80
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=100
+	// +optional
+	UsageThresholdPercent *int32 `json:"usageThresholdPercent,omitempty"`
+}
+
+// S3Storage defines the bucket of an S3 compatible object storage, like AWS S3 or MinIO, where Backups are uploaded
+type S3Storage struct {
+	// Endpoint is the URL of the object storage, e.g. "http://minio.minio:9000". Path-style requests are used.
+	// When empty, the AWS S3 endpoint of the region is used.
+	// +optional
+	Endpoint string `json:"endpoint,omitempty"`
+	// Region of the bucket, defaults to "us-east-1"
+	// +optional
+	Region string `json:"region,omitempty"`
+	// Bucket where the Backups are uploaded, it has to exist
+	Bucket string `json:"bucket"`
+	// Prefix prepended to the keys of the Backup archives
+	// +optional
+	Prefix string `json:"prefix,omitempty"`
+	// CredentialsSecretRef is the name of the Secret containing the AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY keys,
+	// and the AWS_SESSION_TOKEN key for temporary credentials
+	CredentialsSecretRef string `json:"credentialsSecretRef"`
+}
+
+// BackupRetention defines which completed Backups are kept on a BackupVolume.
+// A Backup is kept if it is selected by any of the keep rules, if no keep rule is set all Backups are kept.
+// Backups older than MaxAge are always pruned. The data of the pruned Backups is deleted whatever their deletion policy.
+type BackupRetention struct {
+	// KeepLast keeps the last n Backups
+	// +optional
+	KeepLast *int32 `json:"keepLast,omitempty"`
+	// KeepDaily keeps the last Backup of each day, for the last n days which have a Backup
+	// +optional
+	KeepDaily *int32 `json:"keepDaily,omitempty"`
+	// KeepWeekly keeps the last Backup of each week, for the last n weeks which have a Backup
+	// +optional
+	KeepWeekly *int32 `json:"keepWeekly,omitempty"`
+	// MaxAge prunes the Backups older than the given duration, e.g. "720h"
+	// +optional
+	MaxAge *metav1.Duration `json:"maxAge,omitempty"`
 }
 
 // BackupVolumeStatus defines the observed state of BackupVolume
 type BackupVolumeStatus struct {
 	Conditions status.Conditions `json:"conditions,omitempty"`
+	// Catalog lists the Backups found on the volume, read from their manifests
+	// +optional
+	Catalog []BackupCatalogEntry `json:"catalog,omitempty"`
+	// LastScanTime is the time at which the volume was last scanned for Backups
+	// +optional
+	LastScanTime *metav1.Time `json:"lastScanTime,omitempty"`
+	// Capacity is the capacity of the PersistentVolumeClaim
+	// +optional
+	Capacity *resource.Quantity `json:"capacity,omitempty"`
+	// UsedBytes is the space used on the file system of the PersistentVolumeClaim, measured by a Pod mounting it
+	// +optional
+	UsedBytes int64 `json:"usedBytes,omitempty"`
+	// UsagePercent is the percentage of the file system of the PersistentVolumeClaim which is used
+	// +optional
+	UsagePercent int32 `json:"usagePercent,omitempty"`
+	// BackupCount is the number of succeeded Backups stored on the volume, or copied to it as a replica
+	// +optional
+	BackupCount int32 `json:"backupCount,omitempty"`
+}
+
+// BackupCatalogEntry is a Backup found on a BackupVolume
+type BackupCatalogEntry struct {
+	// Name is the name of the Backup, and of its directory on the volume
+	Name string `json:"name"`
+	// CreationTime is the time at which the archive of the Backup was created
+	CreationTime metav1.Time `json:"creationTime"`
+	// JenkinsVersion is the version of Jenkins which was backed up
+	// +optional
+	JenkinsVersion string `json:"jenkinsVersion,omitempty"`
+	// FileCount is the number of files in the archive of the Backup
+	// +optional
+	FileCount int64 `json:"fileCount,omitempty"`
+	// Encrypted is true when the archive is encrypted, the BackupStrategy holding its key is needed to restore it
+	// +optional
+	Encrypted bool `json:"encrypted,omitempty"`
+	// Orphaned is true when no Backup of the namespace of the volume points to it
+	// +optional
+	Orphaned bool `json:"orphaned,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Capacity",type="string",JSONPath=".status.capacity"
+//+kubebuilder:printcolumn:name="Usage",type="integer",JSONPath=".status.usagePercent"
+//+kubebuilder:printcolumn:name="Backups",type="integer",JSONPath=".status.backupCount"
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 
 // BackupVolume is the Schema for the backupvolumes API
 type BackupVolume struct {
@@ -64,9 +64,19 @@ type JenkinsSpec struct {
 	// BackupEnabled defines whether backup feature is enabled
 	BackupVolumes []string `json:"backupVolumes,omitempty"`
 
+	// BackupRunner is where the Backups and Restores of the Jenkins run. Sidecar, the default, mounts the BackupVolumes
+	// in a backup sidecar of the Jenkins Pod. Job runs every Backup and Restore in a Job whatever the runner of its
+	// BackupStrategy, the Jenkins Pod then has no backup sidecar and doesn't mount the BackupVolumes.
+	// +optional
+	BackupRunner BackupRunner `json:"backupRunner,omitempty"`
+
 	// MetricsEnabled defines whether prometheus metrics are enabled
 	MetricsEnabled bool `json:"metricsEnabled,omitempty"`
 
+	// VeleroEnabled defines whether the Jenkins Pod is annotated with Velero backup hooks, which quiet down Jenkins
+	// while Velero backs it up, and whether the resources of the Jenkins are labelled for the Velero backups
+	VeleroEnabled bool `json:"veleroEnabled,omitempty"`
+
 	// ProxyConfigurationEnabled defines whether openshift global proxy configuration is enabled
 	// if enabled, and if a global proxy is set in openshift, the operator will automatically
 	// configure the jenkins proxy
@@ -74,6 +84,25 @@ type JenkinsSpec struct {
 
 	// PersistentSpec
 	PersistentSpec JenkinsPersistentSpec `json:"persistentSpec,omitempty"`
+
+	// RestoreFrom defines the backup with which the Jenkins Home is populated before Jenkins starts for the first time
+	// +optional
+	RestoreFrom *RestoreFrom `json:"restoreFrom,omitempty"`
+}
+
+// RestoreFrom references the backup with which the Jenkins Home of a new Jenkins is populated, a Backup in the namespace
+// of the Jenkins or a backup listed in the catalog of a BackupVolume, which has no Backup
+type RestoreFrom struct {
+	// BackupRef is the name of the Backup, or the name of the backup on the BackupVolume when it has no Backup
+	BackupRef string `json:"backupRef"`
+	// BackupVolumeRef is the BackupVolume from which the backup is restored, the BackupVolume of the Backup or one of
+	// its replicas. Required when the backup has no Backup.
+	// +optional
+	BackupVolumeRef string `json:"backupVolumeRef,omitempty"`
+	// StrategyRef is the BackupStrategy giving the restored locations and the encryption key of the backup, the
+	// BackupStrategy of the Backup by default, or the default BackupStrategy
+	// +optional
+	StrategyRef string `json:"strategyRef,omitempty"`
 }
 
 type JenkinsPersistentSpec struct {
@@ -27,15 +27,150 @@ import (
 // RestoreSpec defines the desired state of Restore
 type RestoreSpec struct {
 	BackupRef string `json:"backupRef,omitempty"`
+	// BackupNamespace is the namespace of the Backup, defaults to the namespace of the Restore.
+	// The service account of the target Jenkins must be allowed to get the Backup in this namespace.
+	// +optional
+	BackupNamespace string `json:"backupNamespace,omitempty"`
+	// JenkinsRef is the Jenkins, in the namespace of the Restore, in which the Backup is restored.
+	// Defaults to the Jenkins which was backed up, it is required when the Backup is in another namespace.
+	// +optional
+	JenkinsRef string `json:"jenkinsRef,omitempty"`
+	// BackupVolumeRef is the BackupVolume the Backup is restored from: its own BackupVolume, the default, or one of the
+	// replicas it was copied to
+	// +optional
+	BackupVolumeRef string `json:"backupVolumeRef,omitempty"`
+	// CompatibilityPolicy is applied when the Backup was taken from a newer Jenkins, or with plugins which are missing
+	// or older in the target Jenkins: Block fails the Restore, Warn restores anyway and InstallPlugins installs the
+	// plugins before restoring. Defaults to Block.
+	// +optional
+	CompatibilityPolicy RestoreCompatibilityPolicy `json:"compatibilityPolicy,omitempty"`
+	// Items are the full names of the jobs or folders to restore, such as folder/job, instead of the whole Backup.
+	// Their directories are restored with the files selected by the BackupStrategy, then Jenkins reloads them
+	// without restarting.
+	// +optional
+	Items []string `json:"items,omitempty"`
+	// TargetFolder is the full name of the folder in which the Items are restored, under their own name.
+	// Defaults to the folders they were backed up from.
+	// +optional
+	TargetFolder string `json:"targetFolder,omitempty"`
+	// Cancel stops the Restore, which fails and is rolled back to the snapshot taken before it when there is one
+	// +optional
+	Cancel bool `json:"cancel,omitempty"`
 }
 
+// RestoreCompatibilityPolicy is what the Restore does when the Backup is incompatible with the target Jenkins
+// +kubebuilder:validation:Enum=Block;Warn;InstallPlugins
+type RestoreCompatibilityPolicy string
+
+const (
+	// RestoreCompatibilityBlock fails the Restore, nothing is restored
+	RestoreCompatibilityBlock RestoreCompatibilityPolicy = "Block"
+	// RestoreCompatibilityWarn reports the incompatibilities in the conditions of the Restore and restores the Backup
+	RestoreCompatibilityWarn RestoreCompatibilityPolicy = "Warn"
+	// RestoreCompatibilityInstallPlugins installs the missing and older plugins in the target Jenkins before restoring,
+	// the Restore fails if the target Jenkins is older than the backed up Jenkins
+	RestoreCompatibilityInstallPlugins RestoreCompatibilityPolicy = "InstallPlugins"
+)
+
+// RestorePhase is a label for the condition of a Restore at the current time
+type RestorePhase string
+
+const (
+	// RestorePending means the Restore has been accepted but has not started yet
+	RestorePending RestorePhase = "Pending"
+	// RestoreQueued means the Restore waits for another Backup or Restore of its Jenkins to complete
+	RestoreQueued RestorePhase = "Queued"
+	// RestoreRunning means the Backup is being restored
+	RestoreRunning RestorePhase = "Running"
+	// RestoreSucceeded means the Backup has been restored in the Jenkins Home
+	RestoreSucceeded RestorePhase = "Succeeded"
+	// RestoreFailed means the Restore has failed, the error is given in the message
+	RestoreFailed RestorePhase = "Failed"
+)
+
+// RestoreStep is a step of a running Restore, persisted before it runs so that a Restore interrupted by a restart of
+// the Operator resumes from it
+type RestoreStep string
+
+const (
+	// RestoreStepPreRestoreHooks runs the PreRestore hooks
+	RestoreStepPreRestoreHooks RestoreStep = "PreRestoreHooks"
+	// RestoreStepCompatibilityCheck compares the Backup with the target Jenkins
+	RestoreStepCompatibilityCheck RestoreStep = "CompatibilityCheck"
+	// RestoreStepSnapshot saves the locations of the Jenkins Home overwritten by the Restore
+	RestoreStepSnapshot RestoreStep = "Snapshot"
+	// RestoreStepRestore extracts the archive or provisions the Jenkins Home from the VolumeSnapshot
+	RestoreStepRestore RestoreStep = "Restore"
+	// RestoreStepPostRestoreHooks runs the PostRestore hooks
+	RestoreStepPostRestoreHooks RestoreStep = "PostRestoreHooks"
+	// RestoreStepRestart restarts Jenkins
+	RestoreStepRestart RestoreStep = "Restart"
+	// RestoreStepHealthCheck waits for Jenkins to be back after the restart
+	RestoreStepHealthCheck RestoreStep = "HealthCheck"
+)
+
 // RestoreStatus defines the observed state of Restore
 type RestoreStatus struct {
 	Conditions status.Conditions `json:"conditions"`
+	// Phase is a simple, high-level summary of where the Restore is in its lifecycle
+	// +optional
+	Phase RestorePhase `json:"phase,omitempty"`
+	// Step is the step the Restore is running, or the last step it ran once it is complete.
+	// A running Restore resumes from it after a restart of the Operator.
+	// +optional
+	Step RestoreStep `json:"step,omitempty"`
+	// Message is a human readable message indicating why the Restore failed
+	// +optional
+	Message string `json:"message,omitempty"`
+	// StartTime is the time at which the Restore started
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+	// CompletionTime is the time at which the Restore succeeded or failed
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	// Size is the size in bytes of the restored Backup archive
+	// +optional
+	Size int64 `json:"size,omitempty"`
+	// FileCount is the number of files restored
+	// +optional
+	FileCount int64 `json:"fileCount,omitempty"`
+	// Path is the location of the restored Backup on the BackupVolume
+	// +optional
+	Path string `json:"path,omitempty"`
+	// Jenkins is the namespace and name of the Jenkins in which the Backup was restored
+	// +optional
+	Jenkins string `json:"jenkins,omitempty"`
+	// JenkinsPod is the name of the Jenkins Pod which was restored
+	// +optional
+	JenkinsPod string `json:"jenkinsPod,omitempty"`
+	// Job is the name of the Job which ran the Restore when the BackupStrategy runner is Job, its Pod holds the logs
+	// +optional
+	Job string `json:"job,omitempty"`
+	// Hooks are the outcomes of the hook scripts of the BackupStrategy
+	// +optional
+	Hooks []HookResult `json:"hooks,omitempty"`
+	// Snapshot is where the locations of the Jenkins Home overwritten by the Restore were saved, the Restore is rolled
+	// back to it if it fails, even after a restart of the Operator. It is deleted once the Restore is complete.
+	// +optional
+	Snapshot *RestoreSnapshot `json:"snapshot,omitempty"`
+}
+
+// RestoreSnapshot is the location of the snapshot taken by a Restore
+type RestoreSnapshot struct {
+	// BackupVolume is the name of the BackupVolume storing the snapshot
+	BackupVolume string `json:"backupVolume"`
+	// Path is the location of the snapshot on the BackupVolume
+	Path string `json:"path"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Backup",type="string",JSONPath=".spec.backupRef"
+// +kubebuilder:printcolumn:name="Jenkins",type="string",JSONPath=".status.jenkins"
+// +kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase"
+// +kubebuilder:printcolumn:name="Files",type="integer",JSONPath=".status.fileCount"
+// +kubebuilder:printcolumn:name="Completed",type="date",JSONPath=".status.completionTime"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 
 // Restore is the Schema for the restores API
 type Restore struct {
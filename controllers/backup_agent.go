@@ -0,0 +1,520 @@
+package controllers
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jenkinsci/jenkins-automation-operator/api/v1alpha2"
+	"github.com/jenkinsci/jenkins-automation-operator/pkg/encryption"
+	"github.com/jenkinsci/jenkins-automation-operator/pkg/objectstorage"
+	"github.com/operator-framework/operator-lib/status"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// maxBackupJobResultLength is the size limit of the termination message of a container
+const maxBackupJobResultLength = 4096
+
+// RunBackupJob runs the Backup or the Restore described by the environment of a backup Job, writes its result to the
+// termination message of the container and returns the exit code of the Job
+func RunBackupJob() int {
+	return writeBackupJobResult(runBackupJobSpec(context.Background(), defaultJenkinsHome, os.Getenv(backupJobSpecEnvVar)))
+}
+
+// writeBackupJobResult writes the result to the termination message of the container and returns the exit code of the
+// Job. The conditions and the changes are dropped from a result which doesn't fit.
+func writeBackupJobResult(result *backupJobResult) int {
+	content, err := json.Marshal(result)
+	if err == nil && len(content) > maxBackupJobResultLength {
+		result = &backupJobResult{Error: result.Error, Size: result.Size, FileCount: result.FileCount, Path: result.Path, Snapshot: result.Snapshot, Commit: result.Commit}
+		if len(result.Error) > maxBackupJobResultLength/2 {
+			result.Error = result.Error[:maxBackupJobResultLength/2]
+		}
+		content, err = json.Marshal(result)
+	}
+	if err == nil {
+		err = ioutil.WriteFile(corev1.TerminationMessagePathDefault, content, 0644)
+	}
+	if err != nil {
+		logger.Error(err, "Failed to write the result of the backup Job")
+	}
+	if len(result.Error) > 0 {
+		logger.Info(fmt.Sprintf("Backup Job failed: %s", result.Error))
+		return 1
+	}
+	return 0
+}
+
+// runBackupJobSpec runs the Backup or the Restore of the JSON spec on the Jenkins Home mounted in the backup Job
+func runBackupJobSpec(ctx context.Context, jenkinsHome, specContent string) *backupJobResult {
+	spec := &backupJobSpec{}
+	if err := json.Unmarshal([]byte(specContent), spec); err != nil {
+		return &backupJobResult{Error: fmt.Sprintf("invalid %s: %s", backupJobSpecEnvVar, err)}
+	}
+	var encryptionKey []byte
+	if key := os.Getenv(backupJobEncryptionKeyEnvVar); len(key) > 0 {
+		encryptionKey = []byte(key)
+		if len(encryptionKey) < encryption.MinKeyLength {
+			return &backupJobResult{Error: fmt.Sprintf("encryption key must be at least %d bytes", encryption.MinKeyLength)}
+		}
+	}
+	storage, err := newBackupJobStorage(spec)
+	if err != nil {
+		return &backupJobResult{Error: err.Error()}
+	}
+
+	var result *backupJobResult
+	switch spec.Operation {
+	case backupJobBackup:
+		result, err = runBackupJobBackup(ctx, spec, jenkinsHome, storage, encryptionKey)
+	case backupJobRestore:
+		if spec.FirstStart {
+			result, err = runFirstStartRestore(ctx, spec, jenkinsHome, storage, encryptionKey)
+		} else {
+			result, err = runBackupJobRestore(ctx, spec, jenkinsHome, storage, encryptionKey)
+		}
+	case backupJobRollback:
+		result, err = runBackupJobRollback(ctx, spec, jenkinsHome, encryptionKey)
+	case backupJobRemoveSnapshot:
+		result, err = runBackupJobRemoveSnapshot(ctx, spec)
+	default:
+		err = fmt.Errorf("unknown operation '%s'", spec.Operation)
+	}
+	if result == nil {
+		result = &backupJobResult{}
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// newBackupJobStorage returns the storage of the Backup files, on the BackupVolume mounted in the Job or in the bucket
+// with the credentials of the environment
+func newBackupJobStorage(spec *backupJobSpec) (backupStorage, error) {
+	return newBackupJobStorageAt(spec, spec.Directory, spec.KeyPrefix)
+}
+
+// newRestoreSnapshotJobStorage returns the storage of the snapshot kept by the Restore on the BackupVolume, nil if the
+// spec has no snapshot location
+func newRestoreSnapshotJobStorage(spec *backupJobSpec) (backupStorage, error) {
+	if !spec.keepsSnapshot() {
+		return nil, nil
+	}
+	return newBackupJobStorageAt(spec, spec.SnapshotDirectory, spec.SnapshotKeyPrefix)
+}
+
+// newBackupJobStorageAt returns the storage of the files in the directory of the BackupVolume mounted in the Job, or
+// under the key prefix in its bucket
+func newBackupJobStorageAt(spec *backupJobSpec, directory, keyPrefix string) (backupStorage, error) {
+	if spec.S3 == nil {
+		return &localBackupStorage{directory: directory}, nil
+	}
+	credentials := objectstorage.Credentials{
+		AccessKeyID:     os.Getenv(S3AccessKeyIDKey),
+		SecretAccessKey: os.Getenv(S3SecretAccessKeyKey),
+		SessionToken:    os.Getenv(S3SessionTokenKey),
+	}
+	objectStorageClient, err := objectstorage.NewS3Client(spec.S3.Endpoint, spec.S3.Region, spec.S3.Bucket, credentials)
+	if err != nil {
+		return nil, err
+	}
+	return &objectStorageBackupStorage{
+		client:    objectStorageClient,
+		bucket:    spec.S3.Bucket,
+		keyPrefix: keyPrefix,
+		fileNames: []string{BackupArchiveName, BackupManifestName},
+	}, nil
+}
+
+// runBackupJobBackup archives the locations of the Jenkins Home selected by the BackupStrategy and stores the archive
+// along with its manifest
+func runBackupJobBackup(ctx context.Context, spec *backupJobSpec, jenkinsHome string, storage backupStorage, encryptionKey []byte) (*backupJobResult, error) {
+	selection, err := newBackupSelection(spec.Strategy)
+	if err != nil {
+		return nil, err
+	}
+	manifest := &BackupManifest{
+		Backup:       spec.Backup,
+		CreationTime: time.Now().UTC(),
+		Options:      spec.Strategy.Options,
+		Paths:        selection.roots(),
+		Includes:     selection.includes,
+		Excludes:     selection.excludes,
+	}
+	if encryptionKey != nil {
+		manifest.Encryption = encryption.Algorithm
+	}
+	manifest.JenkinsVersion, manifest.Plugins = readJenkinsVersionAndPlugins(jenkinsHome)
+
+	logger.Info(fmt.Sprintf("Archiving %s from %s to %s", strings.Join(manifest.Paths, ", "), jenkinsHome, storage.location()))
+	archiveSize, err := streamBackupArchive(ctx, storage, manifest, encryptionKey, func(out io.Writer) error {
+		return writeHomeArchive(jenkinsHome, selection, out)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &backupJobResult{Size: archiveSize, FileCount: int64(len(manifest.Files)), Path: storage.location()}, nil
+}
+
+// runBackupJobRestore extracts the entries of the Backup archive selected by the BackupStrategy in the Jenkins Home,
+// within the items of the Restore if it has items. The restored locations are saved in a snapshot first, which is put
+// back if the extraction fails. The snapshot is kept on the BackupVolume when the spec has a snapshot location, so that
+// the Operator can put it back if Jenkins is not healthy once restarted. A Job run again reuses the kept snapshot, as the
+// Jenkins Home may already be partly restored.
+func runBackupJobRestore(ctx context.Context, spec *backupJobSpec, jenkinsHome string, storage backupStorage, encryptionKey []byte) (*backupJobResult, error) {
+	manifest, err := readBackupManifest(ctx, storage)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the manifest of Backup '%s': %s", spec.Backup, err)
+	}
+	selection, err := newBackupSelection(spec.Strategy)
+	if err != nil {
+		return nil, err
+	}
+	items, err := newRestoreItems(spec.Items, spec.TargetFolder)
+	if err != nil {
+		return nil, err
+	}
+	restored := getRestoreEntryFilter(selection, items)
+	snapshotSelection := selection
+	if items != nil {
+		if err = items.checkBackup(manifest.Files, selection); err != nil {
+			return nil, err
+		}
+		snapshotSelection = items.targetSelection(selection)
+	}
+	result := &backupJobResult{Path: storage.location()}
+	archive, archiveSize, err := downloadBackupArchive(ctx, storage, manifest, encryptionKey, spec.Name)
+	if err != nil {
+		return result, err
+	}
+	defer os.Remove(archive.Name())
+	defer archive.Close()
+	result.Size = archiveSize
+	for name := range manifest.Files {
+		if _, found := restored(name); found {
+			result.FileCount++
+		}
+	}
+
+	snapshot, err := openBackupJobRestoreSnapshot(ctx, spec, jenkinsHome, snapshotSelection, encryptionKey)
+	if err != nil {
+		err = fmt.Errorf("failed to take snapshot: %s", err)
+		result.Conditions = append(result.Conditions, status.Condition{Type: SnapshotTaken, Status: corev1.ConditionFalse, Reason: SnapshotFailed, Message: err.Error()})
+		return result, err
+	}
+	if spec.keepsSnapshot() {
+		result.Snapshot = snapshot.storage.location()
+	} else {
+		defer snapshot.remove(ctx)
+	}
+	result.Conditions = append(result.Conditions, status.Condition{Type: SnapshotTaken, Status: corev1.ConditionTrue, Message: fmt.Sprintf("%d files saved", len(snapshot.files))})
+
+	logger.Info(fmt.Sprintf("Extracting %d files to %s", result.FileCount, jenkinsHome))
+	err = extractBackupArchive(archive, manifest, encryptionKey, restored, jenkinsHome)
+	if err == nil {
+		return result, nil
+	}
+	rollbackErr := snapshot.rollbackLocal(ctx, jenkinsHome)
+	if rollbackErr != nil {
+		result.Conditions = append(result.Conditions, status.Condition{Type: RolledBack, Status: corev1.ConditionFalse, Reason: RollbackFailed, Message: rollbackErr.Error()})
+		return result, fmt.Errorf("%s, rollback failed: %s", err, rollbackErr)
+	}
+	result.Conditions = append(result.Conditions, status.Condition{Type: RolledBack, Status: corev1.ConditionTrue, Message: fmt.Sprintf("%d files restored from the snapshot", len(snapshot.files))})
+	return result, fmt.Errorf("%s, rolled back to the snapshot", err)
+}
+
+// openBackupJobRestoreSnapshot returns the snapshot kept on the BackupVolume by a previous run of the restore Job, or
+// takes it, in a temporary directory when the spec has no snapshot location
+func openBackupJobRestoreSnapshot(ctx context.Context, spec *backupJobSpec, jenkinsHome string, selection *backupSelection, encryptionKey []byte) (*restoreSnapshot, error) {
+	storage, err := newRestoreSnapshotJobStorage(spec)
+	if err != nil {
+		return nil, err
+	}
+	if storage == nil {
+		directory, err := ioutil.TempDir("", spec.Name+"-snapshot")
+		if err != nil {
+			return nil, err
+		}
+		storage = &localBackupStorage{directory: directory}
+	} else if snapshot, err := openRestoreSnapshot(ctx, storage, encryptionKey); err == nil {
+		logger.Info(fmt.Sprintf("Reusing the snapshot of %s in %s", jenkinsHome, storage.location()))
+		return snapshot, nil
+	}
+	logger.Info(fmt.Sprintf("Saving %s of %s in a snapshot in %s", strings.Join(selection.roots(), ", "), jenkinsHome, storage.location()))
+	return takeLocalRestoreSnapshot(ctx, jenkinsHome, spec.Name, selection, storage, encryptionKey)
+}
+
+// runBackupJobRollback puts back the snapshot kept on the BackupVolume by the restore Job in the Jenkins Home
+func runBackupJobRollback(ctx context.Context, spec *backupJobSpec, jenkinsHome string, encryptionKey []byte) (*backupJobResult, error) {
+	storage, err := newRestoreSnapshotJobStorage(spec)
+	if err != nil {
+		return nil, err
+	}
+	if storage == nil {
+		return nil, fmt.Errorf("no snapshot of Restore '%s' to roll back to", spec.Name)
+	}
+	snapshot, err := openRestoreSnapshot(ctx, storage, encryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the snapshot: %s", err)
+	}
+	result := &backupJobResult{Snapshot: storage.location(), FileCount: int64(len(snapshot.files))}
+	logger.Info(fmt.Sprintf("Putting back %d files from %s to %s", result.FileCount, storage.location(), jenkinsHome))
+	return result, snapshot.rollbackLocal(ctx, jenkinsHome)
+}
+
+// runBackupJobRemoveSnapshot removes the snapshot kept on the BackupVolume by the restore Job
+func runBackupJobRemoveSnapshot(ctx context.Context, spec *backupJobSpec) (*backupJobResult, error) {
+	storage, err := newRestoreSnapshotJobStorage(spec)
+	if err != nil || storage == nil {
+		return nil, err
+	}
+	logger.Info(fmt.Sprintf("Removing the snapshot in %s", storage.location()))
+	return &backupJobResult{}, storage.delete(ctx)
+}
+
+// extractBackupArchive extracts the entries of the verified archive for which restored returns true in the directory,
+// under the name it returns
+func extractBackupArchive(archive io.ReadSeeker, manifest *BackupManifest, encryptionKey []byte, restored func(name string) (string, bool), directory string) error {
+	if _, err := archive.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	compressedArchive, err := openBackupArchive(archive, manifest, encryptionKey)
+	if err != nil {
+		return err
+	}
+	gzipReader, err := gzip.NewReader(compressedArchive)
+	if err != nil {
+		return err
+	}
+	pipeReader, pipeWriter := io.Pipe()
+	go func() {
+		_ = pipeWriter.CloseWithError(renameArchive(gzipReader, pipeWriter, restored))
+	}()
+	defer pipeReader.Close()
+	return extractArchive(pipeReader, directory)
+}
+
+// readJenkinsVersionAndPlugins reads the version of Jenkins and the installed plugins from the Jenkins Home mounted in
+// the backup Job, these are informative only so errors are ignored
+func readJenkinsVersionAndPlugins(jenkinsHome string) (string, []v1alpha2.Plugin) {
+	version, err := ioutil.ReadFile(filepath.Join(jenkinsHome, "jenkins.install.InstallUtil.lastExecVersion"))
+	if err != nil {
+		logger.Info(fmt.Sprintf("Failed to read Jenkins version: %s", err))
+	}
+	pluginManifests := &bytes.Buffer{}
+	manifestFiles, _ := filepath.Glob(filepath.Join(jenkinsHome, "plugins", "*", "META-INF", "MANIFEST.MF"))
+	for _, manifestFile := range manifestFiles {
+		content, err := ioutil.ReadFile(manifestFile)
+		if err != nil {
+			logger.Info(fmt.Sprintf("Failed to read Jenkins plugin: %s", err))
+			continue
+		}
+		pluginManifests.Write(content)
+		pluginManifests.WriteByte('\n')
+	}
+	return strings.TrimSpace(string(version)), parsePluginManifests(pluginManifests)
+}
+
+// walkHome calls walkFn for the entries of the existing roots of the selection in the Jenkins Home, with their path
+// relative to it. The excluded directories are skipped, the other entries must be filtered by walkFn.
+func walkHome(jenkinsHome string, selection *backupSelection, walkFn func(file, name string, info os.FileInfo) error) error {
+	visited := map[string]bool{}
+	for _, root := range selection.roots() {
+		matches, err := filepath.Glob(filepath.Join(jenkinsHome, root))
+		if err != nil {
+			return err
+		}
+		for _, match := range matches {
+			err = filepath.Walk(match, func(file string, info os.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+				name, err := filepath.Rel(jenkinsHome, file)
+				if err != nil {
+					return err
+				}
+				name = filepath.ToSlash(name)
+				if info.IsDir() && selection.isExcluded(name) {
+					return filepath.SkipDir
+				}
+				// The roots may overlap, such as "*" and "jobs"
+				if visited[name] {
+					if info.IsDir() {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				visited[name] = true
+				return walkFn(file, name, info)
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeHomeArchive writes a tar archive of the entries of the Jenkins Home selected by the selection to out, as the
+// archive script of the backup sidecar does. Sockets, pipes and devices are skipped.
+func writeHomeArchive(jenkinsHome string, selection *backupSelection, out io.Writer) error {
+	tarWriter := tar.NewWriter(out)
+	err := walkHome(jenkinsHome, selection, func(file, name string, info os.FileInfo) error {
+		if !selection.isSelected(name) {
+			return nil
+		}
+		link := ""
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			var err error
+			if link, err = os.Readlink(file); err != nil {
+				return err
+			}
+		case !info.Mode().IsRegular() && !info.IsDir():
+			return nil
+		}
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = name
+		if info.IsDir() {
+			header.Name += "/"
+		}
+		if err = tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		content, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer content.Close()
+		// A file which shrinks while it is archived, like a rotated log, is padded with zeros to its size in the header
+		_, err = io.Copy(tarWriter, io.LimitReader(io.MultiReader(content, zeroReader{}), header.Size))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tarWriter.Close()
+}
+
+// zeroReader reads zeros
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+// extractArchive extracts the directories, regular files and symbolic links of the tar archive in the directory.
+// The entries can't be written outside of the directory, neither with their path nor through a symbolic link.
+func extractArchive(in io.Reader, directory string) error {
+	tarReader := tar.NewReader(in)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name := path.Clean(strings.TrimPrefix(header.Name, "./"))
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return fmt.Errorf("invalid archive entry '%s'", header.Name)
+		}
+		if name == "." {
+			continue
+		}
+		if err = checkNoSymlinkInPath(directory, path.Dir(name)); err != nil {
+			return err
+		}
+		target := filepath.Join(directory, filepath.FromSlash(name))
+		mode := os.FileMode(header.Mode).Perm()
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err = os.MkdirAll(target, mode|0700); err != nil {
+				return err
+			}
+		case tar.TypeReg, tar.TypeRegA:
+			if err = prepareArchiveEntry(target); err != nil {
+				return err
+			}
+			file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+			if err != nil {
+				return err
+			}
+			if _, err = io.Copy(file, tarReader); err != nil {
+				_ = file.Close()
+				return err
+			}
+			if err = file.Close(); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err = prepareArchiveEntry(target); err != nil {
+				return err
+			}
+			if err = os.Symlink(header.Linkname, target); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// checkNoSymlinkInPath returns an error if an existing parent directory of an archive entry is a symbolic link
+func checkNoSymlinkInPath(directory, name string) error {
+	current := directory
+	for _, segment := range strings.Split(name, "/") {
+		if segment == "." {
+			continue
+		}
+		current = filepath.Join(current, segment)
+		info, err := os.Lstat(current)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("invalid archive entry in '%s', it is a symbolic link", name)
+		}
+	}
+	return nil
+}
+
+// prepareArchiveEntry creates the parent directory of the file to extract and removes the existing symbolic link
+// or file, so that the entry is not written through a link
+func prepareArchiveEntry(target string) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	info, err := os.Lstat(target)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("'%s' is a directory", target)
+	}
+	return os.Remove(target)
+}
@@ -0,0 +1,196 @@
+package controllers
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/jenkinsci/jenkins-automation-operator/api/v1alpha2"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func writeHomeFiles(jenkinsHome string, files map[string]string) {
+	for name, content := range files {
+		file := filepath.Join(jenkinsHome, filepath.FromSlash(name))
+		Expect(os.MkdirAll(filepath.Dir(file), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(file, []byte(content), 0644)).To(Succeed())
+	}
+}
+
+func readHomeFile(jenkinsHome, name string) string {
+	content, err := ioutil.ReadFile(filepath.Join(jenkinsHome, filepath.FromSlash(name)))
+	Expect(err).NotTo(HaveOccurred())
+	return string(content)
+}
+
+var _ = Describe("Backup Job spec", func() {
+	ctx := context.Background()
+	strategy := v1alpha2.BackupStrategySpec{Options: v1alpha2.BackupOptions{Config: true, Jobs: true}, Excludes: []string{"jobs/*/builds"}}
+	var (
+		tempDir         string
+		jenkinsHome     string
+		backupDirectory string
+		backupResult    *backupJobResult
+	)
+	newSpec := func(operation backupJobOperation) string {
+		content, err := json.Marshal(&backupJobSpec{Operation: operation, Name: "backup", Backup: "backup", Strategy: strategy, Directory: backupDirectory})
+		Expect(err).NotTo(HaveOccurred())
+		return string(content)
+	}
+
+	BeforeEach(func() {
+		var err error
+		tempDir, err = ioutil.TempDir("", "backup-job")
+		Expect(err).NotTo(HaveOccurred())
+		jenkinsHome = filepath.Join(tempDir, "home")
+		backupDirectory = filepath.Join(tempDir, "backups", "backup")
+		writeHomeFiles(jenkinsHome, map[string]string{
+			"config.xml": "<hudson/>",
+			"jenkins.install.InstallUtil.lastExecVersion": "2.263",
+			"jobs/a/config.xml":                           "<project/>",
+			"jobs/a/builds/1/log":                         "excluded",
+			"plugins/git/META-INF/MANIFEST.MF":            "Short-Name: git\nPlugin-Version: 4.4.5\n",
+			"secret.key":                                  "not selected",
+		})
+		Expect(os.Symlink("builds/1", filepath.Join(jenkinsHome, "jobs", "a", "lastSuccessful"))).To(Succeed())
+		backupResult = runBackupJobSpec(ctx, jenkinsHome, newSpec(backupJobBackup))
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tempDir)).To(Succeed())
+	})
+
+	It("Should Back Up The Selected Files", func() {
+		Expect(backupResult.Error).To(BeEmpty())
+		Expect(backupResult.FileCount).To(Equal(int64(2)))
+		Expect(backupResult.Path).To(Equal(backupDirectory))
+		manifest, err := readBackupManifest(ctx, &localBackupStorage{directory: backupDirectory})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(manifest.JenkinsVersion).To(Equal("2.263"))
+		Expect(manifest.Plugins).To(Equal([]v1alpha2.Plugin{{Name: "git", Version: "4.4.5"}}))
+		Expect(manifest.Files).To(HaveKey("jobs/a/config.xml"))
+		Expect(manifest.Files).NotTo(HaveKey("jobs/a/builds/1/log"))
+	})
+
+	It("Should Restore The Backup", func() {
+		writeHomeFiles(jenkinsHome, map[string]string{"config.xml": "<changed/>", "jobs/b/config.xml": "<added/>"})
+
+		result := runBackupJobSpec(ctx, jenkinsHome, newSpec(backupJobRestore))
+
+		Expect(result.Error).To(BeEmpty())
+		Expect(result.FileCount).To(Equal(int64(2)))
+		Expect(readHomeFile(jenkinsHome, "config.xml")).To(Equal("<hudson/>"))
+		Expect(readHomeFile(jenkinsHome, "jobs/b/config.xml")).To(Equal("<added/>"))
+		link, err := os.Readlink(filepath.Join(jenkinsHome, "jobs", "a", "lastSuccessful"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(link).To(Equal("builds/1"))
+		Expect(result.Conditions).To(HaveLen(1))
+		Expect(result.Conditions[0].Type).To(Equal(SnapshotTaken))
+	})
+
+	It("Should Roll Back A Failed Restore", func() {
+		Expect(os.Remove(filepath.Join(jenkinsHome, "jobs", "a", "config.xml"))).To(Succeed())
+		writeHomeFiles(jenkinsHome, map[string]string{"jobs/a/config.xml/conflict": "directory", "jobs/c/config.xml": "<added/>"})
+
+		result := runBackupJobSpec(ctx, jenkinsHome, newSpec(backupJobRestore))
+
+		Expect(result.Error).To(ContainSubstring("rolled back to the snapshot"))
+		Expect(result.Conditions).To(HaveLen(2))
+		Expect(result.Conditions[1].Type).To(Equal(RolledBack))
+		Expect(result.Conditions[1].Status).To(Equal(corev1.ConditionTrue))
+		Expect(readHomeFile(jenkinsHome, "jobs/a/config.xml/conflict")).To(Equal("directory"))
+		Expect(readHomeFile(jenkinsHome, "jobs/c/config.xml")).To(Equal("<added/>"))
+	})
+
+	It("Should Restore Items", func() {
+		writeHomeFiles(jenkinsHome, map[string]string{"config.xml": "<changed/>"})
+		content, err := json.Marshal(&backupJobSpec{Operation: backupJobRestore, Name: "restore", Backup: "backup", Strategy: strategy,
+			Directory: backupDirectory, Items: []string{"a"}, TargetFolder: "restored"})
+		Expect(err).NotTo(HaveOccurred())
+
+		result := runBackupJobSpec(ctx, jenkinsHome, string(content))
+
+		Expect(result.Error).To(BeEmpty())
+		Expect(result.FileCount).To(Equal(int64(1)))
+		Expect(readHomeFile(jenkinsHome, "jobs/restored/jobs/a/config.xml")).To(Equal("<project/>"))
+		Expect(readHomeFile(jenkinsHome, "config.xml")).To(Equal("<changed/>"))
+	})
+
+	It("Should Keep The Snapshot Until It Is Removed", func() {
+		snapshotDirectory := filepath.Join(tempDir, "backups", restoreSnapshotsDirectory, "restore")
+		newRestoreSpec := func(operation backupJobOperation) string {
+			content, err := json.Marshal(&backupJobSpec{Operation: operation, Name: "restore", Backup: "backup", Strategy: strategy,
+				Directory: backupDirectory, SnapshotDirectory: snapshotDirectory})
+			Expect(err).NotTo(HaveOccurred())
+			return string(content)
+		}
+		Expect(os.Remove(filepath.Join(jenkinsHome, "jobs", "a", "config.xml"))).To(Succeed())
+		writeHomeFiles(jenkinsHome, map[string]string{"config.xml": "<before/>"})
+
+		result := runBackupJobSpec(ctx, jenkinsHome, newRestoreSpec(backupJobRestore))
+
+		Expect(result.Error).To(BeEmpty())
+		Expect(result.Snapshot).To(Equal(snapshotDirectory))
+		Expect(readHomeFile(jenkinsHome, "config.xml")).To(Equal("<hudson/>"))
+
+		// A Job run again doesn't save the partly restored Jenkins Home
+		result = runBackupJobSpec(ctx, jenkinsHome, newRestoreSpec(backupJobRestore))
+		Expect(result.Error).To(BeEmpty())
+
+		result = runBackupJobSpec(ctx, jenkinsHome, newRestoreSpec(backupJobRollback))
+
+		Expect(result.Error).To(BeEmpty())
+		Expect(result.FileCount).NotTo(BeZero())
+		Expect(readHomeFile(jenkinsHome, "config.xml")).To(Equal("<before/>"))
+
+		result = runBackupJobSpec(ctx, jenkinsHome, newRestoreSpec(backupJobRemoveSnapshot))
+
+		Expect(result.Error).To(BeEmpty())
+		_, err := os.Stat(snapshotDirectory)
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+})
+
+var _ = Describe("Archive extraction", func() {
+	var directory string
+	newArchive := func(headers ...*tar.Header) *bytes.Buffer {
+		archive := &bytes.Buffer{}
+		tarWriter := tar.NewWriter(archive)
+		for _, header := range headers {
+			Expect(tarWriter.WriteHeader(header)).To(Succeed())
+		}
+		Expect(tarWriter.Close()).To(Succeed())
+		return archive
+	}
+
+	BeforeEach(func() {
+		var err error
+		directory, err = ioutil.TempDir("", "extract")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(directory)).To(Succeed())
+	})
+
+	It("Should Reject A Path Outside Of The Directory", func() {
+		archive := newArchive(&tar.Header{Name: "../config.xml", Typeflag: tar.TypeReg, Mode: 0644})
+
+		Expect(extractArchive(archive, directory)).To(MatchError("invalid archive entry '../config.xml'"))
+	})
+
+	It("Should Reject A File Through A Symbolic Link", func() {
+		archive := newArchive(
+			&tar.Header{Name: "jobs", Typeflag: tar.TypeSymlink, Linkname: "/etc"},
+			&tar.Header{Name: "jobs/config.xml", Typeflag: tar.TypeReg, Mode: 0644},
+		)
+
+		Expect(extractArchive(archive, directory)).To(MatchError("invalid archive entry in 'jobs', it is a symbolic link"))
+	})
+})
@@ -0,0 +1,614 @@
+package controllers
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jenkinsci/jenkins-automation-operator/api/v1alpha2"
+	"github.com/jenkinsci/jenkins-automation-operator/pkg/encryption"
+	"github.com/jenkinsci/jenkins-automation-operator/pkg/exec"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// BackupArchiveName is the name of the compressed tar archive of a Backup
+	BackupArchiveName = "backup.tar.gz"
+	// BackupManifestName is the name of the manifest describing the archive of a Backup
+	BackupManifestName = "manifest.json"
+)
+
+// safePathPattern matches the include and exclude patterns which can be passed to the shell once quoted
+var safePathPattern = regexp.MustCompile(`^[A-Za-z0-9 ._\-@+*?\[\]/]+$`)
+
+// BackupManifest describes the content of a Backup archive
+type BackupManifest struct {
+	// Backup is the name of the Backup
+	Backup string `json:"backup"`
+	// CreationTime is the time at which the archive was created
+	CreationTime time.Time `json:"creationTime"`
+	// JenkinsVersion is the version of Jenkins which was backed up
+	JenkinsVersion string `json:"jenkinsVersion,omitempty"`
+	// Plugins are the plugins installed in the Jenkins which was backed up
+	Plugins []v1alpha2.Plugin `json:"plugins,omitempty"`
+	// Options are the BackupOptions used to create the archive
+	Options v1alpha2.BackupOptions `json:"options"`
+	// Paths are the top level locations of the Jenkins Home included in the archive
+	Paths []string `json:"paths"`
+	// Includes are the patterns of the paths of the Jenkins Home included in the archive
+	Includes []string `json:"includes,omitempty"`
+	// Excludes are the patterns of the paths of the Jenkins Home excluded from the archive
+	Excludes []string `json:"excludes,omitempty"`
+	// Encryption is the algorithm with which the archive is encrypted, empty if it is not encrypted
+	Encryption string `json:"encryption,omitempty"`
+	// Files are the SHA-256 checksums of the regular files of the archive, by path
+	Files map[string]string `json:"files"`
+}
+
+// writeBackupArchive compresses the tar stream read from in to out and returns the checksums of its regular files.
+// The compressed archive is encrypted when an encryption key is given.
+func writeBackupArchive(in io.Reader, out io.Writer, encryptionKey []byte) (map[string]string, error) {
+	var encryptionWriter io.WriteCloser
+	if encryptionKey != nil {
+		var err error
+		encryptionWriter, err = encryption.NewWriter(out, encryptionKey)
+		if err != nil {
+			return nil, err
+		}
+		out = encryptionWriter
+	}
+	gzipWriter := gzip.NewWriter(out)
+	checksums, err := getArchiveChecksums(io.TeeReader(in, gzipWriter))
+	if err != nil {
+		return nil, err
+	}
+	if err = gzipWriter.Close(); err != nil {
+		return nil, err
+	}
+	if encryptionWriter != nil {
+		if err = encryptionWriter.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return checksums, nil
+}
+
+// storeBackupArchive writes the archive, as it is read, then its manifest to the storage and returns the size of the
+// archive. The manifest is written last, a Backup without manifest is incomplete.
+func storeBackupArchive(ctx context.Context, storage backupStorage, archive io.Reader, manifest *BackupManifest) (int64, error) {
+	counter := &countingReader{reader: archive}
+	if err := storage.writeFile(ctx, BackupArchiveName, counter); err != nil {
+		return 0, err
+	}
+	return counter.count, writeBackupManifest(ctx, storage, manifest)
+}
+
+// streamBackupArchive compresses the tar stream written by writeTar and writes it to the storage while it is produced,
+// so that the archive is never staged on disk. The manifest is then completed with the checksums of the files and
+// written last. It returns the size of the archive.
+func streamBackupArchive(ctx context.Context, storage backupStorage, manifest *BackupManifest, encryptionKey []byte, writeTar func(out io.Writer) error) (int64, error) {
+	archiveReader, archiveWriter := io.Pipe()
+	archiveErr := make(chan error, 1)
+	go func() {
+		tarReader, tarWriter := io.Pipe()
+		go func() {
+			_ = tarWriter.CloseWithError(writeTar(tarWriter))
+		}()
+		files, err := writeBackupArchive(tarReader, archiveWriter, encryptionKey)
+		_ = tarReader.CloseWithError(err)
+		manifest.Files = files
+		_ = archiveWriter.CloseWithError(err)
+		archiveErr <- err
+	}()
+	archive := &countingReader{reader: archiveReader}
+	storeErr := storage.writeFile(ctx, BackupArchiveName, archive)
+	// Stops the archiving if the storage failed before reading the whole archive
+	_ = archiveReader.CloseWithError(storeErr)
+	if err := <-archiveErr; err != nil {
+		return 0, err
+	}
+	if storeErr != nil {
+		return 0, storeErr
+	}
+	return archive.count, writeBackupManifest(ctx, storage, manifest)
+}
+
+// writeBackupManifest writes the manifest of the Backup to the storage
+func writeBackupManifest(ctx context.Context, storage backupStorage, manifest *BackupManifest) error {
+	manifestContent, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return storage.writeFile(ctx, BackupManifestName, bytes.NewReader(manifestContent))
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.count += int64(n)
+	return n, err
+}
+
+// readBackupManifest reads the manifest of the Backup from the storage
+func readBackupManifest(ctx context.Context, storage backupStorage) (*BackupManifest, error) {
+	manifestContent := &bytes.Buffer{}
+	err := storage.readFile(ctx, BackupManifestName, manifestContent)
+	if err != nil {
+		return nil, err
+	}
+	manifest := &BackupManifest{}
+	if err = json.Unmarshal(manifestContent.Bytes(), manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// downloadBackupArchive reads the archive of the Backup from the storage to a temporary file and verifies it against
+// the manifest. It returns the file, which must be closed and removed, and the size of the archive.
+func downloadBackupArchive(ctx context.Context, storage backupStorage, manifest *BackupManifest, encryptionKey []byte, resourceName string) (*os.File, int64, error) {
+	archive, err := ioutil.TempFile("", resourceName)
+	if err != nil {
+		return nil, 0, err
+	}
+	archiveSize, err := func() (int64, error) {
+		if err := storage.readFile(ctx, BackupArchiveName, archive); err != nil {
+			return 0, err
+		}
+		archiveSize, err := archive.Seek(0, io.SeekEnd)
+		if err != nil {
+			return 0, err
+		}
+		if _, err = archive.Seek(0, io.SeekStart); err != nil {
+			return 0, err
+		}
+		if err = verifyStoredBackupArchive(archive, manifest, encryptionKey); err != nil {
+			return 0, err
+		}
+		_, err = archive.Seek(0, io.SeekStart)
+		return archiveSize, err
+	}()
+	if err != nil {
+		_ = archive.Close()
+		_ = os.Remove(archive.Name())
+		return nil, 0, err
+	}
+	return archive, archiveSize, nil
+}
+
+// verifyStoredBackupArchive checks the archive, as stored, against the manifest. The whole archive is read.
+func verifyStoredBackupArchive(archive io.Reader, manifest *BackupManifest, encryptionKey []byte) error {
+	compressedArchive, err := openBackupArchive(archive, manifest, encryptionKey)
+	if err != nil {
+		return err
+	}
+	if err = verifyBackupArchive(compressedArchive, manifest); err != nil {
+		return err
+	}
+	_, err = io.Copy(ioutil.Discard, archive)
+	return err
+}
+
+// openBackupArchive returns the compressed archive, decrypted with the encryption key if the manifest says it is encrypted
+func openBackupArchive(archive io.Reader, manifest *BackupManifest, encryptionKey []byte) (io.Reader, error) {
+	if len(manifest.Encryption) == 0 {
+		return archive, nil
+	}
+	if manifest.Encryption != encryption.Algorithm {
+		return nil, fmt.Errorf("archive is encrypted with unsupported %s", manifest.Encryption)
+	}
+	if encryptionKey == nil {
+		return nil, fmt.Errorf("archive is encrypted, the encryption of the BackupStrategy must be set to restore it")
+	}
+	return encryption.NewReader(archive, encryptionKey)
+}
+
+// verifyBackupArchive checks that the compressed archive contains all the files of the manifest with the same checksums
+func verifyBackupArchive(archive io.Reader, manifest *BackupManifest) error {
+	gzipReader, err := gzip.NewReader(archive)
+	if err != nil {
+		return err
+	}
+	checksums, err := getArchiveChecksums(gzipReader)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(manifest.Files))
+	for name := range manifest.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		checksum, found := checksums[name]
+		if !found {
+			return fmt.Errorf("archive is incomplete, file '%s' is missing", name)
+		}
+		if checksum != manifest.Files[name] {
+			return fmt.Errorf("archive is corrupted, checksum of file '%s' is %s instead of %s", name, checksum, manifest.Files[name])
+		}
+	}
+	return nil
+}
+
+// getArchiveChecksums reads the whole tar stream and returns the SHA-256 checksums of its regular files
+func getArchiveChecksums(in io.Reader) (map[string]string, error) {
+	checksums := map[string]string{}
+	tarReader := tar.NewReader(in)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		hash := sha256.New()
+		if _, err = io.Copy(hash, tarReader); err != nil {
+			return nil, err
+		}
+		checksums[strings.TrimPrefix(header.Name, "./")] = hex.EncodeToString(hash.Sum(nil))
+	}
+	// Consume the end of archive padding, so that the whole stream is written when reading through a tee
+	_, err := io.Copy(ioutil.Discard, in)
+	return checksums, err
+}
+
+// parsePluginManifests returns the plugins described by the concatenated META-INF/MANIFEST.MF files of the plugins
+func parsePluginManifests(manifests io.Reader) []v1alpha2.Plugin {
+	plugins := []v1alpha2.Plugin{}
+	plugin := v1alpha2.Plugin{}
+	scanner := bufio.NewScanner(manifests)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "Short-Name:") {
+			plugin.Name = strings.TrimSpace(strings.TrimPrefix(line, "Short-Name:"))
+		} else if strings.HasPrefix(line, "Plugin-Version:") {
+			plugin.Version = strings.TrimSpace(strings.TrimPrefix(line, "Plugin-Version:"))
+		}
+		if len(plugin.Name) > 0 && len(plugin.Version) > 0 {
+			plugins = append(plugins, plugin)
+			plugin = v1alpha2.Plugin{}
+		}
+	}
+	sort.Slice(plugins, func(i, j int) bool {
+		return plugins[i].Name < plugins[j].Name
+	})
+	return plugins
+}
+
+// getBackupSubLocations returns the locations in the Jenkins Home selected by the BackupOptions
+func getBackupSubLocations(options v1alpha2.BackupOptions) []string {
+	subLocations := []string{}
+	if options.Config {
+		subLocations = append(subLocations, "*.xml")
+	}
+	if options.Jobs {
+		subLocations = append(subLocations, "jobs")
+	}
+	if options.Plugins {
+		subLocations = append(subLocations, "plugins")
+	}
+	return subLocations
+}
+
+// backupPresets are the paths of the Jenkins Home included and excluded by each BackupPreset
+var backupPresets = map[v1alpha2.BackupPreset]struct {
+	includes []string
+	excludes []string
+}{
+	v1alpha2.BackupPresetConfigOnly: {
+		includes: []string{"*.xml", "*.key", "*.key.enc", "secrets", "users", "nodes", "jobs/**/config.xml"},
+	},
+	v1alpha2.BackupPresetFullWithoutBuilds: {
+		includes: []string{"*.xml", "*.key", "*.key.enc", "secrets", "users", "nodes", "jobs", "plugins", "userContent"},
+		excludes: []string{"jobs/**/builds", "jobs/**/workspace"},
+	},
+	v1alpha2.BackupPresetFull: {
+		includes: []string{"*.xml", "*.key", "*.key.enc", "secrets", "users", "nodes", "jobs", "plugins", "userContent"},
+	},
+}
+
+// backupSelection is the set of paths of the Jenkins Home selected by a BackupStrategy
+type backupSelection struct {
+	includes []string
+	excludes []string
+}
+
+// newBackupSelection merges the Options, the Preset, the Includes and the Excludes of the BackupStrategy
+func newBackupSelection(spec v1alpha2.BackupStrategySpec) (*backupSelection, error) {
+	selection := &backupSelection{includes: getBackupSubLocations(spec.Options)}
+	if len(spec.Preset) > 0 {
+		preset, found := backupPresets[spec.Preset]
+		if !found {
+			return nil, fmt.Errorf("unknown backup preset '%s'", spec.Preset)
+		}
+		selection.includes = append(selection.includes, preset.includes...)
+		selection.excludes = append(selection.excludes, preset.excludes...)
+	}
+	selection.includes = append(selection.includes, spec.Includes...)
+	selection.excludes = append(selection.excludes, spec.Excludes...)
+	for _, pattern := range append(append([]string{}, selection.includes...), selection.excludes...) {
+		if err := validatePathPattern(pattern); err != nil {
+			return nil, err
+		}
+	}
+	if len(selection.includes) == 0 {
+		return nil, fmt.Errorf("nothing to back up, no backup option, preset or include is set in the BackupStrategy")
+	}
+	return selection, nil
+}
+
+// roots returns the distinct top level locations of the includes, which are traversed to find the selected paths
+func (s *backupSelection) roots() []string {
+	roots := []string{}
+	found := map[string]bool{}
+	for _, include := range s.includes {
+		root := strings.SplitN(path.Clean(include), "/", 2)[0]
+		if root == "**" {
+			root = "*"
+		}
+		if !found[root] {
+			found[root] = true
+			roots = append(roots, root)
+		}
+	}
+	return roots
+}
+
+// isSelected returns true if the path of the archive entry, or one of its parent directories, matches an include
+// and none matches an exclude
+func (s *backupSelection) isSelected(name string) bool {
+	if s.isExcluded(name) {
+		return false
+	}
+	name = strings.TrimSuffix(strings.TrimPrefix(name, "./"), "/")
+	for _, include := range s.includes {
+		if matchPathPattern(include, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// isExcluded returns true if the path of the archive entry, or one of its parent directories, matches an exclude
+func (s *backupSelection) isExcluded(name string) bool {
+	name = strings.TrimSuffix(strings.TrimPrefix(name, "./"), "/")
+	for _, exclude := range s.excludes {
+		if matchPathPattern(exclude, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPathPattern returns true if the pattern matches the path or one of its parent directories.
+// Each segment of the pattern is matched with path.Match, "**" matches any number of segments.
+func matchPathPattern(pattern, name string) bool {
+	return matchPathSegments(strings.Split(path.Clean(pattern), "/"), strings.Split(name, "/"))
+}
+
+func matchPathSegments(pattern, name []string) bool {
+	if len(pattern) == 0 {
+		// The remaining segments are the content of a matched directory
+		return true
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(name); i++ {
+			if matchPathSegments(pattern[1:], name[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(name) == 0 {
+		return false
+	}
+	matched, err := path.Match(pattern[0], name[0])
+	return err == nil && matched && matchPathSegments(pattern[1:], name[1:])
+}
+
+// validatePathPattern checks that the pattern is relative to the Jenkins Home and can be safely passed to the shell
+func validatePathPattern(pattern string) error {
+	if len(pattern) == 0 || path.IsAbs(pattern) || strings.HasPrefix(path.Clean(pattern), "..") {
+		return fmt.Errorf("invalid pattern '%s', it must be a path relative to the Jenkins Home", pattern)
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("invalid pattern '%s': %s", pattern, err)
+	}
+	if !safePathPattern.MatchString(pattern) {
+		return fmt.Errorf("invalid pattern '%s', only letters, digits, spaces and the . _ - @ + * ? [ ] / characters are allowed", pattern)
+	}
+	return nil
+}
+
+// findPathRegex returns the posix-extended regular expression with which find matches the paths matched by the
+// pattern itself, as matchPathPattern does: "**" matches any number of segments, "*", "?" and the bracket expressions
+// match within a segment only.
+func findPathRegex(pattern string) string {
+	regex := &strings.Builder{}
+	segments := strings.Split(path.Clean(pattern), "/")
+	for i, segment := range segments {
+		last := i == len(segments)-1
+		if segment == "**" {
+			if last {
+				// The trailing "**" matches the directory itself and everything below
+				return strings.TrimSuffix(regex.String(), "/") + "(/.*)?"
+			}
+			regex.WriteString("([^/]+/)*")
+			continue
+		}
+		inBrackets := false
+		for _, r := range segment {
+			switch {
+			case inBrackets:
+				regex.WriteRune(r)
+				inBrackets = r != ']'
+			case r == '[':
+				regex.WriteRune(r)
+				inBrackets = true
+			case r == '*':
+				regex.WriteString("[^/]*")
+			case r == '?':
+				regex.WriteString("[^/]")
+			case r == '.' || r == '+':
+				regex.WriteRune('\\')
+				regex.WriteRune(r)
+			default:
+				regex.WriteRune(r)
+			}
+		}
+		if !last {
+			regex.WriteByte('/')
+		}
+	}
+	return regex.String()
+}
+
+// traversedRoots returns the roots of the selection which are not matched by another root, so that find doesn't list
+// the same paths twice, such as with "*" and "jobs"
+func (s *backupSelection) traversedRoots() []string {
+	roots := s.roots()
+	traversed := []string{}
+	for _, root := range roots {
+		covered := false
+		for _, other := range roots {
+			if matched, _ := path.Match(other, root); matched && other != root {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			traversed = append(traversed, root)
+		}
+	}
+	return traversed
+}
+
+// getBackupArchiveScript returns the script archiving the paths of the selection from the Jenkins Home to the standard
+// output. find lists the selected paths, pruning the excluded directories, and tar only archives the listed paths, so
+// the unselected files are never read. The missing roots are skipped so that a preset can list optional locations.
+func getBackupArchiveScript(jenkinsHome string, selection *backupSelection) string {
+	roots := []string{}
+	for _, root := range selection.traversedRoots() {
+		roots = append(roots, shellQuote(root, true))
+	}
+	findArguments := []string{"find", `"$@"`, "-regextype", "posix-extended"}
+	if len(selection.excludes) > 0 {
+		excludes := []string{}
+		for _, exclude := range selection.excludes {
+			excludes = append(excludes, "-regex "+shellQuote(findPathRegex(exclude), false))
+		}
+		findArguments = append(findArguments, `\(`, strings.Join(excludes, " -o "), `\)`, "-prune", "-o")
+	}
+	includes := []string{}
+	for _, include := range selection.includes {
+		includes = append(includes, "-regex "+shellQuote(findPathRegex(include)+"(/.*)?", false))
+	}
+	findArguments = append(findArguments, `\(`, strings.Join(includes, " -o "), `\)`, "-print0")
+	return strings.Join([]string{
+		// A failure of find fails the script where the shell supports pipefail, like bash in the UBI images
+		"if (set -o pipefail) 2>/dev/null; then set -o pipefail; fi",
+		"cd " + shellQuote(jenkinsHome, false),
+		"set --",
+		`for f in ` + strings.Join(roots, " ") + `; do if [ -e "$f" ]; then set -- "$@" "$f"; fi; done`,
+		`{ [ $# -eq 0 ] || ` + strings.Join(findArguments, " ") + `; } | tar cf - --null --no-recursion -T -`,
+	}, " && ")
+}
+
+// streamJenkinsHomeArchive writes the tar stream of the paths of the selection, archived in the Jenkins Pod, to out.
+// Only the selected entries are written, the directories leading to them are traversed.
+func streamJenkinsHomeArchive(ctx context.Context, execClient exec.KubeExecClient, jenkinsPod *corev1.Pod, resourceName string, selection *backupSelection, out io.Writer) error {
+	tarReader, tarWriter := io.Pipe()
+	execErr := make(chan error, 1)
+	go func() {
+		err := execClient.StreamRequest(ctx, jenkinsPod, resourceName, getBackupArchiveScript(defaultJenkinsHome, selection), nil, tarWriter)
+		_ = tarWriter.CloseWithError(err)
+		execErr <- err
+	}()
+	err := filterArchive(tarReader, out, selection.isSelected)
+	_ = tarReader.CloseWithError(err)
+	if streamErr := <-execErr; err == nil {
+		err = streamErr
+	}
+	return err
+}
+
+// shellQuote single quotes the value for sh, the glob characters are left unquoted when glob is true
+// so that the shell expands them. The value must not contain single quotes, see validatePathPattern.
+func shellQuote(value string, glob bool) string {
+	quoted := &strings.Builder{}
+	inQuotes := false
+	for _, r := range value {
+		unquoted := glob && strings.ContainsRune("*?[]", r)
+		if unquoted == inQuotes {
+			quoted.WriteByte('\'')
+			inQuotes = !inQuotes
+		}
+		quoted.WriteRune(r)
+	}
+	if inQuotes {
+		quoted.WriteByte('\'')
+	}
+	return quoted.String()
+}
+
+// filterArchive copies the entries of the tar archive for which selected returns true
+func filterArchive(in io.Reader, out io.Writer, selected func(name string) bool) error {
+	return renameArchive(in, out, func(name string) (string, bool) {
+		return name, selected(name)
+	})
+}
+
+// renameArchive copies the entries of the tar archive for which rename returns true, under the name it returns.
+// The targets of the hard links are renamed too, the hard links to entries which are not copied are skipped.
+func renameArchive(in io.Reader, out io.Writer, rename func(name string) (string, bool)) error {
+	tarReader := tar.NewReader(in)
+	tarWriter := tar.NewWriter(out)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		name, selected := rename(header.Name)
+		if !selected {
+			continue
+		}
+		header.Name = name
+		if header.Typeflag == tar.TypeLink {
+			if header.Linkname, selected = rename(header.Linkname); !selected {
+				continue
+			}
+		}
+		if err = tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err = io.Copy(tarWriter, tarReader); err != nil {
+			return err
+		}
+	}
+	return tarWriter.Close()
+}
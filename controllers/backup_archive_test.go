@@ -0,0 +1,345 @@
+package controllers
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/jenkinsci/jenkins-automation-operator/api/v1alpha2"
+	"github.com/jenkinsci/jenkins-automation-operator/pkg/encryption"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const (
+	configChecksum = "b79606fb3afea5bd1609ed40b622142f1c98125abcfe89a76a661b0e8e343910"
+	jobChecksum    = "5e8c9902207afaeb7120430c585a445f21e92932081d64bc99f80e4925bcb002"
+)
+
+func newTestArchive(files map[string]string) *bytes.Buffer {
+	archive := &bytes.Buffer{}
+	tarWriter := tar.NewWriter(archive)
+	Expect(tarWriter.WriteHeader(&tar.Header{Name: "jobs/", Typeflag: tar.TypeDir, Mode: 0755})).To(Succeed())
+	for name, content := range files {
+		Expect(tarWriter.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))})).To(Succeed())
+		_, err := tarWriter.Write([]byte(content))
+		Expect(err).NotTo(HaveOccurred())
+	}
+	Expect(tarWriter.Close()).To(Succeed())
+	return archive
+}
+
+var _ = Describe("Backup archive verification", func() {
+	var (
+		compressed *bytes.Buffer
+		checksums  map[string]string
+	)
+
+	BeforeEach(func() {
+		compressed = &bytes.Buffer{}
+		var err error
+		checksums, err = writeBackupArchive(newTestArchive(map[string]string{
+			"config.xml":            "config",
+			"jobs/job-1/config.xml": "job",
+		}), compressed, nil)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("Should Compute The Checksum Of Each File", func() {
+		Expect(checksums).To(Equal(map[string]string{"config.xml": configChecksum, "jobs/job-1/config.xml": jobChecksum}))
+	})
+
+	It("Should Accept A Valid Archive", func() {
+		manifest := &BackupManifest{Files: checksums}
+
+		err := verifyBackupArchive(bytes.NewReader(compressed.Bytes()), manifest)
+
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("Should Detect A Corrupted File", func() {
+		manifest := &BackupManifest{Files: map[string]string{"config.xml": jobChecksum}}
+
+		err := verifyBackupArchive(bytes.NewReader(compressed.Bytes()), manifest)
+
+		Expect(err).To(MatchError("archive is corrupted, checksum of file 'config.xml' is " + configChecksum + " instead of " + jobChecksum))
+	})
+
+	It("Should Detect A Missing File", func() {
+		manifest := &BackupManifest{Files: map[string]string{"jobs/job-2/config.xml": jobChecksum}}
+
+		err := verifyBackupArchive(bytes.NewReader(compressed.Bytes()), manifest)
+
+		Expect(err).To(MatchError("archive is incomplete, file 'jobs/job-2/config.xml' is missing"))
+	})
+
+	It("Should Detect A Truncated Archive", func() {
+		manifest := &BackupManifest{Files: checksums}
+
+		err := verifyBackupArchive(bytes.NewReader(compressed.Bytes()[:compressed.Len()/2]), manifest)
+
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("Backup archive streaming", func() {
+	ctx := context.Background()
+	var directory string
+
+	BeforeEach(func() {
+		var err error
+		directory, err = ioutil.TempDir("", "stream")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(directory)).To(Succeed())
+	})
+
+	It("Should Store The Archive And The Manifest", func() {
+		storage := &localBackupStorage{directory: filepath.Join(directory, "backup")}
+		manifest := &BackupManifest{Backup: "backup"}
+
+		size, err := streamBackupArchive(ctx, storage, manifest, nil, func(out io.Writer) error {
+			_, err := io.Copy(out, newTestArchive(map[string]string{"config.xml": "config"}))
+			return err
+		})
+
+		Expect(err).NotTo(HaveOccurred())
+		info, err := os.Stat(filepath.Join(storage.directory, BackupArchiveName))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(size).To(Equal(info.Size()))
+		stored, err := readBackupManifest(ctx, storage)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stored.Files).To(Equal(map[string]string{"config.xml": configChecksum}))
+	})
+
+	It("Should Not Store The Manifest When The Archiving Fails", func() {
+		storage := &localBackupStorage{directory: filepath.Join(directory, "failed-backup")}
+
+		_, err := streamBackupArchive(ctx, storage, &BackupManifest{Backup: "failed-backup"}, nil, func(out io.Writer) error {
+			_, _ = out.Write(newTestArchive(map[string]string{"config.xml": "config"}).Bytes()[:100])
+			return errors.New("tar failed")
+		})
+
+		Expect(err).To(MatchError("tar failed"))
+		_, err = os.Stat(filepath.Join(storage.directory, BackupManifestName))
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+})
+
+var _ = Describe("Encrypted Backup archive", func() {
+	encryptionKey := []byte("0123456789abcdef0123456789abcdef")
+	var (
+		encrypted *bytes.Buffer
+		checksums map[string]string
+		manifest  *BackupManifest
+	)
+
+	BeforeEach(func() {
+		encrypted = &bytes.Buffer{}
+		var err error
+		checksums, err = writeBackupArchive(newTestArchive(map[string]string{
+			"credentials.xml":    "config",
+			"secrets/master.key": "job",
+		}), encrypted, encryptionKey)
+		Expect(err).NotTo(HaveOccurred())
+		manifest = &BackupManifest{Files: checksums, Encryption: encryption.Algorithm}
+	})
+
+	It("Should Not Be Readable As Gzip", func() {
+		_, err := gzip.NewReader(bytes.NewReader(encrypted.Bytes()))
+
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should Be Valid Once Decrypted", func() {
+		archive, err := openBackupArchive(bytes.NewReader(encrypted.Bytes()), manifest, encryptionKey)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = verifyBackupArchive(archive, manifest)
+
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("Should Require The Encryption Key", func() {
+		_, err := openBackupArchive(bytes.NewReader(encrypted.Bytes()), manifest, nil)
+
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should Not Be Valid With The Wrong Encryption Key", func() {
+		archive, err := openBackupArchive(bytes.NewReader(encrypted.Bytes()), manifest, []byte("abcdef0123456789abcdef0123456789"))
+		Expect(err).NotTo(HaveOccurred())
+
+		err = verifyBackupArchive(archive, manifest)
+
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should Be Opened As Is When The Manifest Has No Encryption", func() {
+		archive := bytes.NewReader(encrypted.Bytes())
+
+		opened, err := openBackupArchive(archive, &BackupManifest{Files: checksums}, encryptionKey)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(opened).To(Equal(archive))
+	})
+})
+
+var _ = Describe("Plugin manifests", func() {
+	It("Should Be Parsed Into Plugins Sorted By Name", func() {
+		manifests := `Manifest-Version: 1.0
+Short-Name: workflow-aggregator
+Long-Name: Pipeline
+Plugin-Version: 2.6
+
+Manifest-Version: 1.0
+Plugin-Version: 4.4.5
+Short-Name: git
+`
+
+		plugins := parsePluginManifests(strings.NewReader(manifests))
+
+		Expect(plugins).To(Equal([]v1alpha2.Plugin{
+			{Name: "git", Version: "4.4.5"},
+			{Name: "workflow-aggregator", Version: "2.6"},
+		}))
+	})
+})
+
+var _ = Describe("Backup selection", func() {
+	It("Should Select The Backup Options", func() {
+		selection, err := newBackupSelection(v1alpha2.BackupStrategySpec{Options: v1alpha2.BackupOptions{Jobs: true, Config: true}})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(selection.roots()).To(Equal([]string{"*.xml", "jobs"}))
+		Expect(selection.isSelected("config.xml")).To(BeTrue())
+		Expect(selection.isSelected("./credentials.xml")).To(BeTrue())
+		Expect(selection.isSelected("jobs/")).To(BeTrue())
+		Expect(selection.isSelected("jobs/job-1/config.xml")).To(BeTrue())
+		Expect(selection.isSelected("plugins/git.jpi")).To(BeFalse())
+		Expect(selection.isSelected("users/admin/config.xml")).To(BeFalse())
+		Expect(selection.isSelected("secret.key")).To(BeFalse())
+	})
+
+	It("Should Select The Config-only Preset", func() {
+		selection, err := newBackupSelection(v1alpha2.BackupStrategySpec{Preset: v1alpha2.BackupPresetConfigOnly})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(selection.isSelected("config.xml")).To(BeTrue())
+		Expect(selection.isSelected("secret.key")).To(BeTrue())
+		Expect(selection.isSelected("secrets/master.key")).To(BeTrue())
+		Expect(selection.isSelected("users/admin/config.xml")).To(BeTrue())
+		Expect(selection.isSelected("jobs/job-1/config.xml")).To(BeTrue())
+		Expect(selection.isSelected("jobs/folder/jobs/job-1/config.xml")).To(BeTrue())
+		Expect(selection.isSelected("jobs/job-1/builds/1/log")).To(BeFalse())
+		Expect(selection.isSelected("jobs/job-1/nextBuildNumber")).To(BeFalse())
+		Expect(selection.isSelected("plugins/git.jpi")).To(BeFalse())
+	})
+
+	It("Should Select The Full-without-builds Preset With Includes And Excludes", func() {
+		selection, err := newBackupSelection(v1alpha2.BackupStrategySpec{
+			Preset:   v1alpha2.BackupPresetFullWithoutBuilds,
+			Includes: []string{"fingerprints"},
+			Excludes: []string{"plugins/*.bak"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(selection.isSelected("jobs/job-1/config.xml")).To(BeTrue())
+		Expect(selection.isSelected("jobs/job-1/nextBuildNumber")).To(BeTrue())
+		Expect(selection.isSelected("plugins/git.jpi")).To(BeTrue())
+		Expect(selection.isSelected("fingerprints/0a/1b.xml")).To(BeTrue())
+		Expect(selection.isSelected("jobs/job-1/builds")).To(BeFalse())
+		Expect(selection.isSelected("jobs/folder/jobs/job-1/builds/1/build.xml")).To(BeFalse())
+		Expect(selection.isSelected("jobs/job-1/workspace/README.md")).To(BeFalse())
+		Expect(selection.isSelected("plugins/git.bak")).To(BeFalse())
+		Expect(selection.excludes).To(Equal([]string{"jobs/**/builds", "jobs/**/workspace", "plugins/*.bak"}))
+	})
+
+	It("Should Fail When Nothing Is Selected", func() {
+		_, err := newBackupSelection(v1alpha2.BackupStrategySpec{})
+
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should Reject Invalid Patterns", func() {
+		for _, pattern := range []string{"/etc/passwd", "../secrets", "jobs/[", "$(reboot)", "it's"} {
+			_, err := newBackupSelection(v1alpha2.BackupStrategySpec{Includes: []string{pattern}})
+
+			Expect(err).To(HaveOccurred(), pattern)
+		}
+	})
+})
+
+var _ = Describe("Path pattern", func() {
+	It("Should Match Paths And Their Descendants", func() {
+		Expect(matchPathPattern("jobs", "jobs")).To(BeTrue())
+		Expect(matchPathPattern("jobs", "jobs/job-1/config.xml")).To(BeTrue())
+		Expect(matchPathPattern("jobs/*/config.xml", "jobs/job-1/config.xml")).To(BeTrue())
+		Expect(matchPathPattern("jobs/**/config.xml", "jobs/config.xml")).To(BeTrue())
+		Expect(matchPathPattern("jobs/**/config.xml", "jobs/a/jobs/b/config.xml")).To(BeTrue())
+		Expect(matchPathPattern("**/builds", "jobs/a/builds/1/log")).To(BeTrue())
+		Expect(matchPathPattern("jobs", "jobsConfig.xml")).To(BeFalse())
+		Expect(matchPathPattern("jobs/*/config.xml", "jobs/a/jobs/b/config.xml")).To(BeFalse())
+		Expect(matchPathPattern("*.xml", "users/admin/config.xml")).To(BeFalse())
+	})
+})
+
+var _ = Describe("Backup archive script", func() {
+	It("Should Archive The Selected Paths", func() {
+		selection := &backupSelection{includes: []string{"*.xml", "my jobs/**/config.xml"}, excludes: []string{"my jobs/**/builds"}}
+
+		script := getBackupArchiveScript("/var/lib/jenkins", selection)
+
+		Expect(script).To(Equal(`if (set -o pipefail) 2>/dev/null; then set -o pipefail; fi && cd '/var/lib/jenkins' && set -- && ` +
+			`for f in *'.xml' 'my jobs'; do if [ -e "$f" ]; then set -- "$@" "$f"; fi; done && ` +
+			`{ [ $# -eq 0 ] || find "$@" -regextype posix-extended \( -regex 'my jobs/([^/]+/)*builds' \) -prune -o ` +
+			`\( -regex '[^/]*\.xml(/.*)?' -o -regex 'my jobs/([^/]+/)*config\.xml(/.*)?' \) -print0; } | ` +
+			`tar cf - --null --no-recursion -T -`))
+	})
+})
+
+var _ = Describe("Find path regex", func() {
+	It("Should Match Like The Path Pattern", func() {
+		patterns := []string{"jobs", "*.xml", "jobs/*/config.xml", "jobs/**/config.xml", "**/builds", "jobs/**", "plugins/[a-g]?t.jpi", "secrets/*.key.enc"}
+		names := []string{
+			"jobs", "jobs/job-1", "jobs/job-1/config.xml", "jobs/config.xml", "jobs/a/jobs/b/config.xml", "jobsConfig.xml",
+			"config.xml", "users/admin/config.xml", "jobs/a/builds/1/log", "builds", "plugins/git.jpi", "plugins/gitt.jpi",
+			"secrets/master.key.enc", "secrets/master.keyxenc",
+		}
+		for _, pattern := range patterns {
+			regex := regexp.MustCompile("^(" + findPathRegex(pattern) + ")(/.*)?$")
+			for _, name := range names {
+				Expect(regex.MatchString(name)).To(Equal(matchPathPattern(pattern, name)), "pattern %s, path %s", pattern, name)
+			}
+		}
+	})
+})
+
+var _ = Describe("Archive filter", func() {
+	It("Should Only Keep The Selected Files", func() {
+		archive := newTestArchive(map[string]string{"config.xml": "config", "plugins/git.jpi": "plugin"})
+
+		filtered := &bytes.Buffer{}
+		err := filterArchive(archive, filtered, func(name string) bool {
+			return name == "config.xml"
+		})
+
+		Expect(err).NotTo(HaveOccurred())
+		tarReader := tar.NewReader(filtered)
+		header, err := tarReader.Next()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(header.Name).To(Equal("config.xml"))
+		_, err = tarReader.Next()
+		Expect(err).To(Equal(io.EOF))
+	})
+})
@@ -0,0 +1,394 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jenkinsci/jenkins-automation-operator/api/v1alpha2"
+	"github.com/jenkinsci/jenkins-automation-operator/pkg/configuration/base/resources"
+	"github.com/jenkinsci/jenkins-automation-operator/pkg/exec"
+	"github.com/operator-framework/operator-lib/status"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// backupVolumeScanInterval is the interval at which a BackupVolume is scanned for the Backups stored on it
+	backupVolumeScanInterval = time.Hour
+	// backupVolumeScanRetryInterval is the interval at which a BackupVolume which could not be scanned is scanned again
+	backupVolumeScanRetryInterval = 5 * time.Minute
+	// backupVolumeScanPodCheckInterval is the interval at which the Pod scanning a BackupVolume is checked until it runs
+	backupVolumeScanPodCheckInterval = 10 * time.Second
+	// backupVolumeScanPodLifetime is how long the Pod scanning a BackupVolume runs, or may stay pending
+	backupVolumeScanPodLifetime = 10 * time.Minute
+	// AdoptedBackupAnnotation marks the Backups created for the Backups found on a BackupVolume, it holds its name
+	AdoptedBackupAnnotation = "jenkins.io/adopted-from"
+)
+
+var (
+	// BackupsScanned is set once the BackupVolume was scanned for the Backups stored on it
+	BackupsScanned status.ConditionType = "BackupsScanned"
+	// BackupScanFailed is the reason of the BackupsScanned condition when the BackupVolume could not be scanned
+	BackupScanFailed status.ConditionReason = "BackupScanFailed"
+	// BackupScanPending is the reason of the BackupsScanned condition while the Pod scanning the BackupVolume starts
+	BackupScanPending status.ConditionReason = "BackupScanPending"
+	// BackupAdopted is the reason of the BackupCompleted condition of a Backup created for a Backup found on a BackupVolume
+	BackupAdopted status.ConditionReason = "Adopted"
+)
+
+// catalogBackups scans the BackupVolume for the manifests of the Backups stored on it every backupVolumeScanInterval,
+// publishes them in its catalog and adopts the ones without Backup when AdoptBackups is set. Between scans, only the
+// orphaned Backups of the catalog are updated. It returns when the BackupVolume has to be scanned again.
+func (r *BackupVolumeReconciler) catalogBackups(ctx context.Context, backupVolume *v1alpha2.BackupVolume) (time.Duration, error) {
+	backupList := &v1alpha2.BackupList{}
+	err := r.Client.List(ctx, backupList, client.InNamespace(backupVolume.Namespace))
+	if err != nil {
+		return 0, err
+	}
+	if backupVolume.Status.LastScanTime != nil {
+		nextScan := time.Until(backupVolume.Status.LastScanTime.Add(backupVolumeScanInterval))
+		if nextScan > 0 {
+			if setBackupCatalogOrphans(backupVolume.Status.Catalog, backupList.Items, backupVolume.Name) {
+				return nextScan, r.Client.Status().Update(ctx, backupVolume)
+			}
+			return nextScan, nil
+		}
+	}
+
+	jenkins, err := getBackupVolumeJenkins(ctx, r.Client, backupVolume)
+	var manifests []*BackupManifest
+	scanned := false
+	if err == nil {
+		manifests, scanned, err = r.scanBackupVolume(ctx, backupVolume, jenkins)
+	}
+	if err == nil && !scanned {
+		backupVolume.Status.Conditions.SetCondition(status.Condition{
+			Type:    BackupsScanned,
+			Status:  corev1.ConditionFalse,
+			Reason:  BackupScanPending,
+			Message: fmt.Sprintf("Pod '%s' is starting to scan BackupVolume '%s'", getBackupVolumeScanPodName(backupVolume), backupVolume.Name),
+		})
+		return backupVolumeScanPodCheckInterval, r.Client.Status().Update(ctx, backupVolume)
+	}
+	if err != nil {
+		r.Log.Info(fmt.Sprintf("Failed to scan BackupVolume '%s' for Backups: %s", backupVolume.Name, err))
+		backupVolume.Status.Conditions.SetCondition(status.Condition{
+			Type:    BackupsScanned,
+			Status:  corev1.ConditionFalse,
+			Reason:  BackupScanFailed,
+			Message: err.Error(),
+		})
+		return backupVolumeScanRetryInterval, r.Client.Status().Update(ctx, backupVolume)
+	}
+	if backupVolume.Spec.AdoptBackups {
+		jenkinsName := ""
+		if jenkins != nil {
+			jenkinsName = jenkins.Name
+		}
+		err = adoptBackups(ctx, r.Client, backupVolume, manifests, backupList.Items, jenkinsName)
+		if err != nil {
+			return 0, err
+		}
+		if err = r.Client.List(ctx, backupList, client.InNamespace(backupVolume.Namespace)); err != nil {
+			return 0, err
+		}
+	}
+	now := metav1.Now()
+	backupVolume.Status.LastScanTime = &now
+	backupVolume.Status.Catalog = newBackupCatalog(manifests)
+	setBackupCatalogOrphans(backupVolume.Status.Catalog, backupList.Items, backupVolume.Name)
+	backupVolume.Status.Conditions.SetCondition(status.Condition{
+		Type:    BackupsScanned,
+		Status:  corev1.ConditionTrue,
+		Message: fmt.Sprintf("%d Backups found", len(manifests)),
+	})
+	return backupVolumeScanInterval, r.Client.Status().Update(ctx, backupVolume)
+}
+
+// scanBackupVolume returns the manifests of the Backups stored on the BackupVolume, and false while they can't be read
+// yet. They are read from the bucket of the BackupVolume, or from its PersistentVolumeClaim through the backup sidecar
+// of the Jenkins mounting it. When no backup sidecar mounts it, e.g. when the Backups of the Jenkins run in Jobs, they
+// are read through a scan Pod mounting the PersistentVolumeClaim, which is deleted once it was scanned.
+func (r *BackupVolumeReconciler) scanBackupVolume(ctx context.Context, backupVolume *v1alpha2.BackupVolume, jenkins *v1alpha2.Jenkins) ([]*BackupManifest, bool, error) {
+	if backupVolume.Spec.S3 != nil {
+		objectStorageClient, err := newObjectStorageClient(ctx, r.Client, backupVolume)
+		if err != nil {
+			return nil, false, err
+		}
+		prefixes, err := objectStorageClient.ListPrefixes(ctx, path.Join(backupVolume.Spec.S3.Prefix, backupVolume.Namespace)+"/")
+		if err != nil {
+			return nil, false, err
+		}
+		manifests := []*BackupManifest{}
+		for _, prefix := range prefixes {
+			storage := &objectStorageBackupStorage{client: objectStorageClient, bucket: backupVolume.Spec.S3.Bucket, keyPrefix: prefix}
+			manifest, err := readBackupManifest(ctx, storage)
+			if err != nil {
+				// A Backup being uploaded has no manifest yet
+				r.Log.Info(fmt.Sprintf("Skipping %s while scanning BackupVolume '%s': %s", storage.location(), backupVolume.Name, err))
+				continue
+			}
+			manifests = append(manifests, manifest)
+		}
+		return manifests, true, nil
+	}
+
+	if jenkins != nil && isBackupVolumeMounted(jenkins, backupVolume.Name) {
+		backupReconciler := &BackupReconciler{Client: r.Client}
+		jenkinsPod, err := backupReconciler.GetPodByDeployment(jenkins)
+		if err != nil {
+			return nil, false, err
+		}
+		manifests, err := listBackupManifests(ctx, jenkinsPod, backupVolume)
+		return manifests, err == nil, err
+	}
+	scanPod, err := r.getBackupVolumeScanPod(ctx, backupVolume)
+	if err != nil || scanPod == nil {
+		return nil, false, err
+	}
+	manifests, err := listBackupManifests(ctx, scanPod, backupVolume)
+	// The Pod is created again for the next scan
+	if deleteErr := r.Client.Delete(ctx, scanPod); deleteErr != nil && !apierrors.IsNotFound(deleteErr) && err == nil {
+		err = deleteErr
+	}
+	return manifests, err == nil, err
+}
+
+// listBackupManifests returns the manifests of the Backups stored on the BackupVolume read through the backup container
+// of the Pod mounting its PersistentVolumeClaim
+func listBackupManifests(ctx context.Context, pod *corev1.Pod, backupVolume *v1alpha2.BackupVolume) ([]*BackupManifest, error) {
+	execClient := exec.NewKubeExecClient()
+	if err := execClient.InitKubeGoClient(); err != nil {
+		return nil, err
+	}
+	pipeReader, pipeWriter := io.Pipe()
+	manifestsErr := make(chan error, 1)
+	var manifests []*BackupManifest
+	go func() {
+		var err error
+		manifests, err = parseBackupManifests(pipeReader)
+		_ = pipeReader.CloseWithError(err)
+		manifestsErr <- err
+	}()
+	execErr := execClient.StreamRequest(ctx, pod, backupVolume.Name, getListManifestsScript(backupVolume), nil, pipeWriter)
+	_ = pipeWriter.CloseWithError(execErr)
+	err := <-manifestsErr
+	if err == nil {
+		err = execErr
+	}
+	return manifests, err
+}
+
+// getBackupVolumeScanPod returns the scan Pod of the BackupVolume once it runs, or nil while it starts. It is created
+// when missing, and deleted when it stopped or is still pending after backupVolumeScanPodLifetime, e.g. while the
+// ReadWriteOnce volume is mounted by a Job on another node.
+func (r *BackupVolumeReconciler) getBackupVolumeScanPod(ctx context.Context, backupVolume *v1alpha2.BackupVolume) (*corev1.Pod, error) {
+	scanPod := &corev1.Pod{}
+	err := r.Client.Get(ctx, types.NamespacedName{Name: getBackupVolumeScanPodName(backupVolume), Namespace: backupVolume.Namespace}, scanPod)
+	if apierrors.IsNotFound(err) {
+		return nil, r.Client.Create(ctx, newBackupVolumeScanPod(backupVolume))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch scanPod.Status.Phase {
+	case corev1.PodRunning:
+		return scanPod, nil
+	case corev1.PodSucceeded, corev1.PodFailed:
+		err = r.Client.Delete(ctx, scanPod)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("pod '%s' stopped before BackupVolume '%s' was scanned, it is created again", scanPod.Name, backupVolume.Name)
+	default:
+		if time.Since(scanPod.CreationTimestamp.Time) > backupVolumeScanPodLifetime {
+			err = r.Client.Delete(ctx, scanPod)
+			if err != nil && !apierrors.IsNotFound(err) {
+				return nil, err
+			}
+			return nil, fmt.Errorf("pod '%s' is still pending after %s, it is created again", scanPod.Name, backupVolumeScanPodLifetime)
+		}
+	}
+	return nil, nil
+}
+
+// getBackupVolumeScanPodName returns the name of the Pod through which the BackupVolume is scanned
+func getBackupVolumeScanPodName(backupVolume *v1alpha2.BackupVolume) string {
+	return backupVolume.Name + "-scan"
+}
+
+// newBackupVolumeScanPod returns a Pod idling with the PersistentVolumeClaim of the BackupVolume mounted in a container
+// named like the backup sidecar, so that the manifests are listed by the same script. It stops by itself after
+// backupVolumeScanPodLifetime if it isn't deleted.
+func newBackupVolumeScanPod(backupVolume *v1alpha2.BackupVolume) *corev1.Pod {
+	return newBackupVolumeProbePod(backupVolume, nil, getBackupVolumeScanPodName(backupVolume), corev1.Container{
+		Name:    resources.BackupSidecarName,
+		Image:   resources.GetJenkinsBackupImage(),
+		Command: []string{"sleep", strconv.Itoa(int(backupVolumeScanPodLifetime.Seconds()))},
+	})
+}
+
+// getBackupVolumeJenkins returns the first Jenkins, by name, mounting the BackupVolume in its backup sidecar, or else
+// the first Jenkins running its Backups of the BackupVolume in Jobs, or nil
+func getBackupVolumeJenkins(ctx context.Context, c client.Client, backupVolume *v1alpha2.BackupVolume) (*v1alpha2.Jenkins, error) {
+	jenkinsList := &v1alpha2.JenkinsList{}
+	err := c.List(ctx, jenkinsList, client.InNamespace(backupVolume.Namespace))
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(jenkinsList.Items, func(i, j int) bool {
+		return jenkinsList.Items[i].Name < jenkinsList.Items[j].Name
+	})
+	var jobRunnerJenkins *v1alpha2.Jenkins
+	for i, jenkins := range jenkinsList.Items {
+		if jenkins.DeletionTimestamp != nil {
+			continue
+		}
+		if isBackupVolumeMounted(&jenkinsList.Items[i], backupVolume.Name) {
+			return &jenkinsList.Items[i], nil
+		}
+		if jobRunnerJenkins == nil && jenkins.Spec.BackupRunner == v1alpha2.BackupRunnerJob && isBackupVolumeListed(&jenkinsList.Items[i], backupVolume.Name) {
+			jobRunnerJenkins = &jenkinsList.Items[i]
+		}
+	}
+	return jobRunnerJenkins, nil
+}
+
+// getListManifestsScript returns the script printing the manifests of the Backups stored in the directory of the
+// BackupVolume in the backup sidecar
+func getListManifestsScript(backupVolume *v1alpha2.BackupVolume) string {
+	directory := resources.JenkinsBackupVolumePath + "/" + backupVolume.Name
+	return strings.Join([]string{
+		"cd " + shellQuote(directory, false) + " 2>/dev/null || exit 0",
+		`for m in */` + BackupManifestName + `; do if [ -f "$m" ]; then cat "$m"; fi; done`,
+	}, "; ")
+}
+
+// parseBackupManifests decodes the manifests written one after the other, the manifests without Backup are skipped
+func parseBackupManifests(in io.Reader) ([]*BackupManifest, error) {
+	manifests := []*BackupManifest{}
+	decoder := json.NewDecoder(in)
+	for {
+		manifest := &BackupManifest{}
+		err := decoder.Decode(manifest)
+		if err == io.EOF {
+			return manifests, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid Backup manifest: %s", err)
+		}
+		if len(manifest.Backup) > 0 {
+			manifests = append(manifests, manifest)
+		}
+	}
+}
+
+// newBackupCatalog returns the catalog of the Backups described by the manifests, the newest first
+func newBackupCatalog(manifests []*BackupManifest) []v1alpha2.BackupCatalogEntry {
+	catalog := []v1alpha2.BackupCatalogEntry{}
+	for _, manifest := range manifests {
+		catalog = append(catalog, v1alpha2.BackupCatalogEntry{
+			Name:           manifest.Backup,
+			CreationTime:   metav1.NewTime(manifest.CreationTime),
+			JenkinsVersion: manifest.JenkinsVersion,
+			FileCount:      int64(len(manifest.Files)),
+			Encrypted:      len(manifest.Encryption) > 0,
+		})
+	}
+	sort.SliceStable(catalog, func(i, j int) bool {
+		return catalog[j].CreationTime.Before(&catalog[i].CreationTime)
+	})
+	return catalog
+}
+
+// setBackupCatalogOrphans marks the entries of the catalog without Backup stored or copied on the BackupVolume as
+// orphaned, it returns true if an entry changed
+func setBackupCatalogOrphans(catalog []v1alpha2.BackupCatalogEntry, backups []v1alpha2.Backup, backupVolumeName string) bool {
+	stored := map[string]bool{}
+	for _, backup := range backups {
+		if backup.Spec.BackupVolumeRef == backupVolumeName {
+			stored[backup.Name] = true
+		}
+		for _, replicaName := range getSucceededReplicas(&backup) {
+			stored[backup.Name] = stored[backup.Name] || replicaName == backupVolumeName
+		}
+	}
+	changed := false
+	for i := range catalog {
+		orphaned := !stored[catalog[i].Name]
+		changed = changed || catalog[i].Orphaned != orphaned
+		catalog[i].Orphaned = orphaned
+	}
+	return changed
+}
+
+// adoptBackups creates a succeeded Backup for each manifest without Backup, referencing the Jenkins mounting the
+// BackupVolume. The Backups whose creation was interrupted before their status was set are completed.
+func adoptBackups(ctx context.Context, c client.Client, backupVolume *v1alpha2.BackupVolume, manifests []*BackupManifest, backups []v1alpha2.Backup, jenkinsName string) error {
+	existing := map[string]*v1alpha2.Backup{}
+	for i := range backups {
+		existing[backups[i].Name] = &backups[i]
+	}
+	for _, manifest := range manifests {
+		backup, found := existing[manifest.Backup]
+		if !found {
+			backup = &v1alpha2.Backup{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        manifest.Backup,
+					Namespace:   backupVolume.Namespace,
+					Annotations: map[string]string{AdoptedBackupAnnotation: backupVolume.Name},
+				},
+				// The data found on the BackupVolume outlives the adopted Backup unless its deletion policy is changed
+				Spec: v1alpha2.BackupSpec{JenkinsRef: jenkinsName, BackupVolumeRef: backupVolume.Name, DeletionPolicy: v1alpha2.BackupDeletionPolicyRetain},
+			}
+			err := c.Create(ctx, backup)
+			if apierrors.IsAlreadyExists(err) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if backup.Annotations[AdoptedBackupAnnotation] != backupVolume.Name || len(backup.Status.Phase) > 0 {
+			continue
+		}
+		setAdoptedBackupStatus(backup, backupVolume, manifest)
+		if err := c.Status().Update(ctx, backup); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setAdoptedBackupStatus sets the status of an adopted Backup from its manifest, it succeeded when its archive was created
+func setAdoptedBackupStatus(backup *v1alpha2.Backup, backupVolume *v1alpha2.BackupVolume, manifest *BackupManifest) {
+	creationTime := metav1.NewTime(manifest.CreationTime)
+	backup.Status.Phase = v1alpha2.BackupSucceeded
+	backup.Status.StartTime = &creationTime
+	backup.Status.CompletionTime = &creationTime
+	backup.Status.FileCount = int64(len(manifest.Files))
+	backup.Status.JenkinsVersion = manifest.JenkinsVersion
+	backup.Status.Plugins = manifest.Plugins
+	if backupVolume.Spec.S3 != nil {
+		backup.Status.Path = "s3://" + path.Join(backupVolume.Spec.S3.Bucket, getBackupObjectKeyPrefix(backupVolume, backup))
+	} else {
+		backup.Status.Path = getBackupLocation(backup)
+	}
+	backup.Status.Conditions.SetCondition(status.Condition{
+		Type:    BackupCompleted,
+		Status:  corev1.ConditionTrue,
+		Reason:  BackupAdopted,
+		Message: fmt.Sprintf("Backup found on BackupVolume '%s'", backupVolume.Name),
+	})
+}
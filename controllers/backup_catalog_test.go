@@ -0,0 +1,208 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/jenkinsci/jenkins-automation-operator/api/v1alpha2"
+	"github.com/jenkinsci/jenkins-automation-operator/pkg/log"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Backup manifests parsing", func() {
+	It("Should Parse Concatenated Manifests", func() {
+		manifests, err := parseBackupManifests(strings.NewReader(`{"backup":"backup-1","creationTime":"2020-10-15T12:00:00Z","files":{"config.xml":"` + configChecksum + `"}}
+{"backup":"","files":{}}{"backup":"backup-2","creationTime":"2020-10-16T12:00:00Z","encryption":"AES-256-GCM","files":{}}`))
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(manifests).To(HaveLen(2))
+		Expect(manifests[0].Backup).To(Equal("backup-1"))
+		Expect(manifests[1].Backup).To(Equal("backup-2"))
+
+		_, err = parseBackupManifests(strings.NewReader(`{"backup":`))
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("Backup catalog", func() {
+	It("Should List The Backups Newest First And Mark The Orphans", func() {
+		created := time.Date(2020, 10, 15, 12, 0, 0, 0, time.UTC)
+		manifests := []*BackupManifest{
+			{Backup: "older", CreationTime: created, JenkinsVersion: "2.263", Files: map[string]string{"config.xml": configChecksum}},
+			{Backup: "newer", CreationTime: created.Add(time.Hour), Encryption: "AES-256-GCM"},
+		}
+
+		catalog := newBackupCatalog(manifests)
+
+		Expect(catalog).To(HaveLen(2))
+		Expect(catalog[0]).To(Equal(v1alpha2.BackupCatalogEntry{Name: "newer", CreationTime: metav1.NewTime(created.Add(time.Hour)), Encrypted: true}))
+		Expect(catalog[1]).To(Equal(v1alpha2.BackupCatalogEntry{Name: "older", CreationTime: metav1.NewTime(created), JenkinsVersion: "2.263", FileCount: 1}))
+
+		backups := []v1alpha2.Backup{
+			{ObjectMeta: metav1.ObjectMeta{Name: "older"}, Spec: v1alpha2.BackupSpec{BackupVolumeRef: "volume"}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "newer"}, Spec: v1alpha2.BackupSpec{BackupVolumeRef: "other-volume"}},
+		}
+		Expect(setBackupCatalogOrphans(catalog, backups, "volume")).To(BeTrue())
+		Expect(catalog[0].Orphaned).To(BeTrue())
+		Expect(catalog[1].Orphaned).To(BeFalse())
+		Expect(setBackupCatalogOrphans(catalog, backups, "volume")).To(BeFalse())
+
+		backups[1].Status.Replicas = []v1alpha2.BackupReplica{{BackupVolume: "volume", Succeeded: true}}
+		Expect(setBackupCatalogOrphans(catalog, backups, "volume")).To(BeTrue())
+		Expect(catalog[0].Orphaned).To(BeFalse())
+	})
+})
+
+var _ = Describe("Backup adoption", func() {
+	BeforeEach(func() {
+		Expect(v1alpha2.AddToScheme(scheme.Scheme)).To(Succeed())
+	})
+
+	It("Should Adopt The Orphaned Backups", func() {
+		ctx := context.Background()
+		created := time.Date(2020, 10, 15, 12, 0, 0, 0, time.UTC)
+		backupVolume := &v1alpha2.BackupVolume{ObjectMeta: metav1.ObjectMeta{Name: "volume", Namespace: "jenkins"}}
+		existing := v1alpha2.Backup{
+			ObjectMeta: metav1.ObjectMeta{Name: "existing", Namespace: "jenkins"},
+			Spec:       v1alpha2.BackupSpec{JenkinsRef: "jenkins", BackupVolumeRef: "volume"},
+		}
+		manifests := []*BackupManifest{
+			{Backup: "existing", CreationTime: created},
+			{Backup: "orphaned", CreationTime: created, JenkinsVersion: "2.263", Files: map[string]string{"config.xml": configChecksum}},
+		}
+		c := fake.NewFakeClientWithScheme(scheme.Scheme, &existing)
+
+		err := adoptBackups(ctx, c, backupVolume, manifests, []v1alpha2.Backup{existing}, "jenkins")
+
+		Expect(err).NotTo(HaveOccurred())
+		adopted := &v1alpha2.Backup{}
+		Expect(c.Get(ctx, types.NamespacedName{Name: "orphaned", Namespace: "jenkins"}, adopted)).To(Succeed())
+		Expect(adopted.Annotations[AdoptedBackupAnnotation]).To(Equal("volume"))
+		Expect(adopted.Spec).To(Equal(v1alpha2.BackupSpec{JenkinsRef: "jenkins", BackupVolumeRef: "volume", DeletionPolicy: v1alpha2.BackupDeletionPolicyRetain}))
+		Expect(adopted.Status.Phase).To(Equal(v1alpha2.BackupSucceeded))
+		Expect(adopted.Status.CompletionTime.UTC()).To(Equal(created))
+		Expect(adopted.Status.FileCount).To(Equal(int64(1)))
+		Expect(adopted.Status.JenkinsVersion).To(Equal("2.263"))
+		Expect(adopted.Status.Path).To(Equal("/jenkins-backups/volume/orphaned"))
+		Expect(adopted.Status.Conditions.IsTrueFor(BackupCompleted)).To(BeTrue())
+		untouched := &v1alpha2.Backup{}
+		Expect(c.Get(ctx, types.NamespacedName{Name: "existing", Namespace: "jenkins"}, untouched)).To(Succeed())
+		Expect(untouched.Status.Phase).To(BeEmpty())
+	})
+})
+
+var _ = Describe("List manifests script", func() {
+	It("Should Print The Manifests Of The BackupVolume", func() {
+		script := getListManifestsScript(&v1alpha2.BackupVolume{ObjectMeta: metav1.ObjectMeta{Name: "volume"}})
+
+		Expect(script).To(Equal(`cd '/jenkins-backups/volume' 2>/dev/null || exit 0; for m in */manifest.json; do if [ -f "$m" ]; then cat "$m"; fi; done`))
+	})
+})
+
+var _ = Describe("BackupVolume Jenkins", func() {
+	ctx := context.Background()
+	backupVolume := &v1alpha2.BackupVolume{ObjectMeta: metav1.ObjectMeta{Name: "volume", Namespace: "jenkins"}}
+	jobRunner := &v1alpha2.Jenkins{
+		ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "jenkins"},
+		Spec:       v1alpha2.JenkinsSpec{BackupVolumes: []string{"volume"}, BackupRunner: v1alpha2.BackupRunnerJob},
+	}
+	sidecar := &v1alpha2.Jenkins{
+		ObjectMeta: metav1.ObjectMeta{Name: "b", Namespace: "jenkins"},
+		Spec:       v1alpha2.JenkinsSpec{BackupVolumes: []string{"volume"}},
+	}
+
+	BeforeEach(func() {
+		Expect(v1alpha2.AddToScheme(scheme.Scheme)).To(Succeed())
+	})
+
+	It("Should Prefer The Jenkins Mounting The BackupVolume In Its Backup Sidecar", func() {
+		jenkins, err := getBackupVolumeJenkins(ctx, fake.NewFakeClientWithScheme(scheme.Scheme, jobRunner, sidecar), backupVolume)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(jenkins.Name).To(Equal("b"))
+	})
+
+	It("Should Fall Back To A Jenkins Running Its Backups In Jobs", func() {
+		jenkins, err := getBackupVolumeJenkins(ctx, fake.NewFakeClientWithScheme(scheme.Scheme, jobRunner), backupVolume)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(jenkins.Name).To(Equal("a"))
+	})
+
+	It("Should Return Nil Without Jenkins", func() {
+		jenkins, err := getBackupVolumeJenkins(ctx, fake.NewFakeClientWithScheme(scheme.Scheme), backupVolume)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(jenkins).To(BeNil())
+	})
+})
+
+var _ = Describe("Backup catalog scan Pod", func() {
+	ctx := context.Background()
+	// The Pod of the Jenkins has no backup sidecar mounting the BackupVolume
+	jenkins := &v1alpha2.Jenkins{
+		ObjectMeta: metav1.ObjectMeta{Name: "jenkins", Namespace: "jenkins"},
+		Spec:       v1alpha2.JenkinsSpec{BackupVolumes: []string{"volume"}, BackupRunner: v1alpha2.BackupRunnerJob},
+	}
+	scanPodName := types.NamespacedName{Name: "volume-scan", Namespace: "jenkins"}
+
+	BeforeEach(func() {
+		Expect(v1alpha2.AddToScheme(scheme.Scheme)).To(Succeed())
+	})
+
+	It("Should Create The Scan Pod", func() {
+		backupVolume := &v1alpha2.BackupVolume{ObjectMeta: metav1.ObjectMeta{Name: "volume", Namespace: "jenkins"}}
+		reconciler := &BackupVolumeReconciler{Client: fake.NewFakeClientWithScheme(scheme.Scheme, backupVolume, jenkins), Log: log.Log}
+
+		nextScan, err := reconciler.catalogBackups(ctx, backupVolume)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(nextScan).To(Equal(backupVolumeScanPodCheckInterval))
+		Expect(backupVolume.Status.LastScanTime).To(BeNil())
+		condition := backupVolume.Status.Conditions.GetCondition(BackupsScanned)
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Reason).To(Equal(BackupScanPending))
+		scanPod := &corev1.Pod{}
+		Expect(reconciler.Client.Get(ctx, scanPodName, scanPod)).To(Succeed())
+		Expect(scanPod.Spec.Containers[0].Name).To(Equal("backup"))
+		Expect(scanPod.Spec.Containers[0].VolumeMounts[0].MountPath).To(Equal("/jenkins-backups/volume"))
+		Expect(scanPod.Spec.Containers[0].VolumeMounts[0].ReadOnly).To(BeTrue())
+		Expect(scanPod.Spec.Volumes[0].PersistentVolumeClaim.ClaimName).To(Equal("volume-jenkins-backup"))
+		Expect(scanPod.Spec.Affinity).To(BeNil())
+	})
+
+	It("Should Wait For A Pending Scan Pod", func() {
+		backupVolume := &v1alpha2.BackupVolume{ObjectMeta: metav1.ObjectMeta{Name: "volume", Namespace: "jenkins"}}
+		scanPod := newBackupVolumeScanPod(backupVolume)
+		scanPod.CreationTimestamp = metav1.Now()
+		scanPod.Status.Phase = corev1.PodPending
+		reconciler := &BackupVolumeReconciler{Client: fake.NewFakeClientWithScheme(scheme.Scheme, backupVolume, jenkins, scanPod), Log: log.Log}
+
+		nextScan, err := reconciler.catalogBackups(ctx, backupVolume)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(nextScan).To(Equal(backupVolumeScanPodCheckInterval))
+		Expect(reconciler.Client.Get(ctx, scanPodName, &corev1.Pod{})).To(Succeed())
+	})
+
+	It("Should Delete A Stopped Scan Pod To Create It Again", func() {
+		backupVolume := &v1alpha2.BackupVolume{ObjectMeta: metav1.ObjectMeta{Name: "volume", Namespace: "jenkins"}}
+		scanPod := newBackupVolumeScanPod(backupVolume)
+		scanPod.Status.Phase = corev1.PodFailed
+		reconciler := &BackupVolumeReconciler{Client: fake.NewFakeClientWithScheme(scheme.Scheme, backupVolume, jenkins, scanPod), Log: log.Log}
+
+		nextScan, err := reconciler.catalogBackups(ctx, backupVolume)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(nextScan).To(Equal(backupVolumeScanRetryInterval))
+		Expect(backupVolume.Status.Conditions.GetCondition(BackupsScanned).Reason).To(Equal(BackupScanFailed))
+		Expect(reconciler.Client.Get(ctx, scanPodName, &corev1.Pod{})).NotTo(Succeed())
+	})
+})
@@ -18,8 +18,10 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"strings"
+	"io"
+	"time"
 
 	"github.com/jenkinsci/jenkins-automation-operator/pkg/notifications/event"
 	"github.com/jenkinsci/jenkins-automation-operator/pkg/notifications/reason"
@@ -27,6 +29,7 @@ import (
 	"github.com/go-logr/logr"
 	v1alpha2 "github.com/jenkinsci/jenkins-automation-operator/api/v1alpha2"
 	"github.com/jenkinsci/jenkins-automation-operator/pkg/configuration/base/resources"
+	"github.com/jenkinsci/jenkins-automation-operator/pkg/encryption"
 	"github.com/jenkinsci/jenkins-automation-operator/pkg/exec"
 	"github.com/jenkinsci/jenkins-automation-operator/pkg/log"
 	"github.com/operator-framework/operator-lib/status"
@@ -34,6 +37,7 @@ import (
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
@@ -47,9 +51,14 @@ type BackupReconciler struct {
 	Log                logr.Logger
 	Scheme             *runtime.Scheme
 	NotificationEvents chan event.Event
+	// RESTMapper finds the version of the VolumeSnapshot API served by the cluster
+	RESTMapper meta.RESTMapper
+	// NewExecClient returns the client running the scripts of the backup sidecar, exec.NewKubeExecClient when nil
+	NewExecClient func() exec.KubeExecClient
 }
 
-// +kubebuilder:rbac:groups=jenkins.io,resources=backups;backups/status,verbs=*
+// +kubebuilder:rbac:groups=jenkins.io,resources=backups;backups/status;backups/finalizers,verbs=*
+// +kubebuilder:rbac:groups=snapshot.storage.k8s.io,resources=volumesnapshots,verbs=get;list;watch;create;delete
 
 var (
 	logger             = log.Log.WithName("backup")
@@ -59,18 +68,29 @@ var (
 	QuietDownStarted   status.ConditionType = "QuietDownStarted"
 	BackupCompleted    status.ConditionType = "BackupCompleted"
 	QuietDownCancelled status.ConditionType = "QuietDownCancelled"
+	// PreBackupHooksCompleted and PostBackupHooksCompleted are set when the BackupStrategy has hooks
+	PreBackupHooksCompleted  status.ConditionType = "PreBackupHooksCompleted"
+	PostBackupHooksCompleted status.ConditionType = "PostBackupHooksCompleted"
+	// ExecClientInitializationFailed and other Condition Reasons
+	ExecClientInitializationFailed status.ConditionReason = "ExecClientInitializationFailed"
+	QuietDownFailed                status.ConditionReason = "QuietDownFailed"
+	CancelQuietDownFailed          status.ConditionReason = "CancelQuietDownFailed"
+	BackupArchiveFailed            status.ConditionReason = "BackupArchiveFailed"
+	// BackupInterrupted is the reason of the BackupCompleted condition when a resumed Backup can't complete
+	BackupInterrupted status.ConditionReason = "BackupInterrupted"
 )
 
 func (r *BackupReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&v1alpha2.Backup{}).
+		Owns(&corev1.Pod{}).
 		Complete(r)
 }
 
 func (r *BackupReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	ctx := context.Background()
 	backupLogger := r.Log.WithValues("backup", req.NamespacedName)
-	execClient := exec.NewKubeExecClient()
+	execClient := newExecClient(r.NewExecClient)
 
 	// Fetch the Backup instance
 	backupInstance := &v1alpha2.Backup{}
@@ -85,10 +105,60 @@ func (r *BackupReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 		// Error reading the object - requeue the request.
 		return ctrl.Result{}, err
 	}
-	if len(backupInstance.Status.Conditions) > 0 {
-		return ctrl.Result{}, nil
+	// The data of a deleted Backup is deleted according to its deletion policy
+	if backupInstance.DeletionTimestamp != nil {
+		return r.finalizeBackup(ctx, backupLogger, backupInstance)
+	}
+	if !hasFinalizer(backupInstance, BackupDataFinalizer) {
+		// The data of the Backups which were run before the finalizer was introduced, or adopted from a BackupVolume,
+		// is kept unless their deletion policy is set
+		if len(backupInstance.Spec.DeletionPolicy) == 0 && isBackupDataRetainedByDefault(backupInstance) {
+			backupInstance.Spec.DeletionPolicy = v1alpha2.BackupDeletionPolicyRetain
+		}
+		backupInstance.SetFinalizers(append(backupInstance.GetFinalizers(), BackupDataFinalizer))
+		err = r.Client.Update(ctx, backupInstance)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	switch backupInstance.Status.Phase {
+	case v1alpha2.BackupSucceeded, v1alpha2.BackupFailed:
+		// The Jenkins is unlocked once the Backup is complete
+		holder := getJenkinsLockHolder(lockHolderBackup, backupInstance)
+		return ctrl.Result{}, releaseJenkinsLock(ctx, r.Client, backupInstance.Namespace, backupInstance.Spec.JenkinsRef, holder)
+	case v1alpha2.BackupRunning:
+		backupLogger.Info(fmt.Sprintf("Resuming Backup '%s' at step %s", backupInstance.Name, backupInstance.Status.Step))
+	case v1alpha2.BackupQueued:
+		// The Backup tries again to lock its Jenkins
+	default:
+		// Backups created before the phases were introduced are complete once they have conditions
+		if len(backupInstance.Status.Phase) == 0 && len(backupInstance.Status.Conditions) > 0 {
+			return ctrl.Result{}, nil
+		}
+		// Backups adopted from a BackupVolume are not run, their status is set by the BackupVolume controller
+		if _, adopted := backupInstance.Annotations[AdoptedBackupAnnotation]; adopted {
+			return ctrl.Result{}, nil
+		}
+		backupLogger.Info("Jenkins Backup with name " + backupInstance.Name + " has been created")
+		setBackupPhase(backupInstance, v1alpha2.BackupPending, nil)
+		err = r.Client.Status().Update(ctx, backupInstance)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	resumed := backupInstance.Status.Phase == v1alpha2.BackupRunning
+	// A Backup cancelled before it started fails right away, without locking its Jenkins
+	if backupInstance.Spec.Cancel && !resumed {
+		err = errors.New("backup cancelled before it started")
+		backupInstance.Status.Conditions.SetCondition(status.Condition{
+			Type:    BackupCompleted,
+			Status:  corev1.ConditionFalse,
+			Reason:  OperationCancelled,
+			Message: err.Error(),
+		})
+		setBackupPhase(backupInstance, v1alpha2.BackupFailed, err)
+		return ctrl.Result{}, r.Client.Status().Update(ctx, backupInstance)
 	}
-	backupLogger.Info("Jenkins Backup with name " + backupInstance.Name + " has been created")
 
 	backupSpec := backupInstance.Spec
 	backupStrategy := &v1alpha2.BackupStrategy{}
@@ -101,6 +171,10 @@ func (r *BackupReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	err = r.Client.Get(ctx, backupStrategyNamespacedName, backupStrategy)
 	if err != nil {
 		if apierrors.IsNotFound(err) {
+			// A resumed Backup can't complete without its BackupStrategy
+			if resumed {
+				return ctrl.Result{}, r.failInterruptedBackup(ctx, backupInstance, fmt.Errorf("backupStrategy '%s' was deleted", backupStrategyName))
+			}
 			// Request object not found, could have been deleted after reconcile request.
 			// Owned objects are automatically garbage collected. For additional cleanup logic use finalizers.
 			// Return and don't requeue
@@ -119,6 +193,10 @@ func (r *BackupReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	err = r.Client.Get(ctx, jenkinsNamespacedName, jenkinsInstance)
 	if err != nil {
 		if apierrors.IsNotFound(err) {
+			// A resumed Backup can't complete without its Jenkins
+			if resumed {
+				return ctrl.Result{}, r.failInterruptedBackup(ctx, backupInstance, fmt.Errorf("jenkins '%s' was deleted", backupInstance.Spec.JenkinsRef))
+			}
 			// Request object not found, could have been deleted after reconcile request.
 			// Owned objects are automatically garbage collected. For additional cleanup logic use finalizers.
 			// Return and don't requeue
@@ -127,6 +205,7 @@ func (r *BackupReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 		// Error reading the object - requeue the request.
 		return ctrl.Result{}, err
 	}
+	backupStrategy = withJenkinsBackupRunner(backupStrategy, jenkinsInstance)
 	jenkinsPod, err := r.GetPodByDeployment(jenkinsInstance)
 	if err != nil {
 		return ctrl.Result{}, err
@@ -136,10 +215,12 @@ func (r *BackupReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	err = execClient.InitKubeGoClient()
 	if err != nil {
 		backupInstance.Status.Conditions.SetCondition(status.Condition{
-			Type:   BackupInitialized,
-			Status: corev1.ConditionFalse,
-			Reason: (status.ConditionReason)(err.Error()),
+			Type:    BackupInitialized,
+			Status:  corev1.ConditionFalse,
+			Reason:  ExecClientInitializationFailed,
+			Message: err.Error(),
 		})
+		setBackupPhase(backupInstance, v1alpha2.BackupFailed, err)
 		err = r.Client.Status().Update(ctx, backupInstance)
 		if err != nil {
 			return ctrl.Result{}, err
@@ -150,40 +231,155 @@ func (r *BackupReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 		Type:   BackupInitialized,
 		Status: corev1.ConditionTrue,
 	})
+
+	// Backups and Restores of a Jenkins run one at a time, the Backup is queued while another one holds the lock
+	locked, err := r.lockJenkins(ctx, jenkinsInstance, backupInstance)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if !locked {
+		return ctrl.Result{RequeueAfter: lockRetryInterval}, nil
+	}
+	if !resumed {
+		setBackupPhase(backupInstance, v1alpha2.BackupRunning, nil)
+	}
+	backupInstance.Status.JenkinsPod = jenkinsPod.Name
 	err = r.Client.Status().Update(ctx, backupInstance)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
+	// The steps stop once the Backup is cancelled or reaches the deadline of its BackupStrategy
+	operation := newOperationContext(r.Client, "backup", backupInstance, req.NamespacedName, backupInstance.Status.StartTime,
+		backupStrategy.Spec.ActiveDeadlineSeconds, isBackupCancelled)
+	defer operation.stop()
+
+	// PreBackup hooks, a failing script aborts the Backup
+	jenkinsClient, operations := newJenkinsAccess(ctx, r.Client, execClient, backupStrategy, jenkinsInstance, jenkinsPod, backupInstance.Name)
+	hooks := &hookRunner{client: r.Client, namespace: backupStrategy.Namespace, jenkinsClient: jenkinsClient}
+	run, err := r.enterBackupStep(ctx, backupInstance, v1alpha2.BackupStepPreBackupHooks)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if run {
+		err = r.performBackupHooks(ctx, hooks, backupInstance, backupStrategy, v1alpha2.PreBackupHook, PreBackupHooksCompleted)
+		if err != nil {
+			backupLogger.Info(fmt.Sprintf("Backup '%s' aborted: %s", backupInstance.Name, err))
+			r.sendNewBackupCompletedNotification(jenkinsInstance, backupInstance, err)
+			setBackupPhase(backupInstance, v1alpha2.BackupFailed, err)
+			return ctrl.Result{}, r.Client.Status().Update(ctx, backupInstance)
+		}
+	}
 
 	// QuietDown
-	if backupStrategy.Spec.QuietDownDuringBackup {
-		err := r.performJenkinsQuietDown(ctx, execClient, jenkinsPod, backupInstance)
+	run, err = r.enterBackupStep(ctx, backupInstance, v1alpha2.BackupStepQuietDown)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if run && backupStrategy.Spec.QuietDownDuringBackup {
+		err := r.performJenkinsQuietDown(ctx, operations, backupInstance)
 		r.sendNewBackupInProgressNotification(jenkinsInstance, backupInstance, "quietDown", err)
 		if err != nil {
 			return ctrl.Result{}, err
 		}
 	}
 
-	// Backup
-	err = r.performJenkinsBackup(ctx, execClient, jenkinsPod, backupInstance, backupStrategy)
-	r.sendNewBackupInProgressNotification(jenkinsInstance, backupInstance, "backup", err)
+	// The error of the drain or of the Backup is persisted in the message, the Backup fails once Jenkins is back to
+	// normal even if it was resumed in between
+	var backupErr error
+	if len(backupInstance.Status.Message) > 0 {
+		backupErr = errors.New(backupInstance.Status.Message)
+	}
+
+	// Drain, the Backup is skipped if the builds are still running after the timeout and the policy is to fail
+	run, err = r.enterBackupStep(ctx, backupInstance, v1alpha2.BackupStepDrain)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
+	if run && backupStrategy.Spec.Drain != nil && operation.Err() == nil {
+		backupErr = r.performJenkinsDrain(ctx, operation, jenkinsClient, backupInstance, backupStrategy)
+		r.sendNewBackupInProgressNotification(jenkinsInstance, backupInstance, "drain", backupErr)
+	}
+
+	// Backup, as an archive of the selected files, as a VolumeSnapshot of the whole Jenkins Home or as a commit of the
+	// configurations to a Git repository
+	if backupErr == nil && operation.Err() == nil {
+		run, err = r.enterBackupStep(ctx, backupInstance, v1alpha2.BackupStepBackup)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if run {
+			if isGitExportStrategy(backupStrategy) {
+				backupErr = r.performJenkinsGitExport(operation, jenkinsClient, jenkinsInstance, backupInstance, backupStrategy)
+			} else if backupStrategy.Spec.VolumeSnapshot != nil {
+				backupErr = r.performJenkinsVolumeSnapshot(operation, jenkinsInstance, backupInstance, backupStrategy)
+			} else {
+				backupErr = r.performJenkinsBackup(operation, execClient, jenkinsClient, jenkinsInstance, jenkinsPod, backupInstance, backupStrategy)
+			}
+			r.sendNewBackupInProgressNotification(jenkinsInstance, backupInstance, "backup", backupErr)
+		}
+	}
+	// A cancelled Backup, or one which reached its deadline, fails once Jenkins is taken out of quiet down mode
+	if reason, err := operation.err(); err != nil {
+		backupErr = err
+		backupInstance.Status.Conditions.SetCondition(status.Condition{
+			Type:    BackupCompleted,
+			Status:  corev1.ConditionFalse,
+			Reason:  reason,
+			Message: err.Error(),
+		})
+	}
+	if backupErr != nil {
+		backupInstance.Status.Message = backupErr.Error()
+	}
 
-	// CancelQuietDown
-	if backupStrategy.Spec.QuietDownDuringBackup {
-		err = r.performJenkinsCancelQuietDown(ctx, execClient, jenkinsPod, backupInstance)
+	// CancelQuietDown, even if the Backup failed
+	run, err = r.enterBackupStep(ctx, backupInstance, v1alpha2.BackupStepCancelQuietDown)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if run && backupStrategy.Spec.QuietDownDuringBackup {
+		err = r.performJenkinsCancelQuietDown(ctx, operations, backupInstance)
 		r.sendNewBackupInProgressNotification(jenkinsInstance, backupInstance, "cancelQuietDown", err)
 		if err != nil {
 			return ctrl.Result{}, err
 		}
 	}
-	r.sendNewBackupCompletedNotification(jenkinsInstance, backupInstance, err)
+	// PostBackup hooks, even if the Backup failed. A failing script is reported in the status only
+	run, err = r.enterBackupStep(ctx, backupInstance, v1alpha2.BackupStepPostBackupHooks)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if run {
+		err = r.performBackupHooks(ctx, hooks, backupInstance, backupStrategy, v1alpha2.PostBackupHook, PostBackupHooksCompleted)
+		if err != nil {
+			backupLogger.Info(fmt.Sprintf("PostBackup hooks of Backup '%s' failed: %s", backupInstance.Name, err))
+		}
+	}
+	// Replicate, once the Backup succeeded. A failed copy is reported in the status only
+	if backupErr == nil {
+		run, err = r.enterBackupStep(ctx, backupInstance, v1alpha2.BackupStepReplicate)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if run {
+			err = r.performBackupReplication(ctx, operation, execClient, jenkinsInstance, jenkinsPod, backupInstance, backupStrategy)
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+	}
+	if backupErr != nil {
+		backupLogger.Info(fmt.Sprintf("Backup '%s' failed: %s", backupInstance.Name, backupErr))
+		r.sendNewBackupCompletedNotification(jenkinsInstance, backupInstance, backupErr)
+		setBackupPhase(backupInstance, v1alpha2.BackupFailed, backupErr)
+		return ctrl.Result{}, r.Client.Status().Update(ctx, backupInstance)
+	}
+	r.sendNewBackupCompletedNotification(jenkinsInstance, backupInstance, nil)
 	backupInstance.Status.Conditions.SetCondition(status.Condition{
 		Type:   BackupCompleted,
 		Status: corev1.ConditionTrue,
 	})
+	setBackupPhase(backupInstance, v1alpha2.BackupSucceeded, nil)
 	err = r.Client.Status().Update(ctx, backupInstance)
 	if err != nil {
 		return ctrl.Result{}, err
@@ -192,14 +388,120 @@ func (r *BackupReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	return ctrl.Result{}, nil
 }
 
-func (r *BackupReconciler) performJenkinsCancelQuietDown(ctx context.Context, execClient exec.KubeExecClient, jenkinsPod *corev1.Pod, backupInstance *v1alpha2.Backup) error {
-	execCancelQuietDown := strings.Join([]string{"sh", resources.CancelQuietDownScriptPath}, " ")
-	err := execClient.MakeRequest(jenkinsPod, backupInstance.Name, execCancelQuietDown)
+// isBackupCancelled returns true if the Backup was cancelled through its spec
+func isBackupCancelled(object runtime.Object) bool {
+	backup, ok := object.(*v1alpha2.Backup)
+	return ok && backup.Spec.Cancel
+}
+
+// backupSteps are the steps of a Backup, in the order in which they run
+var backupSteps = []v1alpha2.BackupStep{
+	v1alpha2.BackupStepPreBackupHooks,
+	v1alpha2.BackupStepQuietDown,
+	v1alpha2.BackupStepDrain,
+	v1alpha2.BackupStepBackup,
+	v1alpha2.BackupStepCancelQuietDown,
+	v1alpha2.BackupStepPostBackupHooks,
+	v1alpha2.BackupStepReplicate,
+}
+
+// getBackupStepIndex returns the position of the step in backupSteps, or -1 if the Backup has not started a step yet
+func getBackupStepIndex(step v1alpha2.BackupStep) int {
+	for i, backupStep := range backupSteps {
+		if backupStep == step {
+			return i
+		}
+	}
+	return -1
+}
+
+// enterBackupStep persists the step before it runs, so that the Backup resumes from it if it is interrupted.
+// It returns false if the step already ran, when the Backup was resumed at a later step.
+func (r *BackupReconciler) enterBackupStep(ctx context.Context, backupInstance *v1alpha2.Backup, step v1alpha2.BackupStep) (bool, error) {
+	current := getBackupStepIndex(backupInstance.Status.Step)
+	next := getBackupStepIndex(step)
+	if current > next {
+		return false, nil
+	}
+	if current == next {
+		return true, nil
+	}
+	backupInstance.Status.Step = step
+	return true, r.Client.Status().Update(ctx, backupInstance)
+}
+
+// lockJenkins acquires the lock of the Jenkins for the Backup. The Backup is queued if another Backup or Restore holds it.
+func (r *BackupReconciler) lockJenkins(ctx context.Context, jenkinsInstance *v1alpha2.Jenkins, backupInstance *v1alpha2.Backup) (bool, error) {
+	locked, holder, err := acquireJenkinsLock(ctx, r.Client, jenkinsInstance, lockHolderBackup, backupInstance)
 	if err != nil {
+		return false, err
+	}
+	if locked {
 		backupInstance.Status.Conditions.SetCondition(status.Condition{
-			Type:   QuietDownCancelled,
-			Status: corev1.ConditionFalse,
-			Reason: (status.ConditionReason)(fmt.Sprintf("CancelQuietDown failed with error %s", err.Error())),
+			Type:   LockAcquired,
+			Status: corev1.ConditionTrue,
+		})
+		return true, nil
+	}
+	if backupInstance.Status.Phase != v1alpha2.BackupQueued {
+		logger.Info(fmt.Sprintf("Backup '%s' queued: %s", backupInstance.Name, getJenkinsLockedMessage(jenkinsInstance.Name, holder)))
+	}
+	backupInstance.Status.Conditions.SetCondition(status.Condition{
+		Type:    LockAcquired,
+		Status:  corev1.ConditionFalse,
+		Reason:  JenkinsLocked,
+		Message: getJenkinsLockedMessage(jenkinsInstance.Name, holder),
+	})
+	setBackupPhase(backupInstance, v1alpha2.BackupQueued, nil)
+	return false, r.Client.Status().Update(ctx, backupInstance)
+}
+
+// failInterruptedBackup fails a resumed Backup which can't complete
+func (r *BackupReconciler) failInterruptedBackup(ctx context.Context, backupInstance *v1alpha2.Backup, err error) error {
+	err = fmt.Errorf("backup interrupted at step %s can't be resumed: %s", backupInstance.Status.Step, err)
+	backupInstance.Status.Conditions.SetCondition(status.Condition{
+		Type:    BackupCompleted,
+		Status:  corev1.ConditionFalse,
+		Reason:  BackupInterrupted,
+		Message: err.Error(),
+	})
+	setBackupPhase(backupInstance, v1alpha2.BackupFailed, err)
+	return r.Client.Status().Update(ctx, backupInstance)
+}
+
+// performBackupHooks runs the hook scripts of the stage and records their results in the status of the Backup
+func (r *BackupReconciler) performBackupHooks(ctx context.Context, hooks *hookRunner, backupInstance *v1alpha2.Backup, backupStrategy *v1alpha2.BackupStrategy, stage v1alpha2.HookStage, conditionType status.ConditionType) error {
+	configMaps := getHookScripts(backupStrategy.Spec.Hooks, stage)
+	if len(configMaps) == 0 {
+		return nil
+	}
+	results, err := hooks.run(ctx, stage, configMaps)
+	backupInstance.Status.Hooks = append(backupInstance.Status.Hooks, results...)
+	condition := status.Condition{
+		Type:   conditionType,
+		Status: corev1.ConditionTrue,
+	}
+	if err != nil {
+		condition.Status = corev1.ConditionFalse
+		condition.Reason = HookFailed
+		condition.Message = err.Error()
+	}
+	backupInstance.Status.Conditions.SetCondition(condition)
+	updateErr := r.Client.Status().Update(ctx, backupInstance)
+	if updateErr != nil {
+		return updateErr
+	}
+	return err
+}
+
+func (r *BackupReconciler) performJenkinsCancelQuietDown(ctx context.Context, operations *jenkinsOperations, backupInstance *v1alpha2.Backup) error {
+	err := operations.run(ctx, resources.CancelQuietDownScriptPath)
+	if err != nil {
+		backupInstance.Status.Conditions.SetCondition(status.Condition{
+			Type:    QuietDownCancelled,
+			Status:  corev1.ConditionFalse,
+			Reason:  CancelQuietDownFailed,
+			Message: fmt.Sprintf("CancelQuietDown failed with error %s", err.Error()),
 		})
 		err = r.Client.Status().Update(ctx, backupInstance)
 		if err != nil {
@@ -218,68 +520,141 @@ func (r *BackupReconciler) performJenkinsCancelQuietDown(ctx context.Context, ex
 	return nil
 }
 
-func (r *BackupReconciler) performJenkinsBackup(ctx context.Context, execClient exec.KubeExecClient, jenkinsPod *corev1.Pod, backupInstance *v1alpha2.Backup, backupStrategy *v1alpha2.BackupStrategy) error {
-	backupToLocation := resources.JenkinsBackupVolumePath + "/" + backupInstance.Spec.BackupVolumeRef + "/" + backupInstance.Name + "/"
-	execCreateBackupDir := strings.Join([]string{"mkdir", backupToLocation}, " ")
-	err := execClient.MakeRequest(jenkinsPod, backupInstance.Name, execCreateBackupDir)
+func (r *BackupReconciler) performJenkinsBackup(ctx context.Context, execClient exec.KubeExecClient, jenkinsClient *lazyJenkinsClient, jenkinsInstance *v1alpha2.Jenkins, jenkinsPod *corev1.Pod, backupInstance *v1alpha2.Backup, backupStrategy *v1alpha2.BackupStrategy) error {
+	var err error
+	if isBackupJobRunner(backupStrategy) {
+		err = r.runJenkinsBackupJob(ctx, jenkinsClient, jenkinsInstance, jenkinsPod, backupInstance, backupStrategy)
+	} else {
+		err = r.createJenkinsBackupArchive(ctx, execClient, jenkinsClient, jenkinsPod, backupInstance, backupStrategy)
+	}
 	if err != nil {
+		err = fmt.Errorf("failed to create backup archive: %s", err)
 		backupInstance.Status.Conditions.SetCondition(status.Condition{
-			Type:   BackupCompleted,
-			Status: corev1.ConditionFalse,
-			Reason: (status.ConditionReason)(fmt.Sprintf("Failed to create backup directory %s %s", backupToLocation, err.Error())),
+			Type:    BackupCompleted,
+			Status:  corev1.ConditionFalse,
+			Reason:  BackupArchiveFailed,
+			Message: err.Error(),
 		})
-		err = r.Client.Status().Update(ctx, backupInstance)
-		if err != nil {
-			return err
+		updateErr := r.Client.Status().Update(ctx, backupInstance)
+		if updateErr != nil {
+			return updateErr
 		}
-		return nil
+		return err
 	}
-	// Create Backup based on Spec
-	backupFromLocation := defaultJenkinsHome
-	backupFromSubLocations := []string{}
-	if backupStrategy.Spec.Options.Config {
-		backupFromSubLocations = append(backupFromSubLocations, "*.xml")
+	return nil
+}
+
+// createJenkinsBackupArchive streams a tar archive of the Jenkins Home locations selected by the BackupStrategy from
+// the backup container, compresses it and stores it on the BackupVolume as it is received, along with its manifest
+func (r *BackupReconciler) createJenkinsBackupArchive(ctx context.Context, execClient exec.KubeExecClient, jenkinsClient *lazyJenkinsClient, jenkinsPod *corev1.Pod, backupInstance *v1alpha2.Backup, backupStrategy *v1alpha2.BackupStrategy) error {
+	backupVolume, err := getBackupVolume(ctx, r.Client, backupInstance)
+	if err != nil {
+		return err
 	}
-	if backupStrategy.Spec.Options.Jobs {
-		backupFromSubLocations = append(backupFromSubLocations, "jobs")
+	storage, err := newBackupStorage(ctx, r.Client, execClient, jenkinsPod, backupInstance, backupVolume)
+	if err != nil {
+		return err
 	}
-	if backupStrategy.Spec.Options.Plugins {
-		backupFromSubLocations = append(backupFromSubLocations, "plugins")
+	selection, err := newBackupSelection(backupStrategy.Spec)
+	if err != nil {
+		return err
 	}
-	if len(backupFromSubLocations) > 0 {
-		for _, sl := range backupFromSubLocations {
-			// Backup each location in a different request
-			backupFromSubLocation := strings.Join([]string{backupFromLocation, sl}, "/")
-			execBackupSubLocation := strings.Join([]string{"cp", "-r", backupFromSubLocation, backupToLocation}, " ")
-			err = execClient.MakeRequest(jenkinsPod, backupInstance.Name, execBackupSubLocation)
-			if err != nil {
-				backupInstance.Status.Conditions.SetCondition(status.Condition{
-					Type:   BackupCompleted,
-					Status: corev1.ConditionFalse,
-					Reason: (status.ConditionReason)(fmt.Sprintf("Failed to backup from %s %s", backupFromSubLocation, err)),
-				})
-				err = r.Client.Status().Update(ctx, backupInstance)
-				if err != nil {
-					return err
-				}
-			}
-		}
-		err = r.Client.Status().Update(ctx, backupInstance)
-		if err != nil {
-			return err
-		}
+	manifest := &BackupManifest{
+		Backup:       backupInstance.Name,
+		CreationTime: time.Now().UTC(),
+		Options:      backupStrategy.Spec.Options,
+		Paths:        selection.roots(),
+		Includes:     selection.includes,
+		Excludes:     selection.excludes,
+	}
+	encryptionKey, err := getBackupEncryptionKey(ctx, r.Client, backupStrategy)
+	if err != nil {
+		return err
 	}
+	if encryptionKey != nil {
+		manifest.Encryption = encryption.Algorithm
+	}
+	manifest.JenkinsVersion, manifest.Plugins = getBackupJenkinsVersionAndPlugins(jenkinsClient, backupInstance)
+
+	// The tar stream is filtered by the selection, then the checksums are computed while it is compressed and encrypted
+	archiveSize, err := streamBackupArchive(ctx, storage, manifest, encryptionKey, func(out io.Writer) error {
+		return streamJenkinsHomeArchive(ctx, execClient, jenkinsPod, backupInstance.Name, selection, out)
+	})
+	if err != nil {
+		return err
+	}
+	backupInstance.Status.Size = archiveSize
+	backupInstance.Status.FileCount = int64(len(manifest.Files))
+	backupInstance.Status.Path = storage.location()
+	backupInstance.Status.JenkinsVersion = manifest.JenkinsVersion
+	backupInstance.Status.Plugins = manifest.Plugins
 	return nil
 }
 
-func (r *BackupReconciler) performJenkinsQuietDown(ctx context.Context, execClient exec.KubeExecClient, jenkinsPod *corev1.Pod, backupInstance *v1alpha2.Backup) error {
-	execQuietDown := strings.Join([]string{"sh", resources.QuietDownScriptPath}, " ")
-	err := execClient.MakeRequest(jenkinsPod, backupInstance.Name, execQuietDown)
+// runJenkinsBackupJob creates the Backup archive in a Job mounting the Jenkins Home and the BackupVolume
+func (r *BackupReconciler) runJenkinsBackupJob(ctx context.Context, jenkinsClient *lazyJenkinsClient, jenkinsInstance *v1alpha2.Jenkins, jenkinsPod *corev1.Pod, backupInstance *v1alpha2.Backup, backupStrategy *v1alpha2.BackupStrategy) error {
+	if !jenkinsInstance.Spec.PersistentSpec.Enabled {
+		return fmt.Errorf("the Jenkins Home of Jenkins '%s' is not persistent, it can't be mounted in a Job", jenkinsInstance.Name)
+	}
+	backupVolume, err := getBackupVolume(ctx, r.Client, backupInstance)
+	if err != nil {
+		return err
+	}
+	if err = checkBackupJobSecrets(ctx, r.Client, backupVolume, backupStrategy); err != nil {
+		return err
+	}
+	image, command, err := getBackupJobImage(ctx, r.Client)
+	if err != nil {
+		return err
+	}
+	spec := newBackupJobSpec(backupJobBackup, backupInstance.Name, backupInstance, backupVolume, backupStrategy)
+	job, err := newBackupJob(backupInstance, "Backup", jenkinsInstance, jenkinsPod, backupVolume, backupStrategy, spec, image, command)
+	if err != nil {
+		return err
+	}
+	backupInstance.Status.Job = job.Name
+	if err = r.Client.Status().Update(ctx, backupInstance); err != nil {
+		return err
+	}
+	result, err := runBackupJob(ctx, r.Client, job, backupJobPollInterval, getBackupJobActiveDeadline(backupStrategy)+time.Minute)
+	if err != nil {
+		return err
+	}
+	if len(result.Error) > 0 {
+		return errors.New(result.Error)
+	}
+	backupInstance.Status.Size = result.Size
+	backupInstance.Status.FileCount = result.FileCount
+	backupInstance.Status.Path = result.Path
+	// The plugins don't fit in the termination message of the Job, they are read from the running Jenkins instead
+	backupInstance.Status.JenkinsVersion, backupInstance.Status.Plugins = getBackupJenkinsVersionAndPlugins(jenkinsClient, backupInstance)
+	return nil
+}
+
+// getBackupJenkinsVersionAndPlugins returns the version and the installed plugins of the running Jenkins,
+// these are informative only so they are not recorded if Jenkins can't be reached
+func getBackupJenkinsVersionAndPlugins(jenkinsClient *lazyJenkinsClient, backupInstance *v1alpha2.Backup) (string, []v1alpha2.Plugin) {
+	client, err := jenkinsClient.get()
+	if err != nil {
+		logger.Info(fmt.Sprintf("Failed to read the version and the plugins of Jenkins '%s', they are not recorded in Backup '%s': %s", backupInstance.Spec.JenkinsRef, backupInstance.Name, err))
+		return "", nil
+	}
+	version, plugins, err := getRunningJenkinsVersionAndPlugins(client)
+	if err != nil {
+		logger.Info(fmt.Sprintf("Failed to read the version and the plugins of Jenkins '%s', they are not recorded in Backup '%s': %s", backupInstance.Spec.JenkinsRef, backupInstance.Name, err))
+		return "", nil
+	}
+	return version, plugins
+}
+
+func (r *BackupReconciler) performJenkinsQuietDown(ctx context.Context, operations *jenkinsOperations, backupInstance *v1alpha2.Backup) error {
+	err := operations.run(ctx, resources.QuietDownScriptPath)
 	if err != nil {
 		backupInstance.Status.Conditions.SetCondition(status.Condition{
-			Type:   QuietDownStarted,
-			Status: corev1.ConditionFalse,
-			Reason: (status.ConditionReason)(err.Error()),
+			Type:    QuietDownStarted,
+			Status:  corev1.ConditionFalse,
+			Reason:  QuietDownFailed,
+			Message: err.Error(),
 		})
 		err = r.Client.Status().Update(ctx, backupInstance)
 		if err != nil {
@@ -333,7 +708,10 @@ func (r *BackupReconciler) GetJenkinsDeployment(jenkins *v1alpha2.Jenkins) (*app
 }
 
 func (r *BackupReconciler) GetReplicaSetByDeployment(jenkins *v1alpha2.Jenkins) (*appsv1.ReplicaSet, error) {
-	deployment, _ := r.GetJenkinsDeployment(jenkins)
+	deployment, err := r.GetJenkinsDeployment(jenkins)
+	if err != nil {
+		return nil, err
+	}
 	selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
 	replicasSetList := appsv1.ReplicaSetList{}
 	if err != nil {
@@ -350,6 +728,21 @@ func (r *BackupReconciler) GetReplicaSetByDeployment(jenkins *v1alpha2.Jenkins)
 	return &replicaSet, nil
 }
 
+// setBackupPhase sets the phase of the Backup along with its start or completion time and the error message
+func setBackupPhase(backup *v1alpha2.Backup, phase v1alpha2.BackupPhase, err error) {
+	now := metav1.Now()
+	backup.Status.Phase = phase
+	switch phase {
+	case v1alpha2.BackupRunning:
+		backup.Status.StartTime = &now
+	case v1alpha2.BackupSucceeded, v1alpha2.BackupFailed:
+		backup.Status.CompletionTime = &now
+	}
+	if err != nil {
+		backup.Status.Message = err.Error()
+	}
+}
+
 func (r *BackupReconciler) sendNewBackupCompletedNotification(jenkins *v1alpha2.Jenkins, backup *v1alpha2.Backup, err error) {
 	r.NotificationEvents <- event.Event{
 		Jenkins:    *jenkins,
@@ -0,0 +1,207 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jenkinsci/jenkins-automation-operator/api/v1alpha2"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var _ = Describe("Backup phase", func() {
+	It("Should Set The Start And Completion Times And The Message", func() {
+		backup := &v1alpha2.Backup{}
+
+		setBackupPhase(backup, v1alpha2.BackupPending, nil)
+		Expect(backup.Status.Phase).To(Equal(v1alpha2.BackupPending))
+		Expect(backup.Status.StartTime).To(BeNil())
+
+		setBackupPhase(backup, v1alpha2.BackupRunning, nil)
+		Expect(backup.Status.Phase).To(Equal(v1alpha2.BackupRunning))
+		Expect(backup.Status.StartTime).NotTo(BeNil())
+		Expect(backup.Status.CompletionTime).To(BeNil())
+
+		setBackupPhase(backup, v1alpha2.BackupFailed, errors.New("tar: jobs: Cannot open"))
+		Expect(backup.Status.Phase).To(Equal(v1alpha2.BackupFailed))
+		Expect(backup.Status.CompletionTime).NotTo(BeNil())
+		Expect(backup.Status.Message).To(Equal("tar: jobs: Cannot open"))
+	})
+})
+
+var _ = Describe("Restore phase", func() {
+	It("Should Set The Start And Completion Times", func() {
+		restore := &v1alpha2.Restore{}
+
+		setRestorePhase(restore, v1alpha2.RestoreRunning, nil)
+		Expect(restore.Status.StartTime).NotTo(BeNil())
+		Expect(restore.Status.CompletionTime).To(BeNil())
+
+		setRestorePhase(restore, v1alpha2.RestoreSucceeded, nil)
+		Expect(restore.Status.Phase).To(Equal(v1alpha2.RestoreSucceeded))
+		Expect(restore.Status.CompletionTime).NotTo(BeNil())
+		Expect(restore.Status.Message).To(BeEmpty())
+	})
+})
+
+var _ = Describe("Backup step", func() {
+	BeforeEach(func() {
+		Expect(v1alpha2.AddToScheme(scheme.Scheme)).To(Succeed())
+	})
+
+	It("Should Skip The Steps Before The Current Step And Record The Next Ones", func() {
+		ctx := context.Background()
+		backup := &v1alpha2.Backup{
+			ObjectMeta: metav1.ObjectMeta{Name: "backup", Namespace: "jenkins"},
+			Status:     v1alpha2.BackupStatus{Phase: v1alpha2.BackupRunning, Step: v1alpha2.BackupStepDrain},
+		}
+		reconciler := &BackupReconciler{Client: fake.NewFakeClientWithScheme(scheme.Scheme, backup)}
+
+		run, err := reconciler.enterBackupStep(ctx, backup, v1alpha2.BackupStepQuietDown)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(run).To(BeFalse())
+
+		run, err = reconciler.enterBackupStep(ctx, backup, v1alpha2.BackupStepDrain)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(run).To(BeTrue())
+
+		run, err = reconciler.enterBackupStep(ctx, backup, v1alpha2.BackupStepBackup)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(run).To(BeTrue())
+		current := &v1alpha2.Backup{}
+		Expect(reconciler.Client.Get(ctx, types.NamespacedName{Name: "backup", Namespace: "jenkins"}, current)).To(Succeed())
+		Expect(current.Status.Step).To(Equal(v1alpha2.BackupStepBackup))
+	})
+})
+
+var _ = Describe("Restore step", func() {
+	BeforeEach(func() {
+		Expect(v1alpha2.AddToScheme(scheme.Scheme)).To(Succeed())
+	})
+
+	It("Should Skip The Steps Before The Current Step And Record The Next Ones", func() {
+		ctx := context.Background()
+		restore := &v1alpha2.Restore{ObjectMeta: metav1.ObjectMeta{Name: "restore", Namespace: "jenkins"}}
+		reconciler := &RestoreReconciler{Client: fake.NewFakeClientWithScheme(scheme.Scheme, restore)}
+
+		run, err := reconciler.enterRestoreStep(ctx, restore, v1alpha2.RestoreStepPreRestoreHooks)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(run).To(BeTrue())
+
+		run, err = reconciler.enterRestoreStep(ctx, restore, v1alpha2.RestoreStepRestart)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(run).To(BeTrue())
+
+		run, err = reconciler.enterRestoreStep(ctx, restore, v1alpha2.RestoreStepSnapshot)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(run).To(BeFalse())
+		current := &v1alpha2.Restore{}
+		Expect(reconciler.Client.Get(ctx, types.NamespacedName{Name: "restore", Namespace: "jenkins"}, current)).To(Succeed())
+		Expect(current.Status.Step).To(Equal(v1alpha2.RestoreStepRestart))
+	})
+})
+
+var _ = Describe("Resumed Backup", func() {
+	ctx := context.Background()
+	name := types.NamespacedName{Name: "backup", Namespace: "jenkins"}
+
+	BeforeEach(func() {
+		Expect(v1alpha2.AddToScheme(scheme.Scheme)).To(Succeed())
+	})
+
+	It("Should Keep Its Phase Once Completed", func() {
+		backup := &v1alpha2.Backup{
+			ObjectMeta: metav1.ObjectMeta{Name: "backup", Namespace: "jenkins", Finalizers: []string{BackupDataFinalizer}},
+			Status:     v1alpha2.BackupStatus{Phase: v1alpha2.BackupSucceeded, Step: v1alpha2.BackupStepPostBackupHooks},
+		}
+		reconciler := &BackupReconciler{Client: fake.NewFakeClientWithScheme(scheme.Scheme, backup), Log: log.Log}
+
+		_, err := reconciler.Reconcile(ctrl.Request{NamespacedName: name})
+
+		Expect(err).NotTo(HaveOccurred())
+		current := &v1alpha2.Backup{}
+		Expect(reconciler.Client.Get(ctx, name, current)).To(Succeed())
+		Expect(current.Status.Phase).To(Equal(v1alpha2.BackupSucceeded))
+	})
+
+	It("Should Fail When Its BackupStrategy Was Deleted", func() {
+		backup := &v1alpha2.Backup{
+			ObjectMeta: metav1.ObjectMeta{Name: "backup", Namespace: "jenkins", Finalizers: []string{BackupDataFinalizer}},
+			Spec:       v1alpha2.BackupSpec{StrategyRef: "strategy", JenkinsRef: "jenkins"},
+			Status:     v1alpha2.BackupStatus{Phase: v1alpha2.BackupRunning, Step: v1alpha2.BackupStepBackup},
+		}
+		reconciler := &BackupReconciler{Client: fake.NewFakeClientWithScheme(scheme.Scheme, backup), Log: log.Log}
+
+		_, err := reconciler.Reconcile(ctrl.Request{NamespacedName: name})
+
+		Expect(err).NotTo(HaveOccurred())
+		current := &v1alpha2.Backup{}
+		Expect(reconciler.Client.Get(ctx, name, current)).To(Succeed())
+		Expect(current.Status.Phase).To(Equal(v1alpha2.BackupFailed))
+		Expect(current.Status.Message).To(Equal("backup interrupted at step Backup can't be resumed: backupStrategy 'strategy' was deleted"))
+		condition := current.Status.Conditions.GetCondition(BackupCompleted)
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Reason).To(Equal(BackupInterrupted))
+	})
+})
+
+var _ = Describe("Backup finalizer", func() {
+	ctx := context.Background()
+	name := types.NamespacedName{Name: "backup", Namespace: "jenkins"}
+
+	BeforeEach(func() {
+		Expect(v1alpha2.AddToScheme(scheme.Scheme)).To(Succeed())
+	})
+
+	It("Should Retain The Data Of A Backup Run Before The Finalizer", func() {
+		backup := &v1alpha2.Backup{
+			ObjectMeta: metav1.ObjectMeta{Name: "backup", Namespace: "jenkins"},
+			Status:     v1alpha2.BackupStatus{Phase: v1alpha2.BackupSucceeded},
+		}
+		reconciler := &BackupReconciler{Client: fake.NewFakeClientWithScheme(scheme.Scheme, backup), Log: log.Log}
+
+		_, err := reconciler.Reconcile(ctrl.Request{NamespacedName: name})
+
+		Expect(err).NotTo(HaveOccurred())
+		current := &v1alpha2.Backup{}
+		Expect(reconciler.Client.Get(ctx, name, current)).To(Succeed())
+		Expect(hasFinalizer(current, BackupDataFinalizer)).To(BeTrue())
+		Expect(current.Spec.DeletionPolicy).To(Equal(v1alpha2.BackupDeletionPolicyRetain))
+	})
+
+	It("Should Keep The Deletion Policy Of A Backup Run Before The Finalizer", func() {
+		backup := &v1alpha2.Backup{
+			ObjectMeta: metav1.ObjectMeta{Name: "backup", Namespace: "jenkins"},
+			Spec:       v1alpha2.BackupSpec{DeletionPolicy: v1alpha2.BackupDeletionPolicyDelete},
+			Status:     v1alpha2.BackupStatus{Phase: v1alpha2.BackupSucceeded},
+		}
+		reconciler := &BackupReconciler{Client: fake.NewFakeClientWithScheme(scheme.Scheme, backup), Log: log.Log}
+
+		_, err := reconciler.Reconcile(ctrl.Request{NamespacedName: name})
+
+		Expect(err).NotTo(HaveOccurred())
+		current := &v1alpha2.Backup{}
+		Expect(reconciler.Client.Get(ctx, name, current)).To(Succeed())
+		Expect(current.Spec.DeletionPolicy).To(Equal(v1alpha2.BackupDeletionPolicyDelete))
+	})
+
+	It("Should Retain The Data Of An Adopted Backup", func() {
+		backup := &v1alpha2.Backup{
+			ObjectMeta: metav1.ObjectMeta{Name: "backup", Namespace: "jenkins", Annotations: map[string]string{AdoptedBackupAnnotation: "volume"}},
+		}
+		reconciler := &BackupReconciler{Client: fake.NewFakeClientWithScheme(scheme.Scheme, backup), Log: log.Log}
+
+		_, err := reconciler.Reconcile(ctrl.Request{NamespacedName: name})
+
+		Expect(err).NotTo(HaveOccurred())
+		current := &v1alpha2.Backup{}
+		Expect(reconciler.Client.Get(ctx, name, current)).To(Succeed())
+		Expect(current.Spec.DeletionPolicy).To(Equal(v1alpha2.BackupDeletionPolicyRetain))
+	})
+})
@@ -0,0 +1,122 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jenkinsci/jenkins-automation-operator/api/v1alpha2"
+	jenkinsclient "github.com/jenkinsci/jenkins-automation-operator/pkg/client"
+	"github.com/operator-framework/operator-lib/status"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	// ExecutorsDrained is set when the BackupStrategy drains the running builds before backing up
+	ExecutorsDrained status.ConditionType = "ExecutorsDrained"
+	// DrainInProgress is the reason of the ExecutorsDrained condition while the builds are waited for
+	DrainInProgress status.ConditionReason = "DrainInProgress"
+	// DrainTimeout is the reason of the ExecutorsDrained condition when builds were still running after the timeout
+	DrainTimeout status.ConditionReason = "DrainTimeout"
+	// DrainFailed is the reason of the ExecutorsDrained condition when the executors could not be checked
+	DrainFailed status.ConditionReason = "DrainFailed"
+	// DrainInterrupted is the reason of the ExecutorsDrained condition when the Backup was cancelled or reached its
+	// deadline during the wait
+	DrainInterrupted status.ConditionReason = "DrainInterrupted"
+
+	defaultDrainTimeout      = 10 * time.Minute
+	defaultDrainPollInterval = 10 * time.Second
+)
+
+// getDrainDurations returns the timeout and the poll interval of the drain, with their defaults
+func getDrainDurations(drain *v1alpha2.DrainConfig) (timeout, interval time.Duration) {
+	timeout, interval = defaultDrainTimeout, defaultDrainPollInterval
+	if drain.Timeout != nil {
+		timeout = drain.Timeout.Duration
+	}
+	if drain.PollInterval != nil && drain.PollInterval.Duration > 0 {
+		interval = drain.PollInterval.Duration
+	}
+	return timeout, interval
+}
+
+// waitForIdleExecutors polls the computers of Jenkins until all their executors, one-off executors included, are idle.
+// When the timeout expires it returns an error naming the computers which are still busy.
+func waitForIdleExecutors(ctx context.Context, jenkinsClient jenkinsclient.Jenkins, interval, timeout time.Duration) error {
+	var busy []string
+	var lastErr error
+	err := pollImmediate(ctx, interval, timeout, func() (bool, error) {
+		nodes, err := jenkinsClient.GetAllNodes()
+		if err != nil {
+			// Jenkins may not answer while busy, it is asked again until the timeout
+			lastErr = err
+			return false, nil
+		}
+		lastErr = nil
+		busy = []string{}
+		for _, node := range nodes {
+			if node.Raw != nil && !node.Raw.Idle {
+				busy = append(busy, node.Raw.DisplayName)
+			}
+		}
+		return len(busy) == 0, nil
+	})
+	if err != wait.ErrWaitTimeout {
+		return err
+	}
+	if lastErr != nil {
+		return fmt.Errorf("failed to get the executors of Jenkins within %s: %s", timeout, lastErr)
+	}
+	return fmt.Errorf("builds are still running on %s after %s", strings.Join(busy, ", "), timeout)
+}
+
+// performJenkinsDrain waits for the running builds to complete and records the wait in the conditions of the Backup.
+// The wait stops when the operation context is done, the conditions are updated with ctx which outlives it.
+// It returns an error when the Backup must not be performed, according to the drain timeout policy.
+func (r *BackupReconciler) performJenkinsDrain(ctx, operation context.Context, jenkinsClient *lazyJenkinsClient, backupInstance *v1alpha2.Backup, backupStrategy *v1alpha2.BackupStrategy) error {
+	drain := backupStrategy.Spec.Drain
+	timeout, interval := getDrainDurations(drain)
+	backupInstance.Status.Conditions.SetCondition(status.Condition{
+		Type:    ExecutorsDrained,
+		Status:  corev1.ConditionFalse,
+		Reason:  DrainInProgress,
+		Message: fmt.Sprintf("Waiting up to %s for the running builds to complete", timeout),
+	})
+	err := r.Client.Status().Update(ctx, backupInstance)
+	if err != nil {
+		return err
+	}
+
+	condition := status.Condition{
+		Type:   ExecutorsDrained,
+		Status: corev1.ConditionTrue,
+	}
+	client, drainErr := jenkinsClient.get()
+	reason := DrainFailed
+	if drainErr == nil {
+		drainErr = waitForIdleExecutors(operation, client, interval, timeout)
+		reason = DrainTimeout
+	}
+	if drainErr != nil && operation.Err() != nil {
+		// The Backup is failed by the caller with the cancellation or the deadline, it is not performed anyway
+		condition.Status = corev1.ConditionFalse
+		condition.Reason = DrainInterrupted
+		condition.Message = fmt.Sprintf("The wait for the running builds was interrupted: %s", operation.Err())
+	} else if drainErr != nil {
+		condition.Status = corev1.ConditionFalse
+		condition.Reason = reason
+		condition.Message = drainErr.Error()
+		if drain.OnTimeout != v1alpha2.DrainTimeoutFail {
+			condition.Message += ", backing up anyway"
+			drainErr = nil
+		}
+	}
+	backupInstance.Status.Conditions.SetCondition(condition)
+	err = r.Client.Status().Update(ctx, backupInstance)
+	if err != nil {
+		return err
+	}
+	return drainErr
+}
@@ -0,0 +1,134 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bndr/gojenkins"
+	"github.com/golang/mock/gomock"
+	"github.com/jenkinsci/jenkins-automation-operator/api/v1alpha2"
+	jenkinsclient "github.com/jenkinsci/jenkins-automation-operator/pkg/client"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newNode(name string, idle bool) *gojenkins.Node {
+	return &gojenkins.Node{Raw: &gojenkins.NodeResponse{DisplayName: name, Idle: idle}}
+}
+
+var _ = Describe("Idle executors wait", func() {
+	It("Should Succeed Once The Executors Become Idle", func() {
+		mockCtrl := gomock.NewController(GinkgoT())
+		defer mockCtrl.Finish()
+		jenkinsClient := jenkinsclient.NewMockJenkins(mockCtrl)
+		gomock.InOrder(
+			jenkinsClient.EXPECT().GetAllNodes().Return([]*gojenkins.Node{newNode("master", false), newNode("agent", true)}, nil),
+			jenkinsClient.EXPECT().GetAllNodes().Return(nil, errors.New("timeout")),
+			jenkinsClient.EXPECT().GetAllNodes().Return([]*gojenkins.Node{newNode("master", true), newNode("agent", true)}, nil),
+		)
+
+		err := waitForIdleExecutors(context.Background(), jenkinsClient, time.Millisecond, time.Minute)
+
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("Should Fail While Builds Are Still Running", func() {
+		mockCtrl := gomock.NewController(GinkgoT())
+		defer mockCtrl.Finish()
+		jenkinsClient := jenkinsclient.NewMockJenkins(mockCtrl)
+		jenkinsClient.EXPECT().GetAllNodes().Return([]*gojenkins.Node{newNode("master", false), newNode("agent", true)}, nil).MinTimes(1)
+
+		err := waitForIdleExecutors(context.Background(), jenkinsClient, time.Millisecond, 10*time.Millisecond)
+
+		Expect(err).To(MatchError("builds are still running on master after 10ms"))
+	})
+
+	It("Should Fail When Jenkins Does Not Answer", func() {
+		mockCtrl := gomock.NewController(GinkgoT())
+		defer mockCtrl.Finish()
+		jenkinsClient := jenkinsclient.NewMockJenkins(mockCtrl)
+		jenkinsClient.EXPECT().GetAllNodes().Return(nil, errors.New("connection refused")).MinTimes(1)
+
+		err := waitForIdleExecutors(context.Background(), jenkinsClient, time.Millisecond, 10*time.Millisecond)
+
+		Expect(err).To(MatchError("failed to get the executors of Jenkins within 10ms: connection refused"))
+	})
+})
+
+var _ = Describe("Jenkins drain", func() {
+	ctx := context.Background()
+	drainTimeout := &metav1.Duration{Duration: 10 * time.Millisecond}
+	pollInterval := &metav1.Duration{Duration: time.Millisecond}
+
+	BeforeEach(func() {
+		Expect(v1alpha2.AddToScheme(scheme.Scheme)).To(Succeed())
+	})
+
+	for _, test := range []struct {
+		name      string
+		idle      bool
+		onTimeout v1alpha2.DrainTimeoutPolicy
+		wantErr   bool
+		want      corev1.ConditionStatus
+	}{
+		{name: "idle", idle: true, onTimeout: v1alpha2.DrainTimeoutFail, want: corev1.ConditionTrue},
+		{name: "timeout fails the Backup", onTimeout: v1alpha2.DrainTimeoutFail, wantErr: true, want: corev1.ConditionFalse},
+		{name: "timeout backs up anyway", want: corev1.ConditionFalse},
+	} {
+		test := test
+		It(fmt.Sprintf("Should Set The ExecutorsDrained Condition (%s)", test.name), func() {
+			mockCtrl := gomock.NewController(GinkgoT())
+			defer mockCtrl.Finish()
+			jenkinsClient := jenkinsclient.NewMockJenkins(mockCtrl)
+			jenkinsClient.EXPECT().GetAllNodes().Return([]*gojenkins.Node{newNode("master", test.idle)}, nil).MinTimes(1)
+			backup := &v1alpha2.Backup{ObjectMeta: metav1.ObjectMeta{Name: "backup", Namespace: "jenkins"}}
+			backupStrategy := &v1alpha2.BackupStrategy{Spec: v1alpha2.BackupStrategySpec{
+				Drain: &v1alpha2.DrainConfig{Timeout: drainTimeout, PollInterval: pollInterval, OnTimeout: test.onTimeout},
+			}}
+			reconciler := &BackupReconciler{Client: fake.NewFakeClientWithScheme(scheme.Scheme, backup)}
+
+			err := reconciler.performJenkinsDrain(ctx, ctx, &lazyJenkinsClient{jenkinsClient: jenkinsClient}, backup, backupStrategy)
+
+			if test.wantErr {
+				Expect(err).To(HaveOccurred())
+			} else {
+				Expect(err).NotTo(HaveOccurred())
+			}
+			condition := backup.Status.Conditions.GetCondition(ExecutorsDrained)
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Status).To(Equal(test.want))
+		})
+	}
+
+	It("Should Stop When Cancelled During The Wait", func() {
+		mockCtrl := gomock.NewController(GinkgoT())
+		defer mockCtrl.Finish()
+		jenkinsClient := jenkinsclient.NewMockJenkins(mockCtrl)
+		jenkinsClient.EXPECT().GetAllNodes().Return([]*gojenkins.Node{newNode("master", false)}, nil).AnyTimes()
+		backup := &v1alpha2.Backup{ObjectMeta: metav1.ObjectMeta{Name: "backup", Namespace: "jenkins"}}
+		backupStrategy := &v1alpha2.BackupStrategy{Spec: v1alpha2.BackupStrategySpec{
+			Drain: &v1alpha2.DrainConfig{Timeout: &metav1.Duration{Duration: time.Minute}, PollInterval: pollInterval},
+		}}
+		fakeClient := fake.NewFakeClientWithScheme(scheme.Scheme, backup)
+		reconciler := &BackupReconciler{Client: fakeClient}
+		operation, cancel := context.WithCancel(ctx)
+		cancel()
+
+		err := reconciler.performJenkinsDrain(ctx, operation, &lazyJenkinsClient{jenkinsClient: jenkinsClient}, backup, backupStrategy)
+
+		Expect(err).To(Equal(context.Canceled))
+		stored := &v1alpha2.Backup{}
+		Expect(fakeClient.Get(ctx, types.NamespacedName{Name: "backup", Namespace: "jenkins"}, stored)).To(Succeed())
+		condition := stored.Status.Conditions.GetCondition(ExecutorsDrained)
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Status).To(Equal(corev1.ConditionFalse))
+		Expect(condition.Reason).To(Equal(DrainInterrupted))
+	})
+})
@@ -0,0 +1,295 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/jenkinsci/jenkins-automation-operator/api/v1alpha2"
+	"github.com/jenkinsci/jenkins-automation-operator/pkg/configuration/base/resources"
+	"github.com/jenkinsci/jenkins-automation-operator/pkg/exec"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const (
+	// BackupDataFinalizer deletes the data of a Backup from its BackupVolume when the Backup is deleted,
+	// unless its deletion policy is Retain
+	BackupDataFinalizer = "jenkins.io/backup-data"
+	// PrunedBackupAnnotation marks the Backups pruned by the retention of their BackupVolume, their data is deleted
+	// along with them whatever their deletion policy
+	PrunedBackupAnnotation = "jenkins.io/pruned"
+
+	backupCleanupContainerName = "cleanup"
+	backupCleanupVolumeName    = "backup-volume"
+	// backupCleanupRequeueDelay is the delay between two checks of the Pod deleting the data of a Backup
+	backupCleanupRequeueDelay = 10 * time.Second
+)
+
+// hasFinalizer returns true if the object has the finalizer
+func hasFinalizer(object metav1.Object, finalizer string) bool {
+	for _, f := range object.GetFinalizers() {
+		if f == finalizer {
+			return true
+		}
+	}
+	return false
+}
+
+// removeFinalizer removes the finalizer from the object
+func removeFinalizer(object metav1.Object, finalizer string) {
+	finalizers := []string{}
+	for _, f := range object.GetFinalizers() {
+		if f != finalizer {
+			finalizers = append(finalizers, f)
+		}
+	}
+	object.SetFinalizers(finalizers)
+}
+
+// isBackupDataRetainedByDefault returns true if the Backup was adopted from a BackupVolume, or was run before its
+// data was deleted along with it, the Backups without deletion policy used to keep their data
+func isBackupDataRetainedByDefault(backup *v1alpha2.Backup) bool {
+	if _, adopted := backup.Annotations[AdoptedBackupAnnotation]; adopted {
+		return true
+	}
+	return len(backup.Status.Phase) > 0 || len(backup.Status.Conditions) > 0
+}
+
+// isBackupPruned returns true if the Backup was pruned by the retention of its BackupVolume
+func isBackupPruned(backup *v1alpha2.Backup) bool {
+	_, pruned := backup.Annotations[PrunedBackupAnnotation]
+	return pruned
+}
+
+// finalizeBackup deletes the data of the deleted Backup according to its deletion policy, or because it was pruned,
+// then removes its finalizer
+func (r *BackupReconciler) finalizeBackup(ctx context.Context, backupLogger logr.Logger, backupInstance *v1alpha2.Backup) (ctrl.Result, error) {
+	if !hasFinalizer(backupInstance, BackupDataFinalizer) {
+		return ctrl.Result{}, nil
+	}
+	if backupInstance.Spec.DeletionPolicy == v1alpha2.BackupDeletionPolicyRetain && !isBackupPruned(backupInstance) {
+		backupLogger.Info(fmt.Sprintf("Keeping data of deleted Backup '%s'", backupInstance.Name))
+	} else {
+		replicasDeleted, err := r.deleteReplicasOfDeletedBackup(ctx, backupLogger, backupInstance)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		deleted, err := r.deleteDataOfDeletedBackup(ctx, backupLogger, backupInstance)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if !deleted || !replicasDeleted {
+			return ctrl.Result{RequeueAfter: backupCleanupRequeueDelay}, nil
+		}
+	}
+	removeFinalizer(backupInstance, BackupDataFinalizer)
+	return ctrl.Result{}, r.Client.Update(ctx, backupInstance)
+}
+
+// deleteDataOfDeletedBackup deletes the data of the Backup and returns true once it is deleted. The VolumeSnapshot of a
+// Backup is deleted directly. The data of a Backup stored in a volume is deleted through the backup sidecar of the
+// Jenkins Pod, or by a cleanup Pod mounting the volume when no running backup sidecar mounts it, e.g. when the Backups
+// of the Jenkins run in Jobs. When the BackupVolume, its bucket credentials or its PersistentVolumeClaim are gone, the
+// data can't be reached and is left as is.
+func (r *BackupReconciler) deleteDataOfDeletedBackup(ctx context.Context, backupLogger logr.Logger, backupInstance *v1alpha2.Backup) (bool, error) {
+	// The configurations exported to Git are kept in the history of the repository
+	if backupInstance.Status.GitExport != nil || len(backupInstance.Spec.BackupVolumeRef) == 0 {
+		return true, nil
+	}
+	if len(backupInstance.Status.VolumeSnapshot) > 0 {
+		gvk, err := getVolumeSnapshotGVK(r.RESTMapper)
+		if err != nil {
+			return false, err
+		}
+		return true, deleteVolumeSnapshot(ctx, r.Client, gvk, backupInstance.Namespace, backupInstance.Status.VolumeSnapshot)
+	}
+	backupVolume, err := getBackupVolume(ctx, r.Client, backupInstance)
+	if apierrors.IsNotFound(err) {
+		backupLogger.Info(fmt.Sprintf("BackupVolume '%s' of deleted Backup '%s' not found, its data is left as is", backupInstance.Spec.BackupVolumeRef, backupInstance.Name))
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if backupVolume.Spec.S3 != nil {
+		storage, err := newBackupStorage(ctx, r.Client, nil, nil, backupInstance, backupVolume)
+		if apierrors.IsNotFound(err) {
+			backupLogger.Info(fmt.Sprintf("Credentials of BackupVolume '%s' not found, data of deleted Backup '%s' is left as is", backupVolume.Name, backupInstance.Name))
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		return true, storage.delete(ctx)
+	}
+
+	jenkinsPod := r.getBackupVolumeJenkinsPod(ctx, backupInstance)
+	if jenkinsPod == nil {
+		return r.deleteBackupDataWithPod(ctx, backupLogger, getBackupCleanupPodName(backupInstance), backupInstance, backupVolume)
+	}
+	execClient := exec.NewKubeExecClient()
+	if err = execClient.InitKubeGoClient(); err != nil {
+		return false, err
+	}
+	storage, err := newBackupStorage(ctx, r.Client, execClient, jenkinsPod, backupInstance, backupVolume)
+	if err != nil {
+		return false, err
+	}
+	return true, storage.delete(ctx)
+}
+
+// deleteReplicasOfDeletedBackup deletes the copies of the Backup from its replicas and returns true once they are all
+// deleted. A copy stored in a volume is deleted through the backup sidecar of the Jenkins Pod, or by a cleanup Pod
+// mounting the volume when no backup sidecar mounts it, e.g. when the Backups of the Jenkins run in Jobs. The copies
+// which can't be reached anymore are left as is.
+func (r *BackupReconciler) deleteReplicasOfDeletedBackup(ctx context.Context, backupLogger logr.Logger, backupInstance *v1alpha2.Backup) (bool, error) {
+	var execClient exec.KubeExecClient
+	allDeleted := true
+	for _, replicaName := range getSucceededReplicas(backupInstance) {
+		replicaBackup := getReplicaBackup(backupInstance, replicaName)
+		replicaVolume, err := getBackupVolume(ctx, r.Client, replicaBackup)
+		if apierrors.IsNotFound(err) {
+			backupLogger.Info(fmt.Sprintf("Replica '%s' of deleted Backup '%s' not found, its copy is left as is", replicaName, backupInstance.Name))
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		var jenkinsPod *corev1.Pod
+		if replicaVolume.Spec.S3 == nil {
+			jenkinsPod = r.getBackupVolumeJenkinsPod(ctx, replicaBackup)
+			if jenkinsPod == nil {
+				deleted, err := r.deleteBackupDataWithPod(ctx, backupLogger, getReplicaCleanupPodName(backupInstance, replicaName), replicaBackup, replicaVolume)
+				if err != nil {
+					return false, err
+				}
+				allDeleted = allDeleted && deleted
+				continue
+			}
+			if execClient == nil {
+				execClient = exec.NewKubeExecClient()
+				if err = execClient.InitKubeGoClient(); err != nil {
+					return false, err
+				}
+			}
+		}
+		storage, err := newBackupStorage(ctx, r.Client, execClient, jenkinsPod, replicaBackup, replicaVolume)
+		if apierrors.IsNotFound(err) {
+			backupLogger.Info(fmt.Sprintf("Credentials of replica '%s' not found, copy of deleted Backup '%s' is left as is", replicaName, backupInstance.Name))
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		if err = storage.delete(ctx); err != nil {
+			return false, err
+		}
+	}
+	return allDeleted, nil
+}
+
+// getBackupVolumeJenkinsPod returns the running Pod of the Jenkins of the Backup if the BackupVolume is mounted in its
+// backup sidecar, nil otherwise
+func (r *BackupReconciler) getBackupVolumeJenkinsPod(ctx context.Context, backupInstance *v1alpha2.Backup) *corev1.Pod {
+	jenkins := &v1alpha2.Jenkins{}
+	err := r.Client.Get(ctx, types.NamespacedName{Name: backupInstance.Spec.JenkinsRef, Namespace: backupInstance.Namespace}, jenkins)
+	if err != nil || jenkins.DeletionTimestamp != nil {
+		return nil
+	}
+	if !isBackupVolumeMounted(jenkins, backupInstance.Spec.BackupVolumeRef) {
+		return nil
+	}
+	jenkinsPod, err := r.GetPodByDeployment(jenkins)
+	if err != nil || jenkinsPod.Status.Phase != corev1.PodRunning || jenkinsPod.DeletionTimestamp != nil {
+		return nil
+	}
+	return jenkinsPod
+}
+
+// deleteBackupDataWithPod deletes the directory of the Backup with the named Pod mounting the PersistentVolumeClaim of
+// the BackupVolume, it returns true once the Pod has succeeded
+func (r *BackupReconciler) deleteBackupDataWithPod(ctx context.Context, backupLogger logr.Logger, podName string, backupInstance *v1alpha2.Backup, backupVolume *v1alpha2.BackupVolume) (bool, error) {
+	cleanupPod := &corev1.Pod{}
+	err := r.Client.Get(ctx, types.NamespacedName{Name: podName, Namespace: backupInstance.Namespace}, cleanupPod)
+	if apierrors.IsNotFound(err) {
+		pvc := &corev1.PersistentVolumeClaim{}
+		err = r.Client.Get(ctx, types.NamespacedName{Name: getBackupVolumePVCName(backupVolume), Namespace: backupVolume.Namespace}, pvc)
+		if apierrors.IsNotFound(err) {
+			backupLogger.Info(fmt.Sprintf("PersistentVolumeClaim of BackupVolume '%s' not found, data of deleted Backup '%s' is left as is", backupVolume.Name, backupInstance.Name))
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		backupLogger.Info(fmt.Sprintf("No running backup sidecar mounts BackupVolume '%s', deleting data of deleted Backup '%s' with Pod '%s'", backupVolume.Name, backupInstance.Name, podName))
+		return false, r.Client.Create(ctx, newBackupCleanupPod(podName, backupInstance, backupVolume))
+	}
+	if err != nil {
+		return false, err
+	}
+
+	switch cleanupPod.Status.Phase {
+	case corev1.PodSucceeded:
+		// The Pod is kept until the other data of the Backup is deleted, it is garbage collected along with the Backup
+		return true, nil
+	case corev1.PodFailed:
+		// The Pod is created again at the next attempt
+		err = r.Client.Delete(ctx, cleanupPod)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return false, err
+		}
+		return false, fmt.Errorf("pod '%s' failed to delete data of Backup '%s'", cleanupPod.Name, backupInstance.Name)
+	}
+	return false, nil
+}
+
+// getBackupCleanupPodName returns the name of the Pod deleting the data of the Backup
+func getBackupCleanupPodName(backup *v1alpha2.Backup) string {
+	return backup.Name + "-cleanup"
+}
+
+// getReplicaCleanupPodName returns the name of the Pod deleting the copy of the Backup from the replica
+func getReplicaCleanupPodName(backup *v1alpha2.Backup, replicaName string) string {
+	return backup.Name + "-cleanup-" + replicaName
+}
+
+// newBackupCleanupPod returns the named Pod deleting the directory of the Backup from the PersistentVolumeClaim of the
+// BackupVolume, it is mounted at the same path as in the backup sidecar
+func newBackupCleanupPod(name string, backup *v1alpha2.Backup, backupVolume *v1alpha2.BackupVolume) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: backup.Namespace,
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(backup, v1alpha2.GroupVersion.WithKind("Backup")),
+			},
+		},
+		Spec: corev1.PodSpec{
+			RestartPolicy: corev1.RestartPolicyNever,
+			Containers: []corev1.Container{
+				{
+					Name:    backupCleanupContainerName,
+					Image:   resources.GetJenkinsBackupImage(),
+					Command: []string{"rm", "-rf", getBackupLocation(backup)},
+					VolumeMounts: []corev1.VolumeMount{
+						{Name: backupCleanupVolumeName, MountPath: resources.JenkinsBackupVolumePath + "/" + backupVolume.Name},
+					},
+				},
+			},
+			Volumes: []corev1.Volume{
+				{
+					Name: backupCleanupVolumeName,
+					VolumeSource: corev1.VolumeSource{
+						PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: getBackupVolumePVCName(backupVolume)},
+					},
+				},
+			},
+		},
+	}
+}
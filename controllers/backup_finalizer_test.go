@@ -0,0 +1,166 @@
+package controllers
+
+import (
+	"context"
+
+	"github.com/jenkinsci/jenkins-automation-operator/api/v1alpha2"
+	"github.com/jenkinsci/jenkins-automation-operator/pkg/log"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Backup data deletion", func() {
+	ctx := context.Background()
+	now := metav1.Now()
+	newDeletedBackup := func(deletionPolicy v1alpha2.BackupDeletionPolicy) *v1alpha2.Backup {
+		return &v1alpha2.Backup{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              "backup",
+				Namespace:         "jenkins",
+				DeletionTimestamp: &now,
+				Finalizers:        []string{BackupDataFinalizer},
+			},
+			Spec: v1alpha2.BackupSpec{JenkinsRef: "jenkins", BackupVolumeRef: "backup-volume", DeletionPolicy: deletionPolicy},
+		}
+	}
+	backupVolume := &v1alpha2.BackupVolume{ObjectMeta: metav1.ObjectMeta{Name: "backup-volume", Namespace: "jenkins"}}
+	pvc := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "backup-volume-jenkins-backup", Namespace: "jenkins"}}
+	cleanupPodName := types.NamespacedName{Name: "backup-cleanup", Namespace: "jenkins"}
+
+	BeforeEach(func() {
+		Expect(v1alpha2.AddToScheme(scheme.Scheme)).To(Succeed())
+	})
+
+	It("Should Retain The Data", func() {
+		backup := newDeletedBackup(v1alpha2.BackupDeletionPolicyRetain)
+		reconciler := &BackupReconciler{Client: fake.NewFakeClientWithScheme(scheme.Scheme, backup, backupVolume, pvc)}
+
+		result, err := reconciler.finalizeBackup(ctx, log.Log, backup)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(ctrl.Result{}))
+		Expect(backup.Finalizers).To(BeEmpty())
+		Expect(reconciler.Client.Get(ctx, cleanupPodName, &corev1.Pod{})).NotTo(Succeed())
+	})
+
+	It("Should Remove The Finalizer When The BackupVolume Is Gone", func() {
+		backup := newDeletedBackup(v1alpha2.BackupDeletionPolicyDelete)
+		reconciler := &BackupReconciler{Client: fake.NewFakeClientWithScheme(scheme.Scheme, backup)}
+
+		_, err := reconciler.finalizeBackup(ctx, log.Log, backup)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(backup.Finalizers).To(BeEmpty())
+	})
+
+	It("Should Remove The Finalizer When The PersistentVolumeClaim Is Gone", func() {
+		backup := newDeletedBackup("")
+		reconciler := &BackupReconciler{Client: fake.NewFakeClientWithScheme(scheme.Scheme, backup, backupVolume)}
+
+		_, err := reconciler.finalizeBackup(ctx, log.Log, backup)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(backup.Finalizers).To(BeEmpty())
+	})
+
+	It("Should Delete The VolumeSnapshot", func() {
+		backup := newDeletedBackup("")
+		backup.Status.VolumeSnapshot = "backup"
+		snapshot := newVolumeSnapshotWithStatus("backup", nil)
+		reconciler := &BackupReconciler{Client: fake.NewFakeClientWithScheme(scheme.Scheme, backup, snapshot), RESTMapper: newVolumeSnapshotMapper("v1")}
+
+		_, err := reconciler.finalizeBackup(ctx, log.Log, backup)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(backup.Finalizers).To(BeEmpty())
+		Expect(reconciler.Client.Get(ctx, types.NamespacedName{Name: "backup", Namespace: "jenkins"}, newVolumeSnapshotWithStatus("backup", nil))).NotTo(Succeed())
+	})
+
+	It("Should Delete The Data With A Cleanup Pod When Jenkins Runs Its Backups In Jobs", func() {
+		backup := newDeletedBackup("")
+		// The Pod of the Jenkins has no backup sidecar mounting the BackupVolume
+		jenkins := &v1alpha2.Jenkins{
+			ObjectMeta: metav1.ObjectMeta{Name: "jenkins", Namespace: "jenkins"},
+			Spec:       v1alpha2.JenkinsSpec{BackupVolumes: []string{"backup-volume"}, BackupRunner: v1alpha2.BackupRunnerJob},
+		}
+		reconciler := &BackupReconciler{Client: fake.NewFakeClientWithScheme(scheme.Scheme, backup, backupVolume, pvc, jenkins)}
+
+		result, err := reconciler.finalizeBackup(ctx, log.Log, backup)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(backupCleanupRequeueDelay))
+		Expect(reconciler.Client.Get(ctx, cleanupPodName, &corev1.Pod{})).To(Succeed())
+	})
+
+	It("Should Delete The Data With A Cleanup Pod When Jenkins Is Gone", func() {
+		backup := newDeletedBackup("")
+		reconciler := &BackupReconciler{Client: fake.NewFakeClientWithScheme(scheme.Scheme, backup, backupVolume, pvc)}
+
+		result, err := reconciler.finalizeBackup(ctx, log.Log, backup)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(backupCleanupRequeueDelay))
+		Expect(backup.Finalizers).To(Equal([]string{BackupDataFinalizer}))
+		cleanupPod := &corev1.Pod{}
+		Expect(reconciler.Client.Get(ctx, cleanupPodName, cleanupPod)).To(Succeed())
+		Expect(cleanupPod.Spec.Containers[0].Command).To(Equal([]string{"rm", "-rf", "/jenkins-backups/backup-volume/backup"}))
+		Expect(cleanupPod.Spec.Volumes[0].PersistentVolumeClaim.ClaimName).To(Equal("backup-volume-jenkins-backup"))
+
+		cleanupPod.Status.Phase = corev1.PodSucceeded
+		Expect(reconciler.Client.Status().Update(ctx, cleanupPod)).To(Succeed())
+
+		result, err = reconciler.finalizeBackup(ctx, log.Log, backup)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(ctrl.Result{}))
+		Expect(backup.Finalizers).To(BeEmpty())
+	})
+
+	It("Should Delete The Copy On A Replica With A Cleanup Pod When Jenkins Runs Its Backups In Jobs", func() {
+		backup := newDeletedBackup("")
+		backup.Status.Replicas = []v1alpha2.BackupReplica{{BackupVolume: "replica", Succeeded: true}}
+		replica := &v1alpha2.BackupVolume{ObjectMeta: metav1.ObjectMeta{Name: "replica", Namespace: "jenkins"}}
+		replicaPVC := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "replica-jenkins-backup", Namespace: "jenkins"}}
+		jenkins := &v1alpha2.Jenkins{
+			ObjectMeta: metav1.ObjectMeta{Name: "jenkins", Namespace: "jenkins"},
+			Spec:       v1alpha2.JenkinsSpec{BackupVolumes: []string{"backup-volume", "replica"}, BackupRunner: v1alpha2.BackupRunnerJob},
+		}
+		reconciler := &BackupReconciler{Client: fake.NewFakeClientWithScheme(scheme.Scheme, backup, backupVolume, pvc, replica, replicaPVC, jenkins)}
+		replicaCleanupPodName := types.NamespacedName{Name: "backup-cleanup-replica", Namespace: "jenkins"}
+
+		result, err := reconciler.finalizeBackup(ctx, log.Log, backup)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(backupCleanupRequeueDelay))
+		replicaCleanupPod := &corev1.Pod{}
+		Expect(reconciler.Client.Get(ctx, replicaCleanupPodName, replicaCleanupPod)).To(Succeed())
+		Expect(replicaCleanupPod.Spec.Containers[0].Command).To(Equal([]string{"rm", "-rf", "/jenkins-backups/replica/backup"}))
+		Expect(replicaCleanupPod.Spec.Volumes[0].PersistentVolumeClaim.ClaimName).To(Equal("replica-jenkins-backup"))
+		cleanupPod := &corev1.Pod{}
+		Expect(reconciler.Client.Get(ctx, cleanupPodName, cleanupPod)).To(Succeed())
+
+		cleanupPod.Status.Phase = corev1.PodSucceeded
+		Expect(reconciler.Client.Status().Update(ctx, cleanupPod)).To(Succeed())
+
+		result, err = reconciler.finalizeBackup(ctx, log.Log, backup)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(backupCleanupRequeueDelay), "the copy on the replica is not deleted yet")
+		Expect(backup.Finalizers).To(Equal([]string{BackupDataFinalizer}))
+
+		replicaCleanupPod.Status.Phase = corev1.PodSucceeded
+		Expect(reconciler.Client.Status().Update(ctx, replicaCleanupPod)).To(Succeed())
+
+		result, err = reconciler.finalizeBackup(ctx, log.Log, backup)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(ctrl.Result{}))
+		Expect(backup.Finalizers).To(BeEmpty())
+	})
+})
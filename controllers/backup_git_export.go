@@ -0,0 +1,453 @@
+package controllers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jenkinsci/jenkins-automation-operator/api/v1alpha2"
+	"github.com/jenkinsci/jenkins-automation-operator/pkg/constants"
+	"github.com/jenkinsci/jenkins-automation-operator/pkg/git"
+	"github.com/operator-framework/operator-lib/status"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// GitExportJobCommand is the argument with which the Operator binary commits the configurations in a git export Job
+	GitExportJobCommand = "git-export-job"
+	// GitExportFailed is the reason of the BackupCompleted condition when the configurations couldn't be committed
+	GitExportFailed status.ConditionReason = "GitExportFailed"
+	// GitKnownHostsKey is the key of the Secret of a GitExport BackupStrategy holding the host keys of the SSH server
+	GitKnownHostsKey = "known_hosts"
+
+	// gitExportImageEnvVar sets the image of the git export Jobs, which provides the git and ssh clients
+	gitExportImageEnvVar  = "JENKINS_GIT_EXPORT_IMAGE"
+	defaultGitExportImage = "docker.io/alpine/git:v2.30.2"
+	// gitExportInstallCommand copies the Operator binary to the path following it, so that the git export Job runs it
+	// in the git image
+	gitExportInstallCommand           = "install"
+	gitExportSpecEnvVar               = "GIT_EXPORT_SPEC"
+	gitExportInstallContainerName     = "install"
+	gitExportOperatorVolumeName       = "operator"
+	gitExportOperatorPath             = "/operator"
+	gitExportConfigurationsVolumeName = "configurations"
+	gitExportConfigurationsPath       = "/configurations"
+	gitExportConfigurationsKey        = "configurations.json.gz"
+	gitExportCredentialsVolumeName    = "credentials"
+	gitExportCredentialsPath          = "/credentials"
+	// maxSecretSize is the size limit of the data of a Secret
+	maxSecretSize = 1024 * 1024
+
+	defaultGitExportAuthorName = "Jenkins Operator"
+)
+
+// gitExportJobSpec describes the commit of a git export Job, it is passed as JSON in its environment
+type gitExportJobSpec struct {
+	URL         string `json:"url"`
+	Branch      string `json:"branch,omitempty"`
+	Directory   string `json:"directory"`
+	Subject     string `json:"subject"`
+	AuthorName  string `json:"authorName"`
+	AuthorEmail string `json:"authorEmail"`
+}
+
+// gitExportScript prints the config.xml files of Jenkins, of its jobs and of its folders, one per line as the path
+// relative to the Jenkins Home and the base64 encoded content separated by a tab. The branches of multibranch projects
+// are generated from their sources, their configurations are not exported.
+const gitExportScript = `
+def root = Jenkins.instance.rootDir
+def export = { File file ->
+    if (file.isFile()) {
+        println root.toURI().relativize(file.toURI()).path + '\t' + file.bytes.encodeBase64()
+    }
+}
+def exportJobs
+exportJobs = { File jobs ->
+    jobs.listFiles()?.findAll { it.isDirectory() }?.sort()?.each { File job ->
+        export(new File(job, 'config.xml'))
+        exportJobs(new File(job, 'jobs'))
+    }
+}
+export(new File(root, 'config.xml'))
+exportJobs(new File(root, 'jobs'))
+`
+
+// isGitExportStrategy returns true if the Backups of the BackupStrategy commit the configurations to a Git repository
+func isGitExportStrategy(backupStrategy *v1alpha2.BackupStrategy) bool {
+	return backupStrategy.Spec.Type == v1alpha2.BackupStrategyGitExport
+}
+
+func (r *BackupReconciler) performJenkinsGitExport(ctx context.Context, jenkinsClient *lazyJenkinsClient, jenkinsInstance *v1alpha2.Jenkins, backupInstance *v1alpha2.Backup, backupStrategy *v1alpha2.BackupStrategy) error {
+	err := exportJenkinsConfigurations(ctx, r.Client, jenkinsClient, jenkinsInstance, backupInstance, backupStrategy)
+	if err != nil {
+		err = fmt.Errorf("failed to export configurations to Git: %s", err)
+		backupInstance.Status.Conditions.SetCondition(status.Condition{
+			Type:    BackupCompleted,
+			Status:  corev1.ConditionFalse,
+			Reason:  GitExportFailed,
+			Message: err.Error(),
+		})
+		updateErr := r.Client.Status().Update(ctx, backupInstance)
+		if updateErr != nil {
+			return updateErr
+		}
+		return err
+	}
+	return nil
+}
+
+// exportJenkinsConfigurations reads the configurations of Jenkins through the script console and commits them to the
+// Git repository of the BackupStrategy in a git export Job, the commit is recorded in the status of the Backup. The
+// configurations are handed to the Job in a Secret owned by the Backup, which is deleted once the Job is done.
+func exportJenkinsConfigurations(ctx context.Context, c client.Client, jenkinsClient *lazyJenkinsClient, jenkins *v1alpha2.Jenkins, backup *v1alpha2.Backup, backupStrategy *v1alpha2.BackupStrategy) error {
+	gitExport := backupStrategy.Spec.GitExport
+	if gitExport == nil {
+		return errors.New("gitExport is required by a GitExport BackupStrategy")
+	}
+	// The Job would fail until its Secret is fixed
+	if _, err := getGitExportCredentials(ctx, c, backupStrategy); err != nil {
+		return err
+	}
+	jenkinsAPI, err := jenkinsClient.get()
+	if err != nil {
+		return err
+	}
+	output, err := jenkinsAPI.ExecuteScript(gitExportScript)
+	if err != nil {
+		return fmt.Errorf("failed to read the configurations: %s", err)
+	}
+	files, err := parseGitExportFiles(output)
+	if err != nil {
+		return err
+	}
+	secret, err := newGitExportSecret(backup, files)
+	if err != nil {
+		return err
+	}
+	if err = c.Create(ctx, secret); err != nil && !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+	image, command, err := getBackupJobImage(ctx, c)
+	if err != nil {
+		return err
+	}
+	job, err := newGitExportJob(backup, backupStrategy, newGitExportJobSpec(jenkins, backup, backupStrategy), image, command, getGitExportImage())
+	if err != nil {
+		return err
+	}
+	backup.Status.Job = job.Name
+	if err = c.Status().Update(ctx, backup); err != nil {
+		return err
+	}
+	result, err := runBackupJob(ctx, c, job, backupJobPollInterval, getBackupJobActiveDeadline(backupStrategy)+time.Minute)
+	if err != nil {
+		return err
+	}
+	if err = c.Delete(ctx, secret); err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	if len(result.Error) > 0 {
+		return errors.New(result.Error)
+	}
+	branch := gitExport.Branch
+	if len(branch) == 0 {
+		branch = git.DefaultBranch
+	}
+	backup.Status.GitExport = &v1alpha2.GitExportStatus{URL: gitExport.URL, Branch: branch, Commit: result.Commit, Changes: result.Changes}
+	backup.Status.FileCount = result.FileCount
+	return nil
+}
+
+// newGitExportJobSpec returns the spec of the git export Job committing the configurations of the Jenkins
+func newGitExportJobSpec(jenkins *v1alpha2.Jenkins, backup *v1alpha2.Backup, backupStrategy *v1alpha2.BackupStrategy) *gitExportJobSpec {
+	gitExport := backupStrategy.Spec.GitExport
+	spec := &gitExportJobSpec{
+		URL:         gitExport.URL,
+		Branch:      gitExport.Branch,
+		Directory:   gitExport.Directory,
+		Subject:     fmt.Sprintf("Export configurations of Jenkins '%s/%s' by Backup '%s'", jenkins.Namespace, jenkins.Name, backup.Name),
+		AuthorName:  gitExport.AuthorName,
+		AuthorEmail: gitExport.AuthorEmail,
+	}
+	if len(spec.Directory) == 0 {
+		spec.Directory = path.Join(jenkins.Namespace, jenkins.Name)
+	}
+	if len(spec.AuthorName) == 0 {
+		spec.AuthorName = defaultGitExportAuthorName
+	}
+	if len(spec.AuthorEmail) == 0 {
+		spec.AuthorEmail = "jenkins-operator@" + backupStrategy.Namespace
+	}
+	return spec
+}
+
+// getGitExportCredentials returns the credentials of the Secret of the BackupStrategy authenticating to the Git
+// repository
+func getGitExportCredentials(ctx context.Context, c client.Client, backupStrategy *v1alpha2.BackupStrategy) (git.Credentials, error) {
+	gitExport := backupStrategy.Spec.GitExport
+	credentials := git.Credentials{}
+	if len(gitExport.CredentialsSecretRef) == 0 {
+		return credentials, nil
+	}
+	secret := &corev1.Secret{}
+	err := c.Get(ctx, types.NamespacedName{Name: gitExport.CredentialsSecretRef, Namespace: backupStrategy.Namespace}, secret)
+	if err != nil {
+		return credentials, err
+	}
+	credentials.Username = string(secret.Data[corev1.BasicAuthUsernameKey])
+	credentials.Password = string(secret.Data[corev1.BasicAuthPasswordKey])
+	credentials.SSHPrivateKey = secret.Data[corev1.SSHAuthPrivateKey]
+	credentials.KnownHosts = secret.Data[GitKnownHostsKey]
+	if len(credentials.Password) == 0 && len(credentials.SSHPrivateKey) == 0 {
+		return credentials, fmt.Errorf("secret '%s' must contain the %s and %s keys, or the %s key", gitExport.CredentialsSecretRef,
+			corev1.BasicAuthUsernameKey, corev1.BasicAuthPasswordKey, corev1.SSHAuthPrivateKey)
+	}
+	if len(credentials.SSHPrivateKey) > 0 && len(credentials.KnownHosts) == 0 {
+		return credentials, fmt.Errorf("secret '%s' must contain the %s key along with the %s key, the host keys of the SSH server are always checked",
+			gitExport.CredentialsSecretRef, GitKnownHostsKey, corev1.SSHAuthPrivateKey)
+	}
+	return credentials, nil
+}
+
+// getGitExportImage returns the image of the git export Jobs
+func getGitExportImage() string {
+	if image, found := os.LookupEnv(gitExportImageEnvVar); found && len(image) > 0 {
+		return image
+	}
+	return defaultGitExportImage
+}
+
+// newGitExportSecret returns the Secret handing the configurations to the git export Job of the Backup, as gzipped JSON
+func newGitExportSecret(backup *v1alpha2.Backup, files map[string][]byte) (*corev1.Secret, error) {
+	content := &bytes.Buffer{}
+	writer := gzip.NewWriter(content)
+	if err := json.NewEncoder(writer).Encode(files); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	if content.Len() > maxSecretSize {
+		return nil, fmt.Errorf("the configurations take %d bytes once compressed, above the %d bytes a Secret can hold", content.Len(), maxSecretSize)
+	}
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      getBackupJobName(backup.Name, backupJobGitExport),
+			Namespace: backup.Namespace,
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(backup, v1alpha2.GroupVersion.WithKind("Backup")),
+			},
+		},
+		Data: map[string][]byte{gitExportConfigurationsKey: content.Bytes()},
+	}, nil
+}
+
+// newGitExportJob returns the Job committing the configurations of the Secret of the Backup in the git image. Its init
+// container copies the Operator binary from the Operator image, the git image runs it with the git and ssh clients.
+func newGitExportJob(backup *v1alpha2.Backup, backupStrategy *v1alpha2.BackupStrategy, spec *gitExportJobSpec, image string, command []string, gitImage string) (*batchv1.Job, error) {
+	specContent, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+	name := getBackupJobName(backup.Name, backupJobGitExport)
+	binary := gitExportOperatorPath + "/" + operatorContainerName
+	volumeMounts := []corev1.VolumeMount{
+		{Name: gitExportOperatorVolumeName, MountPath: gitExportOperatorPath, ReadOnly: true},
+		{Name: gitExportConfigurationsVolumeName, MountPath: gitExportConfigurationsPath, ReadOnly: true},
+	}
+	volumes := []corev1.Volume{
+		{Name: gitExportOperatorVolumeName, VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+		{Name: gitExportConfigurationsVolumeName, VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: name}}},
+	}
+	if secretName := backupStrategy.Spec.GitExport.CredentialsSecretRef; len(secretName) > 0 {
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{Name: gitExportCredentialsVolumeName, MountPath: gitExportCredentialsPath, ReadOnly: true})
+		volumes = append(volumes, corev1.Volume{Name: gitExportCredentialsVolumeName, VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: secretName}}})
+	}
+	labels := map[string]string{constants.LabelJenkinsCRKey: backup.Spec.JenkinsRef}
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: backup.Namespace,
+			Labels:    labels,
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(backup, v1alpha2.GroupVersion.WithKind("Backup")),
+			},
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:          pointer.Int32Ptr(0),
+			ActiveDeadlineSeconds: pointer.Int64Ptr(int64(getBackupJobActiveDeadline(backupStrategy).Seconds())),
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					RestartPolicy:                corev1.RestartPolicyNever,
+					AutomountServiceAccountToken: pointer.BoolPtr(false),
+					InitContainers: []corev1.Container{
+						{
+							Name:            gitExportInstallContainerName,
+							Image:           image,
+							ImagePullPolicy: corev1.PullIfNotPresent,
+							Command:         command,
+							Args:            []string{GitExportJobCommand, gitExportInstallCommand, binary},
+							VolumeMounts:    []corev1.VolumeMount{{Name: gitExportOperatorVolumeName, MountPath: gitExportOperatorPath}},
+						},
+					},
+					Containers: []corev1.Container{
+						{
+							Name:                     backupJobContainerName,
+							Image:                    gitImage,
+							ImagePullPolicy:          corev1.PullIfNotPresent,
+							Command:                  []string{binary, GitExportJobCommand},
+							Env:                      []corev1.EnvVar{{Name: gitExportSpecEnvVar, Value: string(specContent)}},
+							VolumeMounts:             volumeMounts,
+							TerminationMessagePolicy: corev1.TerminationMessageReadFile,
+						},
+					},
+					Volumes: volumes,
+				},
+			},
+		},
+	}, nil
+}
+
+// RunGitExportJob commits the configurations mounted in the git export Job as described by its environment, writes
+// its result to the termination message of the container and returns the exit code of the Job. With the install
+// command, it copies the Operator binary for the git export Job instead.
+func RunGitExportJob(args []string) int {
+	if len(args) == 2 && args[0] == gitExportInstallCommand {
+		if err := installOperatorBinary(args[1]); err != nil {
+			logger.Error(err, "Failed to copy the Operator binary")
+			return 1
+		}
+		return 0
+	}
+	return writeBackupJobResult(runGitExportJobSpec(context.Background(), os.Getenv(gitExportSpecEnvVar), gitExportConfigurationsPath, gitExportCredentialsPath))
+}
+
+// installOperatorBinary copies the running binary to the path
+func installOperatorBinary(target string) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	source, err := os.Open(executable)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	destination, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(destination, source); err != nil {
+		_ = destination.Close()
+		return err
+	}
+	return destination.Close()
+}
+
+// runGitExportJobSpec commits the configurations of the configurations directory as described by the JSON spec, with
+// the credentials of the credentials directory
+func runGitExportJobSpec(ctx context.Context, specContent, configurationsDirectory, credentialsDirectory string) *backupJobResult {
+	spec := &gitExportJobSpec{}
+	if err := json.Unmarshal([]byte(specContent), spec); err != nil {
+		return &backupJobResult{Error: fmt.Sprintf("invalid %s: %s", gitExportSpecEnvVar, err)}
+	}
+	files, err := readGitExportConfigurations(filepath.Join(configurationsDirectory, gitExportConfigurationsKey))
+	if err != nil {
+		return &backupJobResult{Error: fmt.Sprintf("failed to read the configurations: %s", err)}
+	}
+	credentials, err := readGitExportCredentials(credentialsDirectory)
+	if err != nil {
+		return &backupJobResult{Error: fmt.Sprintf("failed to read the credentials: %s", err)}
+	}
+	repository, err := git.NewRepository(spec.URL, spec.Branch, credentials, git.Author{Name: spec.AuthorName, Email: spec.AuthorEmail})
+	if err != nil {
+		return &backupJobResult{Error: err.Error()}
+	}
+	commit, err := repository.Export(ctx, spec.Directory, files, spec.Subject)
+	if err != nil {
+		return &backupJobResult{Error: err.Error()}
+	}
+	result := &backupJobResult{FileCount: int64(len(files))}
+	if commit != nil {
+		result.Commit = commit.Hash
+		result.Changes = commit.Changes
+	}
+	return result
+}
+
+// readGitExportConfigurations returns the configurations written by newGitExportSecret, keyed by their path
+func readGitExportConfigurations(name string) (map[string][]byte, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, err
+	}
+	files := map[string][]byte{}
+	if err = json.NewDecoder(reader).Decode(&files); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// readGitExportCredentials returns the credentials of the Secret mounted in the directory, the missing keys are empty
+func readGitExportCredentials(directory string) (git.Credentials, error) {
+	values := map[string][]byte{}
+	for _, key := range []string{corev1.BasicAuthUsernameKey, corev1.BasicAuthPasswordKey, corev1.SSHAuthPrivateKey, GitKnownHostsKey} {
+		content, err := ioutil.ReadFile(filepath.Join(directory, key))
+		if err != nil && !os.IsNotExist(err) {
+			return git.Credentials{}, err
+		}
+		values[key] = content
+	}
+	return git.Credentials{
+		Username:      string(values[corev1.BasicAuthUsernameKey]),
+		Password:      string(values[corev1.BasicAuthPasswordKey]),
+		SSHPrivateKey: values[corev1.SSHAuthPrivateKey],
+		KnownHosts:    values[GitKnownHostsKey],
+	}, nil
+}
+
+// parseGitExportFiles returns the files printed by gitExportScript, keyed by their path relative to the Jenkins Home.
+// The lines which aren't files, such as the verifier of the script console, are ignored.
+func parseGitExportFiles(output string) (map[string][]byte, error) {
+	files := map[string][]byte{}
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimRight(line, "\r")
+		separator := strings.LastIndex(line, "\t")
+		if separator <= 0 {
+			continue
+		}
+		name := line[:separator]
+		content, err := base64.StdEncoding.DecodeString(line[separator+1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid content of file '%s': %s", name, err)
+		}
+		files[name] = content
+	}
+	if _, ok := files["config.xml"]; !ok {
+		return nil, errors.New("the configuration of Jenkins was not found in the output of the script console")
+	}
+	return files, nil
+}
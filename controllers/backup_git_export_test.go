@@ -0,0 +1,315 @@
+package controllers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/golang/mock/gomock"
+	"github.com/jenkinsci/jenkins-automation-operator/api/v1alpha2"
+	jenkinsclient "github.com/jenkinsci/jenkins-automation-operator/pkg/client"
+	"github.com/jenkinsci/jenkins-automation-operator/pkg/configuration/base/resources"
+	"github.com/jenkinsci/jenkins-automation-operator/pkg/git"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// newGitExportOutput returns the output of gitExportScript for the files, followed by the verifier of the script console
+func newGitExportOutput(files map[string]string) string {
+	output := ""
+	for name, content := range files {
+		output += name + "\t" + base64.StdEncoding.EncodeToString([]byte(content)) + "\n"
+	}
+	return output + "verifier-1\n"
+}
+
+var _ = Describe("Git export files parsing", func() {
+	It("Should Decode The Exported Files", func() {
+		files, err := parseGitExportFiles(newGitExportOutput(map[string]string{
+			"config.xml":                    "<hudson/>",
+			"jobs/folder/jobs/a/config.xml": "<project/>",
+		}))
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(files).To(Equal(map[string][]byte{
+			"config.xml":                    []byte("<hudson/>"),
+			"jobs/folder/jobs/a/config.xml": []byte("<project/>"),
+		}))
+	})
+
+	It("Should Fail Without The Jenkins Configuration", func() {
+		_, err := parseGitExportFiles("verifier-1\n")
+
+		Expect(err).To(MatchError("the configuration of Jenkins was not found in the output of the script console"))
+	})
+
+	It("Should Fail With Invalid Content", func() {
+		_, err := parseGitExportFiles("config.xml\t<hudson/>\n")
+
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("invalid content of file 'config.xml'"))
+	})
+})
+
+var _ = Describe("Jenkins configurations export", func() {
+	ctx := context.Background()
+	jenkins := &v1alpha2.Jenkins{ObjectMeta: metav1.ObjectMeta{Name: "example", Namespace: "jenkins"}}
+	backupStrategy := &v1alpha2.BackupStrategy{
+		ObjectMeta: metav1.ObjectMeta{Name: "git", Namespace: "jenkins"},
+		Spec: v1alpha2.BackupStrategySpec{
+			Type:      v1alpha2.BackupStrategyGitExport,
+			GitExport: &v1alpha2.GitExportConfig{URL: "https://git.example.com/jenkins-config.git"},
+		},
+	}
+	// newFinishedJob returns the git export Job of the Backup, finished with the result
+	newFinishedJob := func(result string) []runtime.Object {
+		return []runtime.Object{
+			&batchv1.Job{
+				ObjectMeta: metav1.ObjectMeta{Name: "backup-git-export", Namespace: "jenkins"},
+				Status:     batchv1.JobStatus{Conditions: []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}},
+			},
+			&corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "backup-git-export-x1", Namespace: "jenkins", Labels: map[string]string{"job-name": "backup-git-export"}},
+				Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{
+					{Name: backupJobContainerName, State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Message: result}}},
+				}},
+			},
+		}
+	}
+	export := func(c client.Client, backup *v1alpha2.Backup) error {
+		mockCtrl := gomock.NewController(GinkgoT())
+		defer mockCtrl.Finish()
+		jenkinsClient := jenkinsclient.NewMockJenkins(mockCtrl)
+		jenkinsClient.EXPECT().ExecuteScript(gitExportScript).Return(newGitExportOutput(map[string]string{"config.xml": "<hudson/>"}), nil)
+
+		return exportJenkinsConfigurations(ctx, c, &lazyJenkinsClient{jenkinsClient: jenkinsClient}, jenkins, backup, backupStrategy)
+	}
+
+	BeforeEach(func() {
+		Expect(v1alpha2.AddToScheme(scheme.Scheme)).To(Succeed())
+		Expect(os.Setenv(resources.JenkinsBackupJobImageEnvVar, "jenkins-operator:test")).To(Succeed())
+	})
+
+	AfterEach(func() {
+		Expect(os.Unsetenv(resources.JenkinsBackupJobImageEnvVar)).To(Succeed())
+	})
+
+	It("Should Record The Commit", func() {
+		backup := &v1alpha2.Backup{ObjectMeta: metav1.ObjectMeta{Name: "backup", Namespace: "jenkins"}}
+		c := fake.NewFakeClientWithScheme(scheme.Scheme, append(newFinishedJob(`{"fileCount":1,"commit":"abc123","changes":["A\tjenkins/example/config.xml"]}`), backup)...)
+
+		err := export(c, backup)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(backup.Status.GitExport).To(Equal(&v1alpha2.GitExportStatus{
+			URL:     "https://git.example.com/jenkins-config.git",
+			Branch:  "main",
+			Commit:  "abc123",
+			Changes: []string{"A\tjenkins/example/config.xml"},
+		}))
+		Expect(backup.Status.FileCount).To(Equal(int64(1)))
+		Expect(backup.Status.Job).To(Equal("backup-git-export"))
+		// The configurations are not kept once committed
+		Expect(apierrors.IsNotFound(c.Get(ctx, types.NamespacedName{Name: "backup-git-export", Namespace: "jenkins"}, &corev1.Secret{}))).To(BeTrue())
+	})
+
+	It("Should Fail When The Job Failed", func() {
+		backup := &v1alpha2.Backup{ObjectMeta: metav1.ObjectMeta{Name: "backup", Namespace: "jenkins"}}
+		c := fake.NewFakeClientWithScheme(scheme.Scheme, append(newFinishedJob(`{"error":"git push failed"}`), backup)...)
+
+		err := export(c, backup)
+
+		Expect(err).To(MatchError("git push failed"))
+		Expect(backup.Status.GitExport).To(BeNil())
+	})
+})
+
+var _ = Describe("Git export Job spec", func() {
+	ctx := context.Background()
+	jenkins := &v1alpha2.Jenkins{ObjectMeta: metav1.ObjectMeta{Name: "example", Namespace: "jenkins"}}
+	var (
+		tempDir        string
+		bare           string
+		backupStrategy *v1alpha2.BackupStrategy
+		firstResult    *backupJobResult
+	)
+	// export runs the git export Job of the Backup on the configurations mounted from its Secret
+	export := func(backupName string, files map[string]string) *backupJobResult {
+		backup := &v1alpha2.Backup{ObjectMeta: metav1.ObjectMeta{Name: backupName, Namespace: "jenkins"}}
+		contents := map[string][]byte{}
+		for name, content := range files {
+			contents[name] = []byte(content)
+		}
+		secret, err := newGitExportSecret(backup, contents)
+		Expect(err).NotTo(HaveOccurred())
+		configurations := filepath.Join(tempDir, backupName)
+		Expect(os.Mkdir(configurations, 0700)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(configurations, gitExportConfigurationsKey), secret.Data[gitExportConfigurationsKey], 0600)).To(Succeed())
+		spec, err := json.Marshal(newGitExportJobSpec(jenkins, backup, backupStrategy))
+		Expect(err).NotTo(HaveOccurred())
+
+		return runGitExportJobSpec(ctx, string(spec), configurations, filepath.Join(tempDir, "credentials"))
+	}
+
+	BeforeEach(func() {
+		var err error
+		tempDir, err = ioutil.TempDir("", "git-export")
+		Expect(err).NotTo(HaveOccurred())
+		bare = filepath.Join(tempDir, "config.git")
+		Expect(exec.Command("git", "init", "-q", "--bare", bare).Run()).To(Succeed())
+		backupStrategy = &v1alpha2.BackupStrategy{
+			ObjectMeta: metav1.ObjectMeta{Name: "git", Namespace: "jenkins"},
+			Spec: v1alpha2.BackupStrategySpec{
+				Type:      v1alpha2.BackupStrategyGitExport,
+				GitExport: &v1alpha2.GitExportConfig{URL: bare},
+			},
+		}
+		firstResult = export("first", map[string]string{"config.xml": "<hudson/>", "jobs/a/config.xml": "<project/>"})
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tempDir)).To(Succeed())
+	})
+
+	It("Should Commit The First Export", func() {
+		Expect(firstResult.Error).To(BeEmpty())
+		Expect(firstResult.Commit).NotTo(BeEmpty())
+		Expect(firstResult.Changes).To(Equal([]string{"A\tjenkins/example/config.xml", "A\tjenkins/example/jobs/a/config.xml"}))
+		Expect(firstResult.FileCount).To(Equal(int64(2)))
+		output, err := exec.Command("git", "--git-dir", bare, "log", "-1", "--format=%an <%ae>%n%s", "main").Output()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(strings.TrimSpace(string(output))).To(Equal("Jenkins Operator <jenkins-operator@jenkins>\nExport configurations of Jenkins 'jenkins/example' by Backup 'first'"))
+	})
+
+	It("Should Not Commit Unchanged Configurations", func() {
+		result := export("second", map[string]string{"config.xml": "<hudson/>", "jobs/a/config.xml": "<project/>"})
+
+		Expect(result.Error).To(BeEmpty())
+		Expect(result.Commit).To(BeEmpty())
+		Expect(result.Changes).To(BeEmpty())
+	})
+
+	It("Should Commit A Deleted Job", func() {
+		result := export("second", map[string]string{"config.xml": "<hudson/>"})
+
+		Expect(result.Error).To(BeEmpty())
+		Expect(result.Changes).To(Equal([]string{"D\tjenkins/example/jobs/a/config.xml"}))
+	})
+
+	It("Should Fail With An Invalid Spec", func() {
+		result := runGitExportJobSpec(ctx, "{", tempDir, tempDir)
+
+		Expect(result.Error).To(ContainSubstring("invalid GIT_EXPORT_SPEC"))
+	})
+})
+
+var _ = Describe("Git export credentials files", func() {
+	It("Should Read The Mounted Credentials", func() {
+		tempDir, err := ioutil.TempDir("", "git-credentials")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(tempDir)
+		Expect(ioutil.WriteFile(filepath.Join(tempDir, corev1.SSHAuthPrivateKey), []byte("key"), 0600)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(tempDir, GitKnownHostsKey), []byte("git.example.com ssh-ed25519 AAAA"), 0600)).To(Succeed())
+
+		credentials, err := readGitExportCredentials(tempDir)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(credentials).To(Equal(git.Credentials{SSHPrivateKey: []byte("key"), KnownHosts: []byte("git.example.com ssh-ed25519 AAAA")}))
+	})
+})
+
+var _ = Describe("Git export Job", func() {
+	It("Should Install The Operator Binary Into The Git Image", func() {
+		backup := &v1alpha2.Backup{ObjectMeta: metav1.ObjectMeta{Name: "backup", Namespace: "jenkins"}, Spec: v1alpha2.BackupSpec{JenkinsRef: "example"}}
+		backupStrategy := &v1alpha2.BackupStrategy{
+			ObjectMeta: metav1.ObjectMeta{Name: "git", Namespace: "jenkins"},
+			Spec: v1alpha2.BackupStrategySpec{
+				Type:      v1alpha2.BackupStrategyGitExport,
+				GitExport: &v1alpha2.GitExportConfig{URL: "git@git.example.com:jenkins-config.git", CredentialsSecretRef: "git-credentials"},
+			},
+		}
+
+		job, err := newGitExportJob(backup, backupStrategy, &gitExportJobSpec{URL: backupStrategy.Spec.GitExport.URL}, "jenkins-operator:test", []string{"/manager"}, defaultGitExportImage)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(job.Name).To(Equal("backup-git-export"))
+		podSpec := job.Spec.Template.Spec
+		install := podSpec.InitContainers[0]
+		Expect(install.Image).To(Equal("jenkins-operator:test"))
+		Expect(install.Command).To(Equal([]string{"/manager"}))
+		Expect(install.Args).To(Equal([]string{GitExportJobCommand, gitExportInstallCommand, "/operator/manager"}))
+		container := podSpec.Containers[0]
+		Expect(container.Image).To(Equal(defaultGitExportImage))
+		Expect(container.Command).To(Equal([]string{"/operator/manager", GitExportJobCommand}))
+		Expect(podSpec.Volumes[1].Secret.SecretName).To(Equal("backup-git-export"))
+		Expect(podSpec.Volumes[2].Secret.SecretName).To(Equal("git-credentials"))
+		Expect(container.VolumeMounts[2].MountPath).To(Equal(gitExportCredentialsPath))
+	})
+})
+
+var _ = Describe("Git export credentials", func() {
+	ctx := context.Background()
+	backupStrategy := &v1alpha2.BackupStrategy{
+		ObjectMeta: metav1.ObjectMeta{Name: "git", Namespace: "jenkins"},
+		Spec: v1alpha2.BackupStrategySpec{
+			Type:      v1alpha2.BackupStrategyGitExport,
+			GitExport: &v1alpha2.GitExportConfig{URL: "https://git.example.com/jenkins-config.git", CredentialsSecretRef: "git-credentials"},
+		},
+	}
+	newSecret := func(data map[string][]byte) *corev1.Secret {
+		return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "git-credentials", Namespace: "jenkins"}, Data: data}
+	}
+
+	It("Should Read Basic Auth Credentials", func() {
+		secret := newSecret(map[string][]byte{corev1.BasicAuthUsernameKey: []byte("jenkins"), corev1.BasicAuthPasswordKey: []byte("token")})
+
+		credentials, err := getGitExportCredentials(ctx, fake.NewFakeClientWithScheme(scheme.Scheme, secret), backupStrategy)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(credentials.Password).To(Equal("token"))
+	})
+
+	It("Should Fail Without Credentials", func() {
+		_, err := getGitExportCredentials(ctx, fake.NewFakeClientWithScheme(scheme.Scheme, newSecret(nil)), backupStrategy)
+
+		Expect(err).To(MatchError("secret 'git-credentials' must contain the username and password keys, or the ssh-privatekey key"))
+	})
+
+	It("Should Fail With An SSH Private Key Without Known Hosts", func() {
+		secret := newSecret(map[string][]byte{corev1.SSHAuthPrivateKey: []byte("key")})
+
+		_, err := getGitExportCredentials(ctx, fake.NewFakeClientWithScheme(scheme.Scheme, secret), backupStrategy)
+
+		Expect(err).To(MatchError("secret 'git-credentials' must contain the known_hosts key along with the ssh-privatekey key, the host keys of the SSH server are always checked"))
+	})
+})
+
+var _ = Describe("Operator binary installation", func() {
+	It("Should Copy The Operator Binary", func() {
+		tempDir, err := ioutil.TempDir("", "git-export-install")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(tempDir)
+		target := filepath.Join(tempDir, "manager")
+
+		Expect(installOperatorBinary(target)).To(Succeed())
+
+		info, err := os.Stat(target)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Mode() & 0100).NotTo(BeZero())
+		Expect(info.Size()).NotTo(BeZero())
+	})
+})
@@ -0,0 +1,190 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jenkinsci/jenkins-automation-operator/api/v1alpha2"
+	jenkinsclient "github.com/jenkinsci/jenkins-automation-operator/pkg/client"
+	"github.com/jenkinsci/jenkins-automation-operator/pkg/configuration/base/resources"
+	"github.com/jenkinsci/jenkins-automation-operator/pkg/exec"
+	"github.com/operator-framework/operator-lib/status"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// HookFailed is the reason of a hooks condition when a script failed
+	HookFailed status.ConditionReason = "HookFailed"
+
+	serviceAccountTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	// maxHookOutputLength is the number of characters of the end of the output of a script kept in the status
+	maxHookOutputLength = 1024
+)
+
+// lazyJenkinsClient creates the client of the Jenkins API when it is first needed, as most Backups and Restores don't use it
+type lazyJenkinsClient struct {
+	newJenkinsClient func() (jenkinsclient.Jenkins, error)
+	jenkinsClient    jenkinsclient.Jenkins
+}
+
+// newLazyJenkinsClient returns a lazyJenkinsClient for the Jenkins Pod, authenticated with the token of its service account
+func newLazyJenkinsClient(ctx context.Context, c client.Client, execClient exec.KubeExecClient, jenkins *v1alpha2.Jenkins, jenkinsPod *corev1.Pod, resourceName string) *lazyJenkinsClient {
+	return &lazyJenkinsClient{
+		newJenkinsClient: func() (jenkinsclient.Jenkins, error) {
+			return newJenkinsClient(ctx, c, execClient, jenkins, jenkinsPod, resourceName)
+		},
+	}
+}
+
+// newServiceAccountLazyJenkinsClient returns a lazyJenkinsClient for the Jenkins Pod, authenticated with the token of its
+// service account read from the token Secret, for Jenkins Pods without backup sidecar
+func newServiceAccountLazyJenkinsClient(ctx context.Context, c client.Client, jenkins *v1alpha2.Jenkins, jenkinsPod *corev1.Pod) *lazyJenkinsClient {
+	return &lazyJenkinsClient{
+		newJenkinsClient: func() (jenkinsclient.Jenkins, error) {
+			token, err := getServiceAccountToken(ctx, c, jenkinsPod)
+			if err != nil {
+				return nil, err
+			}
+			return newJenkinsClientWithToken(ctx, c, jenkins, token)
+		},
+	}
+}
+
+func (l *lazyJenkinsClient) get() (jenkinsclient.Jenkins, error) {
+	if l.jenkinsClient == nil {
+		jenkinsClient, err := l.newJenkinsClient()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Jenkins client: %s", err)
+		}
+		l.jenkinsClient = jenkinsClient
+	}
+	return l.jenkinsClient, nil
+}
+
+// hookRunner runs the Groovy hook scripts of a BackupStrategy through the Jenkins script console
+type hookRunner struct {
+	client client.Client
+	// namespace is where the ConfigMaps of the scripts are read
+	namespace     string
+	jenkinsClient *lazyJenkinsClient
+}
+
+// run runs the scripts of the ConfigMaps in order and returns their results, it stops at the first failing script
+func (h *hookRunner) run(ctx context.Context, stage v1alpha2.HookStage, configMaps []v1alpha2.ConfigMapRef) ([]v1alpha2.HookResult, error) {
+	results := []v1alpha2.HookResult{}
+	for _, configMapRef := range configMaps {
+		configMap := &corev1.ConfigMap{}
+		err := h.client.Get(ctx, types.NamespacedName{Name: configMapRef.Name, Namespace: h.namespace}, configMap)
+		if err != nil {
+			err = fmt.Errorf("failed to get ConfigMap '%s': %s", configMapRef.Name, err)
+			results = append(results, v1alpha2.HookResult{Stage: stage, Script: configMapRef.Name, Message: err.Error()})
+			return results, err
+		}
+		keys := make([]string, 0, len(configMap.Data))
+		for key := range configMap.Data {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			result := h.runScript(stage, configMapRef.Name+"/"+key, configMap.Data[key])
+			results = append(results, result)
+			if !result.Succeeded {
+				return results, fmt.Errorf("%s hook '%s' failed: %s", stage, result.Script, result.Message)
+			}
+		}
+	}
+	return results, nil
+}
+
+func (h *hookRunner) runScript(stage v1alpha2.HookStage, name, script string) v1alpha2.HookResult {
+	result := v1alpha2.HookResult{Stage: stage, Script: name}
+	jenkinsClient, err := h.jenkinsClient.get()
+	if err != nil {
+		result.Message = err.Error()
+		return result
+	}
+	output, err := jenkinsClient.ExecuteScript(script)
+	if len(output) > maxHookOutputLength {
+		output = output[len(output)-maxHookOutputLength:]
+	}
+	result.Output = output
+	if err != nil {
+		result.Message = err.Error()
+		return result
+	}
+	result.Succeeded = true
+	return result
+}
+
+// getHookScripts returns the ConfigMaps of the scripts of the stage
+func getHookScripts(hooks *v1alpha2.BackupHooks, stage v1alpha2.HookStage) []v1alpha2.ConfigMapRef {
+	if hooks == nil {
+		return nil
+	}
+	switch stage {
+	case v1alpha2.PreBackupHook:
+		return hooks.PreBackup
+	case v1alpha2.PostBackupHook:
+		return hooks.PostBackup
+	case v1alpha2.PreRestoreHook:
+		return hooks.PreRestore
+	case v1alpha2.PostRestoreHook:
+		return hooks.PostRestore
+	}
+	return nil
+}
+
+// newJenkinsClient returns a client of the Jenkins API of the Jenkins HTTP Service, authenticated with the token of the
+// service account of the Jenkins Pod read from its backup sidecar
+func newJenkinsClient(ctx context.Context, c client.Client, execClient exec.KubeExecClient, jenkins *v1alpha2.Jenkins, jenkinsPod *corev1.Pod, resourceName string) (jenkinsclient.Jenkins, error) {
+	token := &bytes.Buffer{}
+	execReadToken := strings.Join([]string{"cat", serviceAccountTokenPath}, " ")
+	err := execClient.StreamRequest(ctx, jenkinsPod, resourceName, execReadToken, nil, token)
+	if err != nil {
+		return nil, err
+	}
+	return newJenkinsClientWithToken(ctx, c, jenkins, strings.TrimSpace(token.String()))
+}
+
+// newJenkinsClientWithToken returns a client of the Jenkins API of the Jenkins HTTP Service, authenticated with the token
+func newJenkinsClientWithToken(ctx context.Context, c client.Client, jenkins *v1alpha2.Jenkins, token string) (jenkinsclient.Jenkins, error) {
+	service := &corev1.Service{}
+	err := c.Get(ctx, types.NamespacedName{Name: resources.GetJenkinsHTTPServiceName(jenkins), Namespace: jenkins.Namespace}, service)
+	if err != nil {
+		return nil, err
+	}
+	if len(service.Spec.Ports) == 0 {
+		return nil, fmt.Errorf("service '%s' has no port", service.Name)
+	}
+	jenkinsAPIUrl := jenkinsclient.JenkinsAPIConnectionSettings{}.BuildJenkinsAPIUrl(service.Name, service.Namespace, service.Spec.Ports[0].Port, service.Spec.Ports[0].NodePort)
+	return jenkinsclient.NewBearerTokenAuthorization(jenkinsAPIUrl, token)
+}
+
+// getServiceAccountToken returns the token of the service account of the Jenkins Pod from its token Secret
+func getServiceAccountToken(ctx context.Context, c client.Client, jenkinsPod *corev1.Pod) (string, error) {
+	serviceAccount := &corev1.ServiceAccount{}
+	err := c.Get(ctx, types.NamespacedName{Name: jenkinsPod.Spec.ServiceAccountName, Namespace: jenkinsPod.Namespace}, serviceAccount)
+	if err != nil {
+		return "", err
+	}
+	for _, secretRef := range serviceAccount.Secrets {
+		secret := &corev1.Secret{}
+		err = c.Get(ctx, types.NamespacedName{Name: secretRef.Name, Namespace: jenkinsPod.Namespace}, secret)
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if token := secret.Data[corev1.ServiceAccountTokenKey]; secret.Type == corev1.SecretTypeServiceAccountToken && len(token) > 0 {
+			return string(token), nil
+		}
+	}
+	return "", fmt.Errorf("service account '%s' has no token Secret", serviceAccount.Name)
+}
@@ -0,0 +1,124 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/golang/mock/gomock"
+	"github.com/jenkinsci/jenkins-automation-operator/api/v1alpha2"
+	jenkinsclient "github.com/jenkinsci/jenkins-automation-operator/pkg/client"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Backup hooks", func() {
+	ctx := context.Background()
+	configMaps := []v1alpha2.ConfigMapRef{{Name: "flush-caches"}, {Name: "disable-jobs"}}
+	fakeClient := fake.NewFakeClient(
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "flush-caches", Namespace: "jenkins"},
+			Data:       map[string]string{"2-second.groovy": "second", "1-first.groovy": "first"},
+		},
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "disable-jobs", Namespace: "jenkins"},
+			Data:       map[string]string{"disable.groovy": "disable"},
+		},
+	)
+
+	It("Should Run The Scripts In Order", func() {
+		mockCtrl := gomock.NewController(GinkgoT())
+		defer mockCtrl.Finish()
+		jenkinsClient := jenkinsclient.NewMockJenkins(mockCtrl)
+		gomock.InOrder(
+			jenkinsClient.EXPECT().ExecuteScript("first").Return("first done", nil),
+			jenkinsClient.EXPECT().ExecuteScript("second").Return("second done", nil),
+			jenkinsClient.EXPECT().ExecuteScript("disable").Return("disable done", nil),
+		)
+		hooks := &hookRunner{client: fakeClient, namespace: "jenkins", jenkinsClient: &lazyJenkinsClient{jenkinsClient: jenkinsClient}}
+
+		results, err := hooks.run(ctx, v1alpha2.PreBackupHook, configMaps)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(results).To(Equal([]v1alpha2.HookResult{
+			{Stage: v1alpha2.PreBackupHook, Script: "flush-caches/1-first.groovy", Succeeded: true, Output: "first done"},
+			{Stage: v1alpha2.PreBackupHook, Script: "flush-caches/2-second.groovy", Succeeded: true, Output: "second done"},
+			{Stage: v1alpha2.PreBackupHook, Script: "disable-jobs/disable.groovy", Succeeded: true, Output: "disable done"},
+		}))
+	})
+
+	It("Should Stop At The First Failing Script", func() {
+		mockCtrl := gomock.NewController(GinkgoT())
+		defer mockCtrl.Finish()
+		jenkinsClient := jenkinsclient.NewMockJenkins(mockCtrl)
+		jenkinsClient.EXPECT().ExecuteScript("first").Return("groovy.lang.MissingPropertyException", &jenkinsclient.GroovyScriptExecutionFailed{})
+		hooks := &hookRunner{client: fakeClient, namespace: "jenkins", jenkinsClient: &lazyJenkinsClient{jenkinsClient: jenkinsClient}}
+
+		results, err := hooks.run(ctx, v1alpha2.PostRestoreHook, configMaps)
+
+		Expect(err).To(MatchError("PostRestore hook 'flush-caches/1-first.groovy' failed: script execution failed"))
+		Expect(results).To(Equal([]v1alpha2.HookResult{
+			{
+				Stage:   v1alpha2.PostRestoreHook,
+				Script:  "flush-caches/1-first.groovy",
+				Output:  "groovy.lang.MissingPropertyException",
+				Message: "script execution failed",
+			},
+		}))
+	})
+
+	It("Should Fail When A ConfigMap Is Missing", func() {
+		hooks := &hookRunner{client: fakeClient, namespace: "jenkins"}
+
+		results, err := hooks.run(ctx, v1alpha2.PreRestoreHook, []v1alpha2.ConfigMapRef{{Name: "missing"}})
+
+		Expect(err).To(HaveOccurred())
+		Expect(results).To(HaveLen(1))
+		Expect(results[0].Succeeded).To(BeFalse())
+	})
+
+	It("Should Create The Jenkins Client Once", func() {
+		mockCtrl := gomock.NewController(GinkgoT())
+		defer mockCtrl.Finish()
+		jenkinsClient := jenkinsclient.NewMockJenkins(mockCtrl)
+		jenkinsClient.EXPECT().ExecuteScript(gomock.Any()).Return(strings.Repeat("a", 2*maxHookOutputLength), nil).Times(3)
+		created := 0
+		hooks := &hookRunner{client: fakeClient, namespace: "jenkins", jenkinsClient: &lazyJenkinsClient{newJenkinsClient: func() (jenkinsclient.Jenkins, error) {
+			created++
+			return jenkinsClient, nil
+		}}}
+
+		results, err := hooks.run(ctx, v1alpha2.PostBackupHook, configMaps)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(created).To(Equal(1))
+		Expect(results[0].Output).To(HaveLen(maxHookOutputLength))
+	})
+
+	It("Should Fail When The Jenkins Client Can't Be Created", func() {
+		hooks := &hookRunner{client: fakeClient, namespace: "jenkins", jenkinsClient: &lazyJenkinsClient{newJenkinsClient: func() (jenkinsclient.Jenkins, error) {
+			return nil, errors.New("connection refused")
+		}}}
+
+		_, err := hooks.run(ctx, v1alpha2.PreBackupHook, configMaps)
+
+		Expect(err).To(MatchError("PreBackup hook 'flush-caches/1-first.groovy' failed: failed to create Jenkins client: connection refused"))
+	})
+})
+
+var _ = Describe("Hook scripts", func() {
+	It("Should Be The ConfigMaps Of The Stage", func() {
+		hooks := &v1alpha2.BackupHooks{
+			PreBackup:   []v1alpha2.ConfigMapRef{{Name: "pre-backup"}},
+			PostRestore: []v1alpha2.ConfigMapRef{{Name: "post-restore"}},
+		}
+
+		Expect(getHookScripts(hooks, v1alpha2.PreBackupHook)).To(Equal([]v1alpha2.ConfigMapRef{{Name: "pre-backup"}}))
+		Expect(getHookScripts(hooks, v1alpha2.PostRestoreHook)).To(Equal([]v1alpha2.ConfigMapRef{{Name: "post-restore"}}))
+		Expect(getHookScripts(hooks, v1alpha2.PostBackupHook)).To(BeEmpty())
+		Expect(getHookScripts(nil, v1alpha2.PreRestoreHook)).To(BeEmpty())
+	})
+})
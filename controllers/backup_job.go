@@ -0,0 +1,431 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jenkinsci/jenkins-automation-operator/api/v1alpha2"
+	"github.com/jenkinsci/jenkins-automation-operator/pkg/configuration/base/resources"
+	"github.com/jenkinsci/jenkins-automation-operator/pkg/constants"
+	"github.com/jenkinsci/jenkins-automation-operator/pkg/exec"
+	"github.com/operator-framework/operator-lib/status"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// BackupJobCommand is the argument with which the Operator binary runs the Backup or the Restore of a backup Job
+	BackupJobCommand = "backup-job"
+
+	backupJobSpecEnvVar          = "BACKUP_JOB_SPEC"
+	backupJobEncryptionKeyEnvVar = "BACKUP_ENCRYPTION_KEY"
+	operatorPodNameEnvVar        = "POD_NAME"
+	operatorPodNamespaceEnvVar   = "POD_NAMESPACE"
+	operatorContainerName        = "manager"
+	backupJobContainerName       = "backup"
+	backupJobHomeVolumeName      = "jenkins-home"
+	backupJobBackupVolumeName    = "backup-volume"
+	// backupJobActiveDeadline bounds the run of a backup Job when the BackupStrategy has no deadline, the Job is waited
+	// for a little longer
+	backupJobActiveDeadline = time.Hour
+	backupJobPollInterval   = 5 * time.Second
+)
+
+// backupJobOperation is what a backup Job does
+type backupJobOperation string
+
+const (
+	backupJobBackup    backupJobOperation = "backup"
+	backupJobRestore   backupJobOperation = "restore"
+	backupJobGitExport backupJobOperation = "git-export"
+	// backupJobRollback puts back the snapshot kept by a restore Job, backupJobRemoveSnapshot removes it
+	backupJobRollback       backupJobOperation = "rollback"
+	backupJobRemoveSnapshot backupJobOperation = "remove-snapshot"
+)
+
+// backupJobSpec describes the Backup or the Restore run by a backup Job, it is passed as JSON in its environment
+type backupJobSpec struct {
+	Operation backupJobOperation `json:"operation"`
+	// Name is the name of the Backup or of the Restore
+	Name string `json:"name"`
+	// Backup is the name of the Backup which is created or restored
+	Backup   string                      `json:"backup"`
+	Strategy v1alpha2.BackupStrategySpec `json:"strategy"`
+	// Directory is where the files of the Backup are stored on the mounted BackupVolume
+	Directory string `json:"directory,omitempty"`
+	// S3 is the bucket where the files of the Backup are stored under the KeyPrefix
+	S3        *v1alpha2.S3Storage `json:"s3,omitempty"`
+	KeyPrefix string              `json:"keyPrefix,omitempty"`
+	// Items and TargetFolder are the jobs and folders restored by the Restore and where they are restored
+	Items        []string `json:"items,omitempty"`
+	TargetFolder string   `json:"targetFolder,omitempty"`
+	// SnapshotDirectory or SnapshotKeyPrefix is where the snapshot of the Restore is kept on the BackupVolume, until
+	// the Operator removes it. A restore Job without either takes its snapshot in a temporary directory.
+	SnapshotDirectory string `json:"snapshotDirectory,omitempty"`
+	SnapshotKeyPrefix string `json:"snapshotKeyPrefix,omitempty"`
+	// FirstStart restores the Backup only if Jenkins never started on the Jenkins Home, to populate the Jenkins Home of
+	// a new Jenkins from its restoreFrom init container
+	FirstStart bool `json:"firstStart,omitempty"`
+}
+
+// backupJobResult is the outcome of a backup Job, written as JSON to the termination message of its container
+type backupJobResult struct {
+	Size      int64  `json:"size,omitempty"`
+	FileCount int64  `json:"fileCount,omitempty"`
+	Path      string `json:"path,omitempty"`
+	// Error is the reason why the Job failed
+	Error string `json:"error,omitempty"`
+	// Snapshot is the location of the snapshot kept on the BackupVolume by a restore Job
+	Snapshot string `json:"snapshot,omitempty"`
+	// Conditions are the outcomes of the snapshot and of the rollback of a Restore
+	Conditions []status.Condition `json:"conditions,omitempty"`
+	// Commit and Changes are the commit pushed by a git export Job and the files it changed
+	Commit  string   `json:"commit,omitempty"`
+	Changes []string `json:"changes,omitempty"`
+}
+
+// keepsSnapshot returns true if the snapshot of the Restore is kept on the BackupVolume
+func (s *backupJobSpec) keepsSnapshot() bool {
+	return len(s.SnapshotDirectory) > 0 || len(s.SnapshotKeyPrefix) > 0
+}
+
+// isBackupJobRunner returns true if the Backups and Restores of the BackupStrategy run in Jobs
+func isBackupJobRunner(backupStrategy *v1alpha2.BackupStrategy) bool {
+	return backupStrategy.Spec.Runner == v1alpha2.BackupRunnerJob
+}
+
+// withJenkinsBackupRunner returns the BackupStrategy as it applies to the Jenkins: the Backups and Restores of a Jenkins
+// whose backupRunner is Job run in Jobs whatever the runner of their BackupStrategy, as its Pod has no backup sidecar
+func withJenkinsBackupRunner(backupStrategy *v1alpha2.BackupStrategy, jenkins *v1alpha2.Jenkins) *v1alpha2.BackupStrategy {
+	if jenkins.Spec.BackupRunner != v1alpha2.BackupRunnerJob || isBackupJobRunner(backupStrategy) {
+		return backupStrategy
+	}
+	backupStrategy = backupStrategy.DeepCopy()
+	backupStrategy.Spec.Runner = v1alpha2.BackupRunnerJob
+	return backupStrategy
+}
+
+// getBackupJobName returns the name of the Job running the Backup or the Restore
+func getBackupJobName(name string, operation backupJobOperation) string {
+	return name + "-" + string(operation)
+}
+
+// newBackupJobSpec returns the spec of a backup Job creating or restoring the Backup stored on the BackupVolume
+func newBackupJobSpec(operation backupJobOperation, name string, backup *v1alpha2.Backup, backupVolume *v1alpha2.BackupVolume, backupStrategy *v1alpha2.BackupStrategy) *backupJobSpec {
+	spec := &backupJobSpec{Operation: operation, Name: name, Backup: backup.Name, Strategy: backupStrategy.Spec}
+	if backupVolume.Spec.S3 != nil {
+		spec.S3 = backupVolume.Spec.S3
+		spec.KeyPrefix = getBackupObjectKeyPrefix(backupVolume, backup)
+	} else {
+		spec.Directory = getBackupLocation(backup)
+	}
+	return spec
+}
+
+// getBackupJobImage returns the image and the command of the backup Jobs. They run the image of the Operator by default,
+// read from the Pod of the Operator, so that the Jobs run the same binary as the Operator.
+func getBackupJobImage(ctx context.Context, c client.Client) (string, []string, error) {
+	if image, found := os.LookupEnv(resources.JenkinsBackupJobImageEnvVar); found && len(image) > 0 {
+		return image, nil, nil
+	}
+	podName, podNamespace := os.Getenv(operatorPodNameEnvVar), os.Getenv(operatorPodNamespaceEnvVar)
+	if len(podName) == 0 || len(podNamespace) == 0 {
+		return "", nil, fmt.Errorf("image of the backup Jobs is unknown, set the %s environment variable of the Operator, or %s and %s to its Pod",
+			resources.JenkinsBackupJobImageEnvVar, operatorPodNameEnvVar, operatorPodNamespaceEnvVar)
+	}
+	operatorPod := &corev1.Pod{}
+	err := c.Get(ctx, types.NamespacedName{Name: podName, Namespace: podNamespace}, operatorPod)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to get the image of the backup Jobs from the Operator Pod, set the %s environment variable of the Operator: %s",
+			resources.JenkinsBackupJobImageEnvVar, err)
+	}
+	if len(operatorPod.Spec.Containers) == 0 {
+		return "", nil, fmt.Errorf("pod '%s' has no container", podName)
+	}
+	container := operatorPod.Spec.Containers[0]
+	for _, operatorContainer := range operatorPod.Spec.Containers {
+		if operatorContainer.Name == operatorContainerName {
+			container = operatorContainer
+		}
+	}
+	return container.Image, container.Command, nil
+}
+
+// checkBackupJobSecrets checks the Secrets read by a backup Job, a missing Secret would block the Job until its deadline
+func checkBackupJobSecrets(ctx context.Context, c client.Client, backupVolume *v1alpha2.BackupVolume, backupStrategy *v1alpha2.BackupStrategy) error {
+	if backupVolume.Spec.S3 != nil {
+		if _, err := newObjectStorageClient(ctx, c, backupVolume); err != nil {
+			return err
+		}
+	}
+	_, err := getBackupEncryptionKey(ctx, c, backupStrategy)
+	return err
+}
+
+// newBackupJob returns the Job running the spec, owned by the Backup or the Restore. It mounts the Jenkins Home and the
+// BackupVolume, and runs next to the Jenkins Pod, with its security context, so that the ReadWriteOnce volumes can be
+// mounted and the restored files belong to Jenkins. The credentials are read from their Secrets in its environment.
+func newBackupJob(owner metav1.Object, ownerKind string, jenkins *v1alpha2.Jenkins, jenkinsPod *corev1.Pod, backupVolume *v1alpha2.BackupVolume, backupStrategy *v1alpha2.BackupStrategy, spec *backupJobSpec, image string, command []string) (*batchv1.Job, error) {
+	container, backupVolumes, err := newBackupJobContainer(backupJobContainerName, spec, backupJobHomeVolumeName, backupJobBackupVolumeName, backupVolume, backupStrategy, image, command)
+	if err != nil {
+		return nil, err
+	}
+	volumes := []corev1.Volume{
+		{
+			Name: backupJobHomeVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: getJenkinsHomePVCName(jenkins)},
+			},
+		},
+	}
+	volumes = append(volumes, backupVolumes...)
+	for _, jenkinsContainer := range jenkinsPod.Spec.Containers {
+		if jenkinsContainer.Name == resources.JenkinsMasterContainerName {
+			container.SecurityContext = jenkinsContainer.SecurityContext
+		}
+	}
+	labels := map[string]string{constants.LabelJenkinsCRKey: jenkins.Name}
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      getBackupJobName(spec.Name, spec.Operation),
+			Namespace: jenkins.Namespace,
+			Labels:    labels,
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(owner, v1alpha2.GroupVersion.WithKind(ownerKind)),
+			},
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:          pointer.Int32Ptr(0),
+			ActiveDeadlineSeconds: pointer.Int64Ptr(int64(getBackupJobActiveDeadline(backupStrategy).Seconds())),
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					RestartPolicy:                corev1.RestartPolicyNever,
+					AutomountServiceAccountToken: pointer.BoolPtr(false),
+					SecurityContext:              jenkinsPod.Spec.SecurityContext,
+					NodeSelector:                 jenkinsPod.Spec.NodeSelector,
+					Tolerations:                  jenkinsPod.Spec.Tolerations,
+					Affinity: &corev1.Affinity{
+						PodAffinity: &corev1.PodAffinity{
+							RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{
+								{
+									LabelSelector: &metav1.LabelSelector{MatchLabels: jenkinsPod.Labels},
+									TopologyKey:   corev1.LabelHostname,
+								},
+							},
+						},
+					},
+					Containers: []corev1.Container{container},
+					Volumes:    volumes,
+				},
+			},
+		},
+	}, nil
+}
+
+// newBackupJobContainer returns the container running the spec on the Jenkins Home mounted from the volume named
+// homeVolumeName, with the credentials of the BackupVolume and of the BackupStrategy in its environment. The BackupVolume
+// is mounted from the returned volume named backupVolumeVolumeName, unless it is on an object store.
+func newBackupJobContainer(name string, spec *backupJobSpec, homeVolumeName, backupVolumeVolumeName string, backupVolume *v1alpha2.BackupVolume, backupStrategy *v1alpha2.BackupStrategy, image string, command []string) (corev1.Container, []corev1.Volume, error) {
+	specContent, err := json.Marshal(spec)
+	if err != nil {
+		return corev1.Container{}, nil, err
+	}
+	env := []corev1.EnvVar{{Name: backupJobSpecEnvVar, Value: string(specContent)}}
+	volumeMounts := []corev1.VolumeMount{
+		{Name: homeVolumeName, MountPath: defaultJenkinsHome, ReadOnly: spec.Operation == backupJobBackup || spec.Operation == backupJobRemoveSnapshot},
+	}
+	var volumes []corev1.Volume
+	if backupVolume.Spec.S3 != nil {
+		env = append(env,
+			newSecretKeyEnvVar(S3AccessKeyIDKey, backupVolume.Spec.S3.CredentialsSecretRef, S3AccessKeyIDKey),
+			newSecretKeyEnvVar(S3SecretAccessKeyKey, backupVolume.Spec.S3.CredentialsSecretRef, S3SecretAccessKeyKey),
+			newOptionalSecretKeyEnvVar(S3SessionTokenKey, backupVolume.Spec.S3.CredentialsSecretRef, S3SessionTokenKey))
+	} else {
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{Name: backupVolumeVolumeName, MountPath: resources.JenkinsBackupVolumePath + "/" + backupVolume.Name})
+		volumes = append(volumes, corev1.Volume{
+			Name: backupVolumeVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: getBackupVolumePVCName(backupVolume)},
+			},
+		})
+	}
+	if backupEncryption := backupStrategy.Spec.Encryption; backupEncryption != nil {
+		key := backupEncryption.Key
+		if len(key) == 0 {
+			key = DefaultEncryptionKeyKey
+		}
+		env = append(env, newSecretKeyEnvVar(backupJobEncryptionKeyEnvVar, backupEncryption.SecretRef, key))
+	}
+
+	return corev1.Container{
+		Name:                     name,
+		Image:                    image,
+		ImagePullPolicy:          corev1.PullIfNotPresent,
+		Command:                  command,
+		Args:                     []string{BackupJobCommand},
+		Env:                      env,
+		VolumeMounts:             volumeMounts,
+		TerminationMessagePolicy: corev1.TerminationMessageReadFile,
+	}, volumes, nil
+}
+
+// newSecretKeyEnvVar returns an environment variable set to the value of the key of the Secret
+func newSecretKeyEnvVar(name, secretName, key string) corev1.EnvVar {
+	return corev1.EnvVar{
+		Name: name,
+		ValueFrom: &corev1.EnvVarSource{
+			SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: secretName},
+				Key:                  key,
+			},
+		},
+	}
+}
+
+// newOptionalSecretKeyEnvVar returns an environment variable set from a key of a Secret, which may be missing
+func newOptionalSecretKeyEnvVar(name, secretName, key string) corev1.EnvVar {
+	envVar := newSecretKeyEnvVar(name, secretName, key)
+	optional := true
+	envVar.ValueFrom.SecretKeyRef.Optional = &optional
+	return envVar
+}
+
+// getBackupJobActiveDeadline returns how long the backup Job may run, the deadline of the BackupStrategy if it is set
+func getBackupJobActiveDeadline(backupStrategy *v1alpha2.BackupStrategy) time.Duration {
+	if backupStrategy.Spec.ActiveDeadlineSeconds != nil {
+		return time.Duration(*backupStrategy.Spec.ActiveDeadlineSeconds) * time.Second
+	}
+	return backupJobActiveDeadline
+}
+
+// runBackupJob creates the backup Job, or reuses the existing one after a restart of the Operator, waits for it to
+// complete and returns the result written by its container
+func runBackupJob(ctx context.Context, c client.Client, job *batchv1.Job, interval, timeout time.Duration) (*backupJobResult, error) {
+	err := c.Create(ctx, job)
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return nil, err
+	}
+	current := &batchv1.Job{}
+	err = pollImmediate(ctx, interval, timeout, func() (bool, error) {
+		err := c.Get(ctx, types.NamespacedName{Name: job.Name, Namespace: job.Namespace}, current)
+		if err != nil {
+			return false, err
+		}
+		return isJobFinished(current), nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return nil, fmt.Errorf("job '%s' did not complete within %s", job.Name, timeout)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			// The Job of a cancelled Backup or Restore is stopped along with its Pod
+			deleteErr := c.Delete(context.Background(), job, client.PropagationPolicy(metav1.DeletePropagationBackground))
+			if deleteErr != nil && !apierrors.IsNotFound(deleteErr) {
+				return nil, fmt.Errorf("%s, failed to delete Job '%s': %s", err, job.Name, deleteErr)
+			}
+		}
+		return nil, err
+	}
+	return getBackupJobResult(ctx, c, current)
+}
+
+// isJobFinished returns true if the Job has completed or failed
+func isJobFinished(job *batchv1.Job) bool {
+	for _, condition := range job.Status.Conditions {
+		if (condition.Type == batchv1.JobComplete || condition.Type == batchv1.JobFailed) && condition.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return job.Status.Succeeded > 0 || job.Status.Failed > 0
+}
+
+// getBackupJobResult returns the result written by the container of the finished Job to its termination message
+func getBackupJobResult(ctx context.Context, c client.Client, job *batchv1.Job) (*backupJobResult, error) {
+	pods := &corev1.PodList{}
+	err := c.List(ctx, pods, client.InNamespace(job.Namespace), client.MatchingLabels{"job-name": job.Name})
+	if err != nil {
+		return nil, err
+	}
+	for _, pod := range pods.Items {
+		for _, containerStatus := range pod.Status.ContainerStatuses {
+			terminated := containerStatus.State.Terminated
+			if containerStatus.Name != backupJobContainerName || terminated == nil || len(terminated.Message) == 0 {
+				continue
+			}
+			result := &backupJobResult{}
+			if err = json.Unmarshal([]byte(terminated.Message), result); err != nil {
+				return nil, fmt.Errorf("invalid result of Job '%s': %s", job.Name, err)
+			}
+			return result, nil
+		}
+	}
+	message := "the container did not terminate"
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == batchv1.JobFailed && condition.Status == corev1.ConditionTrue {
+			message = condition.Message
+		}
+	}
+	return nil, fmt.Errorf("job '%s' failed without result, see the logs of its Pod: %s", job.Name, message)
+}
+
+// jenkinsOperationScripts are the Groovy scripts run through the Jenkins API in place of the scripts of the backup sidecar
+var jenkinsOperationScripts = map[string]string{
+	resources.QuietDownScriptPath:       "Jenkins.instance.doQuietDown()",
+	resources.CancelQuietDownScriptPath: "Jenkins.instance.doCancelQuietDown()",
+	resources.RestartScriptPath:         "Jenkins.instance.restart()",
+	resources.SafeRestartScriptPath:     "Jenkins.instance.safeRestart()",
+}
+
+// newExecClient returns the client running the scripts of the backup sidecar built by newClient, if any
+func newExecClient(newClient func() exec.KubeExecClient) exec.KubeExecClient {
+	if newClient != nil {
+		return newClient()
+	}
+	return exec.NewKubeExecClient()
+}
+
+// jenkinsOperations quiets down and restarts Jenkins with the scripts of the backup sidecar, or through the Jenkins API
+// when the Backups and Restores run in Jobs and the Jenkins Pod may have no backup sidecar
+type jenkinsOperations struct {
+	execClient   exec.KubeExecClient
+	jenkinsPod   *corev1.Pod
+	resourceName string
+	// jenkinsClient is set when the operations go through the Jenkins API
+	jenkinsClient *lazyJenkinsClient
+}
+
+// newJenkinsAccess returns the client of the Jenkins API and the operations used by a Backup or a Restore of the
+// BackupStrategy. Without the backup sidecar, the token of the service account of Jenkins is read from its Secret.
+// The Backups of a GitExport BackupStrategy don't need the backup sidecar either.
+func newJenkinsAccess(ctx context.Context, c client.Client, execClient exec.KubeExecClient, backupStrategy *v1alpha2.BackupStrategy, jenkins *v1alpha2.Jenkins, jenkinsPod *corev1.Pod, resourceName string) (*lazyJenkinsClient, *jenkinsOperations) {
+	operations := &jenkinsOperations{execClient: execClient, jenkinsPod: jenkinsPod, resourceName: resourceName}
+	if !isBackupJobRunner(backupStrategy) && !isGitExportStrategy(backupStrategy) {
+		return newLazyJenkinsClient(ctx, c, execClient, jenkins, jenkinsPod, resourceName), operations
+	}
+	operations.jenkinsClient = newServiceAccountLazyJenkinsClient(ctx, c, jenkins, jenkinsPod)
+	return operations.jenkinsClient, operations
+}
+
+// run runs the script of the backup sidecar, or the matching Groovy script through the Jenkins API
+func (o *jenkinsOperations) run(ctx context.Context, scriptPath string) error {
+	if o.jenkinsClient == nil {
+		return o.execClient.MakeRequest(ctx, o.jenkinsPod, o.resourceName, strings.Join([]string{"sh", scriptPath}, " "))
+	}
+	jenkinsClient, err := o.jenkinsClient.get()
+	if err != nil {
+		return err
+	}
+	_, err = jenkinsClient.ExecuteScript(jenkinsOperationScripts[scriptPath])
+	return err
+}
@@ -0,0 +1,151 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/jenkinsci/jenkins-automation-operator/api/v1alpha2"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Backup Job", func() {
+	jenkins := &v1alpha2.Jenkins{ObjectMeta: metav1.ObjectMeta{Name: "jenkins", Namespace: "jenkins"}}
+	jenkinsPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "jenkins-1", Namespace: "jenkins", Labels: map[string]string{"app": "jenkins-jenkins"}},
+	}
+	backup := &v1alpha2.Backup{
+		ObjectMeta: metav1.ObjectMeta{Name: "backup", Namespace: "jenkins"},
+		Spec:       v1alpha2.BackupSpec{BackupVolumeRef: "backup-volume"},
+	}
+	backupStrategy := &v1alpha2.BackupStrategy{Spec: v1alpha2.BackupStrategySpec{
+		Runner:     v1alpha2.BackupRunnerJob,
+		Encryption: &v1alpha2.BackupEncryption{SecretRef: "backup-encryption"},
+	}}
+
+	It("Should Mount The Jenkins Home And The BackupVolume", func() {
+		backupVolume := &v1alpha2.BackupVolume{ObjectMeta: metav1.ObjectMeta{Name: "backup-volume", Namespace: "jenkins"}}
+		spec := newBackupJobSpec(backupJobBackup, backup.Name, backup, backupVolume, backupStrategy)
+
+		job, err := newBackupJob(backup, "Backup", jenkins, jenkinsPod, backupVolume, backupStrategy, spec, "operator:latest", []string{"/manager"})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(job.Name).To(Equal("backup-backup"))
+		Expect(job.OwnerReferences[0].Kind).To(Equal("Backup"))
+		podSpec := job.Spec.Template.Spec
+		Expect(podSpec.Affinity.PodAffinity.RequiredDuringSchedulingIgnoredDuringExecution[0].LabelSelector.MatchLabels).To(Equal(map[string]string{"app": "jenkins-jenkins"}))
+		container := podSpec.Containers[0]
+		Expect(container.Image).To(Equal("operator:latest"))
+		Expect(container.Command).To(Equal([]string{"/manager"}))
+		Expect(container.Args).To(Equal([]string{BackupJobCommand}))
+		Expect(container.VolumeMounts).To(Equal([]corev1.VolumeMount{
+			{Name: backupJobHomeVolumeName, MountPath: "/var/lib/jenkins", ReadOnly: true},
+			{Name: backupJobBackupVolumeName, MountPath: "/jenkins-backups/backup-volume"},
+		}))
+		Expect(podSpec.Volumes[0].PersistentVolumeClaim.ClaimName).To(Equal("jenkins"))
+		Expect(podSpec.Volumes[1].PersistentVolumeClaim.ClaimName).To(Equal("backup-volume-jenkins-backup"))
+		jobSpec := &backupJobSpec{}
+		Expect(json.Unmarshal([]byte(container.Env[0].Value), jobSpec)).To(Succeed())
+		Expect(jobSpec.Directory).To(Equal("/jenkins-backups/backup-volume/backup"))
+		Expect(container.Env[1].Name).To(Equal(backupJobEncryptionKeyEnvVar))
+		Expect(container.Env[1].ValueFrom.SecretKeyRef.Name).To(Equal("backup-encryption"))
+		Expect(container.Env[1].ValueFrom.SecretKeyRef.Key).To(Equal(DefaultEncryptionKeyKey))
+	})
+
+	It("Should Pass The S3 Credentials", func() {
+		backupVolume := &v1alpha2.BackupVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: "backup-volume", Namespace: "jenkins"},
+			Spec:       v1alpha2.BackupVolumeSpec{S3: &v1alpha2.S3Storage{Bucket: "backups", CredentialsSecretRef: "s3-credentials"}},
+		}
+		spec := newBackupJobSpec(backupJobRestore, "restore", backup, backupVolume, backupStrategy)
+
+		job, err := newBackupJob(backup, "Restore", jenkins, jenkinsPod, backupVolume, backupStrategy, spec, "operator:latest", nil)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(job.Name).To(Equal("restore-restore"))
+		container := job.Spec.Template.Spec.Containers[0]
+		Expect(container.VolumeMounts).To(Equal([]corev1.VolumeMount{{Name: backupJobHomeVolumeName, MountPath: "/var/lib/jenkins"}}))
+		Expect(container.Env[1].Name).To(Equal(S3AccessKeyIDKey))
+		Expect(container.Env[1].ValueFrom.SecretKeyRef.Name).To(Equal("s3-credentials"))
+		Expect(container.Env[2].Name).To(Equal(S3SecretAccessKeyKey))
+		jobSpec := &backupJobSpec{}
+		Expect(json.Unmarshal([]byte(container.Env[0].Value), jobSpec)).To(Succeed())
+		Expect(jobSpec.KeyPrefix).To(Equal("jenkins/backup"))
+	})
+})
+
+var _ = Describe("Backup Job run", func() {
+	ctx := context.Background()
+	newJob := func(conditionType batchv1.JobConditionType) *batchv1.Job {
+		return &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: "backup-backup", Namespace: "jenkins"},
+			Status: batchv1.JobStatus{Conditions: []batchv1.JobCondition{
+				{Type: conditionType, Status: corev1.ConditionTrue, Message: "Job was active longer than specified deadline"},
+			}},
+		}
+	}
+	newJobPod := func(message string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "backup-backup-x1", Namespace: "jenkins", Labels: map[string]string{"job-name": "backup-backup"}},
+			Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{
+				{Name: backupJobContainerName, State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Message: message}}},
+			}},
+		}
+	}
+
+	It("Should Return The Result Of A Completed Job", func() {
+		c := fake.NewFakeClientWithScheme(scheme.Scheme, newJob(batchv1.JobComplete), newJobPod(`{"size":42,"fileCount":2,"path":"/jenkins-backups/backup-volume/backup"}`))
+
+		result, err := runBackupJob(ctx, c, newJob(""), time.Millisecond, time.Minute)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(&backupJobResult{Size: 42, FileCount: 2, Path: "/jenkins-backups/backup-volume/backup"}))
+	})
+
+	It("Should Fail When The Job Failed Without Result", func() {
+		c := fake.NewFakeClientWithScheme(scheme.Scheme, newJob(batchv1.JobFailed))
+
+		_, err := runBackupJob(ctx, c, newJob(""), time.Millisecond, time.Minute)
+
+		Expect(err).To(MatchError("job 'backup-backup' failed without result, see the logs of its Pod: Job was active longer than specified deadline"))
+	})
+
+	It("Should Fail When The Job Does Not Complete In Time", func() {
+		c := fake.NewFakeClientWithScheme(scheme.Scheme)
+
+		_, err := runBackupJob(ctx, c, newJob(""), time.Millisecond, 10*time.Millisecond)
+
+		Expect(err).To(MatchError("job 'backup-backup' did not complete within 10ms"))
+	})
+})
+
+var _ = Describe("Jenkins Backup runner", func() {
+	backupStrategy := &v1alpha2.BackupStrategy{Spec: v1alpha2.BackupStrategySpec{QuietDownDuringBackup: true}}
+
+	It("Should Keep The BackupStrategy Of A Sidecar Jenkins", func() {
+		jenkins := &v1alpha2.Jenkins{Spec: v1alpha2.JenkinsSpec{BackupVolumes: []string{"backup-volume"}}}
+
+		strategy := withJenkinsBackupRunner(backupStrategy, jenkins)
+
+		Expect(strategy).To(BeIdenticalTo(backupStrategy))
+		Expect(isBackupVolumeMounted(jenkins, "backup-volume")).To(BeTrue())
+	})
+
+	It("Should Run The Backups Of A Job-runner Jenkins In Jobs", func() {
+		jenkins := &v1alpha2.Jenkins{Spec: v1alpha2.JenkinsSpec{BackupVolumes: []string{"backup-volume"}, BackupRunner: v1alpha2.BackupRunnerJob}}
+
+		strategy := withJenkinsBackupRunner(backupStrategy, jenkins)
+
+		// Jenkins is quieted down through its API, the BackupStrategy itself is left as is
+		Expect(isBackupJobRunner(strategy)).To(BeTrue())
+		Expect(strategy.Spec.QuietDownDuringBackup).To(BeTrue())
+		Expect(backupStrategy.Spec.Runner).To(BeEmpty())
+		Expect(isBackupVolumeMounted(jenkins, "backup-volume")).To(BeFalse())
+	})
+})
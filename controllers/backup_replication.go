@@ -0,0 +1,220 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jenkinsci/jenkins-automation-operator/api/v1alpha2"
+	"github.com/jenkinsci/jenkins-automation-operator/pkg/exec"
+	"github.com/operator-framework/operator-lib/status"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var (
+	// Replicated is set once the Backup was copied to the replicas of its BackupStrategy
+	Replicated status.ConditionType = "Replicated"
+	// ReplicationFailed is the reason of the Replicated condition when the Backup could not be copied to a replica
+	ReplicationFailed status.ConditionReason = "ReplicationFailed"
+	// BackupReplicaNotFound is the reason of the RestoreInitialized condition when the Backup was not copied to the
+	// BackupVolume the Restore references
+	BackupReplicaNotFound status.ConditionReason = "BackupReplicaNotFound"
+)
+
+// performBackupReplication copies the archive and the manifest of the succeeded Backup to the replicas of the
+// BackupStrategy which don't have a copy yet. The copies are stopped with the operation, a failed copy is reported
+// in the status of the Backup, which succeeds anyway.
+func (r *BackupReconciler) performBackupReplication(ctx context.Context, operation context.Context, execClient exec.KubeExecClient, jenkinsInstance *v1alpha2.Jenkins, jenkinsPod *corev1.Pod, backupInstance *v1alpha2.Backup, backupStrategy *v1alpha2.BackupStrategy) error {
+	if len(backupStrategy.Spec.Replicas) == 0 || len(backupInstance.Status.VolumeSnapshot) > 0 || isGitExportStrategy(backupStrategy) {
+		return nil
+	}
+	for _, replicaName := range backupStrategy.Spec.Replicas {
+		if replica := getBackupReplica(backupInstance, replicaName); replica != nil && replica.Succeeded {
+			continue
+		}
+		replica := v1alpha2.BackupReplica{BackupVolume: replicaName}
+		target, err := newReplicaStorage(ctx, r.Client, execClient, jenkinsInstance, jenkinsPod, backupInstance, replicaName)
+		if err == nil {
+			replica.Path = target.location()
+			err = r.replicateBackup(operation, execClient, jenkinsInstance, jenkinsPod, backupInstance, backupStrategy, target)
+		}
+		now := metav1.Now()
+		replica.CompletionTime = &now
+		replica.Succeeded = err == nil
+		if err != nil {
+			replica.Message = err.Error()
+			logger.Info(fmt.Sprintf("Failed to copy Backup '%s' to BackupVolume '%s': %s", backupInstance.Name, replicaName, err))
+		}
+		setBackupReplica(backupInstance, replica)
+	}
+
+	failed := []string{}
+	for _, replicaName := range backupStrategy.Spec.Replicas {
+		if replica := getBackupReplica(backupInstance, replicaName); replica != nil && !replica.Succeeded {
+			failed = append(failed, fmt.Sprintf("%s: %s", replicaName, replica.Message))
+		}
+	}
+	if len(failed) > 0 {
+		backupInstance.Status.Conditions.SetCondition(status.Condition{
+			Type:    Replicated,
+			Status:  corev1.ConditionFalse,
+			Reason:  ReplicationFailed,
+			Message: fmt.Sprintf("failed to copy Backup to %s", strings.Join(failed, ", ")),
+		})
+	} else {
+		backupInstance.Status.Conditions.SetCondition(status.Condition{
+			Type:    Replicated,
+			Status:  corev1.ConditionTrue,
+			Message: fmt.Sprintf("Backup copied to %d replicas", len(backupStrategy.Spec.Replicas)),
+		})
+	}
+	return r.Client.Status().Update(ctx, backupInstance)
+}
+
+// replicateBackup copies the archive and the manifest of the Backup from its BackupVolume to the replica storage
+func (r *BackupReconciler) replicateBackup(ctx context.Context, execClient exec.KubeExecClient, jenkinsInstance *v1alpha2.Jenkins, jenkinsPod *corev1.Pod, backupInstance *v1alpha2.Backup, backupStrategy *v1alpha2.BackupStrategy, target backupStorage) error {
+	backupVolume, err := getBackupVolume(ctx, r.Client, backupInstance)
+	if err != nil {
+		return err
+	}
+	if backupVolume.Spec.S3 == nil && !isBackupVolumeMounted(jenkinsInstance, backupVolume.Name) {
+		return fmt.Errorf("backupVolume '%s' of the Backup is not mounted in the backup sidecar of Jenkins '%s'", backupVolume.Name, jenkinsInstance.Name)
+	}
+	source, err := newBackupStorage(ctx, r.Client, execClient, jenkinsPod, backupInstance, backupVolume)
+	if err != nil {
+		return err
+	}
+	if source.location() == target.location() {
+		return fmt.Errorf("the replica is the same location as the Backup, %s", source.location())
+	}
+	encryptionKey, err := getBackupEncryptionKey(ctx, r.Client, backupStrategy)
+	if err != nil {
+		return err
+	}
+	return copyBackup(ctx, source, target, encryptionKey)
+}
+
+// copyBackup streams the archive of the Backup from the source storage to the target storage, verifying it against
+// its manifest on the way. The manifest is only written to the target once the copy is verified, otherwise the
+// incomplete copy is deleted.
+func copyBackup(ctx context.Context, source, target backupStorage, encryptionKey []byte) error {
+	manifest, err := readBackupManifest(ctx, source)
+	if err != nil {
+		return fmt.Errorf("failed to read the manifest of the Backup: %s", err)
+	}
+	archiveReader, archiveWriter := io.Pipe()
+	verifyReader, verifyWriter := io.Pipe()
+	readErr := make(chan error, 1)
+	go func() {
+		err := source.readFile(ctx, BackupArchiveName, io.MultiWriter(archiveWriter, verifyWriter))
+		_ = archiveWriter.CloseWithError(err)
+		_ = verifyWriter.CloseWithError(err)
+		readErr <- err
+	}()
+	verifyErr := make(chan error, 1)
+	go func() {
+		err := verifyStoredBackupArchive(verifyReader, manifest, encryptionKey)
+		_ = verifyReader.CloseWithError(err)
+		verifyErr <- err
+	}()
+	storeErr := target.writeFile(ctx, BackupArchiveName, archiveReader)
+	_ = archiveReader.CloseWithError(storeErr)
+	err = firstError(<-readErr, <-verifyErr, storeErr)
+	if err == nil {
+		err = writeBackupManifest(ctx, target, manifest)
+	}
+	if err != nil {
+		if deleteErr := target.delete(ctx); deleteErr != nil {
+			logger.Info(fmt.Sprintf("Failed to delete the incomplete copy of the Backup in %s: %s", target.location(), deleteErr))
+		}
+		return err
+	}
+	return nil
+}
+
+// firstError returns the first of the errors which is not nil
+func firstError(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newReplicaStorage returns the storage of the copy of the Backup on the replica BackupVolume. A replica stored in a
+// PersistentVolumeClaim is written through the backup sidecar of the Jenkins Pod, it must be mounted in it.
+func newReplicaStorage(ctx context.Context, c client.Client, execClient exec.KubeExecClient, jenkins *v1alpha2.Jenkins, jenkinsPod *corev1.Pod, backup *v1alpha2.Backup, replicaName string) (backupStorage, error) {
+	if replicaName == backup.Spec.BackupVolumeRef {
+		return nil, fmt.Errorf("backupVolume '%s' is the BackupVolume of the Backup", replicaName)
+	}
+	replicaBackup := getReplicaBackup(backup, replicaName)
+	replicaVolume, err := getBackupVolume(ctx, c, replicaBackup)
+	if err != nil {
+		return nil, err
+	}
+	if replicaVolume.Spec.S3 == nil && !isBackupVolumeMounted(jenkins, replicaName) {
+		return nil, fmt.Errorf("backupVolume '%s' is not mounted in the backup sidecar of Jenkins '%s'", replicaName, jenkins.Name)
+	}
+	return newBackupStorage(ctx, c, execClient, jenkinsPod, replicaBackup, replicaVolume)
+}
+
+// getReplicaBackup returns a copy of the Backup stored on the replica BackupVolume, the storage of its files is
+// located from it like the one of the Backup
+func getReplicaBackup(backup *v1alpha2.Backup, replicaName string) *v1alpha2.Backup {
+	replicaBackup := backup.DeepCopy()
+	replicaBackup.Spec.BackupVolumeRef = replicaName
+	return replicaBackup
+}
+
+// getBackupReplica returns the outcome of the copy of the Backup to the replica BackupVolume, or nil
+func getBackupReplica(backup *v1alpha2.Backup, replicaName string) *v1alpha2.BackupReplica {
+	for i := range backup.Status.Replicas {
+		if backup.Status.Replicas[i].BackupVolume == replicaName {
+			return &backup.Status.Replicas[i]
+		}
+	}
+	return nil
+}
+
+// setBackupReplica sets the outcome of the copy of the Backup to a replica BackupVolume
+func setBackupReplica(backup *v1alpha2.Backup, replica v1alpha2.BackupReplica) {
+	if existing := getBackupReplica(backup, replica.BackupVolume); existing != nil {
+		*existing = replica
+		return
+	}
+	backup.Status.Replicas = append(backup.Status.Replicas, replica)
+}
+
+// getSucceededReplicas returns the names of the replica BackupVolumes holding a copy of the Backup
+func getSucceededReplicas(backup *v1alpha2.Backup) []string {
+	replicas := []string{}
+	for _, replica := range backup.Status.Replicas {
+		if replica.Succeeded {
+			replicas = append(replicas, replica.BackupVolume)
+		}
+	}
+	return replicas
+}
+
+// isBackupVolumeMounted returns true if the BackupVolume is mounted in the backup sidecar of the Jenkins. The Pod of a
+// Jenkins running its Backups and Restores in Jobs mounts none.
+func isBackupVolumeMounted(jenkins *v1alpha2.Jenkins, backupVolumeName string) bool {
+	if jenkins.Spec.BackupRunner == v1alpha2.BackupRunnerJob {
+		return false
+	}
+	return isBackupVolumeListed(jenkins, backupVolumeName)
+}
+
+// isBackupVolumeListed returns true if the BackupVolume is one of the BackupVolumes of the Jenkins, whatever its runner
+func isBackupVolumeListed(jenkins *v1alpha2.Jenkins, backupVolumeName string) bool {
+	for _, name := range jenkins.Spec.BackupVolumes {
+		if name == backupVolumeName {
+			return true
+		}
+	}
+	return false
+}
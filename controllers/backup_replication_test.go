@@ -0,0 +1,158 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/jenkinsci/jenkins-automation-operator/api/v1alpha2"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Backup copy", func() {
+	ctx := context.Background()
+	var (
+		directory  string
+		source     *localBackupStorage
+		compressed *bytes.Buffer
+		checksums  map[string]string
+	)
+
+	BeforeEach(func() {
+		var err error
+		directory, err = ioutil.TempDir("", "replication")
+		Expect(err).NotTo(HaveOccurred())
+		source = &localBackupStorage{directory: filepath.Join(directory, "backup-volume", "backup")}
+		compressed = &bytes.Buffer{}
+		checksums, err = writeBackupArchive(newTestArchive(map[string]string{"config.xml": "config"}), compressed, nil)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = storeBackupArchive(ctx, source, bytes.NewReader(compressed.Bytes()), &BackupManifest{Backup: "backup", Files: checksums})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(directory)).To(Succeed())
+	})
+
+	It("Should Copy The Archive", func() {
+		target := &localBackupStorage{directory: filepath.Join(directory, "replica", "backup")}
+
+		err := copyBackup(ctx, source, target, nil)
+
+		Expect(err).NotTo(HaveOccurred())
+		manifest, err := readBackupManifest(ctx, target)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(manifest.Backup).To(Equal("backup"))
+		archive, _, err := downloadBackupArchive(ctx, target, manifest, nil, "backup")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.Remove(archive.Name())
+		defer archive.Close()
+	})
+
+	It("Should Not Copy A Corrupted Archive", func() {
+		target := &localBackupStorage{directory: filepath.Join(directory, "corrupted-replica", "backup")}
+		_, err := storeBackupArchive(ctx, source, bytes.NewReader(compressed.Bytes()[:compressed.Len()/2]), &BackupManifest{Backup: "backup", Files: checksums})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = copyBackup(ctx, source, target, nil)
+
+		Expect(err).To(HaveOccurred())
+		_, err = os.Stat(target.directory)
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+})
+
+var _ = Describe("Replica storage", func() {
+	ctx := context.Background()
+	backup := &v1alpha2.Backup{
+		ObjectMeta: metav1.ObjectMeta{Name: "backup", Namespace: "jenkins"},
+		Spec:       v1alpha2.BackupSpec{JenkinsRef: "jenkins", BackupVolumeRef: "backup-volume"},
+	}
+	jenkins := &v1alpha2.Jenkins{
+		ObjectMeta: metav1.ObjectMeta{Name: "jenkins", Namespace: "jenkins"},
+		Spec:       v1alpha2.JenkinsSpec{BackupVolumes: []string{"backup-volume", "replica"}},
+	}
+	var c client.Client
+
+	BeforeEach(func() {
+		Expect(v1alpha2.AddToScheme(scheme.Scheme)).To(Succeed())
+		c = fake.NewFakeClientWithScheme(scheme.Scheme,
+			&v1alpha2.BackupVolume{ObjectMeta: metav1.ObjectMeta{Name: "replica", Namespace: "jenkins"}},
+			&v1alpha2.BackupVolume{ObjectMeta: metav1.ObjectMeta{Name: "unmounted-replica", Namespace: "jenkins"}},
+		)
+	})
+
+	It("Should Store Into A Mounted Replica", func() {
+		storage, err := newReplicaStorage(ctx, c, nil, jenkins, nil, backup, "replica")
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(storage.location()).To(Equal("/jenkins-backups/replica/backup"))
+		Expect(backup.Spec.BackupVolumeRef).To(Equal("backup-volume"))
+	})
+
+	It("Should Fail When The Replica Is Not Mounted In The Backup Sidecar", func() {
+		_, err := newReplicaStorage(ctx, c, nil, jenkins, nil, backup, "unmounted-replica")
+
+		Expect(err).To(MatchError("backupVolume 'unmounted-replica' is not mounted in the backup sidecar of Jenkins 'jenkins'"))
+	})
+
+	It("Should Fail When The Replica Is The BackupVolume Of The Backup", func() {
+		_, err := newReplicaStorage(ctx, c, nil, jenkins, nil, backup, "backup-volume")
+
+		Expect(err).To(MatchError("backupVolume 'backup-volume' is the BackupVolume of the Backup"))
+	})
+
+	It("Should Fail When The Replica Is Missing", func() {
+		_, err := newReplicaStorage(ctx, c, nil, jenkins, nil, backup, "missing")
+
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("Backup replicas", func() {
+	It("Should Record The Latest Copy To Each Replica", func() {
+		backup := &v1alpha2.Backup{}
+
+		setBackupReplica(backup, v1alpha2.BackupReplica{BackupVolume: "replica-1", Message: "timeout"})
+		setBackupReplica(backup, v1alpha2.BackupReplica{BackupVolume: "replica-2", Succeeded: true})
+		setBackupReplica(backup, v1alpha2.BackupReplica{BackupVolume: "replica-1", Succeeded: true})
+
+		Expect(backup.Status.Replicas).To(Equal([]v1alpha2.BackupReplica{
+			{BackupVolume: "replica-1", Succeeded: true},
+			{BackupVolume: "replica-2", Succeeded: true},
+		}))
+		Expect(getSucceededReplicas(backup)).To(Equal([]string{"replica-1", "replica-2"}))
+	})
+})
+
+var _ = Describe("Restore source Backup", func() {
+	It("Should Restore From The Selected Replica", func() {
+		backup := &v1alpha2.Backup{
+			ObjectMeta: metav1.ObjectMeta{Name: "backup", Namespace: "jenkins"},
+			Spec:       v1alpha2.BackupSpec{BackupVolumeRef: "backup-volume"},
+			Status: v1alpha2.BackupStatus{Replicas: []v1alpha2.BackupReplica{
+				{BackupVolume: "replica", Succeeded: true},
+				{BackupVolume: "failed-replica", Message: "timeout"},
+			}},
+		}
+
+		source, err := getRestoreSourceBackup(backup, "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(source).To(Equal(backup))
+
+		source, err = getRestoreSourceBackup(backup, "replica")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(source.Spec.BackupVolumeRef).To(Equal("replica"))
+		Expect(backup.Spec.BackupVolumeRef).To(Equal("backup-volume"))
+
+		_, err = getRestoreSourceBackup(backup, "failed-replica")
+		Expect(err).To(MatchError("backup 'backup' was not copied to BackupVolume 'failed-replica'"))
+	})
+})
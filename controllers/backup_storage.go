@@ -0,0 +1,268 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/jenkinsci/jenkins-automation-operator/api/v1alpha2"
+	"github.com/jenkinsci/jenkins-automation-operator/pkg/configuration/base/resources"
+	"github.com/jenkinsci/jenkins-automation-operator/pkg/encryption"
+	"github.com/jenkinsci/jenkins-automation-operator/pkg/exec"
+	"github.com/jenkinsci/jenkins-automation-operator/pkg/objectstorage"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// S3AccessKeyIDKey is the key of the access key ID in the S3 credentials Secret
+	S3AccessKeyIDKey = "AWS_ACCESS_KEY_ID"
+	// S3SecretAccessKeyKey is the key of the secret access key in the S3 credentials Secret
+	S3SecretAccessKeyKey = "AWS_SECRET_ACCESS_KEY"
+	// S3SessionTokenKey is the optional key of the session token of temporary credentials in the S3 credentials Secret
+	S3SessionTokenKey = "AWS_SESSION_TOKEN"
+	// DefaultEncryptionKeyKey is the default key of the encryption key in the encryption Secret
+	DefaultEncryptionKeyKey = "key"
+
+	// restoreSnapshotsDirectory holds the snapshots of the Restores on a BackupVolume, the names of the Backups and of
+	// the namespaces can't start with a dot so it is never taken for one of them
+	restoreSnapshotsDirectory = ".restore-snapshots"
+)
+
+// backupStorage reads and writes the files of a Backup on its BackupVolume
+type backupStorage interface {
+	// writeFile stores the content in the named file of the Backup
+	writeFile(ctx context.Context, name string, content io.Reader) error
+	// readFile writes the content of the named file of the Backup to out
+	readFile(ctx context.Context, name string, out io.Writer) error
+	// delete removes all the files of the Backup
+	delete(ctx context.Context) error
+	// location returns where the files of the Backup are stored
+	location() string
+}
+
+// volumeBackupStorage stores the files in the directory of the Backup in the PersistentVolumeClaim of the BackupVolume,
+// through the backup sidecar of the Jenkins Pod
+type volumeBackupStorage struct {
+	execClient exec.KubeExecClient
+	jenkinsPod *corev1.Pod
+	directory  string
+	// resourceName is the name of the resource on behalf of which the scripts run in the backup sidecar
+	resourceName string
+}
+
+func (s *volumeBackupStorage) writeFile(ctx context.Context, name string, content io.Reader) error {
+	execWriteFile := strings.Join([]string{"mkdir", "-p", s.directory, "&&", "cat", ">", path.Join(s.directory, name)}, " ")
+	return s.execClient.StreamRequest(ctx, s.jenkinsPod, s.resourceName, execWriteFile, content, &bytes.Buffer{})
+}
+
+func (s *volumeBackupStorage) readFile(ctx context.Context, name string, out io.Writer) error {
+	execReadFile := strings.Join([]string{"cat", path.Join(s.directory, name)}, " ")
+	return s.execClient.StreamRequest(ctx, s.jenkinsPod, s.resourceName, execReadFile, nil, out)
+}
+
+func (s *volumeBackupStorage) location() string {
+	return s.directory
+}
+
+func (s *volumeBackupStorage) delete(ctx context.Context) error {
+	execDeleteBackupDir := strings.Join([]string{"rm", "-rf", s.directory}, " ")
+	return s.execClient.MakeRequest(ctx, s.jenkinsPod, s.resourceName, execDeleteBackupDir)
+}
+
+// localBackupStorage stores the files in the directory of the Backup on the PersistentVolumeClaim of the BackupVolume
+// mounted in a backup Job
+type localBackupStorage struct {
+	directory string
+}
+
+func (s *localBackupStorage) writeFile(ctx context.Context, name string, content io.Reader) error {
+	if err := os.MkdirAll(s.directory, 0755); err != nil {
+		return err
+	}
+	file, err := os.Create(path.Join(s.directory, name))
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(file, content); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func (s *localBackupStorage) readFile(ctx context.Context, name string, out io.Writer) error {
+	file, err := os.Open(path.Join(s.directory, name))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(out, file)
+	return err
+}
+
+func (s *localBackupStorage) location() string {
+	return s.directory
+}
+
+func (s *localBackupStorage) delete(ctx context.Context) error {
+	return os.RemoveAll(s.directory)
+}
+
+// objectStorageBackupStorage stores the files as objects in the bucket of the BackupVolume
+type objectStorageBackupStorage struct {
+	client    objectstorage.Client
+	bucket    string
+	keyPrefix string
+	// fileNames are the files of a Backup, deleted along with it
+	fileNames []string
+}
+
+func (s *objectStorageBackupStorage) writeFile(ctx context.Context, name string, content io.Reader) error {
+	return s.client.PutObject(ctx, path.Join(s.keyPrefix, name), content)
+}
+
+func (s *objectStorageBackupStorage) readFile(ctx context.Context, name string, out io.Writer) error {
+	object, err := s.client.GetObject(ctx, path.Join(s.keyPrefix, name))
+	if err != nil {
+		return err
+	}
+	defer object.Close()
+	_, err = io.Copy(out, object)
+	return err
+}
+
+func (s *objectStorageBackupStorage) location() string {
+	return "s3://" + path.Join(s.bucket, s.keyPrefix)
+}
+
+func (s *objectStorageBackupStorage) delete(ctx context.Context) error {
+	for _, name := range s.fileNames {
+		if err := s.client.DeleteObject(ctx, path.Join(s.keyPrefix, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newBackupStorage returns the storage of the Backup files, depending on the kind of its BackupVolume
+func newBackupStorage(ctx context.Context, c client.Client, execClient exec.KubeExecClient, jenkinsPod *corev1.Pod, backup *v1alpha2.Backup, backupVolume *v1alpha2.BackupVolume) (backupStorage, error) {
+	if backupVolume.Spec.S3 == nil {
+		return &volumeBackupStorage{execClient: execClient, jenkinsPod: jenkinsPod, directory: getBackupLocation(backup), resourceName: backup.Name}, nil
+	}
+	objectStorageClient, err := newObjectStorageClient(ctx, c, backupVolume)
+	if err != nil {
+		return nil, err
+	}
+	return &objectStorageBackupStorage{
+		client:    objectStorageClient,
+		bucket:    backupVolume.Spec.S3.Bucket,
+		keyPrefix: getBackupObjectKeyPrefix(backupVolume, backup),
+		fileNames: []string{BackupArchiveName, BackupManifestName},
+	}, nil
+}
+
+// newRestoreSnapshotStorage returns the storage of the snapshot of the Restore on the BackupVolume, depending on its
+// kind. The snapshots are stored under restoreSnapshotsDirectory, which is not scanned for Backups.
+func newRestoreSnapshotStorage(ctx context.Context, c client.Client, execClient exec.KubeExecClient, jenkinsPod *corev1.Pod, restore *v1alpha2.Restore, backupVolume *v1alpha2.BackupVolume) (backupStorage, error) {
+	if backupVolume.Spec.S3 == nil {
+		return &volumeBackupStorage{execClient: execClient, jenkinsPod: jenkinsPod, directory: getRestoreSnapshotDirectory(restore, backupVolume), resourceName: restore.Name}, nil
+	}
+	objectStorageClient, err := newObjectStorageClient(ctx, c, backupVolume)
+	if err != nil {
+		return nil, err
+	}
+	return &objectStorageBackupStorage{
+		client:    objectStorageClient,
+		bucket:    backupVolume.Spec.S3.Bucket,
+		keyPrefix: getRestoreSnapshotKeyPrefix(restore, backupVolume),
+		fileNames: []string{BackupArchiveName, BackupManifestName},
+	}, nil
+}
+
+// getRestoreSnapshotDirectory returns the directory of the snapshot of the Restore on the BackupVolume, as it is mounted
+// in the backup sidecar and in the backup Jobs
+func getRestoreSnapshotDirectory(restore *v1alpha2.Restore, backupVolume *v1alpha2.BackupVolume) string {
+	return path.Join(resources.JenkinsBackupVolumePath, backupVolume.Name, restoreSnapshotsDirectory, restore.Name)
+}
+
+// getRestoreSnapshotKeyPrefix returns the prefix of the objects of the snapshot of the Restore in the bucket of the
+// BackupVolume
+func getRestoreSnapshotKeyPrefix(restore *v1alpha2.Restore, backupVolume *v1alpha2.BackupVolume) string {
+	return path.Join(backupVolume.Spec.S3.Prefix, restoreSnapshotsDirectory, restore.Namespace, restore.Name)
+}
+
+// getBackupLocation returns the directory where the Backup is stored in the backup sidecar
+func getBackupLocation(backup *v1alpha2.Backup) string {
+	return resources.JenkinsBackupVolumePath + "/" + backup.Spec.BackupVolumeRef + "/" + backup.Name
+}
+
+// getBackupVolumePVCName returns the name of the PersistentVolumeClaim of the BackupVolume
+func getBackupVolumePVCName(backupVolume *v1alpha2.BackupVolume) string {
+	if len(backupVolume.Spec.PersistentVolumeClaimName) > 0 {
+		return backupVolume.Spec.PersistentVolumeClaimName
+	}
+	return backupVolume.Name + "-jenkins-backup"
+}
+
+// getBackupVolume returns the BackupVolume where the Backup is stored
+func getBackupVolume(ctx context.Context, c client.Client, backup *v1alpha2.Backup) (*v1alpha2.BackupVolume, error) {
+	backupVolume := &v1alpha2.BackupVolume{}
+	err := c.Get(ctx, types.NamespacedName{Name: backup.Spec.BackupVolumeRef, Namespace: backup.Namespace}, backupVolume)
+	if err != nil {
+		return nil, err
+	}
+	return backupVolume, nil
+}
+
+// newObjectStorageClient returns a client for the bucket of the BackupVolume, using the credentials from its Secret
+func newObjectStorageClient(ctx context.Context, c client.Client, backupVolume *v1alpha2.BackupVolume) (objectstorage.Client, error) {
+	s3 := backupVolume.Spec.S3
+	secret := &corev1.Secret{}
+	err := c.Get(ctx, types.NamespacedName{Name: s3.CredentialsSecretRef, Namespace: backupVolume.Namespace}, secret)
+	if err != nil {
+		return nil, err
+	}
+	credentials := objectstorage.Credentials{
+		AccessKeyID:     string(secret.Data[S3AccessKeyIDKey]),
+		SecretAccessKey: string(secret.Data[S3SecretAccessKeyKey]),
+		SessionToken:    string(secret.Data[S3SessionTokenKey]),
+	}
+	if len(credentials.AccessKeyID) == 0 || len(credentials.SecretAccessKey) == 0 {
+		return nil, fmt.Errorf("secret '%s' must contain the %s and %s keys", s3.CredentialsSecretRef, S3AccessKeyIDKey, S3SecretAccessKeyKey)
+	}
+	return objectstorage.NewS3Client(s3.Endpoint, s3.Region, s3.Bucket, credentials)
+}
+
+// getBackupObjectKeyPrefix returns the prefix of the keys of the Backup files in the bucket of the BackupVolume
+func getBackupObjectKeyPrefix(backupVolume *v1alpha2.BackupVolume, backup *v1alpha2.Backup) string {
+	return path.Join(backupVolume.Spec.S3.Prefix, backup.Namespace, backup.Name)
+}
+
+// getBackupEncryptionKey returns the key encrypting the archives from the Secret of the BackupStrategy,
+// or nil if the encryption is not set
+func getBackupEncryptionKey(ctx context.Context, c client.Client, backupStrategy *v1alpha2.BackupStrategy) ([]byte, error) {
+	backupEncryption := backupStrategy.Spec.Encryption
+	if backupEncryption == nil {
+		return nil, nil
+	}
+	secret := &corev1.Secret{}
+	err := c.Get(ctx, types.NamespacedName{Name: backupEncryption.SecretRef, Namespace: backupStrategy.Namespace}, secret)
+	if err != nil {
+		return nil, err
+	}
+	key := backupEncryption.Key
+	if len(key) == 0 {
+		key = DefaultEncryptionKeyKey
+	}
+	encryptionKey := secret.Data[key]
+	if len(encryptionKey) < encryption.MinKeyLength {
+		return nil, fmt.Errorf("secret '%s' must contain an encryption key of at least %d bytes in the %s key", backupEncryption.SecretRef, encryption.MinKeyLength, key)
+	}
+	return encryptionKey, nil
+}
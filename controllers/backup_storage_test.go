@@ -0,0 +1,76 @@
+package controllers
+
+import (
+	"context"
+
+	"github.com/jenkinsci/jenkins-automation-operator/api/v1alpha2"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Backup object key prefix", func() {
+	backup := &v1alpha2.Backup{ObjectMeta: metav1.ObjectMeta{Name: "backup-sample", Namespace: "jenkins"}}
+
+	It("Should Be The Namespace And Name Of The Backup", func() {
+		backupVolume := &v1alpha2.BackupVolume{Spec: v1alpha2.BackupVolumeSpec{S3: &v1alpha2.S3Storage{Bucket: "backups"}}}
+
+		Expect(getBackupObjectKeyPrefix(backupVolume, backup)).To(Equal("jenkins/backup-sample"))
+	})
+
+	It("Should Start With The Prefix Of The BackupVolume", func() {
+		backupVolume := &v1alpha2.BackupVolume{Spec: v1alpha2.BackupVolumeSpec{S3: &v1alpha2.S3Storage{Bucket: "backups", Prefix: "cluster-1/"}}}
+
+		Expect(getBackupObjectKeyPrefix(backupVolume, backup)).To(Equal("cluster-1/jenkins/backup-sample"))
+	})
+})
+
+var _ = Describe("Backup encryption key", func() {
+	ctx := context.Background()
+	fakeClient := fake.NewFakeClient(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "backup-encryption", Namespace: "jenkins"},
+		Data: map[string][]byte{
+			"key":   []byte("0123456789abcdef0123456789abcdef"),
+			"short": []byte("0123456789"),
+		},
+	})
+	var backupStrategy *v1alpha2.BackupStrategy
+
+	BeforeEach(func() {
+		backupStrategy = &v1alpha2.BackupStrategy{ObjectMeta: metav1.ObjectMeta{Name: "backupstrategy", Namespace: "jenkins"}}
+	})
+
+	It("Should Be Nil When Encryption Is Not Set", func() {
+		key, err := getBackupEncryptionKey(ctx, fakeClient, backupStrategy)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(key).To(BeNil())
+	})
+
+	It("Should Be Read From The Default Key Of The Secret", func() {
+		backupStrategy.Spec.Encryption = &v1alpha2.BackupEncryption{SecretRef: "backup-encryption"}
+
+		key, err := getBackupEncryptionKey(ctx, fakeClient, backupStrategy)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(key).To(Equal([]byte("0123456789abcdef0123456789abcdef")))
+	})
+
+	It("Should Be Rejected When Too Short", func() {
+		backupStrategy.Spec.Encryption = &v1alpha2.BackupEncryption{SecretRef: "backup-encryption", Key: "short"}
+
+		_, err := getBackupEncryptionKey(ctx, fakeClient, backupStrategy)
+
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should Fail When The Secret Is Missing", func() {
+		backupStrategy.Spec.Encryption = &v1alpha2.BackupEncryption{SecretRef: "missing"}
+
+		_, err := getBackupEncryptionKey(ctx, fakeClient, backupStrategy)
+
+		Expect(err).To(HaveOccurred())
+	})
+})
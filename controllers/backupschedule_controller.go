@@ -0,0 +1,236 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/jenkinsci/jenkins-automation-operator/api/v1alpha2"
+	"github.com/jenkinsci/jenkins-automation-operator/pkg/constants"
+	"github.com/jenkinsci/jenkins-automation-operator/pkg/notifications/event"
+	"github.com/operator-framework/operator-lib/status"
+	"github.com/robfig/cron/v3"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// BackupScheduleReconciler reconciles a BackupSchedule object
+type BackupScheduleReconciler struct {
+	client.Client
+	Log                logr.Logger
+	Scheme             *runtime.Scheme
+	NotificationEvents chan event.Event
+}
+
+var (
+	// ScheduleValid and other Condition Types
+	ScheduleValid     status.ConditionType = "ScheduleValid"
+	ScheduleSuspended status.ConditionType = "ScheduleSuspended"
+)
+
+// maxMissedStartTimes is the maximum number of missed start times counted by getScheduledTimes, like for a CronJob
+const maxMissedStartTimes = 100
+
+// +kubebuilder:rbac:groups=jenkins.io,resources=backupschedules;backupschedules/status,verbs=*
+
+func (r *BackupScheduleReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&v1alpha2.BackupSchedule{}).
+		Owns(&v1alpha2.Backup{}).
+		Complete(r)
+}
+
+func (r *BackupScheduleReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+	scheduleLogger := r.Log.WithValues("backupSchedule", req.NamespacedName)
+	now := time.Now()
+
+	// Fetch the BackupSchedule instance
+	backupSchedule := &v1alpha2.BackupSchedule{}
+	err := r.Client.Get(ctx, req.NamespacedName, backupSchedule)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			// Request object not found, could have been deleted after reconcile request.
+			// Owned objects are automatically garbage collected. For additional cleanup logic use finalizers.
+			// Return and don't requeue
+			return ctrl.Result{}, nil
+		}
+		// Error reading the object - requeue the request.
+		return ctrl.Result{}, err
+	}
+
+	schedule, err := cron.ParseStandard(backupSchedule.Spec.Schedule)
+	if err != nil {
+		scheduleLogger.Info(fmt.Sprintf("Invalid schedule '%s': %s", backupSchedule.Spec.Schedule, err))
+		backupSchedule.Status.Conditions.SetCondition(status.Condition{
+			Type:    ScheduleValid,
+			Status:  corev1.ConditionFalse,
+			Reason:  "InvalidSchedule",
+			Message: err.Error(),
+		})
+		// Don't requeue, the spec has to be corrected
+		return ctrl.Result{}, r.Client.Status().Update(ctx, backupSchedule)
+	}
+	backupSchedule.Status.Conditions.SetCondition(status.Condition{
+		Type:   ScheduleValid,
+		Status: corev1.ConditionTrue,
+	})
+
+	backupList := &v1alpha2.BackupList{}
+	err = r.Client.List(ctx, backupList, client.InNamespace(req.Namespace), client.MatchingLabels{constants.LabelBackupScheduleKey: backupSchedule.Name})
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if lastSuccessfulBackup := getLastSuccessfulBackup(backupList.Items); lastSuccessfulBackup != nil {
+		backupSchedule.Status.LastSuccessfulBackup = lastSuccessfulBackup.Name
+	}
+
+	if backupSchedule.Spec.Suspend {
+		scheduleLogger.V(1).Info("BackupSchedule is suspended, skipping")
+		backupSchedule.Status.Conditions.SetCondition(status.Condition{
+			Type:   ScheduleSuspended,
+			Status: corev1.ConditionTrue,
+		})
+		// Resuming the schedule is a spec change which will trigger a new reconcile
+		return ctrl.Result{}, r.Client.Status().Update(ctx, backupSchedule)
+	}
+	backupSchedule.Status.Conditions.SetCondition(status.Condition{
+		Type:   ScheduleSuspended,
+		Status: corev1.ConditionFalse,
+	})
+
+	earliestTime := backupSchedule.CreationTimestamp.Time
+	if backupSchedule.Status.LastScheduleTime != nil {
+		earliestTime = backupSchedule.Status.LastScheduleTime.Time
+	}
+	if deadline := backupSchedule.Spec.StartingDeadlineSeconds; deadline != nil {
+		// The runs scheduled before the starting deadline can't be started anymore, there is no need to enumerate them
+		if deadlineTime := now.Add(-time.Duration(*deadline) * time.Second); deadlineTime.After(earliestTime) {
+			earliestTime = deadlineTime
+		}
+	}
+	scheduledTime, missedRuns, tooManyMissed, nextTime := getScheduledTimes(schedule, earliestTime, now)
+	if tooManyMissed {
+		scheduleLogger.Info(fmt.Sprintf("More than %d start times missed, set or decrease startingDeadlineSeconds or check clock skew", maxMissedStartTimes))
+	}
+	if !scheduledTime.IsZero() {
+		// Only the most recent run is started, the older ones are counted as missed
+		deadline := backupSchedule.Spec.StartingDeadlineSeconds
+		if deadline != nil && scheduledTime.Add(time.Duration(*deadline)*time.Second).Before(now) {
+			scheduleLogger.Info(fmt.Sprintf("Missed starting deadline for run scheduled at %s", scheduledTime))
+			missedRuns++
+		} else {
+			backup, err := r.newScheduledBackup(backupSchedule, scheduledTime)
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+			err = r.Client.Create(ctx, backup)
+			if err != nil && !apierrors.IsAlreadyExists(err) {
+				return ctrl.Result{}, err
+			}
+			scheduleLogger.Info(fmt.Sprintf("Backup '%s' created for run scheduled at %s", backup.Name, scheduledTime))
+		}
+		backupSchedule.Status.MissedRuns += missedRuns
+		backupSchedule.Status.LastScheduleTime = &metav1.Time{Time: scheduledTime}
+	}
+
+	err = r.Client.Status().Update(ctx, backupSchedule)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{RequeueAfter: nextTime.Sub(now)}, nil
+}
+
+// newScheduledBackup returns the Backup created by the BackupSchedule for the given scheduled time
+func (r *BackupScheduleReconciler) newScheduledBackup(backupSchedule *v1alpha2.BackupSchedule, scheduledTime time.Time) (*v1alpha2.Backup, error) {
+	backup := &v1alpha2.Backup{
+		ObjectMeta: metav1.ObjectMeta{
+			// Using the scheduled time in the name prevents creating two Backups for the same run
+			Name:      fmt.Sprintf("%s-%d", backupSchedule.Name, scheduledTime.Unix()),
+			Namespace: backupSchedule.Namespace,
+			Labels: map[string]string{
+				constants.LabelBackupScheduleKey: backupSchedule.Name,
+			},
+		},
+		Spec: v1alpha2.BackupSpec{
+			JenkinsRef:      backupSchedule.Spec.JenkinsRef,
+			StrategyRef:     backupSchedule.Spec.StrategyRef,
+			BackupVolumeRef: backupSchedule.Spec.BackupVolumeRef,
+			DeletionPolicy:  backupSchedule.Spec.DeletionPolicy,
+		},
+	}
+	if err := controllerutil.SetControllerReference(backupSchedule, backup, r.Scheme); err != nil {
+		return nil, err
+	}
+	return backup, nil
+}
+
+// getScheduledTimes returns the most recent time scheduled after earliestTime up to now, zero if there is none, the
+// number of older scheduled times, which are missed, and the next scheduled time after now. At most
+// maxMissedStartTimes missed times are counted, as the clock may be skewed or the schedule may have been stopped for a
+// long time: tooManyMissed is true when there were more, and the most recent time is then searched for directly.
+func getScheduledTimes(schedule cron.Schedule, earliestTime, now time.Time) (scheduledTime time.Time, missedTimes int32, tooManyMissed bool, nextTime time.Time) {
+	for scheduled := schedule.Next(earliestTime); !scheduled.After(now); scheduled = schedule.Next(scheduled) {
+		if !scheduledTime.IsZero() {
+			if missedTimes == maxMissedStartTimes {
+				return getMostRecentScheduledTime(schedule, scheduledTime, now), missedTimes, true, schedule.Next(now)
+			}
+			missedTimes++
+		}
+		scheduledTime = scheduled
+	}
+	return scheduledTime, missedTimes, false, schedule.Next(now)
+}
+
+// getMostRecentScheduledTime returns the last scheduled time up to now, the time scheduled after earliestTime must not
+// be after now. The next scheduled time doesn't decrease with the time it follows, so the latest time followed by a
+// scheduled time up to now is bisected to the second, the precision of the schedules.
+func getMostRecentScheduledTime(schedule cron.Schedule, earliestTime, now time.Time) time.Time {
+	low, high := earliestTime, now
+	for high.Sub(low) > time.Second {
+		middle := low.Add(high.Sub(low) / 2)
+		if schedule.Next(middle).After(now) {
+			high = middle
+		} else {
+			low = middle
+		}
+	}
+	return schedule.Next(low)
+}
+
+// getLastSuccessfulBackup returns the most recently created Backup which has completed
+func getLastSuccessfulBackup(backups []v1alpha2.Backup) *v1alpha2.Backup {
+	var lastSuccessfulBackup *v1alpha2.Backup
+	for i, backup := range backups {
+		if !backup.Status.Conditions.IsTrueFor(BackupCompleted) {
+			continue
+		}
+		if lastSuccessfulBackup == nil || lastSuccessfulBackup.CreationTimestamp.Before(&backup.CreationTimestamp) {
+			lastSuccessfulBackup = &backups[i]
+		}
+	}
+	return lastSuccessfulBackup
+}
@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"time"
+
+	"github.com/jenkinsci/jenkins-automation-operator/api/v1alpha2"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/operator-framework/operator-lib/status"
+	"github.com/robfig/cron/v3"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("BackupSchedule scheduled times", func() {
+	var schedule cron.Schedule
+	now := time.Date(2020, 10, 1, 12, 30, 0, 0, time.UTC)
+
+	BeforeEach(func() {
+		var err error
+		schedule, err = cron.ParseStandard("0 * * * *")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("Should Return No Time When No Run Was Missed", func() {
+		scheduledTime, missedTimes, tooManyMissed, nextTime := getScheduledTimes(schedule, time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC), now)
+
+		Expect(scheduledTime.IsZero()).To(BeTrue())
+		Expect(missedTimes).To(BeZero())
+		Expect(tooManyMissed).To(BeFalse())
+		Expect(nextTime).To(Equal(time.Date(2020, 10, 1, 13, 0, 0, 0, time.UTC)))
+	})
+
+	It("Should Return The Scheduled Run", func() {
+		scheduledTime, missedTimes, _, nextTime := getScheduledTimes(schedule, time.Date(2020, 10, 1, 11, 10, 0, 0, time.UTC), now)
+
+		Expect(scheduledTime).To(Equal(time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC)))
+		Expect(missedTimes).To(BeZero())
+		Expect(nextTime).To(Equal(time.Date(2020, 10, 1, 13, 0, 0, 0, time.UTC)))
+	})
+
+	It("Should Return The Most Recent Run And Count The Older Ones As Missed", func() {
+		scheduledTime, missedTimes, tooManyMissed, _ := getScheduledTimes(schedule, time.Date(2020, 10, 1, 9, 0, 0, 0, time.UTC), now)
+
+		Expect(scheduledTime).To(Equal(time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC)))
+		Expect(missedTimes).To(Equal(int32(2)))
+		Expect(tooManyMissed).To(BeFalse())
+	})
+
+	It("Should Count The Hundredth Missed Run", func() {
+		_, missedTimes, tooManyMissed, _ := getScheduledTimes(schedule, now.Add(-101*time.Hour), now)
+
+		Expect(missedTimes).To(Equal(int32(100)))
+		Expect(tooManyMissed).To(BeFalse())
+	})
+
+	It("Should Return The Most Recent Run After Too Many Missed Runs", func() {
+		scheduledTime, missedTimes, tooManyMissed, nextTime := getScheduledTimes(schedule, now.Add(-365*24*time.Hour), now)
+
+		Expect(scheduledTime).To(Equal(time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC)))
+		Expect(missedTimes).To(Equal(int32(maxMissedStartTimes)))
+		Expect(tooManyMissed).To(BeTrue())
+		Expect(nextTime).To(Equal(time.Date(2020, 10, 1, 13, 0, 0, 0, time.UTC)))
+	})
+
+	It("Should Return The Most Recent Run Of A Schedule Every Second", func() {
+		everySecond, err := cron.ParseStandard("@every 1s")
+		Expect(err).NotTo(HaveOccurred())
+
+		scheduledTime, _, tooManyMissed, nextTime := getScheduledTimes(everySecond, now.Add(-time.Hour), now)
+
+		Expect(scheduledTime).To(Equal(now))
+		Expect(tooManyMissed).To(BeTrue())
+		Expect(nextTime).To(Equal(now.Add(time.Second)))
+	})
+})
+
+var _ = Describe("BackupSchedule last successful Backup", func() {
+	day := time.Date(2020, 10, 1, 0, 0, 0, 0, time.UTC)
+	newBackup := func(name string, created time.Time, completed corev1.ConditionStatus) v1alpha2.Backup {
+		backup := v1alpha2.Backup{ObjectMeta: metav1.ObjectMeta{Name: name, CreationTimestamp: metav1.NewTime(created)}}
+		backup.Status.Conditions.SetCondition(status.Condition{Type: BackupCompleted, Status: completed})
+		return backup
+	}
+
+	It("Should Be Nil Without Backups", func() {
+		Expect(getLastSuccessfulBackup(nil)).To(BeNil())
+	})
+
+	It("Should Be The Newest Completed Backup", func() {
+		backups := []v1alpha2.Backup{
+			newBackup("first", day, corev1.ConditionTrue),
+			newBackup("second", day.Add(time.Hour), corev1.ConditionTrue),
+			newBackup("third", day.Add(2*time.Hour), corev1.ConditionFalse),
+		}
+
+		lastSuccessfulBackup := getLastSuccessfulBackup(backups)
+
+		Expect(lastSuccessfulBackup).NotTo(BeNil())
+		Expect(lastSuccessfulBackup.Name).To(Equal("second"))
+	})
+})
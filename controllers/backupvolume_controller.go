@@ -19,6 +19,8 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"sort"
+	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/jenkinsci/jenkins-automation-operator/api/v1alpha2"
@@ -28,17 +30,29 @@ import (
 	storagev1 "k8s.io/api/storage/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
 var (
 	BackupVolumePresent status.ConditionType = "BackupVolumePresent"
 )
 
+const (
+	// backupVolumePruneInterval is the interval at which Backups are checked against the retention MaxAge
+	backupVolumePruneInterval = time.Hour
+	// volumeResizeCheckInterval is the interval at which a PersistentVolumeClaim being resized is checked
+	volumeResizeCheckInterval = time.Minute
+)
+
+// +kubebuilder:rbac:groups=storage.k8s.io,resources=storageclasses,verbs=get;list;watch
+
 // BackupVolumeReconciler reconciles a BackupVolume object
 type BackupVolumeReconciler struct {
 	client.Client
@@ -52,9 +66,28 @@ func (r *BackupVolumeReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&v1alpha2.BackupVolume{}).
 		Owns(&corev1.PersistentVolumeClaim{}).
+		Owns(&corev1.Pod{}).
+		Watches(&source.Kind{Type: &v1alpha2.Backup{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(backupToBackupVolumeRequests),
+		}).
 		Complete(r)
 }
 
+// backupToBackupVolumeRequests maps a Backup to the BackupVolume where it is stored and to the replicas it was copied to
+func backupToBackupVolumeRequests(object handler.MapObject) []reconcile.Request {
+	backup, ok := object.Object.(*v1alpha2.Backup)
+	if !ok || len(backup.Spec.BackupVolumeRef) == 0 {
+		return nil
+	}
+	requests := []reconcile.Request{
+		{NamespacedName: types.NamespacedName{Namespace: backup.Namespace, Name: backup.Spec.BackupVolumeRef}},
+	}
+	for _, replicaName := range getSucceededReplicas(backup) {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: backup.Namespace, Name: replicaName}})
+	}
+	return requests
+}
+
 func (r *BackupVolumeReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	ctx := context.Background()
 	backupLogger := r.Log.WithValues("backupVolume", req.NamespacedName)
@@ -98,10 +131,7 @@ func (r *BackupVolumeReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error
 		volumeSize = backupVolumeSpec.Size
 	}
 
-	backupVolumePVCName := req.Name + "-jenkins-backup"
-	if len(backupVolumeSpec.PersistentVolumeClaimName) > 0 {
-		backupVolumePVCName = backupVolumeSpec.PersistentVolumeClaimName
-	}
+	backupVolumePVCName := getBackupVolumePVCName(backupVolumeInstance)
 
 	backupPVCNamespacedName := types.NamespacedName{
 		Namespace: req.Namespace,
@@ -151,10 +181,139 @@ func (r *BackupVolumeReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error
 		Status: corev1.ConditionTrue,
 	})
 
+	// The PersistentVolumeClaim is expanded when the size of the BackupVolume grows, its usage is reported in the status
+	err = r.resizeBackupVolumePVC(ctx, backupVolumeInstance, backupPVC)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	backupList := &v1alpha2.BackupList{}
+	err = r.Client.List(ctx, backupList, client.InNamespace(backupVolumeInstance.Namespace))
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	r.updateBackupVolumeUsage(ctx, backupVolumeInstance, backupPVC, backupList.Items)
+
 	err = r.Client.Status().Update(ctx, backupVolumeInstance)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
 
-	return ctrl.Result{}, nil
+	// The Backups stored on the volume are listed in its catalog, the volume is scanned again later
+	nextScan, err := r.catalogBackups(ctx, backupVolumeInstance)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	resized := backupVolumeInstance.Status.Conditions.GetCondition(VolumeResized)
+	if resized != nil && resized.Reason == VolumeResizePending && volumeResizeCheckInterval < nextScan {
+		// The capacity of the PersistentVolumeClaim is checked again until it is resized
+		nextScan = volumeResizeCheckInterval
+	}
+
+	retention := backupVolumeSpec.Retention
+	if retention == nil {
+		return ctrl.Result{RequeueAfter: nextScan}, nil
+	}
+	err = r.pruneBackups(ctx, backupVolumeInstance)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if retention.MaxAge != nil && backupVolumePruneInterval < nextScan {
+		// Backups may expire without any event, check again later
+		return ctrl.Result{RequeueAfter: backupVolumePruneInterval}, nil
+	}
+
+	return ctrl.Result{RequeueAfter: nextScan}, nil
+}
+
+// pruneBackups deletes the Backups stored on the BackupVolume, and their data, which are not kept by its retention
+func (r *BackupVolumeReconciler) pruneBackups(ctx context.Context, backupVolume *v1alpha2.BackupVolume) error {
+	backupLogger := r.Log.WithValues("backupVolume", backupVolume.Name)
+	backupList := &v1alpha2.BackupList{}
+	err := r.Client.List(ctx, backupList, client.InNamespace(backupVolume.Namespace))
+	if err != nil {
+		return err
+	}
+	completedBackups := []v1alpha2.Backup{}
+	for _, backup := range backupList.Items {
+		if backup.Spec.BackupVolumeRef == backupVolume.Name && backup.DeletionTimestamp == nil &&
+			backup.Status.Conditions.IsTrueFor(BackupCompleted) {
+			completedBackups = append(completedBackups, backup)
+		}
+	}
+
+	for _, backup := range getBackupsToPrune(completedBackups, backupVolume.Spec.Retention, time.Now()) {
+		backup := backup
+		backupLogger.Info(fmt.Sprintf("Pruning Backup '%s' created at %s", backup.Name, backup.CreationTimestamp))
+		// The data of a pruned Backup is deleted by its finalizer even if its deletion policy is Retain, such as the
+		// Backups adopted from the BackupVolume, otherwise the BackupVolume would never shrink
+		if !isBackupPruned(&backup) || !hasFinalizer(&backup, BackupDataFinalizer) {
+			metav1.SetMetaDataAnnotation(&backup.ObjectMeta, PrunedBackupAnnotation, "true")
+			if !hasFinalizer(&backup, BackupDataFinalizer) {
+				backup.SetFinalizers(append(backup.GetFinalizers(), BackupDataFinalizer))
+			}
+			err = r.Client.Update(ctx, &backup)
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+		}
+		err = r.Client.Delete(ctx, &backup)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// getBackupsToPrune returns the Backups which are not kept by the retention
+func getBackupsToPrune(backups []v1alpha2.Backup, retention *v1alpha2.BackupRetention, now time.Time) []v1alpha2.Backup {
+	sorted := make([]v1alpha2.Backup, len(backups))
+	copy(sorted, backups)
+	// Newest Backups first
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[j].CreationTimestamp.Before(&sorted[i].CreationTimestamp)
+	})
+
+	keepAll := retention.KeepLast == nil && retention.KeepDaily == nil && retention.KeepWeekly == nil
+	keep := make([]bool, len(sorted))
+	if retention.KeepLast != nil {
+		for i := 0; i < len(sorted) && i < int(*retention.KeepLast); i++ {
+			keep[i] = true
+		}
+	}
+	keepLastOfBucket := func(limit *int32, bucket func(time.Time) string) {
+		if limit == nil {
+			return
+		}
+		buckets := map[string]bool{}
+		for i, backup := range sorted {
+			key := bucket(backup.CreationTimestamp.UTC())
+			if buckets[key] {
+				continue
+			}
+			if len(buckets) >= int(*limit) {
+				return
+			}
+			buckets[key] = true
+			keep[i] = true
+		}
+	}
+	keepLastOfBucket(retention.KeepDaily, func(t time.Time) string {
+		return t.Format("2006-01-02")
+	})
+	keepLastOfBucket(retention.KeepWeekly, func(t time.Time) string {
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-%d", year, week)
+	})
+
+	toPrune := []v1alpha2.Backup{}
+	for i, backup := range sorted {
+		expired := retention.MaxAge != nil && backup.CreationTimestamp.Add(retention.MaxAge.Duration).Before(now)
+		if expired || !(keepAll || keep[i]) {
+			toPrune = append(toPrune, backup)
+		}
+	}
+	return toPrune
 }
@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/jenkinsci/jenkins-automation-operator/api/v1alpha2"
+	"github.com/jenkinsci/jenkins-automation-operator/pkg/log"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/operator-framework/operator-lib/status"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// deleteRecordingClient records the objects deleted through it, the fake client deletes them despite their finalizers
+type deleteRecordingClient struct {
+	client.Client
+	deleted []runtime.Object
+}
+
+func (c *deleteRecordingClient) Delete(ctx context.Context, obj runtime.Object, opts ...client.DeleteOption) error {
+	c.deleted = append(c.deleted, obj.DeepCopyObject())
+	return c.Client.Delete(ctx, obj, opts...)
+}
+
+var _ = Describe("BackupVolume retention", func() {
+	now := time.Date(2020, 10, 15, 12, 0, 0, 0, time.UTC)
+	newBackup := func(name string, created time.Time) v1alpha2.Backup {
+		return v1alpha2.Backup{ObjectMeta: metav1.ObjectMeta{Name: name, CreationTimestamp: metav1.NewTime(created)}}
+	}
+	backups := []v1alpha2.Backup{
+		newBackup("oldest", now.Add(-15*24*time.Hour)),
+		newBackup("two-days-ago-morning", now.Add(-2*24*time.Hour-6*time.Hour)),
+		newBackup("two-days-ago-evening", now.Add(-2*24*time.Hour+6*time.Hour)),
+		newBackup("yesterday", now.Add(-24*time.Hour)),
+		newBackup("today", now.Add(-time.Hour)),
+	}
+	names := func(backups []v1alpha2.Backup) []string {
+		names := []string{}
+		for _, backup := range backups {
+			names = append(names, backup.Name)
+		}
+		return names
+	}
+
+	It("Should Keep Every Backup Without Keep Rule", func() {
+		Expect(getBackupsToPrune(backups, &v1alpha2.BackupRetention{}, now)).To(BeEmpty())
+	})
+
+	It("Should Keep The Last Backups", func() {
+		toPrune := getBackupsToPrune(backups, &v1alpha2.BackupRetention{KeepLast: pointer.Int32Ptr(2)}, now)
+
+		Expect(names(toPrune)).To(Equal([]string{"two-days-ago-evening", "two-days-ago-morning", "oldest"}))
+	})
+
+	It("Should Keep The Last Backup Of Each Day", func() {
+		toPrune := getBackupsToPrune(backups, &v1alpha2.BackupRetention{KeepDaily: pointer.Int32Ptr(3)}, now)
+
+		Expect(names(toPrune)).To(Equal([]string{"two-days-ago-morning", "oldest"}))
+	})
+
+	It("Should Keep The Last Backup Of Each Week", func() {
+		toPrune := getBackupsToPrune(backups, &v1alpha2.BackupRetention{KeepWeekly: pointer.Int32Ptr(2)}, now)
+
+		Expect(names(toPrune)).To(Equal([]string{"yesterday", "two-days-ago-evening", "two-days-ago-morning"}))
+	})
+
+	It("Should Combine The Keep Rules", func() {
+		toPrune := getBackupsToPrune(backups, &v1alpha2.BackupRetention{KeepLast: pointer.Int32Ptr(1), KeepDaily: pointer.Int32Ptr(2)}, now)
+
+		Expect(names(toPrune)).To(Equal([]string{"two-days-ago-evening", "two-days-ago-morning", "oldest"}))
+	})
+
+	It("Should Prune The Backups Older Than The Max Age", func() {
+		toPrune := getBackupsToPrune(backups, &v1alpha2.BackupRetention{
+			KeepLast: pointer.Int32Ptr(10),
+			MaxAge:   &metav1.Duration{Duration: 7 * 24 * time.Hour},
+		}, now)
+
+		Expect(names(toPrune)).To(Equal([]string{"oldest"}))
+	})
+})
+
+var _ = Describe("BackupVolume retention of Backups whose data is retained", func() {
+	ctx := context.Background()
+	now := time.Now()
+	newRetainedBackup := func(name string, created time.Time) *v1alpha2.Backup {
+		backup := &v1alpha2.Backup{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "jenkins",
+				CreationTimestamp: metav1.NewTime(created),
+				Annotations:       map[string]string{AdoptedBackupAnnotation: name},
+				Finalizers:        []string{BackupDataFinalizer},
+			},
+			Spec: v1alpha2.BackupSpec{JenkinsRef: "jenkins", BackupVolumeRef: "backup-volume", DeletionPolicy: v1alpha2.BackupDeletionPolicyRetain},
+		}
+		backup.Status.Conditions.SetCondition(status.Condition{Type: BackupCompleted, Status: corev1.ConditionTrue})
+		return backup
+	}
+
+	BeforeEach(func() {
+		Expect(v1alpha2.AddToScheme(scheme.Scheme)).To(Succeed())
+	})
+
+	It("Should Mark The Pruned Backup For The Deletion Of Its Data", func() {
+		backupVolume := &v1alpha2.BackupVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: "backup-volume", Namespace: "jenkins"},
+			Spec:       v1alpha2.BackupVolumeSpec{Retention: &v1alpha2.BackupRetention{KeepLast: pointer.Int32Ptr(1)}},
+		}
+		recordingClient := &deleteRecordingClient{
+			Client: fake.NewFakeClientWithScheme(scheme.Scheme, newRetainedBackup("old", now.Add(-time.Hour)), newRetainedBackup("latest", now)),
+		}
+		reconciler := &BackupVolumeReconciler{Client: recordingClient, Log: log.Log}
+
+		Expect(reconciler.pruneBackups(ctx, backupVolume)).To(Succeed())
+
+		Expect(recordingClient.deleted).To(HaveLen(1))
+		pruned := recordingClient.deleted[0].(*v1alpha2.Backup)
+		Expect(pruned.Name).To(Equal("old"))
+		Expect(isBackupPruned(pruned)).To(BeTrue())
+		Expect(pruned.Finalizers).To(ContainElement(BackupDataFinalizer))
+	})
+
+	It("Should Delete The Data Of The Pruned Backup", func() {
+		backup := newRetainedBackup("old", now.Add(-time.Hour))
+		metav1.SetMetaDataAnnotation(&backup.ObjectMeta, PrunedBackupAnnotation, "true")
+		deletionTime := metav1.NewTime(now)
+		backup.DeletionTimestamp = &deletionTime
+		backupVolume := &v1alpha2.BackupVolume{ObjectMeta: metav1.ObjectMeta{Name: "backup-volume", Namespace: "jenkins"}}
+		pvc := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "backup-volume-jenkins-backup", Namespace: "jenkins"}}
+		reconciler := &BackupReconciler{Client: fake.NewFakeClientWithScheme(scheme.Scheme, backup, backupVolume, pvc)}
+
+		result, err := reconciler.finalizeBackup(ctx, log.Log, backup)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(backupCleanupRequeueDelay))
+		Expect(reconciler.Client.Get(ctx, types.NamespacedName{Name: "old-cleanup", Namespace: "jenkins"}, &corev1.Pod{})).To(Succeed())
+	})
+})
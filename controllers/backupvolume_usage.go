@@ -0,0 +1,383 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jenkinsci/jenkins-automation-operator/api/v1alpha2"
+	"github.com/jenkinsci/jenkins-automation-operator/pkg/configuration/base/resources"
+	"github.com/operator-framework/operator-lib/status"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// defaultUsageThresholdPercent is the usage of a BackupVolume above which UsageThresholdExceeded is set by default
+	defaultUsageThresholdPercent = 80
+	// backupVolumeUsageProbeInterval is the interval at which the probe Pod measures the usage of a BackupVolume again
+	backupVolumeUsageProbeInterval = 10 * time.Minute
+	backupVolumeUsageContainerName = "usage"
+)
+
+var (
+	// UsageThresholdExceeded is true when the used space of the BackupVolume is above its usage threshold
+	UsageThresholdExceeded status.ConditionType = "UsageThresholdExceeded"
+	// UsageMeasured is true when the usage of the BackupVolume was measured by its last probe Pod, the reported usage
+	// is left as is while it is false
+	UsageMeasured status.ConditionType = "UsageMeasured"
+	// UsageProbePending is the reason of the UsageMeasured condition while the probe Pod runs
+	UsageProbePending status.ConditionReason = "UsageProbePending"
+	// UsageProbeFailed is the reason of the UsageMeasured condition when the probe Pod failed or its output can't be read
+	UsageProbeFailed status.ConditionReason = "UsageProbeFailed"
+	// VolumeResized is set once the PersistentVolumeClaim of the BackupVolume was resized to its size
+	VolumeResized status.ConditionType = "VolumeResized"
+	// VolumeResizePending is the reason of the VolumeResized condition while the PersistentVolumeClaim is expanded
+	VolumeResizePending status.ConditionReason = "VolumeResizePending"
+	// VolumeExpansionNotAllowed is the reason of the VolumeResized condition when the storage class of the
+	// PersistentVolumeClaim doesn't allow volume expansion
+	VolumeExpansionNotAllowed status.ConditionReason = "VolumeExpansionNotAllowed"
+	// VolumeShrinkNotSupported is the reason of the VolumeResized condition when the size of the BackupVolume is smaller
+	// than the size of its PersistentVolumeClaim
+	VolumeShrinkNotSupported status.ConditionReason = "VolumeShrinkNotSupported"
+)
+
+// resizeBackupVolumePVC expands the PersistentVolumeClaim of the BackupVolume to the size of its spec when its storage
+// class allows it. The PersistentVolumeClaims can't shrink, and a PersistentVolumeClaim which was not resized is left
+// as is when the BackupVolume has no size.
+func (r *BackupVolumeReconciler) resizeBackupVolumePVC(ctx context.Context, backupVolume *v1alpha2.BackupVolume, pvc *corev1.PersistentVolumeClaim) error {
+	if len(backupVolume.Spec.Size) == 0 {
+		return nil
+	}
+	size, err := resource.ParseQuantity(backupVolume.Spec.Size)
+	if err != nil {
+		return fmt.Errorf("invalid size '%s' of BackupVolume '%s': %s", backupVolume.Spec.Size, backupVolume.Name, err)
+	}
+	requested := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+	switch size.Cmp(requested) {
+	case 1:
+		allowed, err := r.isVolumeExpansionAllowed(ctx, pvc)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			backupVolume.Status.Conditions.SetCondition(status.Condition{
+				Type:    VolumeResized,
+				Status:  corev1.ConditionFalse,
+				Reason:  VolumeExpansionNotAllowed,
+				Message: fmt.Sprintf("storage class of PersistentVolumeClaim '%s' doesn't allow volume expansion, it stays at %s", pvc.Name, requested.String()),
+			})
+			return nil
+		}
+		r.Log.Info(fmt.Sprintf("Expanding PersistentVolumeClaim '%s' of BackupVolume '%s' from %s to %s", pvc.Name, backupVolume.Name, requested.String(), size.String()))
+		pvc.Spec.Resources.Requests[corev1.ResourceStorage] = size
+		if err = r.Client.Update(ctx, pvc); err != nil {
+			return err
+		}
+	case -1:
+		backupVolume.Status.Conditions.SetCondition(status.Condition{
+			Type:    VolumeResized,
+			Status:  corev1.ConditionFalse,
+			Reason:  VolumeShrinkNotSupported,
+			Message: fmt.Sprintf("PersistentVolumeClaim '%s' can't shrink from %s to %s", pvc.Name, requested.String(), size.String()),
+		})
+		return nil
+	}
+	setVolumeResizedCondition(backupVolume, pvc)
+	return nil
+}
+
+// setVolumeResizedCondition sets the VolumeResized condition once the PersistentVolumeClaim was expanded, it is pending
+// until the capacity of the PersistentVolumeClaim reaches its request
+func setVolumeResizedCondition(backupVolume *v1alpha2.BackupVolume, pvc *corev1.PersistentVolumeClaim) {
+	requested := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+	capacity, found := pvc.Status.Capacity[corev1.ResourceStorage]
+	if found && capacity.Cmp(requested) >= 0 {
+		// The condition is only set for the PersistentVolumeClaims which were resized
+		if backupVolume.Status.Conditions.GetCondition(VolumeResized) != nil {
+			backupVolume.Status.Conditions.SetCondition(status.Condition{
+				Type:    VolumeResized,
+				Status:  corev1.ConditionTrue,
+				Message: fmt.Sprintf("PersistentVolumeClaim '%s' resized to %s", pvc.Name, capacity.String()),
+			})
+		}
+		return
+	}
+	if !found && backupVolume.Status.Conditions.GetCondition(VolumeResized) == nil {
+		// The PersistentVolumeClaim is not bound yet
+		return
+	}
+	message := fmt.Sprintf("PersistentVolumeClaim '%s' is being resized to %s", pvc.Name, requested.String())
+	for _, condition := range pvc.Status.Conditions {
+		if condition.Type == corev1.PersistentVolumeClaimFileSystemResizePending && condition.Status == corev1.ConditionTrue {
+			message += ", its file system is resized once a Pod mounts it"
+		}
+	}
+	backupVolume.Status.Conditions.SetCondition(status.Condition{
+		Type:    VolumeResized,
+		Status:  corev1.ConditionFalse,
+		Reason:  VolumeResizePending,
+		Message: message,
+	})
+}
+
+// isVolumeExpansionAllowed returns true if the storage class of the PersistentVolumeClaim allows volume expansion
+func (r *BackupVolumeReconciler) isVolumeExpansionAllowed(ctx context.Context, pvc *corev1.PersistentVolumeClaim) (bool, error) {
+	if pvc.Spec.StorageClassName == nil || len(*pvc.Spec.StorageClassName) == 0 {
+		return false, nil
+	}
+	storageClass := &storagev1.StorageClass{}
+	err := r.Client.Get(ctx, types.NamespacedName{Name: *pvc.Spec.StorageClassName}, storageClass)
+	if err != nil {
+		return false, err
+	}
+	return storageClass.AllowVolumeExpansion != nil && *storageClass.AllowVolumeExpansion, nil
+}
+
+// updateBackupVolumeUsage sets the capacity of the PersistentVolumeClaim of the BackupVolume, the number of Backups
+// stored on it and the space used on its file system. The space used is measured by a probe Pod mounting its
+// PersistentVolumeClaim, it is left as is and the UsageMeasured condition is false while it is unknown.
+func (r *BackupVolumeReconciler) updateBackupVolumeUsage(ctx context.Context, backupVolume *v1alpha2.BackupVolume, pvc *corev1.PersistentVolumeClaim, backups []v1alpha2.Backup) {
+	backupVolume.Status.BackupCount = countStoredBackups(backups, backupVolume.Name)
+	if capacity, found := pvc.Status.Capacity[corev1.ResourceStorage]; found {
+		backupVolume.Status.Capacity = &capacity
+	}
+	if backupVolume.Spec.S3 != nil {
+		return
+	}
+	used, available, err := r.getBackupVolumeDiskUsage(ctx, backupVolume)
+	if err != nil {
+		r.Log.Info(fmt.Sprintf("Failed to measure the usage of BackupVolume '%s': %s", backupVolume.Name, err))
+		backupVolume.Status.Conditions.SetCondition(status.Condition{
+			Type:    UsageMeasured,
+			Status:  corev1.ConditionFalse,
+			Reason:  UsageProbeFailed,
+			Message: err.Error(),
+		})
+		return
+	}
+	if used < 0 {
+		backupVolume.Status.Conditions.SetCondition(status.Condition{
+			Type:    UsageMeasured,
+			Status:  corev1.ConditionFalse,
+			Reason:  UsageProbePending,
+			Message: fmt.Sprintf("Pod '%s' is measuring the usage of BackupVolume '%s'", getBackupVolumeUsagePodName(backupVolume), backupVolume.Name),
+		})
+		return
+	}
+	backupVolume.Status.Conditions.SetCondition(status.Condition{
+		Type:   UsageMeasured,
+		Status: corev1.ConditionTrue,
+	})
+	setBackupVolumeUsage(backupVolume, used, available)
+}
+
+// getBackupVolumeDiskUsage returns the used and available bytes of the file system of the BackupVolume measured by the
+// probe Pod, or -1 while it runs. The probe Pod is kept until its measure is older than backupVolumeUsageProbeInterval,
+// it is then deleted so that the next reconciliation measures the usage again. A probe Pod still pending after that
+// interval is deleted too, e.g. when the Jenkins Pod it runs next to moved to another node.
+func (r *BackupVolumeReconciler) getBackupVolumeDiskUsage(ctx context.Context, backupVolume *v1alpha2.BackupVolume) (int64, int64, error) {
+	probePod := &corev1.Pod{}
+	err := r.Client.Get(ctx, types.NamespacedName{Name: getBackupVolumeUsagePodName(backupVolume), Namespace: backupVolume.Namespace}, probePod)
+	if apierrors.IsNotFound(err) {
+		jenkinsPod, err := r.getBackupVolumeJenkinsPod(ctx, backupVolume)
+		if err != nil {
+			return 0, 0, err
+		}
+		return -1, 0, r.Client.Create(ctx, newBackupVolumeUsagePod(backupVolume, jenkinsPod))
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+
+	switch probePod.Status.Phase {
+	case corev1.PodSucceeded:
+		output, finishedAt := getUsageProbeOutput(probePod)
+		if finishedAt == nil || time.Since(finishedAt.Time) > backupVolumeUsageProbeInterval {
+			if err = r.Client.Delete(ctx, probePod); err != nil && !apierrors.IsNotFound(err) {
+				return 0, 0, err
+			}
+		}
+		return parseDiskUsage(output)
+	case corev1.PodFailed:
+		// The Pod is created again at the next reconciliation
+		err = r.Client.Delete(ctx, probePod)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return 0, 0, err
+		}
+		return 0, 0, fmt.Errorf("pod '%s' failed to measure the usage of BackupVolume '%s'", probePod.Name, backupVolume.Name)
+	case corev1.PodPending:
+		if time.Since(probePod.CreationTimestamp.Time) > backupVolumeUsageProbeInterval {
+			err = r.Client.Delete(ctx, probePod)
+			if err != nil && !apierrors.IsNotFound(err) {
+				return 0, 0, err
+			}
+			return 0, 0, fmt.Errorf("pod '%s' is still pending after %s, it is created again", probePod.Name, backupVolumeUsageProbeInterval)
+		}
+	}
+	return -1, 0, nil
+}
+
+// getBackupVolumeJenkinsPod returns the Pod of the first Jenkins mounting the BackupVolume in its backup sidecar, or nil
+// when no backup sidecar mounts it
+func (r *BackupVolumeReconciler) getBackupVolumeJenkinsPod(ctx context.Context, backupVolume *v1alpha2.BackupVolume) (*corev1.Pod, error) {
+	jenkins, err := getBackupVolumeJenkins(ctx, r.Client, backupVolume)
+	if err != nil || jenkins == nil || !isBackupVolumeMounted(jenkins, backupVolume.Name) {
+		return nil, err
+	}
+	backupReconciler := &BackupReconciler{Client: r.Client}
+	jenkinsPod, err := backupReconciler.GetPodByDeployment(jenkins)
+	if err != nil {
+		return nil, fmt.Errorf("no Pod of Jenkins '%s' mounting BackupVolume '%s': %s", jenkins.Name, backupVolume.Name, err)
+	}
+	return jenkinsPod, nil
+}
+
+// getUsageProbeOutput returns the output of df written by the probe Pod to the termination message of its container,
+// and when it terminated
+func getUsageProbeOutput(probePod *corev1.Pod) (string, *metav1.Time) {
+	for _, containerStatus := range probePod.Status.ContainerStatuses {
+		if terminated := containerStatus.State.Terminated; containerStatus.Name == backupVolumeUsageContainerName && terminated != nil {
+			return terminated.Message, &terminated.FinishedAt
+		}
+	}
+	return "", nil
+}
+
+// getBackupVolumeUsagePodName returns the name of the Pod measuring the usage of the BackupVolume
+func getBackupVolumeUsagePodName(backupVolume *v1alpha2.BackupVolume) string {
+	return backupVolume.Name + "-usage"
+}
+
+// newBackupVolumeUsagePod returns a Pod writing the usage of the file system of the BackupVolume to the termination
+// message of its container
+func newBackupVolumeUsagePod(backupVolume *v1alpha2.BackupVolume, jenkinsPod *corev1.Pod) *corev1.Pod {
+	return newBackupVolumeProbePod(backupVolume, jenkinsPod, getBackupVolumeUsagePodName(backupVolume), corev1.Container{
+		Name:                     backupVolumeUsageContainerName,
+		Image:                    resources.GetJenkinsBackupImage(),
+		Command:                  []string{"sh", "-c", getDiskUsageScript(backupVolume) + " > " + corev1.TerminationMessagePathDefault},
+		TerminationMessagePolicy: corev1.TerminationMessageReadFile,
+	})
+}
+
+// newBackupVolumeProbePod returns a Pod running the container with the PersistentVolumeClaim of the BackupVolume
+// mounted read-only at the same path as in the backup sidecar. When the backup sidecar of a Jenkins Pod mounts the
+// BackupVolume, the Pod runs next to it so that a ReadWriteOnce volume can be mounted.
+func newBackupVolumeProbePod(backupVolume *v1alpha2.BackupVolume, jenkinsPod *corev1.Pod, name string, container corev1.Container) *corev1.Pod {
+	container.VolumeMounts = []corev1.VolumeMount{
+		{Name: backupCleanupVolumeName, MountPath: resources.JenkinsBackupVolumePath + "/" + backupVolume.Name, ReadOnly: true},
+	}
+	probePod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: backupVolume.Namespace,
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(backupVolume, v1alpha2.GroupVersion.WithKind("BackupVolume")),
+			},
+		},
+		Spec: corev1.PodSpec{
+			RestartPolicy: corev1.RestartPolicyNever,
+			Containers:    []corev1.Container{container},
+			Volumes: []corev1.Volume{
+				{
+					Name: backupCleanupVolumeName,
+					VolumeSource: corev1.VolumeSource{
+						PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: getBackupVolumePVCName(backupVolume), ReadOnly: true},
+					},
+				},
+			},
+		},
+	}
+	if jenkinsPod != nil {
+		probePod.Spec.NodeSelector = jenkinsPod.Spec.NodeSelector
+		probePod.Spec.Tolerations = jenkinsPod.Spec.Tolerations
+		probePod.Spec.Affinity = &corev1.Affinity{
+			PodAffinity: &corev1.PodAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{
+					{
+						LabelSelector: &metav1.LabelSelector{MatchLabels: jenkinsPod.Labels},
+						TopologyKey:   corev1.LabelHostname,
+					},
+				},
+			},
+		}
+	}
+	return probePod
+}
+
+// getDiskUsageScript returns the script printing the usage of the file system of the BackupVolume in the probe Pod
+func getDiskUsageScript(backupVolume *v1alpha2.BackupVolume) string {
+	return "df -P -k " + shellQuote(resources.JenkinsBackupVolumePath+"/"+backupVolume.Name, false)
+}
+
+// parseDiskUsage returns the used and available bytes from the POSIX output of df in kilobytes
+func parseDiskUsage(output string) (int64, int64, error) {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	fields := strings.Fields(lines[len(lines)-1])
+	if len(lines) < 2 || len(fields) < 4 {
+		return 0, 0, fmt.Errorf("unexpected df output '%s'", output)
+	}
+	used, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("unexpected df output '%s'", output)
+	}
+	available, err := strconv.ParseInt(fields[3], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("unexpected df output '%s'", output)
+	}
+	return used * 1024, available * 1024, nil
+}
+
+// setBackupVolumeUsage sets the used space of the BackupVolume and the UsageThresholdExceeded condition
+func setBackupVolumeUsage(backupVolume *v1alpha2.BackupVolume, used, available int64) {
+	var percent int32
+	if used+available > 0 {
+		// Rounded up, like df
+		percent = int32((used*100 + used + available - 1) / (used + available))
+	}
+	backupVolume.Status.UsedBytes = used
+	backupVolume.Status.UsagePercent = percent
+	threshold := int32(defaultUsageThresholdPercent)
+	if backupVolume.Spec.UsageThresholdPercent != nil {
+		threshold = *backupVolume.Spec.UsageThresholdPercent
+	}
+	message := fmt.Sprintf("%d%% used, %s available", percent, resource.NewQuantity(available, resource.BinarySI).String())
+	if percent > threshold {
+		backupVolume.Status.Conditions.SetCondition(status.Condition{
+			Type:    UsageThresholdExceeded,
+			Status:  corev1.ConditionTrue,
+			Message: fmt.Sprintf("%s, above the threshold of %d%%", message, threshold),
+		})
+		return
+	}
+	backupVolume.Status.Conditions.SetCondition(status.Condition{
+		Type:    UsageThresholdExceeded,
+		Status:  corev1.ConditionFalse,
+		Message: message,
+	})
+}
+
+// countStoredBackups returns the number of succeeded Backups stored on the BackupVolume or copied to it as a replica
+func countStoredBackups(backups []v1alpha2.Backup, backupVolumeName string) int32 {
+	var count int32
+	for i := range backups {
+		backup := &backups[i]
+		if backup.Status.Phase != v1alpha2.BackupSucceeded || len(backup.Status.VolumeSnapshot) > 0 {
+			continue
+		}
+		stored := backup.Spec.BackupVolumeRef == backupVolumeName
+		for _, replicaName := range getSucceededReplicas(backup) {
+			stored = stored || replicaName == backupVolumeName
+		}
+		if stored {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,324 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/jenkinsci/jenkins-automation-operator/api/v1alpha2"
+	"github.com/jenkinsci/jenkins-automation-operator/pkg/configuration/base/resources"
+	"github.com/jenkinsci/jenkins-automation-operator/pkg/log"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Disk usage parsing", func() {
+	It("Should Parse The Output Of df", func() {
+		used, available, err := parseDiskUsage(`Filesystem           1024-blocks    Used Available Capacity Mounted on
+/dev/sdb                 1015452    512000    487068  52% /jenkins-backups/backup-volume
+`)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(used).To(Equal(int64(512000 * 1024)))
+		Expect(available).To(Equal(int64(487068 * 1024)))
+
+		_, _, err = parseDiskUsage("df: /jenkins-backups/backup-volume: No such file or directory")
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("BackupVolume usage", func() {
+	It("Should Not Exceed The Default Threshold", func() {
+		backupVolume := &v1alpha2.BackupVolume{}
+
+		setBackupVolumeUsage(backupVolume, 512*1024*1024, 512*1024*1024)
+
+		Expect(backupVolume.Status.UsedBytes).To(Equal(int64(512 * 1024 * 1024)))
+		Expect(backupVolume.Status.UsagePercent).To(Equal(int32(50)))
+		Expect(backupVolume.Status.Conditions.IsFalseFor(UsageThresholdExceeded)).To(BeTrue())
+		Expect(backupVolume.Status.Conditions.GetCondition(UsageThresholdExceeded).Message).To(Equal("50% used, 512Mi available"))
+	})
+
+	It("Should Exceed The Threshold", func() {
+		threshold := int32(40)
+		backupVolume := &v1alpha2.BackupVolume{Spec: v1alpha2.BackupVolumeSpec{UsageThresholdPercent: &threshold}}
+
+		setBackupVolumeUsage(backupVolume, 412, 588)
+
+		Expect(backupVolume.Status.UsagePercent).To(Equal(int32(42)))
+		Expect(backupVolume.Status.Conditions.IsTrueFor(UsageThresholdExceeded)).To(BeTrue())
+		Expect(backupVolume.Status.Conditions.GetCondition(UsageThresholdExceeded).Message).To(Equal("42% used, 588 available, above the threshold of 40%"))
+	})
+})
+
+var _ = Describe("Stored Backups count", func() {
+	It("Should Count The Backups And Copies Stored On The BackupVolume", func() {
+		backups := []v1alpha2.Backup{
+			{Spec: v1alpha2.BackupSpec{BackupVolumeRef: "volume"}, Status: v1alpha2.BackupStatus{Phase: v1alpha2.BackupSucceeded}},
+			{Spec: v1alpha2.BackupSpec{BackupVolumeRef: "volume"}, Status: v1alpha2.BackupStatus{Phase: v1alpha2.BackupFailed}},
+			{Spec: v1alpha2.BackupSpec{BackupVolumeRef: "volume"}, Status: v1alpha2.BackupStatus{Phase: v1alpha2.BackupSucceeded, VolumeSnapshot: "snapshot"}},
+			{Spec: v1alpha2.BackupSpec{BackupVolumeRef: "other-volume"}, Status: v1alpha2.BackupStatus{Phase: v1alpha2.BackupSucceeded}},
+			{Spec: v1alpha2.BackupSpec{BackupVolumeRef: "other-volume"}, Status: v1alpha2.BackupStatus{
+				Phase:    v1alpha2.BackupSucceeded,
+				Replicas: []v1alpha2.BackupReplica{{BackupVolume: "volume", Succeeded: true}},
+			}},
+		}
+
+		Expect(countStoredBackups(backups, "volume")).To(Equal(int32(2)))
+	})
+})
+
+var _ = Describe("BackupVolume PVC resizing", func() {
+	ctx := context.Background()
+	allowed := true
+	expandable := &storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "expandable"}, AllowVolumeExpansion: &allowed}
+	fixed := &storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "fixed"}}
+	newPVC := func(storageClassName, size string) *corev1.PersistentVolumeClaim {
+		return &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: "volume-jenkins-backup", Namespace: "jenkins"},
+			Spec: corev1.PersistentVolumeClaimSpec{
+				StorageClassName: &storageClassName,
+				Resources:        corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse(size)}},
+			},
+			Status: corev1.PersistentVolumeClaimStatus{Capacity: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse(size)}},
+		}
+	}
+	newBackupVolume := func(size string) *v1alpha2.BackupVolume {
+		return &v1alpha2.BackupVolume{ObjectMeta: metav1.ObjectMeta{Name: "volume", Namespace: "jenkins"}, Spec: v1alpha2.BackupVolumeSpec{Size: size}}
+	}
+
+	BeforeEach(func() {
+		Expect(v1alpha2.AddToScheme(scheme.Scheme)).To(Succeed())
+	})
+
+	It("Should Expand The PVC", func() {
+		pvc := newPVC("expandable", "1Gi")
+		reconciler := &BackupVolumeReconciler{Client: fake.NewFakeClientWithScheme(scheme.Scheme, expandable, pvc), Log: log.Log}
+		backupVolume := newBackupVolume("2Gi")
+
+		err := reconciler.resizeBackupVolumePVC(ctx, backupVolume, pvc)
+
+		Expect(err).NotTo(HaveOccurred())
+		updated := &corev1.PersistentVolumeClaim{}
+		Expect(reconciler.Client.Get(ctx, types.NamespacedName{Name: pvc.Name, Namespace: pvc.Namespace}, updated)).To(Succeed())
+		Expect(quantityString(updated.Spec.Resources.Requests)).To(Equal("2Gi"))
+		condition := backupVolume.Status.Conditions.GetCondition(VolumeResized)
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Reason).To(Equal(VolumeResizePending))
+
+		updated.Status.Capacity[corev1.ResourceStorage] = resource.MustParse("2Gi")
+		err = reconciler.resizeBackupVolumePVC(ctx, backupVolume, updated)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(backupVolume.Status.Conditions.IsTrueFor(VolumeResized)).To(BeTrue())
+	})
+
+	It("Should Not Expand The PVC When The Storage Class Doesn't Allow It", func() {
+		pvc := newPVC("fixed", "1Gi")
+		reconciler := &BackupVolumeReconciler{Client: fake.NewFakeClientWithScheme(scheme.Scheme, fixed, pvc), Log: log.Log}
+		backupVolume := newBackupVolume("2Gi")
+
+		err := reconciler.resizeBackupVolumePVC(ctx, backupVolume, pvc)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(backupVolume.Status.Conditions.GetCondition(VolumeResized).Reason).To(Equal(VolumeExpansionNotAllowed))
+		Expect(quantityString(pvc.Spec.Resources.Requests)).To(Equal("1Gi"))
+	})
+
+	It("Should Not Shrink The PVC", func() {
+		pvc := newPVC("expandable", "2Gi")
+		reconciler := &BackupVolumeReconciler{Client: fake.NewFakeClientWithScheme(scheme.Scheme, expandable, pvc), Log: log.Log}
+		backupVolume := newBackupVolume("1Gi")
+
+		err := reconciler.resizeBackupVolumePVC(ctx, backupVolume, pvc)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(backupVolume.Status.Conditions.GetCondition(VolumeResized).Reason).To(Equal(VolumeShrinkNotSupported))
+	})
+
+	It("Should Keep The PVC Of Unchanged Size", func() {
+		pvc := newPVC("expandable", "1Gi")
+		reconciler := &BackupVolumeReconciler{Client: fake.NewFakeClientWithScheme(scheme.Scheme, expandable, pvc), Log: log.Log}
+		backupVolume := newBackupVolume("1Gi")
+
+		err := reconciler.resizeBackupVolumePVC(ctx, backupVolume, pvc)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(backupVolume.Status.Conditions.GetCondition(VolumeResized)).To(BeNil())
+	})
+})
+
+func quantityString(resources corev1.ResourceList) string {
+	quantity := resources[corev1.ResourceStorage]
+	return quantity.String()
+}
+
+var _ = Describe("BackupVolume disk usage", func() {
+	ctx := context.Background()
+	backupVolume := &v1alpha2.BackupVolume{ObjectMeta: metav1.ObjectMeta{Name: "volume", Namespace: "jenkins"}}
+	// The Pod of a Jenkins running its Backups in Jobs doesn't mount the BackupVolume
+	jenkins := &v1alpha2.Jenkins{
+		ObjectMeta: metav1.ObjectMeta{Name: "jenkins", Namespace: "jenkins"},
+		Spec:       v1alpha2.JenkinsSpec{BackupVolumes: []string{"volume"}, BackupRunner: v1alpha2.BackupRunnerJob},
+	}
+	probePodName := types.NamespacedName{Name: "volume-usage", Namespace: "jenkins"}
+	terminate := func(reconciler *BackupVolumeReconciler, finishedAt time.Time) {
+		probePod := &corev1.Pod{}
+		Expect(reconciler.Client.Get(ctx, probePodName, probePod)).To(Succeed())
+		probePod.Status.Phase = corev1.PodSucceeded
+		probePod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+			Name: backupVolumeUsageContainerName,
+			State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+				Message:    "Filesystem 1024-blocks Used Available Capacity Mounted on\n/dev/sdb 1000 250 750 25% /jenkins-backups/volume\n",
+				FinishedAt: metav1.NewTime(finishedAt),
+			}},
+		}}
+		Expect(reconciler.Client.Status().Update(ctx, probePod)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		Expect(v1alpha2.AddToScheme(scheme.Scheme)).To(Succeed())
+	})
+
+	It("Should Measure The Usage With A Probe Pod", func() {
+		reconciler := &BackupVolumeReconciler{Client: fake.NewFakeClientWithScheme(scheme.Scheme, jenkins), Log: log.Log}
+
+		used, _, err := reconciler.getBackupVolumeDiskUsage(ctx, backupVolume)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(used).To(Equal(int64(-1)))
+		probePod := &corev1.Pod{}
+		Expect(reconciler.Client.Get(ctx, probePodName, probePod)).To(Succeed())
+		Expect(probePod.Spec.Volumes[0].PersistentVolumeClaim.ClaimName).To(Equal("volume-jenkins-backup"))
+		Expect(probePod.OwnerReferences[0].Kind).To(Equal("BackupVolume"))
+
+		terminate(reconciler, time.Now())
+		used, available, err := reconciler.getBackupVolumeDiskUsage(ctx, backupVolume)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(used).To(Equal(int64(250 * 1024)))
+		Expect(available).To(Equal(int64(750 * 1024)))
+		Expect(reconciler.Client.Get(ctx, probePodName, probePod)).To(Succeed())
+	})
+
+	It("Should Measure The Usage Again Once Outdated", func() {
+		reconciler := &BackupVolumeReconciler{Client: fake.NewFakeClientWithScheme(scheme.Scheme, jenkins), Log: log.Log}
+		_, _, err := reconciler.getBackupVolumeDiskUsage(ctx, backupVolume)
+		Expect(err).NotTo(HaveOccurred())
+		terminate(reconciler, time.Now().Add(-time.Hour))
+
+		used, _, err := reconciler.getBackupVolumeDiskUsage(ctx, backupVolume)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(used).To(Equal(int64(250 * 1024)))
+		Expect(apierrors.IsNotFound(reconciler.Client.Get(ctx, probePodName, &corev1.Pod{}))).To(BeTrue())
+	})
+
+	It("Should Schedule The Probe Pod Next To The Jenkins Pod Mounting The BackupVolume In Its Backup Sidecar", func() {
+		sidecarJenkins := jenkins.DeepCopy()
+		sidecarJenkins.Spec.BackupRunner = ""
+		labels := map[string]string{"app": "jenkins"}
+		deployment := &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: resources.GetJenkinsDeploymentName(sidecarJenkins), Namespace: "jenkins"},
+			Spec:       appsv1.DeploymentSpec{Selector: &metav1.LabelSelector{MatchLabels: labels}},
+		}
+		replicaSet := &appsv1.ReplicaSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "jenkins-1", Namespace: "jenkins", Labels: labels},
+			Spec:       appsv1.ReplicaSetSpec{Selector: &metav1.LabelSelector{MatchLabels: labels}},
+		}
+		jenkinsPod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "jenkins-1-abcde", Namespace: "jenkins", Labels: labels},
+			Spec:       corev1.PodSpec{NodeSelector: map[string]string{"disk": "ssd"}},
+		}
+		reconciler := &BackupVolumeReconciler{Client: fake.NewFakeClientWithScheme(scheme.Scheme, sidecarJenkins, deployment, replicaSet, jenkinsPod), Log: log.Log}
+
+		used, _, err := reconciler.getBackupVolumeDiskUsage(ctx, backupVolume)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(used).To(Equal(int64(-1)))
+		probePod := &corev1.Pod{}
+		Expect(reconciler.Client.Get(ctx, probePodName, probePod)).To(Succeed())
+		Expect(probePod.Spec.NodeSelector).To(Equal(jenkinsPod.Spec.NodeSelector))
+		term := probePod.Spec.Affinity.PodAffinity.RequiredDuringSchedulingIgnoredDuringExecution[0]
+		Expect(term.LabelSelector.MatchLabels).To(Equal(labels))
+		Expect(term.TopologyKey).To(Equal(corev1.LabelHostname))
+	})
+
+	It("Should Create The Probe Pod Again When Pending For Too Long", func() {
+		probePod := newBackupVolumeUsagePod(backupVolume, nil)
+		probePod.CreationTimestamp = metav1.NewTime(time.Now().Add(-time.Hour))
+		probePod.Status.Phase = corev1.PodPending
+		reconciler := &BackupVolumeReconciler{Client: fake.NewFakeClientWithScheme(scheme.Scheme, jenkins, probePod), Log: log.Log}
+
+		_, _, err := reconciler.getBackupVolumeDiskUsage(ctx, backupVolume)
+
+		Expect(err).To(MatchError("pod 'volume-usage' is still pending after 10m0s, it is created again"))
+		Expect(apierrors.IsNotFound(reconciler.Client.Get(ctx, probePodName, &corev1.Pod{}))).To(BeTrue())
+	})
+})
+
+var _ = Describe("BackupVolume usage update", func() {
+	ctx := context.Background()
+	pvc := &corev1.PersistentVolumeClaim{}
+
+	BeforeEach(func() {
+		Expect(v1alpha2.AddToScheme(scheme.Scheme)).To(Succeed())
+	})
+
+	It("Should Be Unknown While Measured", func() {
+		backupVolume := &v1alpha2.BackupVolume{ObjectMeta: metav1.ObjectMeta{Name: "volume", Namespace: "jenkins"}}
+		backupVolume.Status.UsedBytes = 1024
+		reconciler := &BackupVolumeReconciler{Client: fake.NewFakeClientWithScheme(scheme.Scheme), Log: log.Log}
+
+		reconciler.updateBackupVolumeUsage(ctx, backupVolume, pvc, nil)
+
+		condition := backupVolume.Status.Conditions.GetCondition(UsageMeasured)
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Status).To(Equal(corev1.ConditionFalse))
+		Expect(condition.Reason).To(Equal(UsageProbePending))
+		Expect(backupVolume.Status.UsedBytes).To(Equal(int64(1024)))
+	})
+
+	It("Should Be Unknown When The Probe Pod Failed", func() {
+		backupVolume := &v1alpha2.BackupVolume{ObjectMeta: metav1.ObjectMeta{Name: "volume", Namespace: "jenkins"}}
+		probePod := newBackupVolumeUsagePod(backupVolume, nil)
+		probePod.Status.Phase = corev1.PodFailed
+		reconciler := &BackupVolumeReconciler{Client: fake.NewFakeClientWithScheme(scheme.Scheme, probePod), Log: log.Log}
+
+		reconciler.updateBackupVolumeUsage(ctx, backupVolume, pvc, nil)
+
+		condition := backupVolume.Status.Conditions.GetCondition(UsageMeasured)
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Status).To(Equal(corev1.ConditionFalse))
+		Expect(condition.Reason).To(Equal(UsageProbeFailed))
+		Expect(condition.Message).To(Equal("pod 'volume-usage' failed to measure the usage of BackupVolume 'volume'"))
+	})
+
+	It("Should Record The Measured Usage", func() {
+		backupVolume := &v1alpha2.BackupVolume{ObjectMeta: metav1.ObjectMeta{Name: "volume", Namespace: "jenkins"}}
+		probePod := newBackupVolumeUsagePod(backupVolume, nil)
+		probePod.Status.Phase = corev1.PodSucceeded
+		probePod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+			Name: backupVolumeUsageContainerName,
+			State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+				Message:    "Filesystem 1024-blocks Used Available Capacity Mounted on\n/dev/sdb 1000 900 100 90% /jenkins-backups/volume\n",
+				FinishedAt: metav1.Now(),
+			}},
+		}}
+		reconciler := &BackupVolumeReconciler{Client: fake.NewFakeClientWithScheme(scheme.Scheme, probePod), Log: log.Log}
+
+		reconciler.updateBackupVolumeUsage(ctx, backupVolume, pvc, nil)
+
+		Expect(backupVolume.Status.Conditions.GetCondition(UsageMeasured).Status).To(Equal(corev1.ConditionTrue))
+		Expect(backupVolume.Status.UsagePercent).To(Equal(int32(90)))
+		Expect(backupVolume.Status.Conditions.GetCondition(UsageThresholdExceeded).Status).To(Equal(corev1.ConditionTrue))
+	})
+})
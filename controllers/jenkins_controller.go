@@ -278,6 +278,14 @@ func (r *JenkinsReconciler) reconcile(ctx context.Context, request ctrl.Request,
 		return reconcile.Result{}, err
 	}
 
+	// The Jenkins is captured by the Velero backups selecting its resources
+	if jenkins.Spec.VeleroEnabled && jenkins.Labels[constants.LabelVeleroBackupKey] != jenkins.Name {
+		resources.SetVeleroBackupLabel(jenkins, jenkins)
+		if err = r.Update(ctx, jenkins); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+
 	defaultStorageClassName := ""
 	storageClassList := &storagev1.StorageClassList{}
 	err = r.Client.List(context.TODO(), storageClassList)
@@ -319,6 +327,7 @@ func (r *JenkinsReconciler) reconcile(ctx context.Context, request ctrl.Request,
 					request.Name))
 				jenkinsPVC.Name = request.Name
 				jenkinsPVC.Namespace = request.Namespace
+				resources.SetVeleroBackupLabel(jenkins, jenkinsPVC)
 				jenkinsPVC.Spec.StorageClassName = &storageClassName
 				jenkinsPVC.Spec.AccessModes = []corev1.PersistentVolumeAccessMode{
 					corev1.ReadWriteOnce,
@@ -334,11 +343,22 @@ func (r *JenkinsReconciler) reconcile(ctx context.Context, request ctrl.Request,
 					return ctrl.Result{}, err
 				}
 			}
+		} else if jenkins.Spec.VeleroEnabled && jenkinsPVC.Labels[constants.LabelVeleroBackupKey] != jenkins.Name {
+			resources.SetVeleroBackupLabel(jenkins, jenkinsPVC)
+			if err = r.Client.Update(ctx, jenkinsPVC); err != nil {
+				return ctrl.Result{}, err
+			}
 		}
 	}
 
 	logger.V(log.VDebug).Info(fmt.Sprintf("setDefaults reported a change: %v", requeue))
 	config := r.newReconcilerConfiguration(jenkins)
+	// The Jenkins Home of a new Deployment is populated from the backup of restoreFrom
+	config.RestoreFrom, err = r.newRestoreFrom(ctx, jenkins)
+	if err != nil {
+		logger.V(log.VDebug).Info(fmt.Sprintf("Error while trying to restore from a backup %s", err))
+		return ctrl.Result{}, err
+	}
 	// Reconcile base configuration
 	logger.V(log.VDebug).Info("Starting base configuration reconciliation for validation")
 	baseConfiguration := base.New(config, r.jenkinsAPIConnectionSettings)
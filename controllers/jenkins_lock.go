@@ -0,0 +1,241 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jenkinsci/jenkins-automation-operator/api/v1alpha2"
+	"github.com/operator-framework/operator-lib/status"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// +kubebuilder:rbac:groups=coordination.k8s.io,resources=leases,verbs=get;list;watch;create;update
+
+const (
+	// lockRetryInterval is how often a queued Backup or Restore tries again to lock its Jenkins
+	lockRetryInterval = 10 * time.Second
+	// lockHolderBackup and lockHolderRestore are the kinds of the objects holding the lock of a Jenkins
+	lockHolderBackup  = "Backup"
+	lockHolderRestore = "Restore"
+)
+
+var (
+	// LockAcquired is set once the Backup or Restore holds the lock of its Jenkins
+	LockAcquired status.ConditionType = "LockAcquired"
+	// JenkinsLocked is the reason of the LockAcquired condition while another Backup or Restore holds the lock
+	JenkinsLocked status.ConditionReason = "JenkinsLocked"
+)
+
+// getJenkinsLockName returns the name of the Lease locking the Jenkins, held by the Backup or Restore running against it
+func getJenkinsLockName(jenkinsName string) string {
+	return jenkinsName + "-backup-lock"
+}
+
+// getJenkinsLockHolder returns the identity of a Backup or Restore in the Lease, as <kind>/<namespace>/<name>
+func getJenkinsLockHolder(kind string, object metav1.Object) string {
+	return strings.Join([]string{kind, object.GetNamespace(), object.GetName()}, "/")
+}
+
+// acquireJenkinsLock makes the Backup or Restore the holder of the Lease locking the Jenkins, creating the Lease if
+// needed. The lock is taken over from a holder which is complete or deleted. A free lock goes to the queued Backups and
+// Restores first, in the order of their creation. It returns false along with the current holder, or the queued Backup
+// or Restore which runs first, if the Jenkins is locked by another Backup or Restore.
+func acquireJenkinsLock(ctx context.Context, c client.Client, jenkins *v1alpha2.Jenkins, kind string, object metav1.Object) (bool, string, error) {
+	holder := getJenkinsLockHolder(kind, object)
+	now := metav1.NewMicroTime(time.Now())
+	lease := &coordinationv1.Lease{}
+	err := c.Get(ctx, types.NamespacedName{Name: getJenkinsLockName(jenkins.Name), Namespace: jenkins.Namespace}, lease)
+	if apierrors.IsNotFound(err) {
+		ahead, err := getJenkinsLockWaiterAhead(ctx, c, jenkins, newJenkinsLockWaiter(kind, object))
+		if err != nil || len(ahead) > 0 {
+			return false, ahead, err
+		}
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      getJenkinsLockName(jenkins.Name),
+				Namespace: jenkins.Namespace,
+				OwnerReferences: []metav1.OwnerReference{
+					*metav1.NewControllerRef(jenkins, v1alpha2.GroupVersion.WithKind("Jenkins")),
+				},
+			},
+			Spec: coordinationv1.LeaseSpec{HolderIdentity: &holder, AcquireTime: &now},
+		}
+		err = c.Create(ctx, lease)
+		if apierrors.IsAlreadyExists(err) {
+			// Another Backup or Restore created it meanwhile
+			return false, "", nil
+		}
+		return err == nil, "", err
+	}
+	if err != nil {
+		return false, "", err
+	}
+	currentHolder := ""
+	if lease.Spec.HolderIdentity != nil {
+		currentHolder = *lease.Spec.HolderIdentity
+	}
+	if currentHolder == holder {
+		return true, "", nil
+	}
+	if len(currentHolder) > 0 {
+		done, err := isJenkinsLockHolderDone(ctx, c, currentHolder)
+		if err != nil {
+			return false, "", err
+		}
+		if !done {
+			return false, currentHolder, nil
+		}
+	}
+	ahead, err := getJenkinsLockWaiterAhead(ctx, c, jenkins, newJenkinsLockWaiter(kind, object))
+	if err != nil || len(ahead) > 0 {
+		return false, ahead, err
+	}
+	lease.Spec.HolderIdentity = &holder
+	lease.Spec.AcquireTime = &now
+	err = c.Update(ctx, lease)
+	if apierrors.IsConflict(err) {
+		// Another Backup or Restore took it meanwhile
+		return false, currentHolder, nil
+	}
+	return err == nil, "", err
+}
+
+// jenkinsLockWaiter is a Backup or Restore waiting for the lock of a Jenkins, ordered by creation time
+type jenkinsLockWaiter struct {
+	holder  string
+	created metav1.Time
+}
+
+// newJenkinsLockWaiter returns the waiter of the Backup or Restore
+func newJenkinsLockWaiter(kind string, object metav1.Object) jenkinsLockWaiter {
+	return jenkinsLockWaiter{holder: getJenkinsLockHolder(kind, object), created: object.GetCreationTimestamp()}
+}
+
+// before returns true if the waiter takes the lock before the other one
+func (w jenkinsLockWaiter) before(other jenkinsLockWaiter) bool {
+	if !w.created.Equal(&other.created) {
+		return w.created.Before(&other.created)
+	}
+	return w.holder < other.holder
+}
+
+// getJenkinsLockWaiterAhead returns the identity of the oldest Backup or Restore queued for the lock of the Jenkins
+// before the waiter, or an empty string. The queued Backups whose BackupStrategy is gone and the queued Restores whose
+// Backup is gone can't run, they are left out of the queue.
+func getJenkinsLockWaiterAhead(ctx context.Context, c client.Client, jenkins *v1alpha2.Jenkins, waiter jenkinsLockWaiter) (string, error) {
+	var ahead *jenkinsLockWaiter
+	queue := func(candidate jenkinsLockWaiter) {
+		if candidate.holder != waiter.holder && candidate.before(waiter) && (ahead == nil || candidate.before(*ahead)) {
+			ahead = &candidate
+		}
+	}
+
+	backups := &v1alpha2.BackupList{}
+	err := c.List(ctx, backups, client.InNamespace(jenkins.Namespace))
+	if err != nil {
+		return "", err
+	}
+	for i := range backups.Items {
+		backup := &backups.Items[i]
+		if backup.Status.Phase != v1alpha2.BackupQueued || backup.Spec.JenkinsRef != jenkins.Name || backup.Spec.Cancel || backup.DeletionTimestamp != nil {
+			continue
+		}
+		err = c.Get(ctx, types.NamespacedName{Name: backup.Spec.StrategyRef, Namespace: backup.Namespace}, &v1alpha2.BackupStrategy{})
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		queue(newJenkinsLockWaiter(lockHolderBackup, backup))
+	}
+
+	restores := &v1alpha2.RestoreList{}
+	err = c.List(ctx, restores, client.InNamespace(jenkins.Namespace))
+	if err != nil {
+		return "", err
+	}
+	for i := range restores.Items {
+		restore := &restores.Items[i]
+		if restore.Status.Phase != v1alpha2.RestoreQueued || restore.Spec.Cancel || restore.DeletionTimestamp != nil {
+			continue
+		}
+		backup := &v1alpha2.Backup{}
+		err = c.Get(ctx, types.NamespacedName{Name: restore.Spec.BackupRef, Namespace: getRestoreBackupNamespace(restore)}, backup)
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if target, err := getRestoreTargetJenkins(restore, backup); err == nil && target == jenkins.Name {
+			queue(newJenkinsLockWaiter(lockHolderRestore, restore))
+		}
+	}
+
+	if ahead == nil {
+		return "", nil
+	}
+	return ahead.holder, nil
+}
+
+// releaseJenkinsLock releases the Lease locking the Jenkins if it is held by the holder
+func releaseJenkinsLock(ctx context.Context, c client.Client, namespace, jenkinsName, holder string) error {
+	lease := &coordinationv1.Lease{}
+	err := c.Get(ctx, types.NamespacedName{Name: getJenkinsLockName(jenkinsName), Namespace: namespace}, lease)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != holder {
+		return nil
+	}
+	lease.Spec.HolderIdentity = nil
+	lease.Spec.AcquireTime = nil
+	return c.Update(ctx, lease)
+}
+
+// isJenkinsLockHolderDone returns true if the Backup or Restore holding the lock is complete or was deleted, the lock
+// is then stale
+func isJenkinsLockHolderDone(ctx context.Context, c client.Client, holder string) (bool, error) {
+	parts := strings.SplitN(holder, "/", 3)
+	if len(parts) != 3 {
+		return true, nil
+	}
+	name := types.NamespacedName{Namespace: parts[1], Name: parts[2]}
+	var err error
+	done := false
+	switch parts[0] {
+	case lockHolderBackup:
+		backup := &v1alpha2.Backup{}
+		err = c.Get(ctx, name, backup)
+		done = backup.Status.Phase == v1alpha2.BackupSucceeded || backup.Status.Phase == v1alpha2.BackupFailed
+	case lockHolderRestore:
+		restore := &v1alpha2.Restore{}
+		err = c.Get(ctx, name, restore)
+		done = restore.Status.Phase == v1alpha2.RestoreSucceeded || restore.Status.Phase == v1alpha2.RestoreFailed
+	default:
+		return true, nil
+	}
+	if apierrors.IsNotFound(err) {
+		return true, nil
+	}
+	return done, err
+}
+
+// getJenkinsLockedMessage returns the message of the LockAcquired condition of a queued Backup or Restore
+func getJenkinsLockedMessage(jenkinsName, holder string) string {
+	parts := strings.SplitN(holder, "/", 3)
+	if len(parts) != 3 {
+		return fmt.Sprintf("Jenkins '%s' is locked, another Backup or Restore runs first", jenkinsName)
+	}
+	return fmt.Sprintf("Jenkins '%s' is locked, %s '%s' of namespace '%s' runs first", jenkinsName, parts[0], parts[2], parts[1])
+}
@@ -0,0 +1,143 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/jenkinsci/jenkins-automation-operator/api/v1alpha2"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Jenkins lock", func() {
+	ctx := context.Background()
+	jenkins := &v1alpha2.Jenkins{ObjectMeta: metav1.ObjectMeta{Name: "jenkins", Namespace: "jenkins"}}
+	newBackup := func(name string, phase v1alpha2.BackupPhase) *v1alpha2.Backup {
+		return &v1alpha2.Backup{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "jenkins"},
+			Status:     v1alpha2.BackupStatus{Phase: phase},
+		}
+	}
+	firstBackup := newBackup("first", "")
+	secondRestore := &v1alpha2.Restore{ObjectMeta: metav1.ObjectMeta{Name: "second", Namespace: "jenkins"}}
+	first := getJenkinsLockHolder(lockHolderBackup, firstBackup)
+	second := getJenkinsLockHolder(lockHolderRestore, secondRestore)
+	// newQueuedBackup returns a Backup of the Jenkins queued for its lock since the creation time
+	newQueuedBackup := func(name string, created time.Time) *v1alpha2.Backup {
+		backup := newBackup(name, v1alpha2.BackupQueued)
+		backup.CreationTimestamp = metav1.NewTime(created)
+		backup.Spec.JenkinsRef = "jenkins"
+		backup.Spec.StrategyRef = "strategy"
+		return backup
+	}
+	strategy := &v1alpha2.BackupStrategy{ObjectMeta: metav1.ObjectMeta{Name: "strategy", Namespace: "jenkins"}}
+
+	BeforeEach(func() {
+		Expect(v1alpha2.AddToScheme(scheme.Scheme)).To(Succeed())
+	})
+
+	It("Should Be Acquired When Free", func() {
+		c := fake.NewFakeClientWithScheme(scheme.Scheme)
+
+		locked, _, err := acquireJenkinsLock(ctx, c, jenkins, lockHolderBackup, firstBackup)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(locked).To(BeTrue())
+		lease := &coordinationv1.Lease{}
+		Expect(c.Get(ctx, types.NamespacedName{Name: "jenkins-backup-lock", Namespace: "jenkins"}, lease)).To(Succeed())
+		Expect(*lease.Spec.HolderIdentity).To(Equal(first))
+		Expect(lease.OwnerReferences[0].Kind).To(Equal("Jenkins"))
+
+		locked, _, err = acquireJenkinsLock(ctx, c, jenkins, lockHolderBackup, firstBackup)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(locked).To(BeTrue())
+	})
+
+	It("Should Not Be Acquired While Held By A Running Backup", func() {
+		c := fake.NewFakeClientWithScheme(scheme.Scheme, newBackup("first", v1alpha2.BackupRunning))
+		_, _, err := acquireJenkinsLock(ctx, c, jenkins, lockHolderBackup, firstBackup)
+		Expect(err).NotTo(HaveOccurred())
+
+		locked, holder, err := acquireJenkinsLock(ctx, c, jenkins, lockHolderRestore, secondRestore)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(locked).To(BeFalse())
+		Expect(holder).To(Equal(first))
+		Expect(getJenkinsLockedMessage("jenkins", holder)).To(Equal("Jenkins 'jenkins' is locked, Backup 'first' of namespace 'jenkins' runs first"))
+	})
+
+	It("Should Be Taken Over From A Complete Backup", func() {
+		c := fake.NewFakeClientWithScheme(scheme.Scheme, newBackup("first", v1alpha2.BackupFailed))
+		_, _, err := acquireJenkinsLock(ctx, c, jenkins, lockHolderBackup, firstBackup)
+		Expect(err).NotTo(HaveOccurred())
+
+		locked, _, err := acquireJenkinsLock(ctx, c, jenkins, lockHolderRestore, secondRestore)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(locked).To(BeTrue())
+	})
+
+	It("Should Be Taken Over From A Deleted Backup", func() {
+		c := fake.NewFakeClientWithScheme(scheme.Scheme)
+		_, _, err := acquireJenkinsLock(ctx, c, jenkins, lockHolderBackup, firstBackup)
+		Expect(err).NotTo(HaveOccurred())
+
+		locked, _, err := acquireJenkinsLock(ctx, c, jenkins, lockHolderRestore, secondRestore)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(locked).To(BeTrue())
+	})
+
+	It("Should Only Be Released By Its Holder", func() {
+		c := fake.NewFakeClientWithScheme(scheme.Scheme, newBackup("first", v1alpha2.BackupRunning))
+		_, _, err := acquireJenkinsLock(ctx, c, jenkins, lockHolderBackup, firstBackup)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(releaseJenkinsLock(ctx, c, "jenkins", "jenkins", second)).To(Succeed())
+		locked, _, err := acquireJenkinsLock(ctx, c, jenkins, lockHolderRestore, secondRestore)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(locked).To(BeFalse())
+
+		Expect(releaseJenkinsLock(ctx, c, "jenkins", "jenkins", first)).To(Succeed())
+		locked, _, err = acquireJenkinsLock(ctx, c, jenkins, lockHolderRestore, secondRestore)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(locked).To(BeTrue())
+	})
+
+	It("Should Go To The Oldest Queued Backup Or Restore Once Free", func() {
+		now := time.Now()
+		older := newQueuedBackup("older", now.Add(-2*time.Minute))
+		newer := newQueuedBackup("newer", now.Add(-time.Minute))
+		c := fake.NewFakeClientWithScheme(scheme.Scheme, strategy, older, newer)
+
+		locked, holder, err := acquireJenkinsLock(ctx, c, jenkins, lockHolderBackup, newer)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(locked).To(BeFalse())
+		Expect(holder).To(Equal(getJenkinsLockHolder(lockHolderBackup, older)))
+
+		locked, _, err = acquireJenkinsLock(ctx, c, jenkins, lockHolderBackup, older)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(locked).To(BeTrue())
+	})
+
+	It("Should Not Wait For Queued Backups Which Can't Run", func() {
+		older := newQueuedBackup("older", time.Now().Add(-time.Minute))
+		// The BackupStrategy of the queued Backup is gone
+		c := fake.NewFakeClientWithScheme(scheme.Scheme, older)
+		restore := secondRestore.DeepCopy()
+		restore.CreationTimestamp = metav1.Now()
+
+		locked, _, err := acquireJenkinsLock(ctx, c, jenkins, lockHolderRestore, restore)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(locked).To(BeTrue())
+	})
+})
@@ -0,0 +1,165 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jenkinsci/jenkins-automation-operator/api/v1alpha2"
+	"github.com/jenkinsci/jenkins-automation-operator/pkg/configuration/base/resources"
+	appsv1 "k8s.io/api/apps/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// restoredFromFile is written to the Jenkins Home once it was populated from the backup of restoreFrom
+	restoredFromFile = ".restored-from"
+	// restoringFromFile is written to the Jenkins Home before the backup of restoreFrom is extracted, and removed once it
+	// was restored, so that a restore interrupted partway is run again
+	restoringFromFile = ".restoring-from"
+	// restoreFromBackupVolumeName is the volume of the Jenkins Pod mounting the BackupVolume of restoreFrom
+	restoreFromBackupVolumeName = "restore-from-backup-volume"
+)
+
+// newRestoreFrom returns the init container populating the Jenkins Home from the backup of restoreFrom, or nil if the
+// Jenkins has no restoreFrom. It is only returned while the Jenkins Deployment doesn't exist: the backup is restored
+// before Jenkins starts for the first time, the Backup doesn't have to exist afterwards.
+func (r *JenkinsReconciler) newRestoreFrom(ctx context.Context, jenkins *v1alpha2.Jenkins) (*resources.RestoreFrom, error) {
+	if jenkins.Spec.RestoreFrom == nil {
+		return nil, nil
+	}
+	deployment := &appsv1.Deployment{}
+	err := r.Client.Get(ctx, types.NamespacedName{Name: resources.GetJenkinsDeploymentName(jenkins), Namespace: jenkins.Namespace}, deployment)
+	if err == nil || !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+	backup, err := getRestoreFromBackup(ctx, r.Client, jenkins)
+	if err != nil {
+		return nil, err
+	}
+	backupVolume, err := getBackupVolume(ctx, r.Client, backup)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get BackupVolume '%s' of restoreFrom: %s", backup.Spec.BackupVolumeRef, err)
+	}
+	backupStrategyName := backup.Spec.StrategyRef
+	if len(backupStrategyName) == 0 {
+		backupStrategyName = DefaultBackupStrategyName
+	}
+	backupStrategy := &v1alpha2.BackupStrategy{}
+	err = r.Client.Get(ctx, types.NamespacedName{Name: backupStrategyName, Namespace: jenkins.Namespace}, backupStrategy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get BackupStrategy '%s' of restoreFrom: %s", backupStrategyName, err)
+	}
+	// The init container would fail until its Secrets exist
+	if err = checkBackupJobSecrets(ctx, r.Client, backupVolume, backupStrategy); err != nil {
+		return nil, err
+	}
+	image, command, err := getBackupJobImage(ctx, r.Client)
+	if err != nil {
+		return nil, err
+	}
+	return newRestoreFromInitContainer(jenkins, backup, backupVolume, backupStrategy, image, command)
+}
+
+// getRestoreFromBackup returns the backup of restoreFrom as stored on the BackupVolume it is restored from. A backup
+// which has no Backup, such as an orphaned backup of the catalog of the BackupVolume, is stored as a Backup of the
+// namespace of the Jenkins would be.
+func getRestoreFromBackup(ctx context.Context, c client.Client, jenkins *v1alpha2.Jenkins) (*v1alpha2.Backup, error) {
+	restoreFrom := jenkins.Spec.RestoreFrom
+	backup := &v1alpha2.Backup{}
+	err := c.Get(ctx, types.NamespacedName{Name: restoreFrom.BackupRef, Namespace: jenkins.Namespace}, backup)
+	if apierrors.IsNotFound(err) {
+		if len(restoreFrom.BackupVolumeRef) == 0 {
+			return nil, fmt.Errorf("backup '%s' of restoreFrom not found, backupVolumeRef is required to restore a backup which has no Backup", restoreFrom.BackupRef)
+		}
+		return &v1alpha2.Backup{
+			ObjectMeta: metav1.ObjectMeta{Name: restoreFrom.BackupRef, Namespace: jenkins.Namespace},
+			Spec:       v1alpha2.BackupSpec{BackupVolumeRef: restoreFrom.BackupVolumeRef, StrategyRef: restoreFrom.StrategyRef},
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if backup.Status.Phase != v1alpha2.BackupSucceeded {
+		return nil, fmt.Errorf("backup '%s' of restoreFrom has not succeeded", backup.Name)
+	}
+	if len(backup.Status.VolumeSnapshot) > 0 {
+		return nil, fmt.Errorf("backup '%s' of restoreFrom was taken as a VolumeSnapshot, the Jenkins Home is populated from an archive only", backup.Name)
+	}
+	if err = checkBackupRestorable(backup); err != nil {
+		return nil, err
+	}
+	backup, err = getRestoreSourceBackup(backup, restoreFrom.BackupVolumeRef)
+	if err != nil {
+		return nil, err
+	}
+	if len(restoreFrom.StrategyRef) > 0 {
+		backup.Spec.StrategyRef = restoreFrom.StrategyRef
+	}
+	return backup, nil
+}
+
+// newRestoreFromInitContainer returns the init container running the Restore of the Backup as a backup Job would, on
+// the Jenkins Home of the Jenkins Pod, with the security context of the Jenkins container
+func newRestoreFromInitContainer(jenkins *v1alpha2.Jenkins, backup *v1alpha2.Backup, backupVolume *v1alpha2.BackupVolume, backupStrategy *v1alpha2.BackupStrategy, image string, command []string) (*resources.RestoreFrom, error) {
+	spec := newBackupJobSpec(backupJobRestore, jenkins.Name, backup, backupVolume, backupStrategy)
+	spec.FirstStart = true
+	container, volumes, err := newBackupJobContainer(resources.RestoreFromInitContainerName, spec, resources.JenkinsHomeVolumeName, restoreFromBackupVolumeName, backupVolume, backupStrategy, image, command)
+	if err != nil {
+		return nil, err
+	}
+	if jenkins.Status != nil && jenkins.Status.Spec != nil && jenkins.Status.Spec.Master != nil && len(jenkins.Status.Spec.Master.Containers) > 0 {
+		container.SecurityContext = jenkins.Status.Spec.Master.Containers[0].SecurityContext
+	}
+	return &resources.RestoreFrom{Container: container, Volumes: volumes}, nil
+}
+
+// runFirstStartRestore restores the Backup in the Jenkins Home unless it was already restored, or unless Jenkins
+// already started on the Jenkins Home, so that the Restore only runs before Jenkins starts for the first time. An
+// ephemeral Jenkins Home is populated again whenever the Jenkins Pod starts. A restore interrupted partway, e.g. by a
+// crash of the init container, left its in-progress marker and is run again although it may have extracted config.xml.
+func runFirstStartRestore(ctx context.Context, spec *backupJobSpec, jenkinsHome string, storage backupStorage, encryptionKey []byte) (*backupJobResult, error) {
+	marker := filepath.Join(jenkinsHome, restoredFromFile)
+	content, err := ioutil.ReadFile(marker)
+	if err == nil {
+		logger.Info(fmt.Sprintf("Jenkins Home %s was already restored from Backup '%s'", jenkinsHome, strings.TrimSpace(string(content))))
+		return &backupJobResult{}, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	inProgressMarker := filepath.Join(jenkinsHome, restoringFromFile)
+	content, err = ioutil.ReadFile(inProgressMarker)
+	switch {
+	case err == nil:
+		logger.Info(fmt.Sprintf("Restore of Backup '%s' in Jenkins Home %s was interrupted, restoring Backup '%s' again", strings.TrimSpace(string(content)), jenkinsHome, spec.Backup))
+	case os.IsNotExist(err):
+		_, err = os.Stat(filepath.Join(jenkinsHome, "config.xml"))
+		if err == nil {
+			logger.Info(fmt.Sprintf("Jenkins already started on Jenkins Home %s, Backup '%s' is not restored", jenkinsHome, spec.Backup))
+			return &backupJobResult{}, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+	if err = ioutil.WriteFile(inProgressMarker, []byte(spec.Backup+"\n"), 0644); err != nil {
+		return nil, err
+	}
+	result, err := runBackupJobRestore(ctx, spec, jenkinsHome, storage, encryptionKey)
+	if err != nil {
+		return result, err
+	}
+	if err = ioutil.WriteFile(marker, []byte(spec.Backup+"\n"), 0644); err != nil {
+		return result, err
+	}
+	return result, os.Remove(inProgressMarker)
+}
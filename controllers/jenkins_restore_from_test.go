@@ -0,0 +1,202 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/jenkinsci/jenkins-automation-operator/api/v1alpha2"
+	"github.com/jenkinsci/jenkins-automation-operator/pkg/configuration/base/resources"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Jenkins restoreFrom", func() {
+	ctx := context.Background()
+	newJenkins := func(restoreFrom v1alpha2.RestoreFrom) *v1alpha2.Jenkins {
+		return &v1alpha2.Jenkins{
+			ObjectMeta: metav1.ObjectMeta{Name: "jenkins", Namespace: "jenkins"},
+			Spec:       v1alpha2.JenkinsSpec{RestoreFrom: &restoreFrom},
+		}
+	}
+	newReconciler := func(objects ...runtime.Object) *JenkinsReconciler {
+		objects = append(objects,
+			&v1alpha2.BackupVolume{ObjectMeta: metav1.ObjectMeta{Name: "backup-volume", Namespace: "jenkins"}},
+			&v1alpha2.BackupStrategy{ObjectMeta: metav1.ObjectMeta{Name: DefaultBackupStrategyName, Namespace: "jenkins"}},
+		)
+		return &JenkinsReconciler{Client: fake.NewFakeClientWithScheme(scheme.Scheme, objects...)}
+	}
+	backup := &v1alpha2.Backup{
+		ObjectMeta: metav1.ObjectMeta{Name: "backup", Namespace: "jenkins"},
+		Spec:       v1alpha2.BackupSpec{JenkinsRef: "other-jenkins", BackupVolumeRef: "backup-volume"},
+		Status:     v1alpha2.BackupStatus{Phase: v1alpha2.BackupSucceeded},
+	}
+
+	BeforeEach(func() {
+		Expect(v1alpha2.AddToScheme(scheme.Scheme)).To(Succeed())
+		Expect(os.Setenv(resources.JenkinsBackupJobImageEnvVar, "operator:latest")).To(Succeed())
+	})
+
+	AfterEach(func() {
+		Expect(os.Unsetenv(resources.JenkinsBackupJobImageEnvVar)).To(Succeed())
+	})
+
+	It("Should Restore The Backup In An Init Container", func() {
+		reconciler := newReconciler(backup)
+
+		restoreFrom, err := reconciler.newRestoreFrom(ctx, newJenkins(v1alpha2.RestoreFrom{BackupRef: "backup"}))
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(restoreFrom).NotTo(BeNil())
+		container := restoreFrom.Container
+		Expect(container.Name).To(Equal(resources.RestoreFromInitContainerName))
+		Expect(container.Image).To(Equal("operator:latest"))
+		Expect(container.Args).To(Equal([]string{BackupJobCommand}))
+		Expect(container.VolumeMounts).To(Equal([]corev1.VolumeMount{
+			{Name: resources.JenkinsHomeVolumeName, MountPath: "/var/lib/jenkins"},
+			{Name: restoreFromBackupVolumeName, MountPath: "/jenkins-backups/backup-volume"},
+		}))
+		Expect(restoreFrom.Volumes).To(HaveLen(1))
+		Expect(restoreFrom.Volumes[0].PersistentVolumeClaim.ClaimName).To(Equal("backup-volume-jenkins-backup"))
+		spec := &backupJobSpec{}
+		Expect(json.Unmarshal([]byte(container.Env[0].Value), spec)).To(Succeed())
+		Expect(spec.Operation).To(Equal(backupJobRestore))
+		Expect(spec.FirstStart).To(BeTrue())
+		Expect(spec.Backup).To(Equal("backup"))
+		Expect(spec.Directory).To(Equal("/jenkins-backups/backup-volume/backup"))
+	})
+
+	It("Should Restore A Backup Which Has No Backup From The BackupVolume", func() {
+		reconciler := newReconciler()
+
+		restoreFrom, err := reconciler.newRestoreFrom(ctx, newJenkins(v1alpha2.RestoreFrom{BackupRef: "orphaned", BackupVolumeRef: "backup-volume"}))
+
+		Expect(err).NotTo(HaveOccurred())
+		spec := &backupJobSpec{}
+		Expect(json.Unmarshal([]byte(restoreFrom.Container.Env[0].Value), spec)).To(Succeed())
+		Expect(spec.Directory).To(Equal("/jenkins-backups/backup-volume/orphaned"))
+	})
+
+	It("Should Fail When The Backup Is Missing", func() {
+		reconciler := newReconciler()
+
+		_, err := reconciler.newRestoreFrom(ctx, newJenkins(v1alpha2.RestoreFrom{BackupRef: "missing"}))
+
+		Expect(err).To(MatchError("backup 'missing' of restoreFrom not found, backupVolumeRef is required to restore a backup which has no Backup"))
+	})
+
+	It("Should Fail When The Backup Has Not Succeeded", func() {
+		running := backup.DeepCopy()
+		running.Status.Phase = v1alpha2.BackupRunning
+		reconciler := newReconciler(running)
+
+		_, err := reconciler.newRestoreFrom(ctx, newJenkins(v1alpha2.RestoreFrom{BackupRef: "backup"}))
+
+		Expect(err).To(MatchError("backup 'backup' of restoreFrom has not succeeded"))
+	})
+
+	It("Should Fail When The Backup Was Exported To Git", func() {
+		exported := backup.DeepCopy()
+		exported.Status.GitExport = &v1alpha2.GitExportStatus{URL: "/srv/git/config.git", Branch: "main"}
+		reconciler := newReconciler(exported)
+
+		_, err := reconciler.newRestoreFrom(ctx, newJenkins(v1alpha2.RestoreFrom{BackupRef: "backup"}))
+
+		Expect(err).To(MatchError("backup 'backup' was exported to the Git repository /srv/git/config.git, it has no archive to restore"))
+	})
+
+	It("Should Not Restore Once The Deployment Exists", func() {
+		deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "jenkins-jenkins", Namespace: "jenkins"}}
+		reconciler := newReconciler(deployment)
+
+		restoreFrom, err := reconciler.newRestoreFrom(ctx, newJenkins(v1alpha2.RestoreFrom{BackupRef: "backup"}))
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(restoreFrom).To(BeNil())
+	})
+})
+
+var _ = Describe("First start restore", func() {
+	ctx := context.Background()
+	var (
+		tempDir string
+		spec    *backupJobSpec
+		storage *localBackupStorage
+	)
+
+	BeforeEach(func() {
+		var err error
+		tempDir, err = ioutil.TempDir("", "restore-from")
+		Expect(err).NotTo(HaveOccurred())
+		sourceHome := filepath.Join(tempDir, "source")
+		backupDirectory := filepath.Join(tempDir, "backups", "backup")
+		writeHomeFiles(sourceHome, map[string]string{"config.xml": "<hudson/>", "jobs/a/config.xml": "<project/>"})
+		spec = &backupJobSpec{Operation: backupJobBackup, Name: "backup", Backup: "backup",
+			Strategy: v1alpha2.BackupStrategySpec{Options: v1alpha2.BackupOptions{Config: true, Jobs: true}}, Directory: backupDirectory}
+		storage = &localBackupStorage{directory: backupDirectory}
+		_, err = runBackupJobBackup(ctx, spec, sourceHome, storage, nil)
+		Expect(err).NotTo(HaveOccurred())
+		spec.Operation = backupJobRestore
+		spec.FirstStart = true
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tempDir)).To(Succeed())
+	})
+
+	It("Should Restore Into A New Jenkins Home Once", func() {
+		jenkinsHome := filepath.Join(tempDir, "new")
+		Expect(os.MkdirAll(filepath.Join(jenkinsHome, "lost+found"), 0755)).To(Succeed())
+
+		result, err := runFirstStartRestore(ctx, spec, jenkinsHome, storage, nil)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.FileCount).To(Equal(int64(2)))
+		Expect(readHomeFile(jenkinsHome, "jobs/a/config.xml")).To(Equal("<project/>"))
+		Expect(readHomeFile(jenkinsHome, restoredFromFile)).To(Equal("backup\n"))
+
+		writeHomeFiles(jenkinsHome, map[string]string{"jobs/a/config.xml": "<changed/>"})
+		Expect(os.Remove(filepath.Join(jenkinsHome, "config.xml"))).To(Succeed())
+		result, err = runFirstStartRestore(ctx, spec, jenkinsHome, storage, nil)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.FileCount).To(BeZero())
+		Expect(readHomeFile(jenkinsHome, "jobs/a/config.xml")).To(Equal("<changed/>"))
+	})
+
+	It("Should Not Restore Once Jenkins Has Started", func() {
+		jenkinsHome := filepath.Join(tempDir, "started")
+		writeHomeFiles(jenkinsHome, map[string]string{"config.xml": "<started/>"})
+
+		result, err := runFirstStartRestore(ctx, spec, jenkinsHome, storage, nil)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.FileCount).To(BeZero())
+		Expect(readHomeFile(jenkinsHome, "config.xml")).To(Equal("<started/>"))
+		_, err = os.Stat(filepath.Join(jenkinsHome, restoredFromFile))
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+
+	It("Should Restore Again After An Interrupted Restore", func() {
+		jenkinsHome := filepath.Join(tempDir, "interrupted")
+		// The init container crashed once config.xml was extracted
+		writeHomeFiles(jenkinsHome, map[string]string{"config.xml": "<hudson/>", restoringFromFile: "backup\n"})
+
+		result, err := runFirstStartRestore(ctx, spec, jenkinsHome, storage, nil)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.FileCount).To(Equal(int64(2)))
+		Expect(readHomeFile(jenkinsHome, "jobs/a/config.xml")).To(Equal("<project/>"))
+		Expect(readHomeFile(jenkinsHome, restoredFromFile)).To(Equal("backup\n"))
+		_, err = os.Stat(filepath.Join(jenkinsHome, restoringFromFile))
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+})
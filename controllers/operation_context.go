@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/operator-framework/operator-lib/status"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// cancelPollInterval is how often a running Backup or Restore is checked for cancellation
+const cancelPollInterval = 5 * time.Second
+
+var (
+	// OperationCancelled is the reason of the completion condition of a cancelled Backup or Restore
+	OperationCancelled status.ConditionReason = "Cancelled"
+	// DeadlineExceeded is the reason of the completion condition of a Backup or Restore stopped at the
+	// activeDeadlineSeconds of its BackupStrategy
+	DeadlineExceeded status.ConditionReason = "DeadlineExceeded"
+)
+
+// operationContext is the context of the steps of a running Backup or Restore. It is done once the Backup or Restore
+// reaches the deadline of its BackupStrategy, or once it is cancelled.
+type operationContext struct {
+	context.Context
+	cancel    context.CancelFunc
+	kind      string
+	deadline  time.Duration
+	cancelled int32
+}
+
+// newOperationContext returns the context of the running Backup or Restore, with the deadline counted from its start
+// time. The object is fetched every cancelPollInterval and the context is cancelled once isCancelled returns true for it.
+// The context must be stopped once the steps are done.
+func newOperationContext(c client.Client, kind string, object runtime.Object, key types.NamespacedName, startTime *metav1.Time, activeDeadlineSeconds *int64, isCancelled func(runtime.Object) bool) *operationContext {
+	operation := &operationContext{kind: kind}
+	if activeDeadlineSeconds != nil && startTime != nil {
+		operation.deadline = time.Duration(*activeDeadlineSeconds) * time.Second
+		operation.Context, operation.cancel = context.WithDeadline(context.Background(), startTime.Add(operation.deadline))
+	} else {
+		operation.Context, operation.cancel = context.WithCancel(context.Background())
+	}
+	if isCancelled(object) {
+		operation.markCancelled()
+		return operation
+	}
+	go func() {
+		_ = wait.PollUntil(cancelPollInterval, func() (bool, error) {
+			current := object.DeepCopyObject()
+			if err := c.Get(operation, key, current); err != nil {
+				// The cancellation is checked again at the next poll
+				return false, nil
+			}
+			if isCancelled(current) {
+				operation.markCancelled()
+				return true, nil
+			}
+			return false, nil
+		}, operation.Done())
+	}()
+	return operation
+}
+
+func (o *operationContext) markCancelled() {
+	atomic.StoreInt32(&o.cancelled, 1)
+	o.cancel()
+}
+
+// stop releases the resources of the context
+func (o *operationContext) stop() {
+	o.cancel()
+}
+
+// err returns the error failing the Backup or Restore along with its reason once the context is done, nil otherwise
+func (o *operationContext) err() (status.ConditionReason, error) {
+	if atomic.LoadInt32(&o.cancelled) == 1 {
+		return OperationCancelled, fmt.Errorf("%s cancelled", o.kind)
+	}
+	if o.Context.Err() == context.DeadlineExceeded {
+		return DeadlineExceeded, fmt.Errorf("%s exceeded its deadline of %s", o.kind, o.deadline)
+	}
+	return "", nil
+}
+
+// pollImmediate polls the condition like wait.PollImmediate, and stops early with the error of the context once it
+// is done. It returns wait.ErrWaitTimeout when the timeout expires.
+func pollImmediate(ctx context.Context, interval, timeout time.Duration, condition wait.ConditionFunc) error {
+	timeoutCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	err := wait.PollImmediateUntil(interval, condition, timeoutCtx.Done())
+	if err == wait.ErrWaitTimeout && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
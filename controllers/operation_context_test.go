@@ -0,0 +1,83 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/jenkinsci/jenkins-automation-operator/api/v1alpha2"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Operation context", func() {
+	key := types.NamespacedName{Name: "backup", Namespace: "jenkins"}
+	deadline := int64(60)
+	newBackup := func() *v1alpha2.Backup {
+		return &v1alpha2.Backup{ObjectMeta: metav1.ObjectMeta{Name: "backup", Namespace: "jenkins"}}
+	}
+
+	BeforeEach(func() {
+		Expect(v1alpha2.AddToScheme(scheme.Scheme)).To(Succeed())
+	})
+
+	It("Should Not Be Done While Running", func() {
+		backup := newBackup()
+		startTime := metav1.Now()
+		operation := newOperationContext(fake.NewFakeClientWithScheme(scheme.Scheme, backup), "backup", backup, key, &startTime, &deadline, isBackupCancelled)
+		defer operation.stop()
+
+		reason, err := operation.err()
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reason).To(BeEmpty())
+		Expect(operation.Err()).NotTo(HaveOccurred())
+	})
+
+	It("Should Be Done Once Cancelled", func() {
+		backup := newBackup()
+		backup.Spec.Cancel = true
+		operation := newOperationContext(fake.NewFakeClientWithScheme(scheme.Scheme, backup), "backup", backup, key, nil, nil, isBackupCancelled)
+		defer operation.stop()
+
+		reason, err := operation.err()
+
+		Expect(err).To(MatchError("backup cancelled"))
+		Expect(reason).To(Equal(OperationCancelled))
+	})
+
+	It("Should Be Done Once The Deadline Is Exceeded", func() {
+		backup := newBackup()
+		startTime := metav1.NewTime(time.Now().Add(-2 * time.Minute))
+		operation := newOperationContext(fake.NewFakeClientWithScheme(scheme.Scheme, backup), "backup", backup, key, &startTime, &deadline, isBackupCancelled)
+		defer operation.stop()
+
+		reason, err := operation.err()
+
+		Expect(err).To(MatchError("backup exceeded its deadline of 1m0s"))
+		Expect(reason).To(Equal(DeadlineExceeded))
+	})
+})
+
+var _ = Describe("Polling", func() {
+	never := func() (bool, error) { return false, nil }
+
+	It("Should Time Out", func() {
+		err := pollImmediate(context.Background(), time.Millisecond, 10*time.Millisecond, never)
+
+		Expect(err).To(Equal(wait.ErrWaitTimeout))
+	})
+
+	It("Should Stop Once The Context Is Done", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		err := pollImmediate(ctx, time.Millisecond, time.Minute, never)
+
+		Expect(err).To(Equal(context.Canceled))
+	})
+})
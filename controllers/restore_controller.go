@@ -17,8 +17,15 @@ limitations under the License.
 package controllers
 
 import (
+	"compress/gzip"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
 
 	"github.com/jenkinsci/jenkins-automation-operator/pkg/notifications/event"
 	"github.com/jenkinsci/jenkins-automation-operator/pkg/notifications/reason"
@@ -44,7 +51,9 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	v1alpha2 "github.com/jenkinsci/jenkins-automation-operator/api/v1alpha2"
+	jenkinsclient "github.com/jenkinsci/jenkins-automation-operator/pkg/client"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 )
 
 // RestoreReconciler reconciles a Restore object
@@ -53,6 +62,10 @@ type RestoreReconciler struct {
 	Log                logr.Logger
 	Scheme             *runtime.Scheme
 	NotificationEvents chan event.Event
+	// RESTMapper finds the version of the VolumeSnapshot API served by the cluster
+	RESTMapper meta.RESTMapper
+	// NewExecClient returns the client running the scripts of the backup sidecar, exec.NewKubeExecClient when nil
+	NewExecClient func() exec.KubeExecClient
 }
 
 var (
@@ -62,14 +75,36 @@ var (
 	RestoreCompleted   status.ConditionType = "RestoreCompleted"
 	RestartStarted     status.ConditionType = "RestartStarted"
 	SafeRestartStarted status.ConditionType = "SafeRestartStarted"
+	// CompatibilityChecked is set once the Backup was compared with the target Jenkins
+	CompatibilityChecked status.ConditionType = "CompatibilityChecked"
+	// PreRestoreHooksCompleted and PostRestoreHooksCompleted are set when the BackupStrategy has hooks
+	PreRestoreHooksCompleted  status.ConditionType = "PreRestoreHooksCompleted"
+	PostRestoreHooksCompleted status.ConditionType = "PostRestoreHooksCompleted"
+	// RestoreArchiveFailed and other Condition Reasons
+	RestoreArchiveFailed status.ConditionReason = "RestoreArchiveFailed"
+	RestoreCopyFailed    status.ConditionReason = "RestoreCopyFailed"
+	RestoreIncompatible  status.ConditionReason = "RestoreIncompatible"
+	// CompatibilityCheckFailed, PluginsInstalled and PluginInstallFailed are reasons of the CompatibilityChecked condition
+	CompatibilityCheckFailed status.ConditionReason = "CompatibilityCheckFailed"
+	PluginsInstalled         status.ConditionReason = "PluginsInstalled"
+	PluginInstallFailed      status.ConditionReason = "PluginInstallFailed"
+	InvalidRestoreTarget     status.ConditionReason = "InvalidRestoreTarget"
+	BackupAccessDenied       status.ConditionReason = "BackupAccessDenied"
+	RestartFailed            status.ConditionReason = "RestartFailed"
+	SafeRestartFailed        status.ConditionReason = "SafeRestartFailed"
+	// RestoreInterrupted is the reason of the RestoreCompleted condition when a resumed Restore can't complete
+	RestoreInterrupted status.ConditionReason = "RestoreInterrupted"
+	// BackupNotRestorable is the reason of the RestoreInitialized condition when the Backup has no archive to restore
+	BackupNotRestorable status.ConditionReason = "BackupNotRestorable"
 )
 
 // +kubebuilder:rbac:groups=jenkins.io,resources=restores;restores/status,verbs=*
+// +kubebuilder:rbac:groups=authorization.k8s.io,resources=subjectaccessreviews,verbs=create
 
 func (r *RestoreReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	ctx := context.Background()
 	restoreLogger := r.Log.WithValues("restore", req.NamespacedName)
-	execClient := exec.NewKubeExecClient()
+	execClient := newExecClient(r.NewExecClient)
 
 	// Fetch the Restore instance
 	restoreInstance := &v1alpha2.Restore{}
@@ -84,20 +119,57 @@ func (r *RestoreReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 		// Error reading the object - requeue the request.
 		return ctrl.Result{}, err
 	}
-	if len(restoreInstance.Status.Conditions) > 0 {
-		return ctrl.Result{}, nil
+	switch restoreInstance.Status.Phase {
+	case v1alpha2.RestoreSucceeded, v1alpha2.RestoreFailed:
+		// The Jenkins is unlocked once the Restore is complete
+		if len(restoreInstance.Status.Jenkins) == 0 {
+			return ctrl.Result{}, nil
+		}
+		holder := getJenkinsLockHolder(lockHolderRestore, restoreInstance)
+		return ctrl.Result{}, releaseJenkinsLock(ctx, r.Client, restoreInstance.Namespace, restoreInstance.Status.Jenkins, holder)
+	case v1alpha2.RestoreRunning:
+		restoreLogger.Info(fmt.Sprintf("Resuming Restore '%s' at step %s", restoreInstance.Name, restoreInstance.Status.Step))
+	case v1alpha2.RestoreQueued:
+		// The Restore tries again to lock its Jenkins
+	default:
+		// Restores created before the phases were introduced are complete once they have conditions
+		if len(restoreInstance.Status.Phase) == 0 && len(restoreInstance.Status.Conditions) > 0 {
+			return ctrl.Result{}, nil
+		}
+		restoreLogger.Info("Jenkins Restore with name " + restoreInstance.Name + " has been created")
+		setRestorePhase(restoreInstance, v1alpha2.RestorePending, nil)
+		err = r.Client.Status().Update(ctx, restoreInstance)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	resumed := restoreInstance.Status.Phase == v1alpha2.RestoreRunning
+	// A Restore cancelled before it started fails right away, without locking its Jenkins
+	if restoreInstance.Spec.Cancel && !resumed {
+		err = errors.New("restore cancelled before it started")
+		restoreInstance.Status.Conditions.SetCondition(status.Condition{
+			Type:    RestoreCompleted,
+			Status:  corev1.ConditionFalse,
+			Reason:  OperationCancelled,
+			Message: err.Error(),
+		})
+		setRestorePhase(restoreInstance, v1alpha2.RestoreFailed, err)
+		return ctrl.Result{}, r.Client.Status().Update(ctx, restoreInstance)
 	}
-	restoreLogger.Info("Jenkins Restore with name " + restoreInstance.Name + " has been created")
 
-	// Fetch the Backup instance
+	// Fetch the Backup instance, which may be in another namespace
 	backupInstance := &v1alpha2.Backup{}
 	backupNamespacedName := types.NamespacedName{
 		Name:      restoreInstance.Spec.BackupRef,
-		Namespace: req.Namespace,
+		Namespace: getRestoreBackupNamespace(restoreInstance),
 	}
 	err = r.Client.Get(ctx, backupNamespacedName, backupInstance)
 	if err != nil {
 		if apierrors.IsNotFound(err) {
+			// A resumed Restore can't complete without its Backup
+			if resumed {
+				return ctrl.Result{}, r.failInterruptedRestore(ctx, restoreInstance, fmt.Errorf("backup '%s' was deleted", backupNamespacedName.Name))
+			}
 			// Request object not found, could have been deleted after reconcile request.
 			// Owned objects are automatically garbage collected. For additional cleanup logic use finalizers.
 			// Return and don't requeue
@@ -117,12 +189,16 @@ func (r *RestoreReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 		backupStrategyName = backupSpec.StrategyRef
 	}
 	backupStrategyNamespacedName := types.NamespacedName{
-		Namespace: req.Namespace,
+		Namespace: backupInstance.Namespace,
 		Name:      backupStrategyName,
 	}
 	err = r.Client.Get(ctx, backupStrategyNamespacedName, backupStrategy)
 	if err != nil {
 		if apierrors.IsNotFound(err) {
+			// A resumed Restore can't complete without its BackupStrategy
+			if resumed {
+				return ctrl.Result{}, r.failInterruptedRestore(ctx, restoreInstance, fmt.Errorf("backupStrategy '%s' was deleted", backupStrategyName))
+			}
 			// Request object not found, could have been deleted after reconcile request.
 			// Owned objects are automatically garbage collected. For additional cleanup logic use finalizers.
 			// Return and don't requeue
@@ -132,13 +208,66 @@ func (r *RestoreReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 		return ctrl.Result{}, err
 	}
 
+	// Fetch the target Jenkins instance
+	jenkinsName, err := getRestoreTargetJenkins(restoreInstance, backupInstance)
+	if err != nil {
+		restoreInstance.Status.Conditions.SetCondition(status.Condition{
+			Type:    RestoreInitialized,
+			Status:  corev1.ConditionFalse,
+			Reason:  InvalidRestoreTarget,
+			Message: err.Error(),
+		})
+		setRestorePhase(restoreInstance, v1alpha2.RestoreFailed, err)
+		return ctrl.Result{}, r.Client.Status().Update(ctx, restoreInstance)
+	}
+	// The Backup is read from the replica referenced by the Restore, if any
+	backupInstance, err = getRestoreSourceBackup(backupInstance, restoreInstance.Spec.BackupVolumeRef)
+	if err != nil {
+		restoreInstance.Status.Conditions.SetCondition(status.Condition{
+			Type:    RestoreInitialized,
+			Status:  corev1.ConditionFalse,
+			Reason:  BackupReplicaNotFound,
+			Message: err.Error(),
+		})
+		setRestorePhase(restoreInstance, v1alpha2.RestoreFailed, err)
+		return ctrl.Result{}, r.Client.Status().Update(ctx, restoreInstance)
+	}
+	if err = checkBackupRestorable(backupInstance); err != nil {
+		restoreInstance.Status.Conditions.SetCondition(status.Condition{
+			Type:    RestoreInitialized,
+			Status:  corev1.ConditionFalse,
+			Reason:  BackupNotRestorable,
+			Message: err.Error(),
+		})
+		setRestorePhase(restoreInstance, v1alpha2.RestoreFailed, err)
+		return ctrl.Result{}, r.Client.Status().Update(ctx, restoreInstance)
+	}
+	// Jobs and folders are restored from an archive only, a VolumeSnapshot replaces the whole Jenkins Home
+	items, err := newRestoreItems(restoreInstance.Spec.Items, restoreInstance.Spec.TargetFolder)
+	if err == nil && items != nil && len(backupInstance.Status.VolumeSnapshot) > 0 {
+		err = fmt.Errorf("items can't be restored from Backup '%s', it was taken as a VolumeSnapshot", backupInstance.Name)
+	}
+	if err != nil {
+		restoreInstance.Status.Conditions.SetCondition(status.Condition{
+			Type:    RestoreInitialized,
+			Status:  corev1.ConditionFalse,
+			Reason:  InvalidRestoreItems,
+			Message: err.Error(),
+		})
+		setRestorePhase(restoreInstance, v1alpha2.RestoreFailed, err)
+		return ctrl.Result{}, r.Client.Status().Update(ctx, restoreInstance)
+	}
 	jenkinsNamespacedName := types.NamespacedName{
-		Name:      backupSpec.JenkinsRef,
+		Name:      jenkinsName,
 		Namespace: req.Namespace,
 	}
 	err = r.Client.Get(ctx, jenkinsNamespacedName, jenkinsInstance)
 	if err != nil {
 		if apierrors.IsNotFound(err) {
+			// A resumed Restore can't complete without its Jenkins
+			if resumed {
+				return ctrl.Result{}, r.failInterruptedRestore(ctx, restoreInstance, fmt.Errorf("jenkins '%s' was deleted", jenkinsName))
+			}
 			// Request object not found, could have been deleted after reconcile request.
 			// Owned objects are automatically garbage collected. For additional cleanup logic use finalizers.
 			// Return and don't requeue
@@ -147,6 +276,7 @@ func (r *RestoreReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 		// Error reading the object - requeue the request.
 		return ctrl.Result{}, err
 	}
+	backupStrategy = withJenkinsBackupRunner(backupStrategy, jenkinsInstance)
 	restoreLogger.Info(fmt.Sprintf("Restore in progress for Jenkins instance '%s'", jenkinsInstance.Name))
 	restoreLogger.Info(fmt.Sprintf("Jenkins '%s' for Restore '%s' found !", jenkinsInstance.Name, req.Name))
 
@@ -158,47 +288,269 @@ func (r *RestoreReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	err = execClient.InitKubeGoClient()
 	if err != nil {
 		restoreInstance.Status.Conditions.SetCondition(status.Condition{
-			Type:   RestoreInitialized,
-			Status: corev1.ConditionFalse,
-			Reason: (status.ConditionReason)(err.Error()),
+			Type:    RestoreInitialized,
+			Status:  corev1.ConditionFalse,
+			Reason:  ExecClientInitializationFailed,
+			Message: err.Error(),
 		})
+		setRestorePhase(restoreInstance, v1alpha2.RestoreFailed, err)
 		err = r.Client.Status().Update(ctx, restoreInstance)
 		if err != nil {
 			return ctrl.Result{}, err
 		}
 		return ctrl.Result{}, err
 	}
+	// A Backup of another namespace can only be restored if the target Jenkins is allowed to get it
+	if backupInstance.Namespace != restoreInstance.Namespace {
+		err = checkBackupAccess(ctx, r.Client, jenkinsPod, backupInstance)
+		if err != nil {
+			restoreInstance.Status.Conditions.SetCondition(status.Condition{
+				Type:    RestoreInitialized,
+				Status:  corev1.ConditionFalse,
+				Reason:  BackupAccessDenied,
+				Message: err.Error(),
+			})
+			setRestorePhase(restoreInstance, v1alpha2.RestoreFailed, err)
+			return ctrl.Result{}, r.Client.Status().Update(ctx, restoreInstance)
+		}
+	}
 	restoreInstance.Status.Conditions.SetCondition(status.Condition{
 		Type:   RestoreInitialized,
 		Status: corev1.ConditionTrue,
 	})
+	restoreInstance.Status.Jenkins = jenkinsInstance.Name
+
+	// Backups and Restores of a Jenkins run one at a time, the Restore is queued while another one holds the lock
+	locked, err := r.lockJenkins(ctx, jenkinsInstance, restoreInstance)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if !locked {
+		return ctrl.Result{RequeueAfter: lockRetryInterval}, nil
+	}
+	if !resumed {
+		setRestorePhase(restoreInstance, v1alpha2.RestoreRunning, nil)
+	}
+	restoreInstance.Status.JenkinsPod = jenkinsPod.Name
 	err = r.Client.Status().Update(ctx, restoreInstance)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
+	// The steps stop once the Restore is cancelled or reaches the deadline of its BackupStrategy
+	operation := newOperationContext(r.Client, "restore", restoreInstance, req.NamespacedName, restoreInstance.Status.StartTime,
+		backupStrategy.Spec.ActiveDeadlineSeconds, isRestoreCancelled)
+	defer operation.stop()
 
-	// Restore
-	err = r.performJenkinsRestore(ctx, execClient, jenkinsPod, backupInstance, backupStrategy, restoreInstance)
-	r.sendNewRestoreInProgressNotification(jenkinsInstance, restoreInstance, "restore", err)
+	// PreRestore hooks, a failing script aborts the Restore
+	jenkinsClient, operations := newJenkinsAccess(ctx, r.Client, execClient, backupStrategy, jenkinsInstance, jenkinsPod, restoreInstance.Name)
+	hooks := &hookRunner{client: r.Client, namespace: backupStrategy.Namespace, jenkinsClient: jenkinsClient}
+	run, err := r.enterRestoreStep(ctx, restoreInstance, v1alpha2.RestoreStepPreRestoreHooks)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
+	if run {
+		err = r.performRestoreHooks(ctx, hooks, restoreInstance, backupStrategy, v1alpha2.PreRestoreHook, PreRestoreHooksCompleted)
+		if err != nil {
+			restoreLogger.Info(fmt.Sprintf("Restore '%s' aborted: %s", restoreInstance.Name, err))
+			r.sendNewRestoreCompletedNotification(jenkinsInstance, restoreInstance, err)
+			setRestorePhase(restoreInstance, v1alpha2.RestoreFailed, err)
+			return ctrl.Result{}, r.Client.Status().Update(ctx, restoreInstance)
+		}
+	}
 
-	// Restart
-	if backupStrategy.Spec.RestartAfterRestore.Enabled && backupStrategy.Spec.RestartAfterRestore.Safe {
-		err := r.performJenkinsSafeRestart(ctx, jenkinsPod, restoreInstance, execClient)
-		r.sendNewRestoreInProgressNotification(jenkinsInstance, restoreInstance, "safeRestartAfterRestore", err)
+	// A Backup taken as a VolumeSnapshot replaces the whole Jenkins Home, Jenkins is restarted with it. A resumed
+	// Restore provisions the Jenkins Home again, the safety VolumeSnapshot taken before the interruption is kept.
+	// The replacement of the Jenkins Home is not stopped once started.
+	if len(backupInstance.Status.VolumeSnapshot) > 0 {
+		run, err = r.enterRestoreStep(ctx, restoreInstance, v1alpha2.RestoreStepRestore)
 		if err != nil {
 			return ctrl.Result{}, err
 		}
-	} else if backupStrategy.Spec.RestartAfterRestore.Enabled {
-		err := r.performJenkinsRestart(ctx, execClient, jenkinsPod, restoreInstance)
-		r.sendNewRestoreInProgressNotification(jenkinsInstance, restoreInstance, "restartAfterRestore", err)
+		if run {
+			if reason, err := operation.err(); err != nil {
+				return ctrl.Result{}, r.failStoppedRestore(ctx, jenkinsInstance, restoreInstance, reason, err)
+			}
+			err = r.performVolumeSnapshotRestore(ctx, jenkinsInstance, backupInstance, backupStrategy, restoreInstance)
+			r.sendNewRestoreInProgressNotification(jenkinsInstance, restoreInstance, "restore", err)
+			if err != nil {
+				restoreLogger.Info(fmt.Sprintf("Restore '%s' failed: %s", restoreInstance.Name, err))
+				r.sendNewRestoreCompletedNotification(jenkinsInstance, restoreInstance, err)
+				setRestorePhase(restoreInstance, v1alpha2.RestoreFailed, err)
+				return ctrl.Result{}, r.Client.Status().Update(ctx, restoreInstance)
+			}
+		}
+		// PostRestore hooks, through the new Jenkins Pod. A failing script is reported in the status only
+		run, err = r.enterRestoreStep(ctx, restoreInstance, v1alpha2.RestoreStepPostRestoreHooks)
 		if err != nil {
 			return ctrl.Result{}, err
 		}
+		if run {
+			jenkinsPod, err = r.GetPodByDeployment(jenkinsInstance)
+			if err == nil {
+				restoreInstance.Status.JenkinsPod = jenkinsPod.Name
+				hooks.jenkinsClient, _ = newJenkinsAccess(ctx, r.Client, execClient, backupStrategy, jenkinsInstance, jenkinsPod, restoreInstance.Name)
+				err = r.performRestoreHooks(ctx, hooks, restoreInstance, backupStrategy, v1alpha2.PostRestoreHook, PostRestoreHooksCompleted)
+			}
+			if err != nil {
+				restoreLogger.Info(fmt.Sprintf("PostRestore hooks of Restore '%s' failed: %s", restoreInstance.Name, err))
+			}
+		}
+		r.sendNewRestoreCompletedNotification(jenkinsInstance, restoreInstance, nil)
+		setRestorePhase(restoreInstance, v1alpha2.RestoreSucceeded, nil)
+		return ctrl.Result{}, r.Client.Status().Update(ctx, restoreInstance)
 	}
-	r.sendNewRestoreCompletedNotification(jenkinsInstance, restoreInstance, err)
+
+	// Compatibility of the Backup with the target Jenkins, a Backup which doesn't record its Jenkins version and plugins
+	// is checked once its manifest is read
+	run, err = r.enterRestoreStep(ctx, restoreInstance, v1alpha2.RestoreStepCompatibilityCheck)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if run && hasJenkinsVersionAndPlugins(backupInstance) {
+		err = r.performRestoreCompatibilityCheck(ctx, jenkinsClient, backupInstance.Status.JenkinsVersion, backupInstance.Status.Plugins, backupStrategy, restoreInstance)
+		r.sendNewRestoreInProgressNotification(jenkinsInstance, restoreInstance, "compatibilityCheck", err)
+		if err != nil {
+			restoreLogger.Info(fmt.Sprintf("Restore '%s' aborted: %s", restoreInstance.Name, err))
+			r.sendNewRestoreCompletedNotification(jenkinsInstance, restoreInstance, err)
+			setRestorePhase(restoreInstance, v1alpha2.RestoreFailed, err)
+			return ctrl.Result{}, r.Client.Status().Update(ctx, restoreInstance)
+		}
+	}
+
+	// Snapshot of the locations overwritten by the Restore, rolled back to if the Restore fails. A backup Job takes its
+	// own snapshot and rolls back to it if the extraction fails, then a rollback Job puts it back if Jenkins is not
+	// healthy. The snapshot is stored on the BackupVolume of the Backup, a Restore resumed after the snapshot was taken
+	// reads it back from there. It is removed once the Restore is complete.
+	var snapshot *restoreSnapshot
+	defer func() {
+		if restoreInstance.Status.Phase != v1alpha2.RestoreSucceeded && restoreInstance.Status.Phase != v1alpha2.RestoreFailed {
+			return
+		}
+		var err error
+		switch {
+		case snapshot != nil:
+			err = snapshot.remove(ctx)
+		case isBackupJobRunner(backupStrategy) && restoreInstance.Status.Snapshot != nil:
+			_, err = r.runRestoreSnapshotJob(ctx, backupJobRemoveSnapshot, jenkinsInstance, jenkinsPod, backupInstance, backupStrategy, restoreInstance)
+		}
+		if err != nil {
+			restoreLogger.Info(fmt.Sprintf("Failed to remove the snapshot of Restore '%s': %s", restoreInstance.Name, err))
+		}
+	}()
+	run, err = r.enterRestoreStep(ctx, restoreInstance, v1alpha2.RestoreStepSnapshot)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if run && !isBackupJobRunner(backupStrategy) {
+		snapshot, err = r.performRestoreSnapshot(operation, execClient, jenkinsInstance, jenkinsPod, backupInstance, backupStrategy, items, restoreInstance)
+		r.sendNewRestoreInProgressNotification(jenkinsInstance, restoreInstance, "snapshot", err)
+		if reason, stopErr := operation.err(); stopErr != nil {
+			return ctrl.Result{}, r.failStoppedRestore(ctx, jenkinsInstance, restoreInstance, reason, stopErr)
+		}
+		if err != nil {
+			restoreLogger.Info(fmt.Sprintf("Restore '%s' aborted: %s", restoreInstance.Name, err))
+			r.sendNewRestoreCompletedNotification(jenkinsInstance, restoreInstance, err)
+			setRestorePhase(restoreInstance, v1alpha2.RestoreFailed, err)
+			return ctrl.Result{}, r.Client.Status().Update(ctx, restoreInstance)
+		}
+	} else if restoreInstance.Status.Snapshot != nil && !isBackupJobRunner(backupStrategy) {
+		snapshot, err = r.openRestoreSnapshot(ctx, execClient, jenkinsInstance, jenkinsPod, backupInstance, backupStrategy, restoreInstance)
+		if err != nil {
+			restoreLogger.Info(fmt.Sprintf("Restore '%s' can't be rolled back, failed to read its snapshot: %s", restoreInstance.Name, err))
+		}
+	}
+
+	// Restore, extracting the archive again when the Restore is resumed. A cancelled Restore, or one which reached its
+	// deadline, is rolled back.
+	run, err = r.enterRestoreStep(ctx, restoreInstance, v1alpha2.RestoreStepRestore)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if run {
+		if operation.Err() == nil {
+			err = r.performJenkinsRestore(operation, execClient, jenkinsClient, jenkinsInstance, jenkinsPod, backupInstance, backupStrategy, items, restoreInstance)
+			r.sendNewRestoreInProgressNotification(jenkinsInstance, restoreInstance, "restore", err)
+		}
+		if reason, stopErr := operation.err(); stopErr != nil {
+			err = stopErr
+			restoreInstance.Status.Conditions.SetCondition(status.Condition{
+				Type:    RestoreCompleted,
+				Status:  corev1.ConditionFalse,
+				Reason:  reason,
+				Message: err.Error(),
+			})
+		}
+		if err != nil {
+			restoreLogger.Info(fmt.Sprintf("Restore '%s' failed: %s", restoreInstance.Name, err))
+			if rollback := r.getRestoreRollback(ctx, operations, jenkinsInstance, backupInstance, backupStrategy, restoreInstance, snapshot); rollback != nil {
+				err = r.performRestoreRollback(ctx, operations, restoreInstance, rollback, err, false)
+				r.sendNewRestoreInProgressNotification(jenkinsInstance, restoreInstance, "rollback", err)
+			}
+			r.sendNewRestoreCompletedNotification(jenkinsInstance, restoreInstance, err)
+			setRestorePhase(restoreInstance, v1alpha2.RestoreFailed, err)
+			return ctrl.Result{}, r.Client.Status().Update(ctx, restoreInstance)
+		}
+	}
+
+	// PostRestore hooks, before the restart. A failing script is reported in the status only
+	run, err = r.enterRestoreStep(ctx, restoreInstance, v1alpha2.RestoreStepPostRestoreHooks)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if run {
+		err = r.performRestoreHooks(ctx, hooks, restoreInstance, backupStrategy, v1alpha2.PostRestoreHook, PostRestoreHooksCompleted)
+		if err != nil {
+			restoreLogger.Info(fmt.Sprintf("PostRestore hooks of Restore '%s' failed: %s", restoreInstance.Name, err))
+		}
+	}
+
+	// Restart. The start time of Jenkins tells when it was restarted, the health check is skipped if it is unknown.
+	// A Restore resumed after the restart only waits for Jenkins to answer. Restored items were already reloaded.
+	var startTime string
+	var startTimeErr error
+	run, err = r.enterRestoreStep(ctx, restoreInstance, v1alpha2.RestoreStepRestart)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if run && backupStrategy.Spec.RestartAfterRestore.Enabled && items == nil {
+		var client jenkinsclient.Jenkins
+		client, startTimeErr = jenkinsClient.get()
+		if startTimeErr == nil {
+			startTime, startTimeErr = getJenkinsStartTime(client)
+		}
+		if backupStrategy.Spec.RestartAfterRestore.Safe {
+			err = r.performJenkinsSafeRestart(ctx, operations, restoreInstance)
+			r.sendNewRestoreInProgressNotification(jenkinsInstance, restoreInstance, "safeRestartAfterRestore", err)
+		} else {
+			err = r.performJenkinsRestart(ctx, operations, restoreInstance)
+			r.sendNewRestoreInProgressNotification(jenkinsInstance, restoreInstance, "restartAfterRestore", err)
+		}
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	// Health check, the Restore is rolled back if Jenkins does not come back after the restart
+	run, err = r.enterRestoreStep(ctx, restoreInstance, v1alpha2.RestoreStepHealthCheck)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if run && (restoreInstance.Status.Conditions.IsTrueFor(RestartStarted) || restoreInstance.Status.Conditions.IsTrueFor(SafeRestartStarted)) {
+		err = r.performJenkinsHealthCheck(ctx, jenkinsClient, startTime, startTimeErr, backupStrategy, restoreInstance)
+		r.sendNewRestoreInProgressNotification(jenkinsInstance, restoreInstance, "healthCheck", err)
+		if err != nil {
+			restoreLogger.Info(fmt.Sprintf("Jenkins '%s' is not healthy after Restore '%s': %s", jenkinsInstance.Name, restoreInstance.Name, err))
+			if rollback := r.getRestoreRollback(ctx, operations, jenkinsInstance, backupInstance, backupStrategy, restoreInstance, snapshot); rollback != nil {
+				err = r.performRestoreRollback(ctx, operations, restoreInstance, rollback, err, true)
+				r.sendNewRestoreInProgressNotification(jenkinsInstance, restoreInstance, "rollback", err)
+			}
+			r.sendNewRestoreCompletedNotification(jenkinsInstance, restoreInstance, err)
+			setRestorePhase(restoreInstance, v1alpha2.RestoreFailed, err)
+			return ctrl.Result{}, r.Client.Status().Update(ctx, restoreInstance)
+		}
+	}
+	r.sendNewRestoreCompletedNotification(jenkinsInstance, restoreInstance, nil)
+	setRestorePhase(restoreInstance, v1alpha2.RestoreSucceeded, nil)
 	err = r.Client.Status().Update(ctx, restoreInstance)
 	if err != nil {
 		return ctrl.Result{}, err
@@ -207,14 +559,394 @@ func (r *RestoreReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	return ctrl.Result{}, nil
 }
 
-func (r *RestoreReconciler) performJenkinsRestart(ctx context.Context, execClient exec.KubeExecClient, jenkinsPod *corev1.Pod, restoreInstance *v1alpha2.Restore) error {
-	execRestart := strings.Join([]string{"sh", resources.RestartScriptPath}, " ")
-	err := execClient.MakeRequest(jenkinsPod, restoreInstance.Name, execRestart)
+// restoreSteps are the steps of a Restore, in the order in which they run
+var restoreSteps = []v1alpha2.RestoreStep{
+	v1alpha2.RestoreStepPreRestoreHooks,
+	v1alpha2.RestoreStepCompatibilityCheck,
+	v1alpha2.RestoreStepSnapshot,
+	v1alpha2.RestoreStepRestore,
+	v1alpha2.RestoreStepPostRestoreHooks,
+	v1alpha2.RestoreStepRestart,
+	v1alpha2.RestoreStepHealthCheck,
+}
+
+// getRestoreStepIndex returns the position of the step in restoreSteps, or -1 if the Restore has not started a step yet
+func getRestoreStepIndex(step v1alpha2.RestoreStep) int {
+	for i, restoreStep := range restoreSteps {
+		if restoreStep == step {
+			return i
+		}
+	}
+	return -1
+}
+
+// enterRestoreStep persists the step before it runs, so that the Restore resumes from it if it is interrupted.
+// It returns false if the step already ran, when the Restore was resumed at a later step.
+func (r *RestoreReconciler) enterRestoreStep(ctx context.Context, restoreInstance *v1alpha2.Restore, step v1alpha2.RestoreStep) (bool, error) {
+	current := getRestoreStepIndex(restoreInstance.Status.Step)
+	next := getRestoreStepIndex(step)
+	if current > next {
+		return false, nil
+	}
+	if current == next {
+		return true, nil
+	}
+	restoreInstance.Status.Step = step
+	return true, r.Client.Status().Update(ctx, restoreInstance)
+}
+
+// lockJenkins acquires the lock of the target Jenkins for the Restore. The Restore is queued if another Backup or
+// Restore holds it.
+func (r *RestoreReconciler) lockJenkins(ctx context.Context, jenkinsInstance *v1alpha2.Jenkins, restoreInstance *v1alpha2.Restore) (bool, error) {
+	locked, holder, err := acquireJenkinsLock(ctx, r.Client, jenkinsInstance, lockHolderRestore, restoreInstance)
+	if err != nil {
+		return false, err
+	}
+	if locked {
+		restoreInstance.Status.Conditions.SetCondition(status.Condition{
+			Type:   LockAcquired,
+			Status: corev1.ConditionTrue,
+		})
+		return true, nil
+	}
+	if restoreInstance.Status.Phase != v1alpha2.RestoreQueued {
+		restoreLogger.Info(fmt.Sprintf("Restore '%s' queued: %s", restoreInstance.Name, getJenkinsLockedMessage(jenkinsInstance.Name, holder)))
+	}
+	restoreInstance.Status.Conditions.SetCondition(status.Condition{
+		Type:    LockAcquired,
+		Status:  corev1.ConditionFalse,
+		Reason:  JenkinsLocked,
+		Message: getJenkinsLockedMessage(jenkinsInstance.Name, holder),
+	})
+	setRestorePhase(restoreInstance, v1alpha2.RestoreQueued, nil)
+	return false, r.Client.Status().Update(ctx, restoreInstance)
+}
+
+// isRestoreCancelled returns true if the Restore was cancelled through its spec
+func isRestoreCancelled(object runtime.Object) bool {
+	restore, ok := object.(*v1alpha2.Restore)
+	return ok && restore.Spec.Cancel
+}
+
+// failStoppedRestore fails a Restore which was cancelled or reached its deadline before anything was restored
+func (r *RestoreReconciler) failStoppedRestore(ctx context.Context, jenkinsInstance *v1alpha2.Jenkins, restoreInstance *v1alpha2.Restore, reason status.ConditionReason, err error) error {
+	restoreLogger.Info(fmt.Sprintf("Restore '%s' stopped: %s", restoreInstance.Name, err))
+	restoreInstance.Status.Conditions.SetCondition(status.Condition{
+		Type:    RestoreCompleted,
+		Status:  corev1.ConditionFalse,
+		Reason:  reason,
+		Message: err.Error(),
+	})
+	r.sendNewRestoreCompletedNotification(jenkinsInstance, restoreInstance, err)
+	setRestorePhase(restoreInstance, v1alpha2.RestoreFailed, err)
+	return r.Client.Status().Update(ctx, restoreInstance)
+}
+
+// failInterruptedRestore fails a resumed Restore which can't complete
+func (r *RestoreReconciler) failInterruptedRestore(ctx context.Context, restoreInstance *v1alpha2.Restore, err error) error {
+	err = fmt.Errorf("restore interrupted at step %s can't be resumed: %s", restoreInstance.Status.Step, err)
+	restoreInstance.Status.Conditions.SetCondition(status.Condition{
+		Type:    RestoreCompleted,
+		Status:  corev1.ConditionFalse,
+		Reason:  RestoreInterrupted,
+		Message: err.Error(),
+	})
+	setRestorePhase(restoreInstance, v1alpha2.RestoreFailed, err)
+	return r.Client.Status().Update(ctx, restoreInstance)
+}
+
+// performRestoreHooks runs the hook scripts of the stage and records their results in the status of the Restore
+func (r *RestoreReconciler) performRestoreHooks(ctx context.Context, hooks *hookRunner, restoreInstance *v1alpha2.Restore, backupStrategy *v1alpha2.BackupStrategy, stage v1alpha2.HookStage, conditionType status.ConditionType) error {
+	configMaps := getHookScripts(backupStrategy.Spec.Hooks, stage)
+	if len(configMaps) == 0 {
+		return nil
+	}
+	results, err := hooks.run(ctx, stage, configMaps)
+	restoreInstance.Status.Hooks = append(restoreInstance.Status.Hooks, results...)
+	condition := status.Condition{
+		Type:   conditionType,
+		Status: corev1.ConditionTrue,
+	}
 	if err != nil {
+		condition.Status = corev1.ConditionFalse
+		condition.Reason = HookFailed
+		condition.Message = err.Error()
+	}
+	restoreInstance.Status.Conditions.SetCondition(condition)
+	updateErr := r.Client.Status().Update(ctx, restoreInstance)
+	if updateErr != nil {
+		return updateErr
+	}
+	return err
+}
+
+// performRestoreCompatibilityCheck compares the Jenkins version and the plugins recorded by the Backup with the ones of
+// the running target Jenkins, and applies the CompatibilityPolicy of the Restore when they are incompatible
+func (r *RestoreReconciler) performRestoreCompatibilityCheck(ctx context.Context, jenkinsClient *lazyJenkinsClient, backupVersion string, backupPlugins []v1alpha2.Plugin, backupStrategy *v1alpha2.BackupStrategy, restoreInstance *v1alpha2.Restore) error {
+	var compatibility *restoreCompatibility
+	client, err := jenkinsClient.get()
+	if err == nil {
+		var selection *backupSelection
+		selection, err = newBackupSelection(backupStrategy.Spec)
+		if err == nil {
+			var jenkinsVersion string
+			var jenkinsPlugins []v1alpha2.Plugin
+			jenkinsVersion, jenkinsPlugins, err = getRunningJenkinsVersionAndPlugins(client)
+			// The plugins are not restored with the items of the Restore
+			restoresPlugins := len(restoreInstance.Spec.Items) == 0 && selection.isSelected("plugins")
+			compatibility = getRestoreCompatibility(backupVersion, backupPlugins, jenkinsVersion, jenkinsPlugins, restoresPlugins)
+		}
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to check the compatibility with Jenkins: %s", err)
+		restoreInstance.Status.Conditions.SetCondition(status.Condition{
+			Type:    CompatibilityChecked,
+			Status:  corev1.ConditionFalse,
+			Reason:  CompatibilityCheckFailed,
+			Message: err.Error(),
+		})
+		updateErr := r.Client.Status().Update(ctx, restoreInstance)
+		if updateErr != nil {
+			return updateErr
+		}
+		return err
+	}
+	if len(compatibility.problems) == 0 {
+		restoreInstance.Status.Conditions.SetCondition(status.Condition{
+			Type:   CompatibilityChecked,
+			Status: corev1.ConditionTrue,
+		})
+		return r.Client.Status().Update(ctx, restoreInstance)
+	}
+
+	incompatibleErr := &restoreIncompatibleError{jenkins: restoreInstance.Status.Jenkins, problems: compatibility.problems}
+	policy := restoreInstance.Spec.CompatibilityPolicy
+	if policy == v1alpha2.RestoreCompatibilityInstallPlugins && !compatibility.olderJenkins {
+		// The plugins are installed from the update center of Jenkins, a restart is needed to load the upgraded ones
+		installed := []string{}
+		for _, plugin := range compatibility.plugins {
+			err = client.InstallPlugin(plugin.Name, plugin.Version)
+			if err != nil {
+				err = fmt.Errorf("failed to install plugin %s:%s: %s", plugin.Name, plugin.Version, err)
+				break
+			}
+			installed = append(installed, fmt.Sprintf("%s:%s", plugin.Name, plugin.Version))
+		}
+		if err != nil {
+			restoreInstance.Status.Conditions.SetCondition(status.Condition{
+				Type:    CompatibilityChecked,
+				Status:  corev1.ConditionFalse,
+				Reason:  PluginInstallFailed,
+				Message: fmt.Sprintf("%s, %s", incompatibleErr, err),
+			})
+			updateErr := r.Client.Status().Update(ctx, restoreInstance)
+			if updateErr != nil {
+				return updateErr
+			}
+			return err
+		}
 		restoreInstance.Status.Conditions.SetCondition(status.Condition{
-			Type:   RestartStarted,
-			Status: corev1.ConditionFalse,
-			Reason: (status.ConditionReason)(fmt.Sprintf("Failed to restart Jenkins %s", err.Error())),
+			Type:    CompatibilityChecked,
+			Status:  corev1.ConditionTrue,
+			Reason:  PluginsInstalled,
+			Message: fmt.Sprintf("Installed plugins %s", strings.Join(installed, ", ")),
+		})
+		return r.Client.Status().Update(ctx, restoreInstance)
+	}
+
+	restoreInstance.Status.Conditions.SetCondition(status.Condition{
+		Type:    CompatibilityChecked,
+		Status:  corev1.ConditionFalse,
+		Reason:  RestoreIncompatible,
+		Message: incompatibleErr.Error(),
+	})
+	updateErr := r.Client.Status().Update(ctx, restoreInstance)
+	if updateErr != nil {
+		return updateErr
+	}
+	if policy == v1alpha2.RestoreCompatibilityWarn {
+		restoreLogger.Info(fmt.Sprintf("Restore '%s' continues despite: %s", restoreInstance.Name, incompatibleErr))
+		return nil
+	}
+	return incompatibleErr
+}
+
+// performRestoreSnapshot saves the locations of the Jenkins Home selected by the BackupStrategy before they are overwritten,
+// only the directories of the items when the Restore has items. The location of the snapshot is recorded in the status.
+func (r *RestoreReconciler) performRestoreSnapshot(ctx context.Context, execClient exec.KubeExecClient, jenkinsInstance *v1alpha2.Jenkins, jenkinsPod *corev1.Pod, backupInstance *v1alpha2.Backup, backupStrategy *v1alpha2.BackupStrategy, items *restoreItems, restoreInstance *v1alpha2.Restore) (*restoreSnapshot, error) {
+	var snapshot *restoreSnapshot
+	selection, err := newBackupSelection(backupStrategy.Spec)
+	if err == nil {
+		if items != nil {
+			selection = items.targetSelection(selection)
+		}
+		var storage backupStorage
+		storage, err = r.getRestoreSnapshotStorage(ctx, execClient, jenkinsInstance, jenkinsPod, backupInstance, restoreInstance, backupInstance.Spec.BackupVolumeRef)
+		if err == nil {
+			var encryptionKey []byte
+			encryptionKey, err = getBackupEncryptionKey(ctx, r.Client, backupStrategy)
+			if err == nil {
+				snapshot, err = takeRestoreSnapshot(ctx, execClient, jenkinsPod, restoreInstance.Name, selection, storage, encryptionKey)
+			}
+		}
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to take snapshot: %s", err)
+		restoreInstance.Status.Conditions.SetCondition(status.Condition{
+			Type:    SnapshotTaken,
+			Status:  corev1.ConditionFalse,
+			Reason:  SnapshotFailed,
+			Message: err.Error(),
+		})
+		updateErr := r.Client.Status().Update(ctx, restoreInstance)
+		if updateErr != nil {
+			return nil, updateErr
+		}
+		return nil, err
+	}
+	restoreInstance.Status.Snapshot = &v1alpha2.RestoreSnapshot{
+		BackupVolume: backupInstance.Spec.BackupVolumeRef,
+		Path:         snapshot.storage.location(),
+	}
+	restoreInstance.Status.Conditions.SetCondition(status.Condition{
+		Type:    SnapshotTaken,
+		Status:  corev1.ConditionTrue,
+		Message: fmt.Sprintf("%d files saved", len(snapshot.files)),
+	})
+	err = r.Client.Status().Update(ctx, restoreInstance)
+	if err != nil {
+		_ = snapshot.remove(ctx)
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// openRestoreSnapshot reads back the snapshot recorded in the status of a resumed Restore, with the encryption key
+// of the BackupStrategy
+func (r *RestoreReconciler) openRestoreSnapshot(ctx context.Context, execClient exec.KubeExecClient, jenkinsInstance *v1alpha2.Jenkins, jenkinsPod *corev1.Pod, backupInstance *v1alpha2.Backup, backupStrategy *v1alpha2.BackupStrategy, restoreInstance *v1alpha2.Restore) (*restoreSnapshot, error) {
+	storage, err := r.getRestoreSnapshotStorage(ctx, execClient, jenkinsInstance, jenkinsPod, backupInstance, restoreInstance, restoreInstance.Status.Snapshot.BackupVolume)
+	if err != nil {
+		return nil, err
+	}
+	encryptionKey, err := getBackupEncryptionKey(ctx, r.Client, backupStrategy)
+	if err != nil {
+		return nil, err
+	}
+	return openRestoreSnapshot(ctx, storage, encryptionKey)
+}
+
+// getRestoreSnapshotStorage returns the storage of the snapshot of the Restore on the BackupVolume of the Backup, in
+// the namespace of the Backup. A BackupVolume which is not mounted in the target Jenkins is reached through the
+// Jenkins which was backed up, like the Backup.
+func (r *RestoreReconciler) getRestoreSnapshotStorage(ctx context.Context, execClient exec.KubeExecClient, jenkinsInstance *v1alpha2.Jenkins, jenkinsPod *corev1.Pod, backupInstance *v1alpha2.Backup, restoreInstance *v1alpha2.Restore, backupVolumeName string) (backupStorage, error) {
+	backupVolume := &v1alpha2.BackupVolume{}
+	err := r.Client.Get(ctx, types.NamespacedName{Name: backupVolumeName, Namespace: backupInstance.Namespace}, backupVolume)
+	if err != nil {
+		return nil, err
+	}
+	snapshotPod := jenkinsPod
+	if backupVolume.Spec.S3 == nil && !isBackupVolumeMounted(jenkinsInstance, backupVolume.Name) {
+		snapshotPod, err = r.getBackupJenkinsPod(ctx, backupInstance)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return newRestoreSnapshotStorage(ctx, r.Client, execClient, snapshotPod, restoreInstance, backupVolume)
+}
+
+// getRestoreRollback returns the function putting back the snapshot of the Restore, which returns the number of files
+// put back, nil if there is no snapshot to roll back to. The snapshot kept by a restore Job is put back by a rollback
+// Job, unless the restore Job already rolled back to it.
+func (r *RestoreReconciler) getRestoreRollback(ctx context.Context, operations *jenkinsOperations, jenkinsInstance *v1alpha2.Jenkins, backupInstance *v1alpha2.Backup, backupStrategy *v1alpha2.BackupStrategy, restoreInstance *v1alpha2.Restore, snapshot *restoreSnapshot) func() (int, error) {
+	if snapshot != nil {
+		return func() (int, error) {
+			return len(snapshot.files), snapshot.rollback(ctx, operations.execClient, operations.jenkinsPod, restoreInstance.Name)
+		}
+	}
+	if !isBackupJobRunner(backupStrategy) || restoreInstance.Status.Snapshot == nil || restoreInstance.Status.Conditions.GetCondition(RolledBack) != nil {
+		return nil
+	}
+	return func() (int, error) {
+		return r.runRestoreSnapshotJob(ctx, backupJobRollback, jenkinsInstance, operations.jenkinsPod, backupInstance, backupStrategy, restoreInstance)
+	}
+}
+
+// performRestoreRollback puts back the snapshot with rollback after the Restore failed with restoreErr, and restarts
+// Jenkins if it was restarted with the restored files. It returns the error with which the Restore fails.
+func (r *RestoreReconciler) performRestoreRollback(ctx context.Context, operations *jenkinsOperations, restoreInstance *v1alpha2.Restore, rollback func() (int, error), restoreErr error, restart bool) error {
+	fileCount, err := rollback()
+	if err == nil && restart {
+		err = operations.run(ctx, resources.RestartScriptPath)
+		if err != nil {
+			err = fmt.Errorf("failed to restart Jenkins: %s", err)
+		}
+	}
+	if err != nil {
+		restoreInstance.Status.Conditions.SetCondition(status.Condition{
+			Type:    RolledBack,
+			Status:  corev1.ConditionFalse,
+			Reason:  RollbackFailed,
+			Message: err.Error(),
+		})
+		restoreErr = fmt.Errorf("%s, rollback failed: %s", restoreErr, err)
+	} else {
+		restoreInstance.Status.Conditions.SetCondition(status.Condition{
+			Type:    RolledBack,
+			Status:  corev1.ConditionTrue,
+			Message: fmt.Sprintf("%d files restored from the snapshot", fileCount),
+		})
+		restoreErr = fmt.Errorf("%s, rolled back to the snapshot", restoreErr)
+	}
+	updateErr := r.Client.Status().Update(ctx, restoreInstance)
+	if updateErr != nil {
+		return updateErr
+	}
+	return restoreErr
+}
+
+// performJenkinsHealthCheck waits for Jenkins to be back after the restart, it returns an error if it is not.
+// Jenkins is considered healthy when its start time before the restart could not be read.
+func (r *RestoreReconciler) performJenkinsHealthCheck(ctx context.Context, jenkinsClient *lazyJenkinsClient, startTime string, startTimeErr error, backupStrategy *v1alpha2.BackupStrategy, restoreInstance *v1alpha2.Restore) error {
+	if startTimeErr != nil {
+		restoreInstance.Status.Conditions.SetCondition(status.Condition{
+			Type:    JenkinsHealthy,
+			Status:  corev1.ConditionUnknown,
+			Message: fmt.Sprintf("Health check skipped, failed to get the start time of Jenkins: %s", startTimeErr),
+		})
+		return r.Client.Status().Update(ctx, restoreInstance)
+	}
+	client, err := jenkinsClient.get()
+	if err == nil {
+		err = waitForJenkinsRestart(client, startTime, healthCheckPollInterval, getHealthCheckTimeout(backupStrategy.Spec.RestartAfterRestore))
+	}
+	if err != nil {
+		restoreInstance.Status.Conditions.SetCondition(status.Condition{
+			Type:    JenkinsHealthy,
+			Status:  corev1.ConditionFalse,
+			Reason:  HealthCheckFailed,
+			Message: err.Error(),
+		})
+		updateErr := r.Client.Status().Update(ctx, restoreInstance)
+		if updateErr != nil {
+			return updateErr
+		}
+		return err
+	}
+	restoreInstance.Status.Conditions.SetCondition(status.Condition{
+		Type:   JenkinsHealthy,
+		Status: corev1.ConditionTrue,
+	})
+	return r.Client.Status().Update(ctx, restoreInstance)
+}
+
+func (r *RestoreReconciler) performJenkinsRestart(ctx context.Context, operations *jenkinsOperations, restoreInstance *v1alpha2.Restore) error {
+	err := operations.run(ctx, resources.RestartScriptPath)
+	if err != nil {
+		restoreInstance.Status.Conditions.SetCondition(status.Condition{
+			Type:    RestartStarted,
+			Status:  corev1.ConditionFalse,
+			Reason:  RestartFailed,
+			Message: fmt.Sprintf("Failed to restart Jenkins %s", err.Error()),
 		})
 		err = r.Client.Status().Update(ctx, restoreInstance)
 		if err != nil {
@@ -222,21 +954,22 @@ func (r *RestoreReconciler) performJenkinsRestart(ctx context.Context, execClien
 		}
 		return nil
 	}
+	// The condition is persisted so that a Restore resumed after the restart still checks the health of Jenkins
 	restoreInstance.Status.Conditions.SetCondition(status.Condition{
 		Type:   RestartStarted,
 		Status: corev1.ConditionTrue,
 	})
-	return nil
+	return r.Client.Status().Update(ctx, restoreInstance)
 }
 
-func (r *RestoreReconciler) performJenkinsSafeRestart(ctx context.Context, jenkinsPod *corev1.Pod, restoreInstance *v1alpha2.Restore, execClient exec.KubeExecClient) error {
-	execSafeRestart := strings.Join([]string{"sh", resources.SafeRestartScriptPath}, " ")
-	err := execClient.MakeRequest(jenkinsPod, restoreInstance.Name, execSafeRestart)
+func (r *RestoreReconciler) performJenkinsSafeRestart(ctx context.Context, operations *jenkinsOperations, restoreInstance *v1alpha2.Restore) error {
+	err := operations.run(ctx, resources.SafeRestartScriptPath)
 	if err != nil {
 		restoreInstance.Status.Conditions.SetCondition(status.Condition{
-			Type:   SafeRestartStarted,
-			Status: corev1.ConditionFalse,
-			Reason: (status.ConditionReason)(fmt.Sprintf("Failed to safe restart Jenkins %s", err.Error())),
+			Type:    SafeRestartStarted,
+			Status:  corev1.ConditionFalse,
+			Reason:  SafeRestartFailed,
+			Message: fmt.Sprintf("Failed to safe restart Jenkins %s", err.Error()),
 		})
 		err = r.Client.Status().Update(ctx, restoreInstance)
 		if err != nil {
@@ -244,26 +977,277 @@ func (r *RestoreReconciler) performJenkinsSafeRestart(ctx context.Context, jenki
 		}
 		return nil
 	}
+	// The condition is persisted so that a Restore resumed after the restart still checks the health of Jenkins
 	restoreInstance.Status.Conditions.SetCondition(status.Condition{
 		Type:   SafeRestartStarted,
 		Status: corev1.ConditionTrue,
 	})
+	return r.Client.Status().Update(ctx, restoreInstance)
+}
+
+func (r *RestoreReconciler) performJenkinsRestore(ctx context.Context, execClient exec.KubeExecClient, jenkinsClient *lazyJenkinsClient, jenkinsInstance *v1alpha2.Jenkins, jenkinsPod *corev1.Pod, backupInstance *v1alpha2.Backup, backupStrategy *v1alpha2.BackupStrategy, items *restoreItems, restoreInstance *v1alpha2.Restore) error {
+	backupVolume, err := getBackupVolume(ctx, r.Client, backupInstance)
+	if err != nil {
+		return err
+	}
+	if isBackupJobRunner(backupStrategy) {
+		err = r.runJenkinsRestoreJob(ctx, jenkinsInstance, jenkinsPod, backupInstance, backupVolume, backupStrategy, restoreInstance)
+	} else {
+		// The files of a Backup stored in a volume are read through the Jenkins Pod which was backed up, then streamed
+		// to the target Jenkins Pod by the Operator
+		backupPod := jenkinsPod
+		if backupVolume.Spec.S3 == nil && isRestoredInOtherJenkins(jenkinsInstance, backupInstance) {
+			backupPod, err = r.getBackupJenkinsPod(ctx, backupInstance)
+			if err != nil {
+				return err
+			}
+		}
+		if backupVolume.Spec.S3 == nil && !r.hasBackupManifest(ctx, execClient, backupPod, backupInstance, restoreInstance) {
+			if backupPod != jenkinsPod {
+				return fmt.Errorf("backup '%s' was created before Backups were archived and can only be restored in Jenkins '%s'", backupInstance.Name, backupInstance.Spec.JenkinsRef)
+			}
+			if items != nil {
+				return fmt.Errorf("backup '%s' was created before Backups were archived, its items can't be restored one by one", backupInstance.Name)
+			}
+			return r.performJenkinsDirectoryRestore(ctx, execClient, jenkinsPod, backupInstance, backupStrategy, restoreInstance)
+		}
+		var storage backupStorage
+		storage, err = newBackupStorage(ctx, r.Client, execClient, backupPod, backupInstance, backupVolume)
+		if err == nil {
+			err = r.extractJenkinsBackupArchive(ctx, execClient, jenkinsClient, jenkinsInstance, jenkinsPod, backupInstance, backupStrategy, items, restoreInstance, storage)
+		}
+	}
+	if err != nil {
+		reason := RestoreArchiveFailed
+		if _, incompatible := err.(*restoreIncompatibleError); incompatible {
+			reason = RestoreIncompatible
+		} else {
+			err = fmt.Errorf("failed to restore from backup archive: %s", err)
+		}
+		restoreInstance.Status.Conditions.SetCondition(status.Condition{
+			Type:    RestoreCompleted,
+			Status:  corev1.ConditionFalse,
+			Reason:  reason,
+			Message: err.Error(),
+		})
+		updateErr := r.Client.Status().Update(ctx, restoreInstance)
+		if updateErr != nil {
+			return updateErr
+		}
+		return err
+	}
+	restoreInstance.Status.Conditions.SetCondition(status.Condition{
+		Type:   RestoreCompleted,
+		Status: corev1.ConditionTrue,
+	})
+	if items != nil {
+		return r.performItemsReload(ctx, jenkinsClient, items, restoreInstance)
+	}
+	return r.Client.Status().Update(ctx, restoreInstance)
+}
+
+// performItemsReload loads the restored items in Jenkins through the script console, instead of restarting it
+func (r *RestoreReconciler) performItemsReload(ctx context.Context, jenkinsClient *lazyJenkinsClient, items *restoreItems, restoreInstance *v1alpha2.Restore) error {
+	client, err := jenkinsClient.get()
+	if err == nil {
+		_, err = client.ExecuteScript(getItemsReloadScript(items.fullNames()))
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to reload the restored items: %s", err)
+		restoreInstance.Status.Conditions.SetCondition(status.Condition{
+			Type:    ItemsReloaded,
+			Status:  corev1.ConditionFalse,
+			Reason:  ItemsReloadFailed,
+			Message: err.Error(),
+		})
+		updateErr := r.Client.Status().Update(ctx, restoreInstance)
+		if updateErr != nil {
+			return updateErr
+		}
+		return err
+	}
+	restoreInstance.Status.Conditions.SetCondition(status.Condition{
+		Type:    ItemsReloaded,
+		Status:  corev1.ConditionTrue,
+		Message: strings.Join(items.fullNames(), ", "),
+	})
+	return r.Client.Status().Update(ctx, restoreInstance)
+}
+
+// runJenkinsRestoreJob extracts the Backup archive in a Job mounting the Jenkins Home and the BackupVolume, the Job
+// takes a snapshot first and rolls back to it if the extraction fails
+func (r *RestoreReconciler) runJenkinsRestoreJob(ctx context.Context, jenkinsInstance *v1alpha2.Jenkins, jenkinsPod *corev1.Pod, backupInstance *v1alpha2.Backup, backupVolume *v1alpha2.BackupVolume, backupStrategy *v1alpha2.BackupStrategy, restoreInstance *v1alpha2.Restore) error {
+	if backupInstance.Namespace != restoreInstance.Namespace {
+		return fmt.Errorf("backup '%s' of namespace '%s' can't be restored by a Job, its BackupVolume can only be mounted in its namespace", backupInstance.Name, backupInstance.Namespace)
+	}
+	if !jenkinsInstance.Spec.PersistentSpec.Enabled {
+		return fmt.Errorf("the Jenkins Home of Jenkins '%s' is not persistent, it can't be mounted in a Job", jenkinsInstance.Name)
+	}
+	if err := checkBackupJobSecrets(ctx, r.Client, backupVolume, backupStrategy); err != nil {
+		return err
+	}
+	image, command, err := getBackupJobImage(ctx, r.Client)
+	if err != nil {
+		return err
+	}
+	spec := newRestoreJobSpec(backupJobRestore, restoreInstance, backupInstance, backupVolume, backupStrategy)
+	job, err := newBackupJob(restoreInstance, "Restore", jenkinsInstance, jenkinsPod, backupVolume, backupStrategy, spec, image, command)
+	if err != nil {
+		return err
+	}
+	restoreInstance.Status.Job = job.Name
+	if err = r.Client.Status().Update(ctx, restoreInstance); err != nil {
+		return err
+	}
+	result, err := runBackupJob(ctx, r.Client, job, backupJobPollInterval, getBackupJobActiveDeadline(backupStrategy)+time.Minute)
+	if err != nil {
+		return err
+	}
+	for _, condition := range result.Conditions {
+		restoreInstance.Status.Conditions.SetCondition(condition)
+	}
+	restoreInstance.Status.Size = result.Size
+	restoreInstance.Status.FileCount = result.FileCount
+	restoreInstance.Status.Path = result.Path
+	if len(result.Snapshot) > 0 {
+		restoreInstance.Status.Snapshot = &v1alpha2.RestoreSnapshot{BackupVolume: backupVolume.Name, Path: result.Snapshot}
+	}
+	if len(result.Error) > 0 {
+		return errors.New(result.Error)
+	}
 	return nil
 }
 
-func (r *RestoreReconciler) performJenkinsRestore(ctx context.Context, execClient exec.KubeExecClient, jenkinsPod *corev1.Pod, backupInstance *v1alpha2.Backup, backupStrategy *v1alpha2.BackupStrategy, restoreInstance *v1alpha2.Restore) error {
-	restoreFromLocation := resources.JenkinsBackupVolumePath + "/" + backupInstance.Spec.BackupVolumeRef + "/" + backupInstance.Name
-	restoreToLocation := defaultJenkinsHome
-	restoreToSubLocations := []string{}
-	if backupStrategy.Spec.Options.Config {
-		restoreToSubLocations = append(restoreToSubLocations, "*.xml")
+// runRestoreSnapshotJob runs the Job putting back or removing the snapshot kept on the BackupVolume by the restore Job,
+// it returns the number of files put back
+func (r *RestoreReconciler) runRestoreSnapshotJob(ctx context.Context, operation backupJobOperation, jenkinsInstance *v1alpha2.Jenkins, jenkinsPod *corev1.Pod, backupInstance *v1alpha2.Backup, backupStrategy *v1alpha2.BackupStrategy, restoreInstance *v1alpha2.Restore) (int, error) {
+	backupVolume, err := getBackupVolume(ctx, r.Client, backupInstance)
+	if err != nil {
+		return 0, err
+	}
+	image, command, err := getBackupJobImage(ctx, r.Client)
+	if err != nil {
+		return 0, err
 	}
-	if backupStrategy.Spec.Options.Jobs {
-		restoreToSubLocations = append(restoreToSubLocations, "jobs")
+	spec := newRestoreJobSpec(operation, restoreInstance, backupInstance, backupVolume, backupStrategy)
+	job, err := newBackupJob(restoreInstance, "Restore", jenkinsInstance, jenkinsPod, backupVolume, backupStrategy, spec, image, command)
+	if err != nil {
+		return 0, err
+	}
+	result, err := runBackupJob(ctx, r.Client, job, backupJobPollInterval, getBackupJobActiveDeadline(backupStrategy)+time.Minute)
+	if err != nil {
+		return 0, err
 	}
-	if backupStrategy.Spec.Options.Plugins {
-		restoreToSubLocations = append(restoreToSubLocations, "plugins")
+	if len(result.Error) > 0 {
+		return 0, errors.New(result.Error)
 	}
+	return int(result.FileCount), nil
+}
+
+// newRestoreJobSpec returns the spec of a backup Job running the operation for the Restore, with the location of its
+// snapshot on the BackupVolume
+func newRestoreJobSpec(operation backupJobOperation, restoreInstance *v1alpha2.Restore, backupInstance *v1alpha2.Backup, backupVolume *v1alpha2.BackupVolume, backupStrategy *v1alpha2.BackupStrategy) *backupJobSpec {
+	spec := newBackupJobSpec(operation, restoreInstance.Name, backupInstance, backupVolume, backupStrategy)
+	spec.Items, spec.TargetFolder = restoreInstance.Spec.Items, restoreInstance.Spec.TargetFolder
+	if backupVolume.Spec.S3 != nil {
+		spec.SnapshotKeyPrefix = getRestoreSnapshotKeyPrefix(restoreInstance, backupVolume)
+	} else {
+		spec.SnapshotDirectory = getRestoreSnapshotDirectory(restoreInstance, backupVolume)
+	}
+	return spec
+}
+
+// getBackupJenkinsPod returns the Pod of the Jenkins which was backed up
+func (r *RestoreReconciler) getBackupJenkinsPod(ctx context.Context, backupInstance *v1alpha2.Backup) (*corev1.Pod, error) {
+	backupJenkins := &v1alpha2.Jenkins{}
+	err := r.Client.Get(ctx, types.NamespacedName{Name: backupInstance.Spec.JenkinsRef, Namespace: backupInstance.Namespace}, backupJenkins)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Jenkins '%s' holding the BackupVolume of Backup '%s': %s", backupInstance.Spec.JenkinsRef, backupInstance.Name, err)
+	}
+	return r.GetPodByDeployment(backupJenkins)
+}
+
+// hasBackupManifest returns true if the directory of the Backup contains a manifest
+func (r *RestoreReconciler) hasBackupManifest(ctx context.Context, execClient exec.KubeExecClient, jenkinsPod *corev1.Pod, backupInstance *v1alpha2.Backup, restoreInstance *v1alpha2.Restore) bool {
+	execTestManifest := strings.Join([]string{"test", "-f", path.Join(getBackupLocation(backupInstance), BackupManifestName)}, " ")
+	return execClient.MakeRequest(ctx, jenkinsPod, restoreInstance.Name, execTestManifest) == nil
+}
+
+// extractJenkinsBackupArchive downloads the Backup archive in a temporary file and verifies it against its manifest,
+// then streams the entries selected by the BackupStrategy to the backup container, which extracts them in the Jenkins Home.
+// Only the entries of the items are streamed when the Restore has items, moved to their target folder.
+// Encrypted archives are decrypted with the key of the BackupStrategy.
+func (r *RestoreReconciler) extractJenkinsBackupArchive(ctx context.Context, execClient exec.KubeExecClient, jenkinsClient *lazyJenkinsClient, jenkinsInstance *v1alpha2.Jenkins, jenkinsPod *corev1.Pod, backupInstance *v1alpha2.Backup, backupStrategy *v1alpha2.BackupStrategy, items *restoreItems, restoreInstance *v1alpha2.Restore, storage backupStorage) error {
+	manifest, err := readBackupManifest(ctx, storage)
+	if err != nil {
+		return err
+	}
+	selection, err := newBackupSelection(backupStrategy.Spec)
+	if err != nil {
+		return err
+	}
+	if items != nil {
+		if err = items.checkBackup(manifest.Files, selection); err != nil {
+			return err
+		}
+	}
+	restored := getRestoreEntryFilter(selection, items)
+	// Backups which don't record the Jenkins version and the plugins in their status are checked against their manifest
+	if !hasJenkinsVersionAndPlugins(backupInstance) {
+		err = r.performRestoreCompatibilityCheck(ctx, jenkinsClient, manifest.JenkinsVersion, manifest.Plugins, backupStrategy, restoreInstance)
+		if err != nil {
+			return err
+		}
+	}
+
+	var encryptionKey []byte
+	if len(manifest.Encryption) > 0 {
+		encryptionKey, err = getBackupEncryptionKey(ctx, r.Client, backupStrategy)
+		if err != nil {
+			return err
+		}
+	}
+
+	archive, archiveSize, err := downloadBackupArchive(ctx, storage, manifest, encryptionKey, restoreInstance.Name)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(archive.Name())
+	defer archive.Close()
+	restoreInstance.Status.Size = archiveSize
+	restoreInstance.Status.Path = storage.location()
+	restoreInstance.Status.FileCount = 0
+	for name := range manifest.Files {
+		if _, found := restored(name); found {
+			restoreInstance.Status.FileCount++
+		}
+	}
+	compressedArchive, err := openBackupArchive(archive, manifest, encryptionKey)
+	if err != nil {
+		return err
+	}
+	gzipReader, err := gzip.NewReader(compressedArchive)
+	if err != nil {
+		return err
+	}
+
+	// Only the restored entries are sent to the backup container
+	pipeReader, pipeWriter := io.Pipe()
+	go func() {
+		_ = pipeWriter.CloseWithError(renameArchive(gzipReader, pipeWriter, restored))
+	}()
+	defer pipeReader.Close()
+	execExtract := strings.Join([]string{"tar", "xf", "-", "-C", defaultJenkinsHome}, " ")
+	return execClient.StreamRequest(ctx, jenkinsPod, restoreInstance.Name, execExtract, pipeReader, ioutil.Discard)
+}
+
+// performJenkinsDirectoryRestore copies the locations selected by the BackupStrategy from the directory of a Backup
+// created before Backups were archived
+func (r *RestoreReconciler) performJenkinsDirectoryRestore(ctx context.Context, execClient exec.KubeExecClient, jenkinsPod *corev1.Pod, backupInstance *v1alpha2.Backup, backupStrategy *v1alpha2.BackupStrategy, restoreInstance *v1alpha2.Restore) error {
+	restoreFromLocation := getBackupLocation(backupInstance)
+	restoreInstance.Status.Path = restoreFromLocation
+	restoreToLocation := defaultJenkinsHome
+	restoreToSubLocations := getBackupSubLocations(backupStrategy.Spec.Options)
 	if len(restoreToSubLocations) > 0 {
 		for _, sl := range restoreToSubLocations {
 			// Restore each location in a different request
@@ -277,18 +1261,20 @@ func (r *RestoreReconciler) performJenkinsRestore(ctx context.Context, execClien
 				restoreToSubLocation = strings.Join([]string{restoreToLocation, sl}, "/")
 			}
 			execRestoreSubLocation := strings.Join([]string{"cp", "-r", restoreFromSubLocation, restoreToSubLocation}, " ")
-			err := execClient.MakeRequest(jenkinsPod, restoreInstance.Name, execRestoreSubLocation)
+			err := execClient.MakeRequest(ctx, jenkinsPod, restoreInstance.Name, execRestoreSubLocation)
 			if err != nil {
+				err = fmt.Errorf("failed to restore from %s: %s", restoreFromSubLocation, err)
 				restoreInstance.Status.Conditions.SetCondition(status.Condition{
-					Type:   RestoreCompleted,
-					Status: corev1.ConditionFalse,
-					Reason: (status.ConditionReason)(fmt.Sprintf("Failed to restore from %s %s", restoreFromSubLocation, err.Error())),
+					Type:    RestoreCompleted,
+					Status:  corev1.ConditionFalse,
+					Reason:  RestoreCopyFailed,
+					Message: err.Error(),
 				})
-				err = r.Client.Status().Update(ctx, restoreInstance)
-				if err != nil {
-					return err
+				updateErr := r.Client.Status().Update(ctx, restoreInstance)
+				if updateErr != nil {
+					return updateErr
 				}
-				return nil
+				return err
 			}
 		}
 		restoreInstance.Status.Conditions.SetCondition(status.Condition{
@@ -344,7 +1330,10 @@ func (r *RestoreReconciler) GetJenkinsDeployment(jenkins *v1alpha2.Jenkins) (*ap
 }
 
 func (r *RestoreReconciler) GetReplicaSetByDeployment(jenkins *v1alpha2.Jenkins) (*appsv1.ReplicaSet, error) {
-	deployment, _ := r.GetJenkinsDeployment(jenkins)
+	deployment, err := r.GetJenkinsDeployment(jenkins)
+	if err != nil {
+		return nil, err
+	}
 	selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
 	replicasSetList := appsv1.ReplicaSetList{}
 	if err != nil {
@@ -361,6 +1350,21 @@ func (r *RestoreReconciler) GetReplicaSetByDeployment(jenkins *v1alpha2.Jenkins)
 	return &replicaSet, nil
 }
 
+// setRestorePhase sets the phase of the Restore along with its start or completion time and the error message
+func setRestorePhase(restore *v1alpha2.Restore, phase v1alpha2.RestorePhase, err error) {
+	now := metav1.Now()
+	restore.Status.Phase = phase
+	switch phase {
+	case v1alpha2.RestoreRunning:
+		restore.Status.StartTime = &now
+	case v1alpha2.RestoreSucceeded, v1alpha2.RestoreFailed:
+		restore.Status.CompletionTime = &now
+	}
+	if err != nil {
+		restore.Status.Message = err.Error()
+	}
+}
+
 func (r *RestoreReconciler) sendNewRestoreCompletedNotification(jenkins *v1alpha2.Jenkins, restore *v1alpha2.Restore, err error) {
 	r.NotificationEvents <- event.Event{
 		Jenkins:    *jenkins,
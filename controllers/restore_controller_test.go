@@ -0,0 +1,76 @@
+package controllers
+
+import (
+	"context"
+
+	"github.com/jenkinsci/jenkins-automation-operator/api/v1alpha2"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/operator-framework/operator-lib/status"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Jenkins restart", func() {
+	ctx := context.Background()
+	operations := &jenkinsOperations{execClient: &snapshotExecClient{}, jenkinsPod: &corev1.Pod{}, resourceName: "restore"}
+	newRestore := func() *v1alpha2.Restore {
+		return &v1alpha2.Restore{ObjectMeta: metav1.ObjectMeta{Name: "restore", Namespace: "jenkins"}}
+	}
+	key := types.NamespacedName{Name: "restore", Namespace: "jenkins"}
+
+	BeforeEach(func() {
+		Expect(v1alpha2.AddToScheme(scheme.Scheme)).To(Succeed())
+	})
+
+	// The condition is read back by a Restore resumed after the restart to check the health of Jenkins
+	It("Should Record The Started Restart", func() {
+		restore := newRestore()
+		reconciler := &RestoreReconciler{Client: fake.NewFakeClientWithScheme(scheme.Scheme, restore)}
+
+		Expect(reconciler.performJenkinsRestart(ctx, operations, restore)).To(Succeed())
+
+		persisted := &v1alpha2.Restore{}
+		Expect(reconciler.Client.Get(ctx, key, persisted)).To(Succeed())
+		Expect(persisted.Status.Conditions.IsTrueFor(RestartStarted)).To(BeTrue())
+	})
+
+	It("Should Record The Started Safe Restart", func() {
+		restore := newRestore()
+		reconciler := &RestoreReconciler{Client: fake.NewFakeClientWithScheme(scheme.Scheme, restore)}
+
+		Expect(reconciler.performJenkinsSafeRestart(ctx, operations, restore)).To(Succeed())
+
+		persisted := &v1alpha2.Restore{}
+		Expect(reconciler.Client.Get(ctx, key, persisted)).To(Succeed())
+		Expect(persisted.Status.Conditions.IsTrueFor(SafeRestartStarted)).To(BeTrue())
+	})
+})
+
+var _ = Describe("Restore rollback", func() {
+	It("Should Roll Back To The Snapshot Of The Restore", func() {
+		ctx := context.Background()
+		reconciler := &RestoreReconciler{}
+		operations := &jenkinsOperations{execClient: &snapshotExecClient{}, jenkinsPod: &corev1.Pod{}, resourceName: "restore"}
+		jobStrategy := &v1alpha2.BackupStrategy{Spec: v1alpha2.BackupStrategySpec{Runner: v1alpha2.BackupRunnerJob}}
+		newRestore := func(snapshot *v1alpha2.RestoreSnapshot, conditions ...status.Condition) *v1alpha2.Restore {
+			restore := &v1alpha2.Restore{ObjectMeta: metav1.ObjectMeta{Name: "restore", Namespace: "jenkins"}}
+			restore.Status.Snapshot = snapshot
+			for _, condition := range conditions {
+				restore.Status.Conditions.SetCondition(condition)
+			}
+			return restore
+		}
+		keptSnapshot := &v1alpha2.RestoreSnapshot{BackupVolume: "volume", Path: "/backup/volume/.restore-snapshots/restore"}
+
+		Expect(reconciler.getRestoreRollback(ctx, operations, nil, nil, &v1alpha2.BackupStrategy{}, newRestore(keptSnapshot), &restoreSnapshot{})).NotTo(BeNil())
+		Expect(reconciler.getRestoreRollback(ctx, operations, nil, nil, &v1alpha2.BackupStrategy{}, newRestore(keptSnapshot), nil)).To(BeNil())
+		// The snapshot kept by a restore Job is put back by a rollback Job, unless the restore Job rolled back to it
+		Expect(reconciler.getRestoreRollback(ctx, operations, nil, nil, jobStrategy, newRestore(keptSnapshot), nil)).NotTo(BeNil())
+		Expect(reconciler.getRestoreRollback(ctx, operations, nil, nil, jobStrategy, newRestore(nil), nil)).To(BeNil())
+		Expect(reconciler.getRestoreRollback(ctx, operations, nil, nil, jobStrategy, newRestore(keptSnapshot, status.Condition{Type: RolledBack, Status: corev1.ConditionTrue}), nil)).To(BeNil())
+	})
+})
@@ -0,0 +1,186 @@
+package controllers
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/operator-framework/operator-lib/status"
+)
+
+var (
+	// ItemsReloaded is set once Jenkins reloaded the jobs and folders restored by the Restore
+	ItemsReloaded status.ConditionType = "ItemsReloaded"
+	// InvalidRestoreItems is the reason of the RestoreInitialized condition when the items of the Restore are invalid
+	InvalidRestoreItems status.ConditionReason = "InvalidRestoreItems"
+	// ItemsReloadFailed is the reason of the ItemsReloaded condition when Jenkins could not reload the restored items
+	ItemsReloadFailed status.ConditionReason = "ItemsReloadFailed"
+)
+
+// safeItemName matches the segments of the full names of the jobs and folders which can be restored, they are passed
+// to the shell and to the script console once quoted
+var safeItemName = regexp.MustCompile(`^[A-Za-z0-9 ._\-@+]+$`)
+
+// restoreItems are the jobs and folders restored by a Restore, instead of the whole Jenkins Home
+type restoreItems struct {
+	items []restoreItem
+}
+
+// restoreItem is a job or a folder restored from its directory in the Backup archive to its directory in the Jenkins Home
+type restoreItem struct {
+	// name is the full name of the item in the Backup
+	name   string
+	source string
+	target string
+	// fullName is the full name of the restored item in the target Jenkins
+	fullName string
+}
+
+// newRestoreItems returns the items of the Restore, moved to the target folder when there is one. It returns nil when
+// the Restore has no items, the whole Backup is then restored.
+func newRestoreItems(items []string, targetFolder string) (*restoreItems, error) {
+	if len(items) == 0 {
+		if len(targetFolder) > 0 {
+			return nil, fmt.Errorf("targetFolder '%s' is set without items to restore in it", targetFolder)
+		}
+		return nil, nil
+	}
+	if len(targetFolder) > 0 {
+		if err := validateItemFullName(targetFolder); err != nil {
+			return nil, err
+		}
+	}
+	selection := &restoreItems{}
+	fullNames := map[string]string{}
+	for _, item := range items {
+		if err := validateItemFullName(item); err != nil {
+			return nil, err
+		}
+		fullName := item
+		if len(targetFolder) > 0 {
+			fullName = targetFolder + "/" + path.Base(item)
+		}
+		if other, found := fullNames[fullName]; found {
+			return nil, fmt.Errorf("items '%s' and '%s' are both restored as '%s'", other, item, fullName)
+		}
+		for _, other := range items {
+			if strings.HasPrefix(item, other+"/") {
+				return nil, fmt.Errorf("item '%s' is restored with its folder '%s'", item, other)
+			}
+		}
+		fullNames[fullName] = item
+		selection.items = append(selection.items, restoreItem{
+			name:     item,
+			source:   getItemLocation(item),
+			target:   getItemLocation(fullName),
+			fullName: fullName,
+		})
+	}
+	return selection, nil
+}
+
+// validateItemFullName checks that the full name of a job or folder is made of folder and item names separated by "/"
+func validateItemFullName(fullName string) error {
+	for _, name := range strings.Split(fullName, "/") {
+		if name == "." || name == ".." || !safeItemName.MatchString(name) {
+			return fmt.Errorf("invalid item '%s', it must be the full name of a job or folder such as folder/job, "+
+				"made of letters, digits, spaces and the . _ - @ + characters", fullName)
+		}
+	}
+	return nil
+}
+
+// getItemLocation returns the directory of a job or folder in the Jenkins Home, the items of a folder being in its
+// jobs directory
+func getItemLocation(fullName string) string {
+	return "jobs/" + strings.Join(strings.Split(fullName, "/"), "/jobs/")
+}
+
+// locate returns the path in the Jenkins Home of the archive entry, and false if it is not within a restored item
+func (r *restoreItems) locate(name string) (string, bool) {
+	trimmed := strings.TrimPrefix(name, "./")
+	for _, item := range r.items {
+		if trimmed == item.source || strings.HasPrefix(trimmed, item.source+"/") {
+			return item.target + strings.TrimPrefix(trimmed, item.source), true
+		}
+	}
+	return "", false
+}
+
+// fullNames returns the full names of the restored items in the target Jenkins
+func (r *restoreItems) fullNames() []string {
+	fullNames := []string{}
+	for _, item := range r.items {
+		fullNames = append(fullNames, item.fullName)
+	}
+	return fullNames
+}
+
+// targetSelection returns the selection of the directories of the restored items in the Jenkins Home, with the excludes
+// of the BackupStrategy, which is saved in the snapshot taken before the Restore
+func (r *restoreItems) targetSelection(selection *backupSelection) *backupSelection {
+	targets := &backupSelection{excludes: selection.excludes}
+	for _, item := range r.items {
+		targets.includes = append(targets.includes, item.target)
+	}
+	return targets
+}
+
+// checkBackup returns an error if an item is not in the files of the Backup selected by the BackupStrategy
+func (r *restoreItems) checkBackup(files map[string]string, selection *backupSelection) error {
+	for _, item := range r.items {
+		found := false
+		for name := range files {
+			if strings.HasPrefix(name, item.source+"/") && selection.isSelected(name) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("item '%s' is not in the Backup", item.name)
+		}
+	}
+	return nil
+}
+
+// getRestoreEntryFilter returns the function giving the path in the Jenkins Home of the archive entries which are
+// restored: the entries selected by the BackupStrategy, within the restored items if there are
+func getRestoreEntryFilter(selection *backupSelection, items *restoreItems) func(name string) (string, bool) {
+	return func(name string) (string, bool) {
+		if !selection.isSelected(name) {
+			return "", false
+		}
+		if items == nil {
+			return name, true
+		}
+		return items.locate(name)
+	}
+}
+
+// getItemsReloadScript returns the script console script loading the restored items in Jenkins without restarting it.
+// The items which exist are reloaded from their configuration, the others are created from it in their folder, which
+// loads their builds and, for a folder, its items.
+func getItemsReloadScript(fullNames []string) string {
+	quoted := []string{}
+	for _, fullName := range fullNames {
+		quoted = append(quoted, "'"+fullName+"'")
+	}
+	return `def instance = jenkins.model.Jenkins.get()
+[` + strings.Join(quoted, ", ") + `].each { fullName ->
+  def item = instance.getItemByFullName(fullName)
+  if (item != null) {
+    item.doReload()
+    return
+  }
+  def separator = fullName.lastIndexOf('/')
+  def parent = separator < 0 ? instance : instance.getItemByFullName(fullName.substring(0, separator))
+  if (parent == null) {
+    throw new IllegalStateException("folder of item '" + fullName + "' not found")
+  }
+  def name = fullName.substring(separator + 1)
+  def config = new File(parent.rootDir, 'jobs/' + name + '/config.xml')
+  parent.createProjectFromXML(name, new ByteArrayInputStream(config.bytes))
+}
+`
+}
@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Restore items", func() {
+	It("Should Restore The Whole Backup Without Items", func() {
+		items, err := newRestoreItems(nil, "")
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(items).To(BeNil())
+	})
+
+	It("Should Locate The Files Of The Items", func() {
+		items, err := newRestoreItems([]string{"team/pipeline", "tools"}, "")
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(items.fullNames()).To(Equal([]string{"team/pipeline", "tools"}))
+		target, found := items.locate("jobs/team/jobs/pipeline/builds/1/log")
+		Expect(found).To(BeTrue())
+		Expect(target).To(Equal("jobs/team/jobs/pipeline/builds/1/log"))
+		target, found = items.locate("./jobs/tools/")
+		Expect(found).To(BeTrue())
+		Expect(target).To(Equal("jobs/tools/"))
+		_, found = items.locate("jobs/team/config.xml")
+		Expect(found).To(BeFalse())
+		_, found = items.locate("jobs/tools-2/config.xml")
+		Expect(found).To(BeFalse())
+	})
+
+	It("Should Locate The Files Of The Items In The Target Folder", func() {
+		items, err := newRestoreItems([]string{"team/pipeline"}, "restored/today")
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(items.fullNames()).To(Equal([]string{"restored/today/pipeline"}))
+		target, found := items.locate("jobs/team/jobs/pipeline/config.xml")
+		Expect(found).To(BeTrue())
+		Expect(target).To(Equal("jobs/restored/jobs/today/jobs/pipeline/config.xml"))
+		selection := items.targetSelection(&backupSelection{includes: []string{"jobs"}, excludes: []string{"jobs/**/workspace"}})
+		Expect(selection.includes).To(Equal([]string{"jobs/restored/jobs/today/jobs/pipeline"}))
+		Expect(selection.excludes).To(Equal([]string{"jobs/**/workspace"}))
+	})
+
+	It("Should Reject Invalid Items", func() {
+		_, err := newRestoreItems(nil, "restored")
+		Expect(err).To(MatchError("targetFolder 'restored' is set without items to restore in it"))
+		_, err = newRestoreItems([]string{"../secrets"}, "")
+		Expect(err.Error()).To(ContainSubstring("invalid item '../secrets'"))
+		_, err = newRestoreItems([]string{"team/*"}, "")
+		Expect(err.Error()).To(ContainSubstring("invalid item 'team/*'"))
+		_, err = newRestoreItems([]string{"team", "team/pipeline"}, "")
+		Expect(err).To(MatchError("item 'team/pipeline' is restored with its folder 'team'"))
+		_, err = newRestoreItems([]string{"a/pipeline", "b/pipeline"}, "restored")
+		Expect(err).To(MatchError("items 'a/pipeline' and 'b/pipeline' are both restored as 'restored/pipeline'"))
+	})
+})
+
+var _ = Describe("Restore items Backup check", func() {
+	It("Should Fail When An Item Is Not In The Backup", func() {
+		items, err := newRestoreItems([]string{"pipeline"}, "")
+		Expect(err).NotTo(HaveOccurred())
+		selection := &backupSelection{includes: []string{"jobs"}, excludes: []string{"jobs/*/builds"}}
+
+		Expect(items.checkBackup(map[string]string{"jobs/pipeline/config.xml": configChecksum}, selection)).To(Succeed())
+		Expect(items.checkBackup(map[string]string{"jobs/pipeline/builds/1/log": jobChecksum}, selection)).To(MatchError("item 'pipeline' is not in the Backup"))
+	})
+})
+
+var _ = Describe("Restore items archive renaming", func() {
+	It("Should Rename The Entries Of The Items Into The Target Folder", func() {
+		items, err := newRestoreItems([]string{"pipeline"}, "restored")
+		Expect(err).NotTo(HaveOccurred())
+		archive := newTestArchive(map[string]string{"config.xml": "config", "jobs/pipeline/config.xml": "job", "jobs/pipeline/builds/1/log": "log"})
+
+		renamed := &bytes.Buffer{}
+		err = renameArchive(archive, renamed, getRestoreEntryFilter(&backupSelection{includes: []string{"jobs"}, excludes: []string{"jobs/*/builds"}}, items))
+
+		Expect(err).NotTo(HaveOccurred())
+		tarReader := tar.NewReader(renamed)
+		header, err := tarReader.Next()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(header.Name).To(Equal("jobs/restored/jobs/pipeline/config.xml"))
+		_, err = tarReader.Next()
+		Expect(err).To(Equal(io.EOF))
+	})
+})
+
+var _ = Describe("Restore items reload script", func() {
+	It("Should Reload The Restored Items", func() {
+		script := getItemsReloadScript([]string{"team/pipeline", "tools"})
+
+		Expect(script).To(ContainSubstring("['team/pipeline', 'tools'].each { fullName ->"))
+		Expect(script).To(ContainSubstring("item.doReload()"))
+		Expect(script).To(ContainSubstring("parent.createProjectFromXML(name, new ByteArrayInputStream(config.bytes))"))
+	})
+})
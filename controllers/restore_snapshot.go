@@ -0,0 +1,260 @@
+package controllers
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jenkinsci/jenkins-automation-operator/api/v1alpha2"
+	jenkinsclient "github.com/jenkinsci/jenkins-automation-operator/pkg/client"
+	"github.com/jenkinsci/jenkins-automation-operator/pkg/encryption"
+	"github.com/jenkinsci/jenkins-automation-operator/pkg/exec"
+	"github.com/operator-framework/operator-lib/status"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	// SnapshotTaken is set once the locations of the Jenkins Home overwritten by the Restore are saved
+	SnapshotTaken status.ConditionType = "SnapshotTaken"
+	// JenkinsHealthy is set once Jenkins is back after the restart following the Restore
+	JenkinsHealthy status.ConditionType = "JenkinsHealthy"
+	// RolledBack is set when a failed Restore was rolled back to the snapshot
+	RolledBack status.ConditionType = "RolledBack"
+	// SnapshotFailed is the reason of the SnapshotTaken condition when the snapshot could not be taken
+	SnapshotFailed status.ConditionReason = "SnapshotFailed"
+	// HealthCheckFailed is the reason of the JenkinsHealthy condition when Jenkins did not come back after the restart
+	HealthCheckFailed status.ConditionReason = "HealthCheckFailed"
+	// RollbackFailed is the reason of the RolledBack condition when the snapshot could not be restored
+	RollbackFailed status.ConditionReason = "RollbackFailed"
+
+	defaultHealthCheckTimeout = 10 * time.Minute
+	healthCheckPollInterval   = 10 * time.Second
+	// jenkinsStartTimeScript prints the start time of the JVM of Jenkins, which changes when Jenkins is restarted
+	jenkinsStartTimeScript = "print(java.lang.management.ManagementFactory.runtimeMXBean.startTime)"
+)
+
+// restoreSnapshot is a compressed tar archive of the locations of the Jenkins Home selected by a BackupStrategy as they
+// were before a Restore overwrote them. It is stored with its manifest like the files of a Backup, so that it outlives
+// the Operator. It is encrypted like the Backups when the BackupStrategy sets an encryption.
+type restoreSnapshot struct {
+	selection *backupSelection
+	storage   backupStorage
+	// files are the regular files of the snapshot
+	files map[string]string
+	// encryption is the algorithm with which the archive is encrypted, empty if it is not encrypted
+	encryption    string
+	encryptionKey []byte
+}
+
+// newRestoreSnapshotManifest returns the manifest of a snapshot of the selection, completed once it is stored
+func newRestoreSnapshotManifest(resourceName string, selection *backupSelection, encryptionKey []byte) *BackupManifest {
+	manifest := &BackupManifest{
+		Backup:       resourceName,
+		CreationTime: time.Now().UTC(),
+		Paths:        selection.roots(),
+		Includes:     selection.includes,
+		Excludes:     selection.excludes,
+	}
+	if encryptionKey != nil {
+		manifest.Encryption = encryption.Algorithm
+	}
+	return manifest
+}
+
+// takeRestoreSnapshot archives the locations of the Jenkins Home selected by the BackupStrategy to the storage,
+// encrypted with the encryption key if it is set. The snapshot must be removed once the Restore is complete.
+func takeRestoreSnapshot(ctx context.Context, execClient exec.KubeExecClient, jenkinsPod *corev1.Pod, resourceName string, selection *backupSelection, storage backupStorage, encryptionKey []byte) (*restoreSnapshot, error) {
+	manifest := newRestoreSnapshotManifest(resourceName, selection, encryptionKey)
+	_, err := streamBackupArchive(ctx, storage, manifest, encryptionKey, func(out io.Writer) error {
+		return streamJenkinsHomeArchive(ctx, execClient, jenkinsPod, resourceName, selection, out)
+	})
+	if err != nil {
+		_ = storage.delete(ctx)
+		return nil, err
+	}
+	return &restoreSnapshot{selection: selection, storage: storage, files: manifest.Files, encryption: manifest.Encryption, encryptionKey: encryptionKey}, nil
+}
+
+// openRestoreSnapshot reads the manifest of a snapshot taken before the Restore was resumed, an encrypted snapshot
+// is read with the encryption key
+func openRestoreSnapshot(ctx context.Context, storage backupStorage, encryptionKey []byte) (*restoreSnapshot, error) {
+	manifest, err := readBackupManifest(ctx, storage)
+	if err != nil {
+		return nil, err
+	}
+	selection := &backupSelection{includes: manifest.Includes, excludes: manifest.Excludes}
+	return &restoreSnapshot{selection: selection, storage: storage, files: manifest.Files, encryption: manifest.Encryption, encryptionKey: encryptionKey}, nil
+}
+
+// rollback puts back the Jenkins Home as it was when the snapshot was taken: the selected files which were not in
+// the snapshot are deleted, then the snapshot is streamed from its storage and extracted over the restored files
+func (s *restoreSnapshot) rollback(ctx context.Context, execClient exec.KubeExecClient, jenkinsPod *corev1.Pod, resourceName string) error {
+	currentFiles := &bytes.Buffer{}
+	err := execClient.StreamRequest(ctx, jenkinsPod, resourceName, getListFilesScript(defaultJenkinsHome, s.selection), nil, currentFiles)
+	if err != nil {
+		return fmt.Errorf("failed to list the restored files: %s", err)
+	}
+	deletions := getRollbackDeletions(currentFiles, s.files, s.selection)
+	if len(deletions) > 0 {
+		execDelete := "cd " + shellQuote(defaultJenkinsHome, false) + ` && while IFS= read -r f; do rm -f -- "$f"; done`
+		err = execClient.StreamRequest(ctx, jenkinsPod, resourceName, execDelete, strings.NewReader(strings.Join(deletions, "\n")+"\n"), ioutil.Discard)
+		if err != nil {
+			return fmt.Errorf("failed to delete the restored files: %s", err)
+		}
+	}
+
+	execExtract := strings.Join([]string{"tar", "xf", "-", "-C", defaultJenkinsHome}, " ")
+	err = s.readArchive(ctx, func(archive io.Reader) error {
+		return execClient.StreamRequest(ctx, jenkinsPod, resourceName, execExtract, archive, ioutil.Discard)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to extract the snapshot: %s", err)
+	}
+	return nil
+}
+
+// readArchive streams the decrypted and uncompressed archive of the snapshot from its storage to extract
+func (s *restoreSnapshot) readArchive(ctx context.Context, extract func(archive io.Reader) error) error {
+	archiveReader, archiveWriter := io.Pipe()
+	go func() {
+		_ = archiveWriter.CloseWithError(s.storage.readFile(ctx, BackupArchiveName, archiveWriter))
+	}()
+	compressedArchive, err := openBackupArchive(archiveReader, &BackupManifest{Encryption: s.encryption}, s.encryptionKey)
+	if err == nil {
+		var gzipReader *gzip.Reader
+		gzipReader, err = gzip.NewReader(compressedArchive)
+		if err == nil {
+			err = extract(gzipReader)
+		}
+	}
+	// Stops the reading of the storage if the extraction failed before reading the whole archive
+	_ = archiveReader.CloseWithError(err)
+	return err
+}
+
+// takeLocalRestoreSnapshot archives the locations of the Jenkins Home mounted in a backup Job selected by the
+// BackupStrategy to the storage, encrypted like takeRestoreSnapshot. The snapshot must be removed.
+func takeLocalRestoreSnapshot(ctx context.Context, jenkinsHome, resourceName string, selection *backupSelection, storage backupStorage, encryptionKey []byte) (*restoreSnapshot, error) {
+	manifest := newRestoreSnapshotManifest(resourceName, selection, encryptionKey)
+	_, err := streamBackupArchive(ctx, storage, manifest, encryptionKey, func(out io.Writer) error {
+		return writeHomeArchive(jenkinsHome, selection, out)
+	})
+	if err != nil {
+		_ = storage.delete(ctx)
+		return nil, err
+	}
+	return &restoreSnapshot{selection: selection, storage: storage, files: manifest.Files, encryption: manifest.Encryption, encryptionKey: encryptionKey}, nil
+}
+
+// rollbackLocal puts back the Jenkins Home mounted in a backup Job as it was when the snapshot was taken, like rollback
+func (s *restoreSnapshot) rollbackLocal(ctx context.Context, jenkinsHome string) error {
+	currentFiles := &bytes.Buffer{}
+	err := walkHome(jenkinsHome, s.selection, func(_, name string, info os.FileInfo) error {
+		if info.Mode().IsRegular() {
+			currentFiles.WriteString(name + "\n")
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list the restored files: %s", err)
+	}
+	for _, name := range getRollbackDeletions(currentFiles, s.files, s.selection) {
+		err = os.Remove(filepath.Join(jenkinsHome, filepath.FromSlash(name)))
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to delete the restored files: %s", err)
+		}
+	}
+
+	err = s.readArchive(ctx, func(archive io.Reader) error {
+		return extractArchive(archive, jenkinsHome)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to extract the snapshot: %s", err)
+	}
+	return nil
+}
+
+// remove deletes the archive and the manifest of the snapshot from its storage
+func (s *restoreSnapshot) remove(ctx context.Context) error {
+	return s.storage.delete(ctx)
+}
+
+// getListFilesScript returns the script listing the regular files of the existing roots of the selection, one per line
+func getListFilesScript(jenkinsHome string, selection *backupSelection) string {
+	roots := []string{}
+	for _, root := range selection.roots() {
+		roots = append(roots, shellQuote(root, true))
+	}
+	return strings.Join([]string{
+		"cd " + shellQuote(jenkinsHome, false),
+		`for f in ` + strings.Join(roots, " ") + `; do if [ -e "$f" ]; then find "$f" -type f; fi; done`,
+	}, " && ")
+}
+
+// getRollbackDeletions returns the sorted files of the list which are selected but not in the snapshot,
+// they were added by the Restore
+func getRollbackDeletions(currentFiles io.Reader, snapshotFiles map[string]string, selection *backupSelection) []string {
+	deletions := []string{}
+	scanner := bufio.NewScanner(currentFiles)
+	for scanner.Scan() {
+		name := strings.TrimPrefix(scanner.Text(), "./")
+		if len(name) == 0 || !selection.isSelected(name) {
+			continue
+		}
+		if _, found := snapshotFiles[name]; !found {
+			deletions = append(deletions, name)
+		}
+	}
+	sort.Strings(deletions)
+	return deletions
+}
+
+// getJenkinsStartTime returns the start time of the JVM of Jenkins, as printed by the script console
+func getJenkinsStartTime(jenkinsClient jenkinsclient.Jenkins) (string, error) {
+	output, err := jenkinsClient.ExecuteScript(jenkinsStartTimeScript)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(output), nil
+}
+
+// waitForJenkinsRestart polls the script console of Jenkins until it answers with another start time than the one
+// before the restart, which means that Jenkins was restarted and is fully up
+func waitForJenkinsRestart(jenkinsClient jenkinsclient.Jenkins, startTime string, interval, timeout time.Duration) error {
+	var lastErr error
+	err := wait.PollImmediate(interval, timeout, func() (bool, error) {
+		currentStartTime, err := getJenkinsStartTime(jenkinsClient)
+		if err != nil {
+			// Jenkins doesn't answer while it restarts
+			lastErr = err
+			return false, nil
+		}
+		lastErr = nil
+		return currentStartTime != startTime, nil
+	})
+	if err != wait.ErrWaitTimeout {
+		return err
+	}
+	if lastErr != nil {
+		return fmt.Errorf("Jenkins is not healthy %s after the restart: %s", timeout, lastErr)
+	}
+	return fmt.Errorf("Jenkins was not restarted within %s", timeout)
+}
+
+// getHealthCheckTimeout returns how long Jenkins is waited for after the restart following a Restore
+func getHealthCheckTimeout(restart v1alpha2.RestartConfig) time.Duration {
+	if restart.HealthCheckTimeout != nil {
+		return restart.HealthCheckTimeout.Duration
+	}
+	return defaultHealthCheckTimeout
+}
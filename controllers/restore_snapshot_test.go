@@ -0,0 +1,219 @@
+package controllers
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/jenkinsci/jenkins-automation-operator/api/v1alpha2"
+	jenkinsclient "github.com/jenkinsci/jenkins-automation-operator/pkg/client"
+	"github.com/jenkinsci/jenkins-automation-operator/pkg/encryption"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// snapshotExecClient serves the scripts run to take and roll back a snapshot
+type snapshotExecClient struct {
+	home      map[string]string
+	deleted   []string
+	extracted map[string]string
+}
+
+func (e *snapshotExecClient) InitKubeGoClient() error {
+	return nil
+}
+
+func (e *snapshotExecClient) MakeRequest(context.Context, *corev1.Pod, string, string) error {
+	return nil
+}
+
+func (e *snapshotExecClient) StreamRequest(_ context.Context, _ *corev1.Pod, _, script string, stdin io.Reader, stdout io.Writer) error {
+	switch {
+	case strings.Contains(script, "tar cf -"):
+		tarWriter := tar.NewWriter(stdout)
+		for name, content := range e.home {
+			header := &tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}
+			if err := tarWriter.WriteHeader(header); err != nil {
+				return err
+			}
+			if _, err := tarWriter.Write([]byte(content)); err != nil {
+				return err
+			}
+		}
+		return tarWriter.Close()
+	case strings.Contains(script, "find"):
+		for _, name := range []string{"./config.xml", "./jobs/old/config.xml", "./jobs/new/config.xml", "./jobs/new/builds/1/log"} {
+			if _, err := io.WriteString(stdout, name+"\n"); err != nil {
+				return err
+			}
+		}
+		return nil
+	case strings.Contains(script, "rm -f"):
+		content, err := ioutil.ReadAll(stdin)
+		e.deleted = strings.Fields(string(content))
+		return err
+	case strings.Contains(script, "tar xf -"):
+		e.extracted = map[string]string{}
+		tarReader := tar.NewReader(stdin)
+		for {
+			header, err := tarReader.Next()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			content, err := ioutil.ReadAll(tarReader)
+			if err != nil {
+				return err
+			}
+			e.extracted[header.Name] = string(content)
+		}
+	}
+	return errors.New("unexpected script " + script)
+}
+
+var _ = Describe("Restore snapshot", func() {
+	ctx := context.Background()
+	home := map[string]string{
+		"config.xml":            "<hudson/>",
+		"jobs/old/config.xml":   "<project/>",
+		"jobs/old/builds/1/log": "excluded",
+	}
+	var (
+		selection *backupSelection
+		directory string
+		storage   *localBackupStorage
+	)
+
+	BeforeEach(func() {
+		var err error
+		selection, err = newBackupSelection(v1alpha2.BackupStrategySpec{Options: v1alpha2.BackupOptions{Config: true, Jobs: true}, Excludes: []string{"jobs/*/builds"}})
+		Expect(err).NotTo(HaveOccurred())
+		directory, err = ioutil.TempDir("", "snapshot")
+		Expect(err).NotTo(HaveOccurred())
+		storage = &localBackupStorage{directory: filepath.Join(directory, restoreSnapshotsDirectory, "restore")}
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(directory)).To(Succeed())
+	})
+
+	It("Should Roll Back The Jenkins Home", func() {
+		execClient := &snapshotExecClient{home: home}
+
+		snapshot, err := takeRestoreSnapshot(ctx, execClient, &corev1.Pod{}, "restore", selection, storage, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(snapshot.files).To(HaveLen(2))
+
+		err = snapshot.rollback(ctx, execClient, &corev1.Pod{}, "restore")
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(execClient.deleted).To(Equal([]string{"jobs/new/config.xml"}))
+		Expect(execClient.extracted).To(Equal(map[string]string{"config.xml": "<hudson/>", "jobs/old/config.xml": "<project/>"}))
+	})
+
+	It("Should Roll Back The Jenkins Home Once Resumed", func() {
+		_, err := takeRestoreSnapshot(ctx, &snapshotExecClient{home: home}, &corev1.Pod{}, "restore", selection, storage, nil)
+		Expect(err).NotTo(HaveOccurred())
+		execClient := &snapshotExecClient{}
+
+		snapshot, err := openRestoreSnapshot(ctx, storage, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(snapshot.selection).To(Equal(selection))
+		Expect(snapshot.files).To(HaveLen(2))
+
+		err = snapshot.rollback(ctx, execClient, &corev1.Pod{}, "restore")
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(execClient.deleted).To(Equal([]string{"jobs/new/config.xml"}))
+		Expect(execClient.extracted).To(Equal(map[string]string{"config.xml": "<hudson/>", "jobs/old/config.xml": "<project/>"}))
+	})
+
+	It("Should Remove The Snapshot", func() {
+		_, err := takeRestoreSnapshot(ctx, &snapshotExecClient{home: home}, &corev1.Pod{}, "restore", selection, storage, nil)
+		Expect(err).NotTo(HaveOccurred())
+		snapshot, err := openRestoreSnapshot(ctx, storage, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(snapshot.remove(ctx)).To(Succeed())
+
+		_, err = os.Stat(storage.directory)
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+
+	It("Should Encrypt The Snapshot", func() {
+		encryptionKey := []byte("0123456789abcdef0123456789abcdef")
+		execClient := &snapshotExecClient{home: map[string]string{"credentials.xml": "<credentials/>"}}
+		_, err := takeRestoreSnapshot(ctx, execClient, &corev1.Pod{}, "restore", selection, storage, encryptionKey)
+		Expect(err).NotTo(HaveOccurred())
+		archive, err := ioutil.ReadFile(filepath.Join(storage.directory, BackupArchiveName))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(archive)).NotTo(ContainSubstring("credentials"))
+
+		snapshot, err := openRestoreSnapshot(ctx, storage, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(snapshot.rollback(ctx, execClient, &corev1.Pod{}, "restore")).NotTo(Succeed())
+		snapshot, err = openRestoreSnapshot(ctx, storage, encryptionKey)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(snapshot.encryption).To(Equal(encryption.Algorithm))
+		err = snapshot.rollback(ctx, execClient, &corev1.Pod{}, "restore")
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(execClient.extracted).To(Equal(map[string]string{"credentials.xml": "<credentials/>"}))
+	})
+})
+
+var _ = Describe("Rollback deletions", func() {
+	It("Should Delete The Selected Files Missing From The Snapshot", func() {
+		selection := &backupSelection{includes: []string{"*.xml", "jobs"}, excludes: []string{"jobs/*/builds"}}
+		currentFiles := strings.NewReader("./config.xml\n./credentials.xml\njobs/b/config.xml\njobs/a/config.xml\njobs/a/builds/1/log\nsecret.key\n\n")
+		snapshotFiles := map[string]string{"config.xml": "checksum"}
+
+		Expect(getRollbackDeletions(currentFiles, snapshotFiles, selection)).To(Equal([]string{"credentials.xml", "jobs/a/config.xml", "jobs/b/config.xml"}))
+	})
+})
+
+var _ = Describe("List files script", func() {
+	It("Should List The Selected Files Of The Jenkins Home", func() {
+		selection := &backupSelection{includes: []string{"*.xml", "jobs/**/config.xml"}}
+
+		Expect(getListFilesScript("/var/lib/jenkins", selection)).To(Equal(`cd '/var/lib/jenkins' && for f in *'.xml' 'jobs'; do if [ -e "$f" ]; then find "$f" -type f; fi; done`))
+	})
+})
+
+var _ = Describe("Jenkins restart wait", func() {
+	It("Should Succeed Once Jenkins Is Restarted", func() {
+		mockCtrl := gomock.NewController(GinkgoT())
+		defer mockCtrl.Finish()
+		jenkinsClient := jenkinsclient.NewMockJenkins(mockCtrl)
+		gomock.InOrder(
+			jenkinsClient.EXPECT().ExecuteScript(jenkinsStartTimeScript).Return("1000", nil),
+			jenkinsClient.EXPECT().ExecuteScript(jenkinsStartTimeScript).Return("", errors.New("503 Service Unavailable")),
+			jenkinsClient.EXPECT().ExecuteScript(jenkinsStartTimeScript).Return("2000\n", nil),
+		)
+
+		err := waitForJenkinsRestart(jenkinsClient, "1000", time.Millisecond, time.Minute)
+
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("Should Fail When Jenkins Does Not Come Back", func() {
+		mockCtrl := gomock.NewController(GinkgoT())
+		defer mockCtrl.Finish()
+		jenkinsClient := jenkinsclient.NewMockJenkins(mockCtrl)
+		jenkinsClient.EXPECT().ExecuteScript(jenkinsStartTimeScript).Return("", errors.New("503 Service Unavailable")).MinTimes(1)
+
+		err := waitForJenkinsRestart(jenkinsClient, "1000", time.Millisecond, 10*time.Millisecond)
+
+		Expect(err).To(MatchError("Jenkins is not healthy 10ms after the restart: 503 Service Unavailable"))
+	})
+})
@@ -0,0 +1,175 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jenkinsci/jenkins-automation-operator/api/v1alpha2"
+	jenkinsclient "github.com/jenkinsci/jenkins-automation-operator/pkg/client"
+	"github.com/jenkinsci/jenkins-automation-operator/pkg/plugins"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// restoreIncompatibleError is returned when the Backup cannot be restored in the target Jenkins
+type restoreIncompatibleError struct {
+	jenkins  string
+	problems []string
+}
+
+func (e *restoreIncompatibleError) Error() string {
+	return fmt.Sprintf("backup is incompatible with Jenkins '%s': %s", e.jenkins, strings.Join(e.problems, ", "))
+}
+
+// getRestoreBackupNamespace returns the namespace of the Backup of the Restore
+func getRestoreBackupNamespace(restore *v1alpha2.Restore) string {
+	if len(restore.Spec.BackupNamespace) > 0 {
+		return restore.Spec.BackupNamespace
+	}
+	return restore.Namespace
+}
+
+// getRestoreTargetJenkins returns the name of the Jenkins, in the namespace of the Restore, in which the Backup is restored
+func getRestoreTargetJenkins(restore *v1alpha2.Restore, backup *v1alpha2.Backup) (string, error) {
+	if len(restore.Spec.JenkinsRef) > 0 {
+		return restore.Spec.JenkinsRef, nil
+	}
+	if backup.Namespace != restore.Namespace {
+		return "", fmt.Errorf("jenkinsRef is required to restore Backup '%s' from namespace '%s'", backup.Name, backup.Namespace)
+	}
+	return backup.Spec.JenkinsRef, nil
+}
+
+// getRestoreSourceBackup returns the Backup as stored on the BackupVolume it is restored from, which is its own
+// BackupVolume or one of the replicas it was copied to
+func getRestoreSourceBackup(backup *v1alpha2.Backup, backupVolumeName string) (*v1alpha2.Backup, error) {
+	if len(backupVolumeName) == 0 || backupVolumeName == backup.Spec.BackupVolumeRef {
+		return backup, nil
+	}
+	if len(backup.Status.VolumeSnapshot) > 0 {
+		return nil, fmt.Errorf("backup '%s' was taken as a VolumeSnapshot, it has no replicas", backup.Name)
+	}
+	for _, replicaName := range getSucceededReplicas(backup) {
+		if replicaName == backupVolumeName {
+			return getReplicaBackup(backup, replicaName), nil
+		}
+	}
+	return nil, fmt.Errorf("backup '%s' was not copied to BackupVolume '%s'", backup.Name, backupVolumeName)
+}
+
+// checkBackupRestorable returns an error if the Backup has no archive or VolumeSnapshot to restore, such as a Backup
+// which exported the configurations to a Git repository, restored from the history of the repository instead
+func checkBackupRestorable(backup *v1alpha2.Backup) error {
+	if backup.Status.GitExport != nil {
+		return fmt.Errorf("backup '%s' was exported to the Git repository %s, it has no archive to restore", backup.Name, backup.Status.GitExport.URL)
+	}
+	return nil
+}
+
+// isRestoredInOtherJenkins returns true if the Backup is restored in another Jenkins than the one which was backed up
+func isRestoredInOtherJenkins(jenkins *v1alpha2.Jenkins, backup *v1alpha2.Backup) bool {
+	return jenkins.Namespace != backup.Namespace || jenkins.Name != backup.Spec.JenkinsRef
+}
+
+// checkBackupAccess checks with a SubjectAccessReview that the service account of the Jenkins Pod is allowed to get the Backup
+func checkBackupAccess(ctx context.Context, c client.Client, jenkinsPod *corev1.Pod, backup *v1alpha2.Backup) error {
+	serviceAccount := jenkinsPod.Spec.ServiceAccountName
+	if len(serviceAccount) == 0 {
+		serviceAccount = "default"
+	}
+	review := &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:   fmt.Sprintf("system:serviceaccount:%s:%s", jenkinsPod.Namespace, serviceAccount),
+			Groups: []string{"system:serviceaccounts", "system:serviceaccounts:" + jenkinsPod.Namespace},
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace: backup.Namespace,
+				Verb:      "get",
+				Group:     v1alpha2.GroupVersion.Group,
+				Resource:  "backups",
+				Name:      backup.Name,
+			},
+		},
+	}
+	if err := c.Create(ctx, review); err != nil {
+		return err
+	}
+	if !review.Status.Allowed {
+		return fmt.Errorf("service account '%s' of namespace '%s' is not allowed to get Backup '%s' in namespace '%s'",
+			serviceAccount, jenkinsPod.Namespace, backup.Name, backup.Namespace)
+	}
+	return nil
+}
+
+// hasJenkinsVersionAndPlugins returns true if the Backup recorded the version and the plugins of the backed up Jenkins
+// in its status, Backups created before they were recorded only have them in their manifest
+func hasJenkinsVersionAndPlugins(backup *v1alpha2.Backup) bool {
+	return len(backup.Status.JenkinsVersion) > 0 || len(backup.Status.Plugins) > 0
+}
+
+// restoreCompatibility is the outcome of the comparison of the Jenkins version and the plugins recorded by a Backup
+// with the ones of the target Jenkins
+type restoreCompatibility struct {
+	// olderJenkins is true when the target Jenkins is older than the backed up Jenkins
+	olderJenkins bool
+	// plugins are the backed up plugins, at their backed up version, which are missing or older in the target Jenkins
+	plugins []v1alpha2.Plugin
+	// problems describe the incompatibilities
+	problems []string
+}
+
+// getRestoreCompatibility compares the Jenkins version and the plugins recorded by the Backup with the ones of the
+// target Jenkins. Restoring in an older Jenkins, or without plugins the Backup was using, may break the configuration.
+// The plugins are not compared when they are restored too.
+func getRestoreCompatibility(backupVersion string, backupPlugins []v1alpha2.Plugin, jenkinsVersion string, jenkinsPlugins []v1alpha2.Plugin, restoresPlugins bool) *restoreCompatibility {
+	compatibility := &restoreCompatibility{problems: []string{}}
+	if len(backupVersion) > 0 && len(jenkinsVersion) > 0 && plugins.CompareVersions(jenkinsVersion, backupVersion) < 0 {
+		compatibility.olderJenkins = true
+		compatibility.problems = append(compatibility.problems, fmt.Sprintf("Jenkins version %s is older than the backed up version %s", jenkinsVersion, backupVersion))
+	}
+	if restoresPlugins {
+		return compatibility
+	}
+	installed := map[string]string{}
+	for _, plugin := range jenkinsPlugins {
+		installed[plugin.Name] = plugin.Version
+	}
+	for _, plugin := range backupPlugins {
+		version, found := installed[plugin.Name]
+		if !found {
+			compatibility.plugins = append(compatibility.plugins, plugin)
+			compatibility.problems = append(compatibility.problems, fmt.Sprintf("plugin %s:%s is missing", plugin.Name, plugin.Version))
+		} else if plugins.CompareVersions(version, plugin.Version) < 0 {
+			compatibility.plugins = append(compatibility.plugins, plugin)
+			compatibility.problems = append(compatibility.problems, fmt.Sprintf("plugin %s:%s is older than the backed up version %s", plugin.Name, version, plugin.Version))
+		}
+	}
+	return compatibility
+}
+
+// jenkinsVersionScript prints the version of the running Jenkins
+const jenkinsVersionScript = `print(jenkins.model.Jenkins.VERSION)`
+
+// getRunningJenkinsVersionAndPlugins returns the version of the running Jenkins and its installed plugins, sorted by name
+func getRunningJenkinsVersionAndPlugins(jenkinsClient jenkinsclient.Jenkins) (string, []v1alpha2.Plugin, error) {
+	version, err := jenkinsClient.ExecuteScript(jenkinsVersionScript)
+	if err != nil {
+		return "", nil, err
+	}
+	installedPlugins, err := jenkinsClient.GetPlugins(1)
+	if err != nil {
+		return "", nil, err
+	}
+	jenkinsPlugins := []v1alpha2.Plugin{}
+	if installedPlugins.Raw != nil {
+		for _, plugin := range installedPlugins.Raw.Plugins {
+			jenkinsPlugins = append(jenkinsPlugins, v1alpha2.Plugin{Name: plugin.ShortName, Version: plugin.Version})
+		}
+	}
+	sort.Slice(jenkinsPlugins, func(i, j int) bool {
+		return jenkinsPlugins[i].Name < jenkinsPlugins[j].Name
+	})
+	return strings.TrimSpace(version), jenkinsPlugins, nil
+}
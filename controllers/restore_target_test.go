@@ -0,0 +1,175 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/bndr/gojenkins"
+	"github.com/golang/mock/gomock"
+	"github.com/jenkinsci/jenkins-automation-operator/api/v1alpha2"
+	jenkinsclient "github.com/jenkinsci/jenkins-automation-operator/pkg/client"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/operator-framework/operator-lib/status"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Restore target Jenkins", func() {
+	backup := &v1alpha2.Backup{
+		ObjectMeta: metav1.ObjectMeta{Name: "backup", Namespace: "production"},
+		Spec:       v1alpha2.BackupSpec{JenkinsRef: "jenkins"},
+	}
+
+	It("Should Be The Jenkins Which Was Backed Up By Default", func() {
+		restore := &v1alpha2.Restore{ObjectMeta: metav1.ObjectMeta{Namespace: "production"}, Spec: v1alpha2.RestoreSpec{BackupRef: "backup"}}
+
+		jenkins, err := getRestoreTargetJenkins(restore, backup)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(jenkins).To(Equal("jenkins"))
+		Expect(getRestoreBackupNamespace(restore)).To(Equal("production"))
+	})
+
+	It("Should Be The Other Jenkins Of The Restore", func() {
+		restore := &v1alpha2.Restore{ObjectMeta: metav1.ObjectMeta{Namespace: "production"}, Spec: v1alpha2.RestoreSpec{BackupRef: "backup", JenkinsRef: "jenkins-clone"}}
+
+		jenkins, err := getRestoreTargetJenkins(restore, backup)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(jenkins).To(Equal("jenkins-clone"))
+		Expect(isRestoredInOtherJenkins(&v1alpha2.Jenkins{ObjectMeta: metav1.ObjectMeta{Name: jenkins, Namespace: "production"}}, backup)).To(BeTrue())
+	})
+
+	It("Should Be The Jenkins Of The Restore For A Backup Of Another Namespace", func() {
+		restore := &v1alpha2.Restore{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "staging"},
+			Spec:       v1alpha2.RestoreSpec{BackupRef: "backup", BackupNamespace: "production", JenkinsRef: "jenkins"},
+		}
+
+		jenkins, err := getRestoreTargetJenkins(restore, backup)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getRestoreBackupNamespace(restore)).To(Equal("production"))
+		Expect(isRestoredInOtherJenkins(&v1alpha2.Jenkins{ObjectMeta: metav1.ObjectMeta{Name: jenkins, Namespace: "staging"}}, backup)).To(BeTrue())
+	})
+
+	It("Should Require The JenkinsRef For A Backup Of Another Namespace", func() {
+		restore := &v1alpha2.Restore{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "staging"},
+			Spec:       v1alpha2.RestoreSpec{BackupRef: "backup", BackupNamespace: "production"},
+		}
+
+		_, err := getRestoreTargetJenkins(restore, backup)
+
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("Restore compatibility", func() {
+	backupPlugins := []v1alpha2.Plugin{
+		{Name: "git", Version: "4.4.5"},
+		{Name: "workflow-aggregator", Version: "2.6"},
+	}
+
+	It("Should Have No Problems With Newer Jenkins And Plugins", func() {
+		compatibility := getRestoreCompatibility("2.263.1", backupPlugins, "2.263.4", []v1alpha2.Plugin{
+			{Name: "git", Version: "4.5.0"},
+			{Name: "workflow-aggregator", Version: "2.6"},
+			{Name: "kubernetes", Version: "1.28.0"},
+		}, false)
+
+		Expect(compatibility.problems).To(BeEmpty())
+		Expect(compatibility.olderJenkins).To(BeFalse())
+		Expect(compatibility.plugins).To(BeEmpty())
+	})
+
+	It("Should List Older Jenkins, Missing And Older Plugins", func() {
+		compatibility := getRestoreCompatibility("2.263.1", backupPlugins, "2.249.3", []v1alpha2.Plugin{{Name: "git", Version: "4.2.0"}}, false)
+
+		Expect(compatibility.problems).To(Equal([]string{
+			"Jenkins version 2.249.3 is older than the backed up version 2.263.1",
+			"plugin git:4.2.0 is older than the backed up version 4.4.5",
+			"plugin workflow-aggregator:2.6 is missing",
+		}))
+		Expect(compatibility.olderJenkins).To(BeTrue())
+		Expect(compatibility.plugins).To(Equal(backupPlugins))
+	})
+
+	It("Should Ignore The Plugins When They Are Restored", func() {
+		compatibility := getRestoreCompatibility("2.263.1", backupPlugins, "2.263.1", nil, true)
+
+		Expect(compatibility.problems).To(BeEmpty())
+	})
+})
+
+var _ = Describe("Restore compatibility check", func() {
+	ctx := context.Background()
+	backupPlugins := []v1alpha2.Plugin{{Name: "git", Version: "4.4.5"}}
+	newPlugins := func(plugins ...gojenkins.Plugin) *gojenkins.Plugins {
+		return &gojenkins.Plugins{Raw: &gojenkins.PluginResponse{Plugins: plugins}}
+	}
+
+	BeforeEach(func() {
+		Expect(v1alpha2.AddToScheme(scheme.Scheme)).To(Succeed())
+	})
+
+	for _, test := range []struct {
+		name       string
+		policy     v1alpha2.RestoreCompatibilityPolicy
+		version    string
+		plugins    *gojenkins.Plugins
+		install    bool
+		installErr error
+		wantErr    string
+		wantStatus corev1.ConditionStatus
+		wantReason status.ConditionReason
+	}{
+		{name: "compatible", version: "2.263.1", plugins: newPlugins(gojenkins.Plugin{ShortName: "git", Version: "4.5.0"}), wantStatus: corev1.ConditionTrue},
+		{name: "block", version: "2.263.1", plugins: newPlugins(), wantStatus: corev1.ConditionFalse, wantReason: RestoreIncompatible,
+			wantErr: "backup is incompatible with Jenkins 'jenkins': plugin git:4.4.5 is missing"},
+		{name: "warn", policy: v1alpha2.RestoreCompatibilityWarn, version: "2.263.1", plugins: newPlugins(), wantStatus: corev1.ConditionFalse, wantReason: RestoreIncompatible},
+		{name: "install plugins", policy: v1alpha2.RestoreCompatibilityInstallPlugins, version: "2.263.1",
+			plugins: newPlugins(gojenkins.Plugin{ShortName: "git", Version: "4.2.0"}), install: true, wantStatus: corev1.ConditionTrue, wantReason: PluginsInstalled},
+		{name: "install plugins fails", policy: v1alpha2.RestoreCompatibilityInstallPlugins, version: "2.263.1", plugins: newPlugins(), install: true,
+			installErr: errors.New("Invalid status code returned: 500"), wantStatus: corev1.ConditionFalse, wantReason: PluginInstallFailed,
+			wantErr: "failed to install plugin git:4.4.5: Invalid status code returned: 500"},
+		{name: "install plugins in older Jenkins", policy: v1alpha2.RestoreCompatibilityInstallPlugins, version: "2.249.3", plugins: newPlugins(),
+			wantStatus: corev1.ConditionFalse, wantReason: RestoreIncompatible,
+			wantErr: "backup is incompatible with Jenkins 'jenkins': Jenkins version 2.249.3 is older than the backed up version 2.263.1, plugin git:4.4.5 is missing"},
+	} {
+		test := test
+		It(fmt.Sprintf("Should Check The Compatibility (%s)", test.name), func() {
+			mockCtrl := gomock.NewController(GinkgoT())
+			defer mockCtrl.Finish()
+			jenkinsClient := jenkinsclient.NewMockJenkins(mockCtrl)
+			jenkinsClient.EXPECT().ExecuteScript(jenkinsVersionScript).Return(test.version+"\n", nil)
+			jenkinsClient.EXPECT().GetPlugins(1).Return(test.plugins, nil)
+			if test.install {
+				jenkinsClient.EXPECT().InstallPlugin("git", "4.4.5").Return(test.installErr)
+			}
+			restore := &v1alpha2.Restore{
+				ObjectMeta: metav1.ObjectMeta{Name: "restore", Namespace: "jenkins"},
+				Spec:       v1alpha2.RestoreSpec{CompatibilityPolicy: test.policy},
+				Status:     v1alpha2.RestoreStatus{Jenkins: "jenkins"},
+			}
+			backupStrategy := &v1alpha2.BackupStrategy{Spec: v1alpha2.BackupStrategySpec{Options: v1alpha2.BackupOptions{Jobs: true}}}
+			reconciler := &RestoreReconciler{Client: fake.NewFakeClientWithScheme(scheme.Scheme, restore)}
+
+			err := reconciler.performRestoreCompatibilityCheck(ctx, &lazyJenkinsClient{jenkinsClient: jenkinsClient}, "2.263.1", backupPlugins, backupStrategy, restore)
+
+			if len(test.wantErr) > 0 {
+				Expect(err).To(MatchError(test.wantErr))
+			} else {
+				Expect(err).NotTo(HaveOccurred())
+			}
+			condition := restore.Status.Conditions.GetCondition(CompatibilityChecked)
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Status).To(Equal(test.wantStatus))
+			Expect(condition.Reason).To(Equal(test.wantReason))
+		})
+	}
+})
@@ -0,0 +1,190 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/jenkinsci/jenkins-automation-operator/api/v1alpha2"
+	"github.com/jenkinsci/jenkins-automation-operator/pkg/configuration/base/resources"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/operator-framework/operator-lib/status"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// +kubebuilder:docs-gen:collapse=Imports
+
+const (
+	resumeTimeout  = time.Second * 30
+	resumeInterval = time.Millisecond * 250
+)
+
+var _ = Describe("Backup and Restore resumption", func() {
+	ctx := context.Background()
+
+	It("Check Prerequisites", func() {
+		CreateNamespaceIfNotPresent(ctx, JenkinsTestNamespace)
+	})
+
+	Context("When the Operator restarts during a Backup", func() {
+		It("Completed Backup Should Be Left Untouched", func() {
+			backup := createBackupWithStatus(ctx, "resume-completed", func(backupStatus *v1alpha2.BackupStatus) {
+				backupStatus.Phase = v1alpha2.BackupSucceeded
+				backupStatus.Step = v1alpha2.BackupStepPostBackupHooks
+			})
+			Consistently(func() v1alpha2.BackupPhase {
+				return getBackupStatus(ctx, backup).Phase
+			}, time.Second*2, resumeInterval).Should(Equal(v1alpha2.BackupSucceeded))
+		})
+
+		It("Backup Created Before The Phases Should Be Left Untouched", func() {
+			backup := createBackupWithStatus(ctx, "resume-legacy", func(backupStatus *v1alpha2.BackupStatus) {
+				backupStatus.Phase = ""
+				backupStatus.Conditions.SetCondition(status.Condition{Type: BackupCompleted, Status: corev1.ConditionTrue})
+			})
+			Consistently(func() v1alpha2.BackupPhase {
+				return getBackupStatus(ctx, backup).Phase
+			}, time.Second*2, resumeInterval).Should(BeEmpty())
+		})
+
+		It("Running Backup Without Its BackupStrategy Should Fail", func() {
+			backup := createBackupWithStatus(ctx, "resume-running", func(backupStatus *v1alpha2.BackupStatus) {
+				backupStatus.Phase = v1alpha2.BackupRunning
+				backupStatus.Step = v1alpha2.BackupStepBackup
+			})
+			Eventually(func() v1alpha2.BackupPhase {
+				return getBackupStatus(ctx, backup).Phase
+			}, resumeTimeout, resumeInterval).Should(Equal(v1alpha2.BackupFailed))
+			condition := getBackupStatus(ctx, backup).Conditions.GetCondition(BackupCompleted)
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Reason).To(Equal(BackupInterrupted))
+		})
+	})
+
+	Context("When the Operator restarts during a Backup of a running Jenkins", func() {
+		jenkins := GetJenkinsTestInstance("resume", JenkinsTestNamespace)
+		jenkins.Spec.BackupVolumes = nil
+
+		It("Running Backup Should Resume At Its Step And Succeed", func() {
+			CreateBackupStrategy(ctx, "resume", JenkinsTestNamespace)
+			Expect(k8sClient.Create(ctx, jenkins)).Should(Succeed())
+			replicaSet := createJenkinsReplicaSet(ctx, jenkins)
+			// The Backup waits for the Jenkins Pod, which is created once the Backup is marked as interrupted
+			backup := &v1alpha2.Backup{
+				ObjectMeta: metav1.ObjectMeta{Name: "resume-middle-step", Namespace: JenkinsTestNamespace},
+				Spec:       v1alpha2.BackupSpec{StrategyRef: "resume", JenkinsRef: jenkins.Name, BackupVolumeRef: "test"},
+			}
+			Expect(k8sClient.Create(ctx, backup)).Should(Succeed())
+			Eventually(func() v1alpha2.BackupPhase {
+				return getBackupStatus(ctx, backup).Phase
+			}, resumeTimeout, resumeInterval).Should(Equal(v1alpha2.BackupPending))
+			Eventually(func() error {
+				current := &v1alpha2.Backup{}
+				err := k8sClient.Get(ctx, types.NamespacedName{Name: backup.Name, Namespace: backup.Namespace}, current)
+				if err != nil {
+					return err
+				}
+				startTime := metav1.Now()
+				current.Status.Phase = v1alpha2.BackupRunning
+				current.Status.Step = v1alpha2.BackupStepPostBackupHooks
+				current.Status.StartTime = &startTime
+				return k8sClient.Status().Update(ctx, current)
+			}, resumeTimeout, resumeInterval).Should(Succeed())
+			createJenkinsPod(ctx, replicaSet)
+
+			Eventually(func() v1alpha2.BackupPhase {
+				return getBackupStatus(ctx, backup).Phase
+			}, resumeTimeout, resumeInterval).Should(Equal(v1alpha2.BackupSucceeded))
+			backupStatus := getBackupStatus(ctx, backup)
+			Expect(backupStatus.Step).To(Equal(v1alpha2.BackupStepReplicate))
+			Expect(backupStatus.Conditions.IsTrueFor(BackupCompleted)).To(BeTrue())
+			// The steps before the one the Backup resumed at are not run again, Jenkins was not quieted down
+			Expect(backupStatus.Conditions.GetCondition(QuietDownStarted)).To(BeNil())
+		})
+	})
+
+	Context("When the Operator restarts during a Restore", func() {
+		It("Running Restore Without Its Backup Should Fail", func() {
+			restore := &v1alpha2.Restore{
+				ObjectMeta: metav1.ObjectMeta{Name: "resume-running", Namespace: JenkinsTestNamespace},
+				Spec:       v1alpha2.RestoreSpec{BackupRef: "missing", JenkinsRef: "missing"},
+			}
+			Expect(k8sClient.Create(ctx, restore)).Should(Succeed())
+			Eventually(func() error {
+				current := &v1alpha2.Restore{}
+				err := k8sClient.Get(ctx, types.NamespacedName{Name: restore.Name, Namespace: restore.Namespace}, current)
+				if err != nil {
+					return err
+				}
+				current.Status.Phase = v1alpha2.RestoreRunning
+				current.Status.Step = v1alpha2.RestoreStepRestore
+				return k8sClient.Status().Update(ctx, current)
+			}, resumeTimeout, resumeInterval).Should(Succeed())
+			Eventually(func() v1alpha2.RestorePhase {
+				current := &v1alpha2.Restore{}
+				_ = k8sClient.Get(ctx, types.NamespacedName{Name: restore.Name, Namespace: restore.Namespace}, current)
+				return current.Status.Phase
+			}, resumeTimeout, resumeInterval).Should(Equal(v1alpha2.RestoreFailed))
+		})
+	})
+})
+
+// createBackupWithStatus creates a Backup referencing a missing BackupStrategy, then sets its status as if the Operator
+// had been restarted while handling it
+func createBackupWithStatus(ctx context.Context, name string, setStatus func(*v1alpha2.BackupStatus)) *v1alpha2.Backup {
+	backup := &v1alpha2.Backup{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: JenkinsTestNamespace},
+		Spec:       v1alpha2.BackupSpec{StrategyRef: "missing", JenkinsRef: "missing", BackupVolumeRef: "missing"},
+	}
+	Expect(k8sClient.Create(ctx, backup)).Should(Succeed())
+	Eventually(func() error {
+		current := &v1alpha2.Backup{}
+		err := k8sClient.Get(ctx, types.NamespacedName{Name: backup.Name, Namespace: backup.Namespace}, current)
+		if err != nil {
+			return err
+		}
+		setStatus(&current.Status)
+		return k8sClient.Status().Update(ctx, current)
+	}, resumeTimeout, resumeInterval).Should(Succeed())
+	return backup
+}
+
+// getBackupStatus returns the current status of the Backup
+func getBackupStatus(ctx context.Context, backup *v1alpha2.Backup) v1alpha2.BackupStatus {
+	current := &v1alpha2.Backup{}
+	Expect(k8sClient.Get(ctx, types.NamespacedName{Name: backup.Name, Namespace: backup.Namespace}, current)).Should(Succeed())
+	return current.Status
+}
+
+// createJenkinsReplicaSet creates the ReplicaSet of the Deployment of the Jenkins, no controller creates it in the
+// test environment
+func createJenkinsReplicaSet(ctx context.Context, jenkins *v1alpha2.Jenkins) *appsv1.ReplicaSet {
+	deployment := &appsv1.Deployment{}
+	Eventually(func() error {
+		key := types.NamespacedName{Name: resources.GetJenkinsDeploymentName(jenkins), Namespace: jenkins.Namespace}
+		return k8sClient.Get(ctx, key, deployment)
+	}, timeout, interval).Should(Succeed())
+	replicaSet := &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{Name: deployment.Name + "-1", Namespace: deployment.Namespace, Labels: deployment.Spec.Selector.MatchLabels},
+		Spec: appsv1.ReplicaSetSpec{
+			Selector: deployment.Spec.Selector,
+			Template: deployment.Spec.Template,
+		},
+	}
+	Expect(k8sClient.Create(ctx, replicaSet)).Should(Succeed())
+	return replicaSet
+}
+
+// createJenkinsPod creates the Jenkins Pod selected by the ReplicaSet, it doesn't run in the test environment
+func createJenkinsPod(ctx context.Context, replicaSet *appsv1.ReplicaSet) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: replicaSet.Name + "-pod", Namespace: replicaSet.Namespace, Labels: replicaSet.Spec.Selector.MatchLabels},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: resources.JenkinsMasterContainerName, Image: "jenkins/jenkins:lts"}},
+		},
+	}
+	Expect(k8sClient.Create(ctx, pod)).Should(Succeed())
+}
@@ -17,7 +17,9 @@ limitations under the License.
 package controllers
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"testing"
@@ -26,11 +28,13 @@ import (
 
 	"github.com/jenkinsci/jenkins-automation-operator/pkg/constants"
 	"github.com/jenkinsci/jenkins-automation-operator/pkg/event"
+	"github.com/jenkinsci/jenkins-automation-operator/pkg/exec"
 	"github.com/jenkinsci/jenkins-automation-operator/pkg/notifications"
 	e "github.com/jenkinsci/jenkins-automation-operator/pkg/notifications/event"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -93,6 +97,7 @@ var _ = BeforeSuite(func(done Done) {
 	registerJenkinsRestoreController(manager)
 	registerJenkinsBackupController(manager)
 	registerJenkinsBackupVolumeController(manager)
+	registerJenkinsBackupScheduleController(manager)
 	registerJenkinsImageController(manager)
 	registerJenkinsController(manager, restConfig)
 
@@ -113,9 +118,12 @@ var _ = BeforeSuite(func(done Done) {
 
 func registerJenkinsRestoreController(manager manager.Manager) {
 	controller := &RestoreReconciler{
-		Client: manager.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("Restore"),
-		Scheme: manager.GetScheme(),
+		Client:             manager.GetClient(),
+		Log:                ctrl.Log.WithName("controllers").WithName("Restore"),
+		Scheme:             manager.GetScheme(),
+		NotificationEvents: newDiscardedNotificationEvents(),
+		RESTMapper:         manager.GetRESTMapper(),
+		NewExecClient:      newTestExecClient,
 	}
 	err := controller.SetupWithManager(manager)
 	Expect(err).ToNot(HaveOccurred())
@@ -123,9 +131,12 @@ func registerJenkinsRestoreController(manager manager.Manager) {
 
 func registerJenkinsBackupController(manager manager.Manager) {
 	controller := &BackupReconciler{
-		Client: manager.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("Backup"),
-		Scheme: manager.GetScheme(),
+		Client:             manager.GetClient(),
+		Log:                ctrl.Log.WithName("controllers").WithName("Backup"),
+		Scheme:             manager.GetScheme(),
+		NotificationEvents: newDiscardedNotificationEvents(),
+		RESTMapper:         manager.GetRESTMapper(),
+		NewExecClient:      newTestExecClient,
 	}
 	err := controller.SetupWithManager(manager)
 	Expect(err).ToNot(HaveOccurred())
@@ -141,6 +152,16 @@ func registerJenkinsBackupVolumeController(manager manager.Manager) {
 	Expect(err).ToNot(HaveOccurred())
 }
 
+func registerJenkinsBackupScheduleController(manager manager.Manager) {
+	controller := &BackupScheduleReconciler{
+		Client: manager.GetClient(),
+		Log:    ctrl.Log.WithName("controllers").WithName("BackupSchedule"),
+		Scheme: manager.GetScheme(),
+	}
+	err := controller.SetupWithManager(manager)
+	Expect(err).ToNot(HaveOccurred())
+}
+
 func registerJenkinsImageController(manager manager.Manager) {
 	controller := &JenkinsImageReconciler{
 		Client: manager.GetClient(),
@@ -166,6 +187,36 @@ func registerJenkinsController(manager manager.Manager, c *rest.Config) {
 	Expect(err).ToNot(HaveOccurred())
 }
 
+// newDiscardedNotificationEvents returns a channel of notifications which are dropped, the Backup and Restore
+// controllers block until their notifications are read
+func newDiscardedNotificationEvents() chan e.Event {
+	events := make(chan e.Event)
+	go func() {
+		for range events {
+		}
+	}()
+	return events
+}
+
+// testExecClient stands for the backup sidecar, no container runs in the test environment
+type testExecClient struct{}
+
+func newTestExecClient() exec.KubeExecClient {
+	return &testExecClient{}
+}
+
+func (c *testExecClient) InitKubeGoClient() error {
+	return nil
+}
+
+func (c *testExecClient) MakeRequest(context.Context, *corev1.Pod, string, string) error {
+	return errors.New("no backup sidecar in the test environment")
+}
+
+func (c *testExecClient) StreamRequest(context.Context, *corev1.Pod, string, string, io.Reader, io.Writer) error {
+	return errors.New("no backup sidecar in the test environment")
+}
+
 var _ = AfterSuite(func() {
 	By("tearing down the test environment")
 	err := testEnv.Stop()
@@ -0,0 +1,465 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jenkinsci/jenkins-automation-operator/api/v1alpha2"
+	"github.com/jenkinsci/jenkins-automation-operator/pkg/constants"
+	"github.com/operator-framework/operator-lib/status"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// VolumeSnapshotFailed is the reason of the BackupCompleted condition when the VolumeSnapshot could not be taken
+	VolumeSnapshotFailed status.ConditionReason = "VolumeSnapshotFailed"
+	// VolumeSnapshotRestoreFailed is the reason of the RestoreCompleted condition when the Jenkins Home could not be
+	// provisioned from the VolumeSnapshot
+	VolumeSnapshotRestoreFailed status.ConditionReason = "VolumeSnapshotRestoreFailed"
+
+	defaultVolumeSnapshotTimeout = 10 * time.Minute
+	volumeSnapshotPollInterval   = 5 * time.Second
+	// jenkinsHomeReplaceTimeout is how long the Jenkins Pod is waited for to stop, then to be ready again, while the
+	// PersistentVolumeClaim of its Jenkins Home is replaced
+	jenkinsHomeReplaceTimeout = 10 * time.Minute
+)
+
+var (
+	// volumeSnapshotGroupKind is the kind of the CSI VolumeSnapshots, whose API is not vendored, they are handled as
+	// unstructured objects in the version served by the cluster
+	volumeSnapshotGroupKind = schema.GroupKind{Group: "snapshot.storage.k8s.io", Kind: "VolumeSnapshot"}
+	// volumeSnapshotVersions are the versions of the VolumeSnapshot API supported by the Operator, by order of preference
+	volumeSnapshotVersions = []string{"v1", "v1beta1"}
+)
+
+// getVolumeSnapshotGVK returns the kind of the VolumeSnapshots in the preferred version served by the cluster
+func getVolumeSnapshotGVK(mapper meta.RESTMapper) (schema.GroupVersionKind, error) {
+	mapping, err := mapper.RESTMapping(volumeSnapshotGroupKind, volumeSnapshotVersions...)
+	if err != nil {
+		return schema.GroupVersionKind{}, fmt.Errorf("the %s API is not served in version %s: %s",
+			volumeSnapshotGroupKind.Group, strings.Join(volumeSnapshotVersions, " or "), err)
+	}
+	return mapping.GroupVersionKind, nil
+}
+
+// getJenkinsHomePVCName returns the name of the PersistentVolumeClaim of the Jenkins Home, see GetJenkinsMasterPodBaseVolumes
+func getJenkinsHomePVCName(jenkins *v1alpha2.Jenkins) string {
+	return jenkins.Name
+}
+
+// getVolumeSnapshotTimeout returns how long a VolumeSnapshot is waited for to be ready to use
+func getVolumeSnapshotTimeout(config *v1alpha2.VolumeSnapshotConfig) time.Duration {
+	if config != nil && config.Timeout != nil {
+		return config.Timeout.Duration
+	}
+	return defaultVolumeSnapshotTimeout
+}
+
+// newVolumeSnapshot returns a VolumeSnapshot of the PersistentVolumeClaim of the Jenkins Home
+func newVolumeSnapshot(gvk schema.GroupVersionKind, name string, jenkins *v1alpha2.Jenkins, config *v1alpha2.VolumeSnapshotConfig) *unstructured.Unstructured {
+	snapshot := &unstructured.Unstructured{}
+	snapshot.SetGroupVersionKind(gvk)
+	snapshot.SetName(name)
+	snapshot.SetNamespace(jenkins.Namespace)
+	snapshot.SetLabels(map[string]string{constants.LabelJenkinsCRKey: jenkins.Name})
+	spec := map[string]interface{}{
+		"source": map[string]interface{}{"persistentVolumeClaimName": getJenkinsHomePVCName(jenkins)},
+	}
+	if config != nil && len(config.VolumeSnapshotClassName) > 0 {
+		spec["volumeSnapshotClassName"] = config.VolumeSnapshotClassName
+	}
+	snapshot.Object["spec"] = spec
+	return snapshot
+}
+
+// createVolumeSnapshot creates the VolumeSnapshot unless it already exists
+func createVolumeSnapshot(ctx context.Context, c client.Client, snapshot *unstructured.Unstructured) error {
+	err := c.Create(ctx, snapshot)
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
+
+// waitForVolumeSnapshot polls the VolumeSnapshot until it is ready to use and returns its restore size in bytes,
+// it returns an error as soon as the snapshot controller reports one
+func waitForVolumeSnapshot(ctx context.Context, c client.Client, gvk schema.GroupVersionKind, namespace, name string, interval, timeout time.Duration) (int64, error) {
+	var restoreSize int64
+	err := pollImmediate(ctx, interval, timeout, func() (bool, error) {
+		snapshot := &unstructured.Unstructured{}
+		snapshot.SetGroupVersionKind(gvk)
+		err := c.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, snapshot)
+		if err != nil {
+			return false, err
+		}
+		if message, _, _ := unstructured.NestedString(snapshot.Object, "status", "error", "message"); len(message) > 0 {
+			return false, fmt.Errorf("VolumeSnapshot '%s' failed: %s", name, message)
+		}
+		if ready, _, _ := unstructured.NestedBool(snapshot.Object, "status", "readyToUse"); !ready {
+			return false, nil
+		}
+		if size, found, _ := unstructured.NestedString(snapshot.Object, "status", "restoreSize"); found {
+			quantity, err := resource.ParseQuantity(size)
+			if err != nil {
+				return false, fmt.Errorf("VolumeSnapshot '%s' has an invalid restore size: %s", name, err)
+			}
+			restoreSize = quantity.Value()
+		}
+		return true, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return 0, fmt.Errorf("VolumeSnapshot '%s' is not ready to use after %s", name, timeout)
+	}
+	return restoreSize, err
+}
+
+// deleteVolumeSnapshot deletes the VolumeSnapshot, a missing VolumeSnapshot is not an error
+func deleteVolumeSnapshot(ctx context.Context, c client.Client, gvk schema.GroupVersionKind, namespace, name string) error {
+	snapshot := &unstructured.Unstructured{}
+	snapshot.SetGroupVersionKind(gvk)
+	snapshot.SetName(name)
+	snapshot.SetNamespace(namespace)
+	err := c.Delete(ctx, snapshot)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// performJenkinsVolumeSnapshot backs up the Jenkins Home with a VolumeSnapshot of its PersistentVolumeClaim
+func (r *BackupReconciler) performJenkinsVolumeSnapshot(ctx context.Context, jenkinsInstance *v1alpha2.Jenkins, backupInstance *v1alpha2.Backup, backupStrategy *v1alpha2.BackupStrategy) error {
+	err := r.createJenkinsVolumeSnapshot(ctx, jenkinsInstance, backupInstance, backupStrategy)
+	if err != nil {
+		err = fmt.Errorf("failed to take VolumeSnapshot: %s", err)
+		backupInstance.Status.Conditions.SetCondition(status.Condition{
+			Type:    BackupCompleted,
+			Status:  corev1.ConditionFalse,
+			Reason:  VolumeSnapshotFailed,
+			Message: err.Error(),
+		})
+		updateErr := r.Client.Status().Update(ctx, backupInstance)
+		if updateErr != nil {
+			return updateErr
+		}
+		return err
+	}
+	return nil
+}
+
+// createJenkinsVolumeSnapshot creates the VolumeSnapshot of the Backup, named after it, and waits until it is ready to use
+func (r *BackupReconciler) createJenkinsVolumeSnapshot(ctx context.Context, jenkinsInstance *v1alpha2.Jenkins, backupInstance *v1alpha2.Backup, backupStrategy *v1alpha2.BackupStrategy) error {
+	if !jenkinsInstance.Spec.PersistentSpec.Enabled {
+		return fmt.Errorf("the Jenkins Home of Jenkins '%s' is not persistent", jenkinsInstance.Name)
+	}
+	gvk, err := getVolumeSnapshotGVK(r.RESTMapper)
+	if err != nil {
+		return err
+	}
+	snapshot := newVolumeSnapshot(gvk, backupInstance.Name, jenkinsInstance, backupStrategy.Spec.VolumeSnapshot)
+	err = createVolumeSnapshot(ctx, r.Client, snapshot)
+	if err != nil {
+		return err
+	}
+	// The VolumeSnapshot is recorded before it is ready so that it is deleted along with the Backup
+	backupInstance.Status.VolumeSnapshot = snapshot.GetName()
+	err = r.Client.Status().Update(ctx, backupInstance)
+	if err != nil {
+		return err
+	}
+	restoreSize, err := waitForVolumeSnapshot(ctx, r.Client, gvk, snapshot.GetNamespace(), snapshot.GetName(),
+		volumeSnapshotPollInterval, getVolumeSnapshotTimeout(backupStrategy.Spec.VolumeSnapshot))
+	if err != nil {
+		return err
+	}
+	backupInstance.Status.Size = restoreSize
+	return nil
+}
+
+// getRestoreSafetySnapshotName returns the name of the VolumeSnapshot of the Jenkins Home taken before it is replaced
+// by the Restore
+func getRestoreSafetySnapshotName(restore *v1alpha2.Restore) string {
+	return restore.Name + "-safety"
+}
+
+// performVolumeSnapshotRestore replaces the Jenkins Home with a PersistentVolumeClaim provisioned from the
+// VolumeSnapshot of the Backup. The Jenkins Home is snapshotted first and put back if the Restore fails.
+func (r *RestoreReconciler) performVolumeSnapshotRestore(ctx context.Context, jenkinsInstance *v1alpha2.Jenkins, backupInstance *v1alpha2.Backup, backupStrategy *v1alpha2.BackupStrategy, restoreInstance *v1alpha2.Restore) error {
+	if backupInstance.Namespace != jenkinsInstance.Namespace || !jenkinsInstance.Spec.PersistentSpec.Enabled {
+		err := fmt.Errorf("backup '%s' is a VolumeSnapshot and can only be restored in a Jenkins with a persistent Jenkins Home of namespace '%s'", backupInstance.Name, backupInstance.Namespace)
+		restoreInstance.Status.Conditions.SetCondition(status.Condition{
+			Type:    RestoreCompleted,
+			Status:  corev1.ConditionFalse,
+			Reason:  InvalidRestoreTarget,
+			Message: err.Error(),
+		})
+		updateErr := r.Client.Status().Update(ctx, restoreInstance)
+		if updateErr != nil {
+			return updateErr
+		}
+		return err
+	}
+
+	gvk, err := getVolumeSnapshotGVK(r.RESTMapper)
+	safetySnapshot := newVolumeSnapshot(gvk, getRestoreSafetySnapshotName(restoreInstance), jenkinsInstance, backupStrategy.Spec.VolumeSnapshot)
+	if err == nil {
+		err = createVolumeSnapshot(ctx, r.Client, safetySnapshot)
+	}
+	if err == nil {
+		_, err = waitForVolumeSnapshot(ctx, r.Client, gvk, safetySnapshot.GetNamespace(), safetySnapshot.GetName(),
+			volumeSnapshotPollInterval, getVolumeSnapshotTimeout(backupStrategy.Spec.VolumeSnapshot))
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to take snapshot: %s", err)
+		restoreInstance.Status.Conditions.SetCondition(status.Condition{
+			Type:    SnapshotTaken,
+			Status:  corev1.ConditionFalse,
+			Reason:  SnapshotFailed,
+			Message: err.Error(),
+		})
+		updateErr := r.Client.Status().Update(ctx, restoreInstance)
+		if updateErr != nil {
+			return updateErr
+		}
+		return err
+	}
+	restoreInstance.Status.Conditions.SetCondition(status.Condition{
+		Type:    SnapshotTaken,
+		Status:  corev1.ConditionTrue,
+		Message: fmt.Sprintf("VolumeSnapshot '%s' taken", safetySnapshot.GetName()),
+	})
+	err = r.Client.Status().Update(ctx, restoreInstance)
+	if err != nil {
+		return err
+	}
+
+	err = r.replaceJenkinsHome(ctx, jenkinsInstance, backupInstance.Status.VolumeSnapshot, backupInstance.Status.Size)
+	if err != nil {
+		err = fmt.Errorf("failed to restore from VolumeSnapshot '%s': %s", backupInstance.Status.VolumeSnapshot, err)
+		restoreInstance.Status.Conditions.SetCondition(status.Condition{
+			Type:    RestoreCompleted,
+			Status:  corev1.ConditionFalse,
+			Reason:  VolumeSnapshotRestoreFailed,
+			Message: err.Error(),
+		})
+		// The safety VolumeSnapshot is kept, the Jenkins Home can be provisioned from it manually if the rollback fails
+		rollbackErr := r.replaceJenkinsHome(ctx, jenkinsInstance, safetySnapshot.GetName(), 0)
+		if rollbackErr != nil {
+			restoreInstance.Status.Conditions.SetCondition(status.Condition{
+				Type:    RolledBack,
+				Status:  corev1.ConditionFalse,
+				Reason:  RollbackFailed,
+				Message: rollbackErr.Error(),
+			})
+			err = fmt.Errorf("%s, rollback failed: %s", err, rollbackErr)
+		} else {
+			restoreInstance.Status.Conditions.SetCondition(status.Condition{
+				Type:    RolledBack,
+				Status:  corev1.ConditionTrue,
+				Message: fmt.Sprintf("Jenkins Home provisioned from VolumeSnapshot '%s'", safetySnapshot.GetName()),
+			})
+			err = fmt.Errorf("%s, rolled back to the snapshot", err)
+		}
+		updateErr := r.Client.Status().Update(ctx, restoreInstance)
+		if updateErr != nil {
+			return updateErr
+		}
+		return err
+	}
+	restoreInstance.Status.Conditions.SetCondition(status.Condition{
+		Type:   RestoreCompleted,
+		Status: corev1.ConditionTrue,
+	})
+	// Jenkins was restarted with the restored Jenkins Home and its Pod is ready
+	restoreInstance.Status.Conditions.SetCondition(status.Condition{
+		Type:   JenkinsHealthy,
+		Status: corev1.ConditionTrue,
+	})
+	restoreInstance.Status.Size = backupInstance.Status.Size
+	err = r.Client.Status().Update(ctx, restoreInstance)
+	if err != nil {
+		return err
+	}
+	err = deleteVolumeSnapshot(ctx, r.Client, gvk, safetySnapshot.GetNamespace(), safetySnapshot.GetName())
+	if err != nil {
+		restoreLogger.Info(fmt.Sprintf("Failed to delete VolumeSnapshot '%s': %s", safetySnapshot.GetName(), err))
+	}
+	return nil
+}
+
+// replaceJenkinsHome stops Jenkins, replaces the PersistentVolumeClaim of its Jenkins Home with one provisioned from
+// the VolumeSnapshot, then starts Jenkins again and waits for its Pod to be ready
+func (r *RestoreReconciler) replaceJenkinsHome(ctx context.Context, jenkinsInstance *v1alpha2.Jenkins, snapshotName string, size int64) error {
+	deployment, err := r.GetJenkinsDeployment(jenkinsInstance)
+	if err != nil {
+		return err
+	}
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil && *deployment.Spec.Replicas > 0 {
+		replicas = *deployment.Spec.Replicas
+	}
+	err = scaleDeployment(ctx, r.Client, deployment, 0)
+	if err != nil {
+		return err
+	}
+	err = waitForDeploymentPods(ctx, r.Client, deployment, false, volumeSnapshotPollInterval, jenkinsHomeReplaceTimeout)
+	if err == nil {
+		err = replaceJenkinsHomePVC(ctx, r.Client, jenkinsInstance, snapshotName, size, volumeSnapshotPollInterval, jenkinsHomeReplaceTimeout)
+	}
+	// Jenkins is started again even if its Jenkins Home could not be replaced
+	scaleErr := scaleDeployment(ctx, r.Client, deployment, replicas)
+	if err != nil {
+		return err
+	}
+	if scaleErr != nil {
+		return scaleErr
+	}
+	return waitForDeploymentPods(ctx, r.Client, deployment, true, volumeSnapshotPollInterval, jenkinsHomeReplaceTimeout)
+}
+
+// scaleDeployment sets the number of replicas of the Deployment
+func scaleDeployment(ctx context.Context, c client.Client, deployment *appsv1.Deployment, replicas int32) error {
+	current := &appsv1.Deployment{}
+	err := c.Get(ctx, types.NamespacedName{Name: deployment.Name, Namespace: deployment.Namespace}, current)
+	if err != nil {
+		return err
+	}
+	current.Spec.Replicas = &replicas
+	return c.Update(ctx, current)
+}
+
+// waitForDeploymentPods polls the Pods of the Deployment until one of them is ready when ready is true, or until
+// they are all gone otherwise
+func waitForDeploymentPods(ctx context.Context, c client.Client, deployment *appsv1.Deployment, ready bool, interval, timeout time.Duration) error {
+	selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+	if err != nil {
+		return err
+	}
+	err = pollImmediate(ctx, interval, timeout, func() (bool, error) {
+		pods := &corev1.PodList{}
+		err := c.List(ctx, pods, client.InNamespace(deployment.Namespace), client.MatchingLabelsSelector{Selector: selector})
+		if err != nil {
+			return false, err
+		}
+		if !ready {
+			return len(pods.Items) == 0, nil
+		}
+		for _, pod := range pods.Items {
+			if pod.DeletionTimestamp == nil && isPodReady(&pod) {
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	if err != wait.ErrWaitTimeout {
+		return err
+	}
+	if ready {
+		return fmt.Errorf("no Pod of Deployment '%s' is ready after %s", deployment.Name, timeout)
+	}
+	return fmt.Errorf("pods of Deployment '%s' are still running after %s", deployment.Name, timeout)
+}
+
+// isPodReady returns true if the Pod has the Ready condition
+func isPodReady(pod *corev1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// replaceJenkinsHomePVC deletes the PersistentVolumeClaim of the Jenkins Home and creates it again, provisioned from
+// the VolumeSnapshot. An empty claim created meanwhile by the Jenkins controller is deleted as well. A claim already
+// provisioned from the VolumeSnapshot is kept, when a resumed Restore replaces the Jenkins Home again.
+func replaceJenkinsHomePVC(ctx context.Context, c client.Client, jenkins *v1alpha2.Jenkins, snapshotName string, size int64, interval, timeout time.Duration) error {
+	name := types.NamespacedName{Name: getJenkinsHomePVCName(jenkins), Namespace: jenkins.Namespace}
+	current := &corev1.PersistentVolumeClaim{}
+	// The claim is missing if a Restore was interrupted while replacing it, until the Jenkins controller creates it again
+	err := pollImmediate(ctx, interval, timeout, func() (bool, error) {
+		err := c.Get(ctx, name, current)
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return err == nil, err
+	})
+	if err == wait.ErrWaitTimeout {
+		return fmt.Errorf("PersistentVolumeClaim '%s' was not found within %s", name.Name, timeout)
+	}
+	if err != nil {
+		return err
+	}
+	if current.DeletionTimestamp == nil && current.Spec.DataSource != nil && current.Spec.DataSource.Name == snapshotName {
+		return nil
+	}
+	pvc := newJenkinsHomePVC(current, snapshotName, size)
+	created := false
+	err = pollImmediate(ctx, interval, timeout, func() (bool, error) {
+		current := &corev1.PersistentVolumeClaim{}
+		err := c.Get(ctx, name, current)
+		if apierrors.IsNotFound(err) {
+			err = c.Create(ctx, pvc.DeepCopy())
+			if apierrors.IsAlreadyExists(err) {
+				return false, nil
+			}
+			created = err == nil
+			return created, err
+		}
+		if err != nil {
+			return false, err
+		}
+		if current.DeletionTimestamp == nil {
+			err = c.Delete(ctx, current)
+			if err != nil && !apierrors.IsNotFound(err) {
+				return false, err
+			}
+		}
+		return false, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return fmt.Errorf("PersistentVolumeClaim '%s' was not replaced within %s", name.Name, timeout)
+	}
+	return err
+}
+
+// newJenkinsHomePVC returns a copy of the PersistentVolumeClaim of the Jenkins Home provisioned from the VolumeSnapshot,
+// its requested storage is raised to the size of the VolumeSnapshot if it is smaller
+func newJenkinsHomePVC(current *corev1.PersistentVolumeClaim, snapshotName string, size int64) *corev1.PersistentVolumeClaim {
+	storage := current.Spec.Resources.Requests[corev1.ResourceStorage]
+	if size > storage.Value() {
+		storage = *resource.NewQuantity(size, resource.BinarySI)
+	}
+	apiGroup := volumeSnapshotGroupKind.Group
+	return &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      current.Name,
+			Namespace: current.Namespace,
+			Labels:    current.Labels,
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes:      current.Spec.AccessModes,
+			StorageClassName: current.Spec.StorageClassName,
+			VolumeMode:       current.Spec.VolumeMode,
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: storage},
+			},
+			DataSource: &corev1.TypedLocalObjectReference{
+				APIGroup: &apiGroup,
+				Kind:     volumeSnapshotGroupKind.Kind,
+				Name:     snapshotName,
+			},
+		},
+	}
+}
@@ -0,0 +1,191 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/jenkinsci/jenkins-automation-operator/api/v1alpha2"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// testVolumeSnapshotGVK is the kind of the VolumeSnapshots served in the tests
+var testVolumeSnapshotGVK = volumeSnapshotGroupKind.WithVersion("v1")
+
+func newVolumeSnapshotWithStatus(name string, snapshotStatus map[string]interface{}) *unstructured.Unstructured {
+	jenkins := &v1alpha2.Jenkins{ObjectMeta: metav1.ObjectMeta{Name: "jenkins", Namespace: "jenkins"}}
+	snapshot := newVolumeSnapshot(testVolumeSnapshotGVK, name, jenkins, nil)
+	if snapshotStatus != nil {
+		snapshot.Object["status"] = snapshotStatus
+	}
+	return snapshot
+}
+
+var _ = Describe("VolumeSnapshot", func() {
+	It("Should Snapshot The Jenkins Home PVC", func() {
+		jenkins := &v1alpha2.Jenkins{ObjectMeta: metav1.ObjectMeta{Name: "jenkins", Namespace: "jenkins"}}
+
+		snapshot := newVolumeSnapshot(testVolumeSnapshotGVK, "backup", jenkins, &v1alpha2.VolumeSnapshotConfig{VolumeSnapshotClassName: "csi-snapclass"})
+
+		Expect(snapshot.GetAPIVersion()).To(Equal("snapshot.storage.k8s.io/v1"))
+		Expect(snapshot.GetKind()).To(Equal("VolumeSnapshot"))
+		Expect(snapshot.Object["spec"]).To(Equal(map[string]interface{}{
+			"source":                  map[string]interface{}{"persistentVolumeClaimName": "jenkins"},
+			"volumeSnapshotClassName": "csi-snapclass",
+		}))
+	})
+})
+
+// newVolumeSnapshotMapper returns a RESTMapper serving the versions of the VolumeSnapshot API
+func newVolumeSnapshotMapper(versions ...string) meta.RESTMapper {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	for _, version := range versions {
+		mapper.Add(volumeSnapshotGroupKind.WithVersion(version), meta.RESTScopeNamespace)
+	}
+	return mapper
+}
+
+var _ = Describe("VolumeSnapshot API version", func() {
+	It("Should Prefer v1", func() {
+		gvk, err := getVolumeSnapshotGVK(newVolumeSnapshotMapper("v1beta1", "v1"))
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(gvk.Version).To(Equal("v1"))
+	})
+
+	It("Should Fall Back To v1beta1", func() {
+		gvk, err := getVolumeSnapshotGVK(newVolumeSnapshotMapper("v1beta1"))
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(gvk.Version).To(Equal("v1beta1"))
+	})
+
+	It("Should Fail When The API Is Not Served", func() {
+		_, err := getVolumeSnapshotGVK(newVolumeSnapshotMapper())
+
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("VolumeSnapshot wait", func() {
+	ctx := context.Background()
+
+	It("Should Return The Restore Size Once Ready To Use", func() {
+		snapshot := newVolumeSnapshotWithStatus("backup", map[string]interface{}{"readyToUse": true, "restoreSize": "2Gi"})
+		c := fake.NewFakeClientWithScheme(scheme.Scheme, snapshot)
+
+		size, err := waitForVolumeSnapshot(ctx, c, testVolumeSnapshotGVK, "jenkins", "backup", time.Millisecond, time.Minute)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(size).To(Equal(int64(2 * 1024 * 1024 * 1024)))
+	})
+
+	It("Should Fail When The VolumeSnapshot Failed", func() {
+		snapshot := newVolumeSnapshotWithStatus("backup", map[string]interface{}{
+			"readyToUse": false,
+			"error":      map[string]interface{}{"message": "driver does not support snapshots"},
+		})
+		c := fake.NewFakeClientWithScheme(scheme.Scheme, snapshot)
+
+		_, err := waitForVolumeSnapshot(ctx, c, testVolumeSnapshotGVK, "jenkins", "backup", time.Millisecond, time.Minute)
+
+		Expect(err).To(MatchError("VolumeSnapshot 'backup' failed: driver does not support snapshots"))
+	})
+
+	It("Should Fail When The VolumeSnapshot Is Not Ready In Time", func() {
+		c := fake.NewFakeClientWithScheme(scheme.Scheme, newVolumeSnapshotWithStatus("backup", nil))
+
+		_, err := waitForVolumeSnapshot(ctx, c, testVolumeSnapshotGVK, "jenkins", "backup", time.Millisecond, 10*time.Millisecond)
+
+		Expect(err).To(MatchError("VolumeSnapshot 'backup' is not ready to use after 10ms"))
+	})
+})
+
+var _ = Describe("Deployment Pods wait", func() {
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "jenkins", Namespace: "jenkins"},
+		Spec:       appsv1.DeploymentSpec{Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "jenkins"}}},
+	}
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "jenkins", Namespace: "jenkins", Labels: map[string]string{"app": "jenkins"}}}
+
+	It("Should Succeed Once The Pods Are Ready", func() {
+		pod := pod.DeepCopy()
+		pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+		c := fake.NewFakeClientWithScheme(scheme.Scheme, pod)
+
+		err := waitForDeploymentPods(context.Background(), c, deployment, true, time.Millisecond, time.Minute)
+
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("Should Stop Once The Context Is Done", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		c := fake.NewFakeClientWithScheme(scheme.Scheme, pod)
+
+		err := waitForDeploymentPods(ctx, c, deployment, false, time.Millisecond, time.Minute)
+
+		Expect(err).To(Equal(context.Canceled))
+	})
+})
+
+var _ = Describe("Jenkins home PVC replacement", func() {
+	ctx := context.Background()
+	jenkins := &v1alpha2.Jenkins{ObjectMeta: metav1.ObjectMeta{Name: "jenkins", Namespace: "jenkins"}}
+
+	It("Should Restore The PVC From The VolumeSnapshot", func() {
+		storageClassName := "standard"
+		currentPVC := &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: "jenkins", Namespace: "jenkins"},
+			Spec: corev1.PersistentVolumeClaimSpec{
+				AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+				StorageClassName: &storageClassName,
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("1Gi")},
+				},
+			},
+		}
+		c := fake.NewFakeClientWithScheme(scheme.Scheme, currentPVC)
+
+		err := replaceJenkinsHomePVC(ctx, c, jenkins, "backup", 2*1024*1024*1024, time.Millisecond, time.Minute)
+
+		Expect(err).NotTo(HaveOccurred())
+		pvc := &corev1.PersistentVolumeClaim{}
+		Expect(c.Get(ctx, types.NamespacedName{Name: "jenkins", Namespace: "jenkins"}, pvc)).To(Succeed())
+		Expect(pvc.Spec.DataSource).NotTo(BeNil())
+		Expect(*pvc.Spec.DataSource.APIGroup).To(Equal("snapshot.storage.k8s.io"))
+		Expect(pvc.Spec.DataSource.Kind).To(Equal("VolumeSnapshot"))
+		Expect(pvc.Spec.DataSource.Name).To(Equal("backup"))
+		Expect(pvc.Spec.StorageClassName).To(Equal(&storageClassName))
+		Expect(pvc.Spec.AccessModes).To(Equal([]corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}))
+		storage := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+		Expect(storage.String()).To(Equal("2Gi"))
+	})
+
+	It("Should Keep A PVC Already Restored From The VolumeSnapshot", func() {
+		apiGroup := "snapshot.storage.k8s.io"
+		replacedPVC := &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: "jenkins", Namespace: "jenkins", UID: "replaced"},
+			Spec: corev1.PersistentVolumeClaimSpec{
+				DataSource: &corev1.TypedLocalObjectReference{APIGroup: &apiGroup, Kind: "VolumeSnapshot", Name: "backup"},
+			},
+		}
+		c := fake.NewFakeClientWithScheme(scheme.Scheme, replacedPVC)
+
+		err := replaceJenkinsHomePVC(ctx, c, jenkins, "backup", 0, time.Millisecond, time.Minute)
+
+		Expect(err).NotTo(HaveOccurred())
+		pvc := &corev1.PersistentVolumeClaim{}
+		Expect(c.Get(ctx, types.NamespacedName{Name: "jenkins", Namespace: "jenkins"}, pvc)).To(Succeed())
+		Expect(pvc.UID).To(Equal(types.UID("replaced")))
+	})
+})
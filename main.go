@@ -81,6 +81,15 @@ func init() {
 }
 
 func main() {
+	// The Operator binary also runs the Backups and Restores of the backup Jobs, and the commits of the git export Jobs
+	if len(os.Args) > 1 && os.Args[1] == controllers.BackupJobCommand {
+		ctrl.SetLogger(kzap.New())
+		os.Exit(controllers.RunBackupJob())
+	}
+	if len(os.Args) > 1 && os.Args[1] == controllers.GitExportJobCommand {
+		ctrl.SetLogger(kzap.New())
+		os.Exit(controllers.RunGitExportJob(os.Args[2:]))
+	}
 	var metricsAddr string
 	var enableLeaderElection bool
 	parseFlags(metricsAddr, enableLeaderElection)
@@ -113,6 +122,7 @@ func main() {
 	setupJenkinsBackupRenconciler(manager, notificationsChannel)
 	setupJenkinsRestoreRenconciler(manager, notificationsChannel)
 	setupBackupVolumeRenconciler(manager, notificationsChannel)
+	setupBackupScheduleRenconciler(manager, notificationsChannel)
 	// start the Cmd
 	setupLog.Info("Starting the Cmd.")
 	runMananger(manager)
@@ -267,6 +277,7 @@ func newJenkinsBackupRenconciler(mgr manager.Manager, eventChan chan e.Event) *c
 		Log:                ctrl.Log.WithName("controllers").WithName("Backup"),
 		Scheme:             mgr.GetScheme(),
 		NotificationEvents: eventChan,
+		RESTMapper:         mgr.GetRESTMapper(),
 	}
 }
 
@@ -283,6 +294,7 @@ func newJenkinsRestoreRenconciler(mgr manager.Manager, eventChan chan e.Event) *
 		Log:                ctrl.Log.WithName("controllers").WithName("Restore"),
 		Scheme:             mgr.GetScheme(),
 		NotificationEvents: eventChan,
+		RESTMapper:         mgr.GetRESTMapper(),
 	}
 }
 
@@ -302,6 +314,22 @@ func newBackupVolumeRenconciler(mgr manager.Manager, eventChan chan e.Event) *co
 	}
 }
 
+func setupBackupScheduleRenconciler(mgr manager.Manager, eventChan chan e.Event) {
+	if err := newBackupScheduleRenconciler(mgr, eventChan).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "BackupSchedule")
+		os.Exit(1)
+	}
+}
+
+func newBackupScheduleRenconciler(mgr manager.Manager, eventChan chan e.Event) *controllers.BackupScheduleReconciler {
+	return &controllers.BackupScheduleReconciler{
+		Client:             mgr.GetClient(),
+		Log:                ctrl.Log.WithName("controllers").WithName("BackupSchedule"),
+		Scheme:             mgr.GetScheme(),
+		NotificationEvents: eventChan,
+	}
+}
+
 func fatal(err error, debug bool) {
 	if debug {
 		setupLog.Error(nil, fmt.Sprintf("%+v", err))
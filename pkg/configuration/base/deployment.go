@@ -39,7 +39,7 @@ func (r *JenkinsBaseConfigurationReconciler) ensureJenkinsDeploymentIsPresent(me
 	}
 	if apierrors.IsNotFound(err) {
 		r.logger.Info("Error type is not found: Creating deployment")
-		jenkinsDeployment = resources.NewJenkinsDeployment(meta, jenkins, jenkins.Status.Spec)
+		jenkinsDeployment = resources.NewJenkinsDeployment(meta, jenkins, jenkins.Status.Spec, r.RestoreFrom)
 		deploymentName := jenkinsDeployment.Name
 		r.logger.Info("Sending notification")
 		r.sendDeploymentCreationNotification()
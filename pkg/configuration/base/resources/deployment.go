@@ -11,11 +11,16 @@ import (
 )
 
 // NewJenkinsMasterPod builds Jenkins Master Kubernetes Pod resource.
-func NewJenkinsDeployment(objectMeta metav1.ObjectMeta, jenkins *v1alpha2.Jenkins, jenkinsSpec *v1alpha2.JenkinsSpec) *appsv1.Deployment {
+// restoreFrom is the init container populating the Jenkins Home from a backup, nil when the Jenkins Home is not restored.
+func NewJenkinsDeployment(objectMeta metav1.ObjectMeta, jenkins *v1alpha2.Jenkins, jenkinsSpec *v1alpha2.JenkinsSpec, restoreFrom *RestoreFrom) *appsv1.Deployment {
 	serviceAccountName := objectMeta.Name
 	objectMeta.Annotations = jenkinsSpec.Master.Annotations
 	objectMeta.Name = GetJenkinsDeploymentName(jenkins)
 	selector := &metav1.LabelSelector{MatchLabels: objectMeta.Labels}
+	podObjectMeta := objectMeta
+	if jenkinsSpec.VeleroEnabled {
+		podObjectMeta = newVeleroBackupPodObjectMeta(jenkins, objectMeta)
+	}
 	return &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      objectMeta.Name,
@@ -26,13 +31,13 @@ func NewJenkinsDeployment(objectMeta metav1.ObjectMeta, jenkins *v1alpha2.Jenkin
 			Replicas: pointer.Int32Ptr(1),
 			Strategy: appsv1.DeploymentStrategy{Type: appsv1.RollingUpdateDeploymentStrategyType},
 			Template: corev1.PodTemplateSpec{
-				ObjectMeta: objectMeta,
+				ObjectMeta: podObjectMeta,
 				Spec: corev1.PodSpec{
 					ServiceAccountName: serviceAccountName,
 					NodeSelector:       jenkinsSpec.Master.NodeSelector,
-					InitContainers:     newInitContainers(jenkinsSpec),
+					InitContainers:     newInitContainers(jenkinsSpec, restoreFrom),
 					Containers:         newContainers(jenkins, jenkinsSpec),
-					Volumes:            getJenkinsVolumes(jenkins, jenkinsSpec),
+					Volumes:            getJenkinsVolumes(jenkins, jenkinsSpec, restoreFrom),
 					SecurityContext:    jenkinsSpec.Master.SecurityContext,
 					ImagePullSecrets:   jenkinsSpec.Master.ImagePullSecrets,
 					Tolerations:        jenkinsSpec.Master.Tolerations,
@@ -44,21 +49,24 @@ func NewJenkinsDeployment(objectMeta metav1.ObjectMeta, jenkins *v1alpha2.Jenkin
 	}
 }
 
-func getJenkinsVolumes(jenkins *v1alpha2.Jenkins, jenkinsSpec *v1alpha2.JenkinsSpec) []corev1.Volume {
+func getJenkinsVolumes(jenkins *v1alpha2.Jenkins, jenkinsSpec *v1alpha2.JenkinsSpec, restoreFrom *RestoreFrom) []corev1.Volume {
 	volumes := append(GetJenkinsMasterPodBaseVolumes(jenkins), jenkinsSpec.Master.Volumes...)
+	if restoreFrom != nil {
+		volumes = append(volumes, restoreFrom.Volumes...)
+	}
 
-	if backupVolumeNames := jenkins.Spec.BackupVolumes; len(backupVolumeNames) > 0 {
-		for _, bvn := range backupVolumeNames {
-			backupVolume := corev1.Volume{
-				Name: GetJenkinsBackupPoolName(bvn),
-				VolumeSource: corev1.VolumeSource{
-					PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
-						ClaimName: GetJenkinsBackupPVCName(bvn),
-					},
+	for _, bvn := range getSidecarBackupVolumes(&jenkins.Spec) {
+		backupVolume := corev1.Volume{
+			Name: GetJenkinsBackupPoolName(bvn),
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: GetJenkinsBackupPVCName(bvn),
 				},
-			}
-			volumes = append(volumes, backupVolume)
+			},
 		}
+		volumes = append(volumes, backupVolume)
+	}
+	if isBackupSidecarEnabled(jenkinsSpec) {
 		backupScriptsVolume := corev1.Volume{
 			Name: ScriptsVolumeMountName,
 			VolumeSource: corev1.VolumeSource{
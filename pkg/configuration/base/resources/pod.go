@@ -20,6 +20,9 @@ import (
 const (
 	JenkinsSideCarImageEnvVar = "JENKINS_SIDECAR_IMAGE"
 	JenkinsBackupImageEnvVar  = "JENKINS_BACKUP_IMAGE"
+	// JenkinsBackupJobImageEnvVar overrides the image of the Jobs running Backups and Restores, which is the image of
+	// the Operator by default
+	JenkinsBackupJobImageEnvVar = "JENKINS_BACKUP_JOB_IMAGE"
 
 	JenkinsMasterContainerName = constants.DefaultJenkinsMasterContainerName
 	// JenkinsHomeVolumeName is the Jenkins home volume name
@@ -60,6 +63,8 @@ const (
 	PluginsInitContainerName = "plugins-init"
 	BackupSidecarName        = "backup"
 	BackupInitContainerName  = "backup-init"
+	// RestoreFromInitContainerName is the init container populating the Jenkins Home from the backup of restoreFrom
+	RestoreFromInitContainerName = "restore-from"
 	// Config Sidecar related variables
 	JenkinsSCConfigReqURL     = "http://localhost:8080/reload-configuration-as-code/?casc-reload-token=$(POD_NAME)"
 	JenkinsSCConfigReqMethod  = "POST"
@@ -167,7 +172,7 @@ func GetJenkinsMasterPodBaseVolumes(jenkins *v1alpha2.Jenkins) []corev1.Volume {
 	}
 
 	// Add Volumes for Backup
-	if backupVolumes := jenkins.Spec.BackupVolumes; len(backupVolumes) > 0 {
+	if backupVolumes := getSidecarBackupVolumes(&jenkins.Spec); len(backupVolumes) > 0 {
 		for _, bvName := range backupVolumes {
 			// TODO: use existing PVCs / be able to pass custom claimName
 			volumes = append(volumes, getPVCVolume(bvName, bvName+"-jenkins-backup"))
@@ -361,7 +366,7 @@ func NewJenkinsBackupContainer(jenkins *v1alpha2.Jenkins) corev1.Container {
 		getVolumeMount(JenkinsHomeVolumeName, getJenkinsHomePath(jenkins), false),
 	}
 
-	if backupVolumeNames := jenkins.Spec.BackupVolumes; len(backupVolumeNames) > 0 {
+	if backupVolumeNames := getSidecarBackupVolumes(&jenkins.Spec); len(backupVolumeNames) > 0 {
 		for _, bvn := range backupVolumeNames {
 			volumeMounts = append(volumeMounts,
 				getVolumeMount(GetJenkinsBackupPoolName(bvn), getJenkinsBackupVolumePath(bvn), false),
@@ -371,7 +376,7 @@ func NewJenkinsBackupContainer(jenkins *v1alpha2.Jenkins) corev1.Container {
 
 	backupContainer := corev1.Container{
 		Name:            BackupSidecarName,
-		Image:           getJenkinsBackupImage(),
+		Image:           GetJenkinsBackupImage(),
 		ImagePullPolicy: corev1.PullIfNotPresent,
 		Command:         []string{"/bin/sh", "-c", "--"},
 		Args:            []string{"while true; do sleep 30; done;"},
@@ -447,7 +452,7 @@ func NewJenkinsBackupInitContainer(spec *v1alpha2.JenkinsSpec) corev1.Container
 		getVolumeMount(ScriptsVolumeMountName, ScriptsVolumePath, false),
 	}
 
-	if backupVolumeNames := spec.BackupVolumes; len(backupVolumeNames) > 0 {
+	if backupVolumeNames := getSidecarBackupVolumes(spec); len(backupVolumeNames) > 0 {
 		for _, bvn := range backupVolumeNames {
 			volumeMounts = append(volumeMounts,
 				getVolumeMount(GetJenkinsBackupPoolName(bvn), getJenkinsBackupVolumePath(bvn), false),
@@ -526,24 +531,50 @@ func newContainers(jenkins *v1alpha2.Jenkins, spec *v1alpha2.JenkinsSpec) (conta
 			containers = append(containers, convertJenkinsContainerToKubernetesContainer(container))
 		}
 	}
-	if len(spec.BackupVolumes) > 0 {
+	if isBackupSidecarEnabled(spec) {
 		containers = append(containers, NewJenkinsBackupContainer(jenkins))
 	}
 
 	return containers
 }
 
-func newInitContainers(jenkinsSpec *v1alpha2.JenkinsSpec) (containers []corev1.Container) {
+// RestoreFrom is the init container populating the Jenkins Home from the backup of restoreFrom before Jenkins starts
+// for the first time, and the volumes it mounts besides the Jenkins Home
+type RestoreFrom struct {
+	Container corev1.Container
+	Volumes   []corev1.Volume
+}
+
+func newInitContainers(jenkinsSpec *v1alpha2.JenkinsSpec, restoreFrom *RestoreFrom) (containers []corev1.Container) {
+	// The Jenkins Home is populated before the other init containers run
+	if restoreFrom != nil {
+		containers = append(containers, restoreFrom.Container)
+	}
 	containers = append(containers, NewJenkinsPluginsInitContainer(jenkinsSpec))
 	if jenkinsSpec.ConfigurationAsCode == nil || jenkinsSpec.ConfigurationAsCode.Enabled {
 		containers = append(containers, NewJenkinsConfigInitContainer(jenkinsSpec))
 	}
-	if len(jenkinsSpec.BackupVolumes) > 0 {
+	if isBackupSidecarEnabled(jenkinsSpec) {
 		containers = append(containers, NewJenkinsBackupInitContainer(jenkinsSpec))
 	}
 	return containers
 }
 
+// isBackupSidecarEnabled returns true if the Jenkins Pod has the backup sidecar and its scripts, which are used by the
+// Backups and Restores of the BackupVolumes and by the Velero backup hooks
+func isBackupSidecarEnabled(jenkinsSpec *v1alpha2.JenkinsSpec) bool {
+	return len(getSidecarBackupVolumes(jenkinsSpec)) > 0 || jenkinsSpec.VeleroEnabled
+}
+
+// getSidecarBackupVolumes returns the BackupVolumes mounted in the Jenkins Pod for the backup sidecar. There are none
+// when the Backups and Restores of the Jenkins run in Jobs, which mount the BackupVolumes themselves.
+func getSidecarBackupVolumes(jenkinsSpec *v1alpha2.JenkinsSpec) []string {
+	if jenkinsSpec.BackupRunner == v1alpha2.BackupRunnerJob {
+		return nil
+	}
+	return jenkinsSpec.BackupVolumes
+}
+
 func GetJenkinsBackupPVCName(backupVolumeName string) string {
 	return backupVolumeName + backupVolumeSuffix
 }
@@ -677,8 +708,8 @@ func getJenkinsSideCarImage() string {
 	return jenkinsSideCarImage
 }
 
-// getJenkinsBackupImage returns the ubi minimal image
-func getJenkinsBackupImage() string {
+// GetJenkinsBackupImage returns the ubi minimal image
+func GetJenkinsBackupImage() string {
 	jenkinsBackupImage, _ := os.LookupEnv(JenkinsBackupImageEnvVar)
 	if len(jenkinsBackupImage) == 0 {
 		jenkinsBackupImage = constants.DefaultJenkinsBackupImage
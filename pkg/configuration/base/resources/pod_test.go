@@ -5,6 +5,7 @@ import (
 
 	"github.com/jenkinsci/jenkins-automation-operator/api/v1alpha2"
 	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -27,6 +28,58 @@ func TestGetJenkinsMasterPodBaseVolumes(t *testing.T) {
 	})
 }
 
+func TestNewJenkinsDeploymentBackupSidecar(t *testing.T) {
+	newJenkins := func(runner v1alpha2.BackupRunner) *v1alpha2.Jenkins {
+		spec := v1alpha2.JenkinsSpec{
+			BackupVolumes: []string{"daily"},
+			BackupRunner:  runner,
+			Master: &v1alpha2.JenkinsMaster{
+				Containers: []v1alpha2.Container{{Name: JenkinsMasterContainerName, Image: "jenkins/jenkins:lts"}},
+			},
+		}
+		return &v1alpha2.Jenkins{
+			ObjectMeta: metav1.ObjectMeta{Name: "example", Namespace: "default"},
+			Spec:       spec,
+			Status:     &v1alpha2.JenkinsStatus{Spec: &spec},
+		}
+	}
+	containerNames := func(containers []corev1.Container) (names []string) {
+		for _, container := range containers {
+			names = append(names, container.Name)
+		}
+		return names
+	}
+	volumeNames := func(volumes []corev1.Volume) (names []string) {
+		for _, volume := range volumes {
+			names = append(names, volume.Name)
+		}
+		return names
+	}
+
+	t.Run("sidecar runner", func(t *testing.T) {
+		jenkins := newJenkins(v1alpha2.BackupRunnerSidecar)
+
+		deployment := NewJenkinsDeployment(NewResourceObjectMeta(jenkins), jenkins, &jenkins.Spec, nil)
+
+		podSpec := deployment.Spec.Template.Spec
+		assert.Contains(t, containerNames(podSpec.Containers), BackupSidecarName)
+		assert.Contains(t, containerNames(podSpec.InitContainers), BackupInitContainerName)
+		assert.Contains(t, volumeNames(podSpec.Volumes), GetJenkinsBackupPoolName("daily"))
+	})
+	t.Run("job runner", func(t *testing.T) {
+		jenkins := newJenkins(v1alpha2.BackupRunnerJob)
+
+		deployment := NewJenkinsDeployment(NewResourceObjectMeta(jenkins), jenkins, &jenkins.Spec, nil)
+
+		// The Jobs mount the BackupVolumes, the Jenkins Pod neither runs the sidecar nor claims their volumes
+		podSpec := deployment.Spec.Template.Spec
+		assert.NotContains(t, containerNames(podSpec.Containers), BackupSidecarName)
+		assert.NotContains(t, containerNames(podSpec.InitContainers), BackupInitContainerName)
+		assert.NotContains(t, volumeNames(podSpec.Volumes), GetJenkinsBackupPoolName("daily"))
+		assert.NotContains(t, volumeNames(podSpec.Volumes), "daily")
+	})
+}
+
 func checkSecretVolumesPresence(jenkins *v1alpha2.Jenkins) (cmVolume, initVolume, secretVolume bool) {
 	for _, volume := range GetJenkinsMasterPodBaseVolumes(jenkins) {
 		switch volume.Name {
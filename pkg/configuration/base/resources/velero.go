@@ -0,0 +1,58 @@
+package resources
+
+import (
+	"fmt"
+
+	"github.com/jenkinsci/jenkins-automation-operator/api/v1alpha2"
+	"github.com/jenkinsci/jenkins-automation-operator/pkg/constants"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// Velero runs the commands of these annotations in the container of the annotated Pod, before and after it backs up
+	// the Pod and its volumes
+	veleroPreBackupHookContainerAnnotation  = "pre.hook.backup.velero.io/container"
+	veleroPreBackupHookCommandAnnotation    = "pre.hook.backup.velero.io/command"
+	veleroPostBackupHookContainerAnnotation = "post.hook.backup.velero.io/container"
+	veleroPostBackupHookCommandAnnotation   = "post.hook.backup.velero.io/command"
+)
+
+// SetVeleroBackupLabel labels the resource of the Jenkins with the name of the Jenkins when Velero is enabled, so that
+// a Velero backup selecting the label captures the Jenkins along with its resources
+func SetVeleroBackupLabel(jenkins *v1alpha2.Jenkins, obj metav1.Object) {
+	if !jenkins.Spec.VeleroEnabled {
+		return
+	}
+	labels := obj.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[constants.LabelVeleroBackupKey] = jenkins.Name
+	obj.SetLabels(labels)
+}
+
+// newVeleroBackupPodObjectMeta returns the metadata of the Jenkins Pod with the Velero backup label and the Velero
+// backup hooks, which quiet down Jenkins with the scripts of the backup sidecar while its volumes are backed up
+func newVeleroBackupPodObjectMeta(jenkins *v1alpha2.Jenkins, objectMeta metav1.ObjectMeta) metav1.ObjectMeta {
+	labels := map[string]string{}
+	for key, value := range objectMeta.Labels {
+		labels[key] = value
+	}
+	labels[constants.LabelVeleroBackupKey] = jenkins.Name
+	annotations := map[string]string{}
+	for key, value := range objectMeta.Annotations {
+		annotations[key] = value
+	}
+	annotations[veleroPreBackupHookContainerAnnotation] = BackupSidecarName
+	annotations[veleroPreBackupHookCommandAnnotation] = getVeleroBackupHookCommand(QuietDownScriptPath)
+	annotations[veleroPostBackupHookContainerAnnotation] = BackupSidecarName
+	annotations[veleroPostBackupHookCommandAnnotation] = getVeleroBackupHookCommand(CancelQuietDownScriptPath)
+	objectMeta.Labels = labels
+	objectMeta.Annotations = annotations
+	return objectMeta
+}
+
+// getVeleroBackupHookCommand returns the JSON array of the command of a Velero backup hook running the script
+func getVeleroBackupHookCommand(scriptPath string) string {
+	return fmt.Sprintf(`["/bin/sh", "%s"]`, scriptPath)
+}
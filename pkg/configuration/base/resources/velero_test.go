@@ -0,0 +1,63 @@
+package resources
+
+import (
+	"testing"
+
+	"github.com/jenkinsci/jenkins-automation-operator/api/v1alpha2"
+	"github.com/jenkinsci/jenkins-automation-operator/pkg/constants"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNewJenkinsDeploymentWithVelero(t *testing.T) {
+	spec := v1alpha2.JenkinsSpec{
+		VeleroEnabled: true,
+		Master: &v1alpha2.JenkinsMaster{
+			Annotations: map[string]string{"team": "ci"},
+			Containers:  []v1alpha2.Container{{Name: JenkinsMasterContainerName, Image: "jenkins/jenkins:lts"}},
+		},
+	}
+	jenkins := &v1alpha2.Jenkins{
+		ObjectMeta: metav1.ObjectMeta{Name: "example", Namespace: "default"},
+		Spec:       spec,
+		Status:     &v1alpha2.JenkinsStatus{Spec: &spec},
+	}
+
+	deployment := NewJenkinsDeployment(NewResourceObjectMeta(jenkins), jenkins, &spec, nil)
+
+	podMeta := deployment.Spec.Template.ObjectMeta
+	assert.Equal(t, "example", podMeta.Labels[constants.LabelVeleroBackupKey])
+	assert.NotContains(t, deployment.Spec.Selector.MatchLabels, constants.LabelVeleroBackupKey)
+	assert.Equal(t, map[string]string{
+		"team":                                 "ci",
+		"pre.hook.backup.velero.io/container":  BackupSidecarName,
+		"pre.hook.backup.velero.io/command":    `["/bin/sh", "/jenkins-operator-scripts/quietdown.sh"]`,
+		"post.hook.backup.velero.io/container": BackupSidecarName,
+		"post.hook.backup.velero.io/command":   `["/bin/sh", "/jenkins-operator-scripts/cancelquietdown.sh"]`,
+	}, podMeta.Annotations)
+	assert.Equal(t, map[string]string{"team": "ci"}, spec.Master.Annotations)
+	// The scripts of the hooks are written by the backup init container to the volume shared with the backup sidecar
+	containers := deployment.Spec.Template.Spec.Containers
+	require.NotEmpty(t, containers)
+	assert.Equal(t, BackupSidecarName, containers[len(containers)-1].Name)
+	initContainers := deployment.Spec.Template.Spec.InitContainers
+	assert.Equal(t, BackupInitContainerName, initContainers[len(initContainers)-1].Name)
+	assert.Contains(t, deployment.Spec.Template.Spec.Volumes, corev1.Volume{
+		Name:         ScriptsVolumeMountName,
+		VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+	})
+}
+
+func TestSetVeleroBackupLabel(t *testing.T) {
+	jenkins := &v1alpha2.Jenkins{ObjectMeta: metav1.ObjectMeta{Name: "example"}}
+	service := &corev1.Service{}
+
+	SetVeleroBackupLabel(jenkins, service)
+	assert.Empty(t, service.Labels)
+
+	jenkins.Spec.VeleroEnabled = true
+	SetVeleroBackupLabel(jenkins, service)
+	assert.Equal(t, map[string]string{constants.LabelVeleroBackupKey: "example"}, service.Labels)
+}
@@ -35,6 +35,8 @@ type Configuration struct {
 	Jenkins                      *v1alpha2.Jenkins
 	Scheme                       *runtime.Scheme
 	Notifications                *chan event.Event
+	// RestoreFrom is the init container populating the Jenkins Home of a new Jenkins Deployment from a backup
+	RestoreFrom *resources.RestoreFrom
 }
 
 var (
@@ -78,6 +80,7 @@ func (c *Configuration) CreateResource(obj metav1.Object) error {
 	if err := controllerutil.SetControllerReference(c.Jenkins, obj, c.Scheme); err != nil {
 		return stackerr.WithStack(err)
 	}
+	resources.SetVeleroBackupLabel(c.Jenkins, obj)
 
 	return c.Client.Create(context.TODO(), runtimeObj) // don't wrap error
 }
@@ -91,6 +94,7 @@ func (c *Configuration) UpdateResource(obj metav1.Object) error {
 
 	// set Jenkins instance as the owner and controller, don't check error(can be already set)
 	_ = controllerutil.SetControllerReference(c.Jenkins, obj, c.Scheme)
+	resources.SetVeleroBackupLabel(c.Jenkins, obj)
 
 	return c.Client.Update(context.TODO(), runtimeObj) // don't wrap error
 }
@@ -104,6 +108,7 @@ func (c *Configuration) CreateOrUpdateResource(obj metav1.Object) error {
 
 	// set Jenkins instance as the owner and controller, don't check error(can be already set)
 	_ = controllerutil.SetControllerReference(c.Jenkins, obj, c.Scheme)
+	resources.SetVeleroBackupLabel(c.Jenkins, obj)
 
 	err := c.Client.Create(context.TODO(), runtimeObj)
 	if err != nil && k8serrors.IsAlreadyExists(err) {
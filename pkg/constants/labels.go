@@ -13,4 +13,11 @@ const (
 
 	// LabelJenkinsCRKey Kubernetes label name which contains Jenkins CR name
 	LabelJenkinsCRKey = "jenkins-cr"
+
+	// LabelBackupScheduleKey Kubernetes label name which contains the BackupSchedule CR name of a scheduled Backup
+	LabelBackupScheduleKey = "backup-schedule"
+
+	// LabelVeleroBackupKey Kubernetes label name which contains the Jenkins CR name on the resources of a Jenkins
+	// backed up by Velero
+	LabelVeleroBackupKey = "jenkins-velero-backup"
 )
@@ -0,0 +1,178 @@
+package encryption
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// Algorithm is the name of the encryption, recorded along with the encrypted data
+	Algorithm = "AES-256-GCM"
+	// MinKeyLength is the minimal length of the secret key, which should be random
+	MinKeyLength = 32
+
+	magic      = "JENKINSENC1"
+	saltLength = 32
+	// chunkLength is the length of the plaintext of each encrypted chunk, the last chunk may be shorter
+	chunkLength = 64 * 1024
+	// nonceLength is the length of the GCM nonce, made of the chunk counter and of the last chunk flag
+	nonceLength = 12
+)
+
+// NewWriter returns a writer encrypting the data written to it in out. The data is split in chunks which are encrypted
+// and authenticated with AES-256-GCM, using a key derived from the secret key and a random salt written first in out.
+// Close must be called to write the last chunk, it does not close out.
+func NewWriter(out io.Writer, key []byte) (io.WriteCloser, error) {
+	salt := make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key, salt)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = out.Write(append([]byte(magic), salt...)); err != nil {
+		return nil, err
+	}
+	return &writer{out: out, aead: aead, buffer: make([]byte, 0, chunkLength)}, nil
+}
+
+// NewReader returns a reader decrypting the data read from in, written by a writer returned by NewWriter.
+// Reading fails if the key is wrong or if the data was modified or truncated.
+func NewReader(in io.Reader, key []byte) (io.Reader, error) {
+	header := make([]byte, len(magic)+saltLength)
+	if _, err := io.ReadFull(in, header); err != nil {
+		return nil, errors.Wrap(err, "failed to read encryption header")
+	}
+	if string(header[:len(magic)]) != magic {
+		return nil, errors.New("data is not encrypted")
+	}
+	aead, err := newAEAD(key, header[len(magic):])
+	if err != nil {
+		return nil, err
+	}
+	return &reader{in: bufio.NewReaderSize(in, chunkLength+aead.Overhead()+1), aead: aead}, nil
+}
+
+// newAEAD derives the key of the data from the secret key and the salt
+func newAEAD(key, salt []byte) (cipher.AEAD, error) {
+	if len(key) < MinKeyLength {
+		return nil, errors.Errorf("encryption key must be at least %d bytes long", MinKeyLength)
+	}
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write(salt)
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// nonce returns a unique nonce for each chunk, the last chunk is flagged to detect truncated data
+func nonce(counter uint64, last bool) []byte {
+	nonce := make([]byte, nonceLength)
+	binary.BigEndian.PutUint64(nonce[3:11], counter)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+type writer struct {
+	out     io.Writer
+	aead    cipher.AEAD
+	buffer  []byte
+	counter uint64
+	closed  bool
+}
+
+func (w *writer) Write(data []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("write on closed encryption writer")
+	}
+	written := 0
+	for len(data) > 0 {
+		// A full chunk is only written once more data follows, so that the last chunk is never empty but for empty data
+		if len(w.buffer) == chunkLength {
+			if err := w.writeChunk(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(w.buffer[len(w.buffer):chunkLength], data)
+		w.buffer = w.buffer[:len(w.buffer)+n]
+		data = data[n:]
+		written += n
+	}
+	return written, nil
+}
+
+func (w *writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	return w.writeChunk(true)
+}
+
+func (w *writer) writeChunk(last bool) error {
+	sealed := w.aead.Seal(nil, nonce(w.counter, last), w.buffer, nil)
+	w.counter++
+	w.buffer = w.buffer[:0]
+	_, err := w.out.Write(sealed)
+	return err
+}
+
+type reader struct {
+	in      *bufio.Reader
+	aead    cipher.AEAD
+	chunk   []byte
+	counter uint64
+	done    bool
+}
+
+func (r *reader) Read(data []byte) (int, error) {
+	for len(r.chunk) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.readChunk(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(data, r.chunk)
+	r.chunk = r.chunk[n:]
+	return n, nil
+}
+
+func (r *reader) readChunk() error {
+	sealed := make([]byte, chunkLength+r.aead.Overhead())
+	n, err := io.ReadFull(r.in, sealed)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		if err == io.EOF {
+			return errors.New("encrypted data is truncated")
+		}
+		return err
+	}
+	// The last chunk is the one followed by the end of the data
+	_, peekErr := r.in.Peek(1)
+	last := peekErr == io.EOF
+	if peekErr != nil && !last {
+		return peekErr
+	}
+	chunk, err := r.aead.Open(nil, nonce(r.counter, last), sealed[:n], nil)
+	if err != nil {
+		return errors.New("failed to decrypt data, the encryption key is wrong or the data is corrupted or truncated")
+	}
+	r.counter++
+	r.chunk = chunk
+	r.done = last
+	return nil
+}
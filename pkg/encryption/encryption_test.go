@@ -0,0 +1,89 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func encrypt(t *testing.T, key, data []byte) []byte {
+	encrypted := &bytes.Buffer{}
+	writer, err := NewWriter(encrypted, key)
+	require.NoError(t, err)
+	_, err = writer.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	return encrypted.Bytes()
+}
+
+func decrypt(key, encrypted []byte) ([]byte, error) {
+	reader, err := NewReader(bytes.NewReader(encrypted), key)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(reader)
+}
+
+func TestEncryption(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	large := make([]byte, 3*chunkLength+100)
+	_, err := rand.Read(large)
+	require.NoError(t, err)
+
+	for name, data := range map[string][]byte{
+		"empty":          {},
+		"small":          []byte("secret"),
+		"one full chunk": large[:chunkLength],
+		"many chunks":    large,
+	} {
+		t.Run(name, func(t *testing.T) {
+			encrypted := encrypt(t, key, data)
+
+			decrypted, err := decrypt(key, encrypted)
+
+			require.NoError(t, err)
+			assert.Equal(t, data, decrypted)
+			if len(data) > 0 {
+				assert.False(t, bytes.Contains(encrypted, data))
+			}
+		})
+	}
+	t.Run("wrong key", func(t *testing.T) {
+		encrypted := encrypt(t, key, []byte("secret"))
+
+		_, err := decrypt([]byte("abcdef0123456789abcdef0123456789"), encrypted)
+
+		assert.Error(t, err)
+	})
+	t.Run("modified data", func(t *testing.T) {
+		encrypted := encrypt(t, key, []byte("secret"))
+		encrypted[len(encrypted)-1] ^= 1
+
+		_, err := decrypt(key, encrypted)
+
+		assert.Error(t, err)
+	})
+	t.Run("truncated at a chunk boundary", func(t *testing.T) {
+		encrypted := encrypt(t, key, large)
+		headerLength := len(magic) + saltLength
+		chunkOverhead := 16
+
+		_, err := decrypt(key, encrypted[:headerLength+2*(chunkLength+chunkOverhead)])
+
+		assert.Error(t, err)
+	})
+	t.Run("not encrypted", func(t *testing.T) {
+		_, err := decrypt(key, large[:100])
+
+		assert.Error(t, err)
+	})
+	t.Run("short key", func(t *testing.T) {
+		_, err := NewWriter(&bytes.Buffer{}, []byte("short"))
+
+		assert.Error(t, err)
+	})
+}
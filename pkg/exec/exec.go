@@ -2,10 +2,14 @@ package exec
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/jenkinsci/jenkins-automation-operator/pkg/log"
 	"k8s.io/client-go/rest"
@@ -18,21 +22,29 @@ import (
 	"k8s.io/kubectl/pkg/scheme"
 )
 
+// KubeExecClient runs scripts in the backup container of the Jenkins Pod. The scripts are stopped once their context
+// is done, a hung stream doesn't block the caller.
 type KubeExecClient interface {
 	InitKubeGoClient() error
-	MakeRequest(*corev1.Pod, string, string) error
+	MakeRequest(context.Context, *corev1.Pod, string, string) error
+	StreamRequest(context.Context, *corev1.Pod, string, string, io.Reader, io.Writer) error
 }
 
 var (
 	logger = log.Log.WithName("exec")
 )
 
+const (
+	// stopTimeout is how long the processes of a script are waited for once they were stopped
+	stopTimeout = 30 * time.Second
+	// pidFileDirectory is where the PID of each running script is written in the backup container
+	pidFileDirectory = "/tmp"
+)
+
 var _ KubeExecClient = (*kubeExecClient)(nil)
 
 type kubeExecClient struct {
-	client       *rest.Config
-	execComplete chan bool
-	execErr      chan error
+	client *rest.Config
 }
 
 func NewKubeExecClient() KubeExecClient {
@@ -41,10 +53,6 @@ func NewKubeExecClient() KubeExecClient {
 
 func (e *kubeExecClient) InitKubeGoClient() error {
 	var err error
-	// Initialize channels for managing exec goroutines
-	e.execComplete = make(chan bool, 1)
-	e.execErr = make(chan error, 1)
-
 	// Initialize go-client client
 	home := homedir.HomeDir()
 	serviceHost := os.Getenv("KUBERNETES_SERVICE_HOST")
@@ -65,12 +73,13 @@ func (e *kubeExecClient) InitKubeGoClient() error {
 	return nil
 }
 
-func (e *kubeExecClient) MakeRequest(jenkinsPod *corev1.Pod, resourceName, script string) error {
-	request, err := e.newScriptRequest(jenkinsPod, script)
+func (e *kubeExecClient) MakeRequest(ctx context.Context, jenkinsPod *corev1.Pod, resourceName, script string) error {
+	pidFile := newPIDFile()
+	request, err := e.newScriptRequest(jenkinsPod, script, pidFile)
 	if err != nil {
 		return err
 	}
-	err = e.runPodExec(request, resourceName)
+	err = e.runPodExec(ctx, request, resourceName, e.stopper(jenkinsPod, pidFile))
 	if err != nil {
 		return err
 	}
@@ -78,7 +87,48 @@ func (e *kubeExecClient) MakeRequest(jenkinsPod *corev1.Pod, resourceName, scrip
 	return nil
 }
 
-func (e *kubeExecClient) newScriptRequest(jenkinsPod *corev1.Pod, script string) (*rest.Request, error) {
+// StreamRequest runs the script with stdin and stdout attached to the given reader and writer, which allows
+// transferring binary data like archives from and to the backup container
+func (e *kubeExecClient) StreamRequest(ctx context.Context, jenkinsPod *corev1.Pod, resourceName, script string, stdin io.Reader, stdout io.Writer) error {
+	pidFile := newPIDFile()
+	request, err := e.newRequest(jenkinsPod, getStoppableCommand(script, pidFile), &corev1.PodExecOptions{
+		Stdin:  stdin != nil,
+		Stdout: true,
+		Stderr: true,
+		TTY:    false,
+	})
+	if err != nil {
+		return err
+	}
+	stderr := &bytes.Buffer{}
+	remoteCommand, err := remotecommand.NewSPDYExecutor(e.client, "POST", request.URL())
+	if err != nil {
+		return err
+	}
+	err = stream(ctx, remoteCommand, remotecommand.StreamOptions{
+		Stdin:  stdin,
+		Stdout: stdout,
+		Stderr: stderr,
+		Tty:    false,
+	}, e.stopper(jenkinsPod, pidFile))
+	if err != nil {
+		logger.Info(fmt.Sprintf("'%s' Execution STDERR\n\t%s", resourceName, stderr.String()))
+		return fmt.Errorf("%s: %s", err, stderr.String())
+	}
+	logger.Info(fmt.Sprintf("Script %s for instance %s has been successful", script, resourceName))
+	return nil
+}
+
+func (e *kubeExecClient) newScriptRequest(jenkinsPod *corev1.Pod, script, pidFile string) (*rest.Request, error) {
+	return e.newRequest(jenkinsPod, getStoppableCommand(script, pidFile), &corev1.PodExecOptions{
+		Stdin:  false,
+		Stdout: true,
+		Stderr: true,
+		TTY:    true,
+	})
+}
+
+func (e *kubeExecClient) newRequest(jenkinsPod *corev1.Pod, command []string, podExecOptions *corev1.PodExecOptions) (*rest.Request, error) {
 	client, err := clientgocorev1.NewForConfig(e.client)
 	if err != nil {
 		return nil, err
@@ -88,25 +138,15 @@ func (e *kubeExecClient) newScriptRequest(jenkinsPod *corev1.Pod, script string)
 		Name(jenkinsPod.Name).
 		Namespace(jenkinsPod.Namespace).
 		SubResource("exec")
-	podExecOptions := &corev1.PodExecOptions{
-		Stdin:     false,
-		Stdout:    true,
-		Stderr:    true,
-		TTY:       true,
-		Container: "backup",
-		Command: []string{
-			"sh", "-c", script,
-		},
-	}
-	logger.Info(strings.Join([]string{
-		"sh", "-c", script,
-	}, " "))
+	podExecOptions.Container = "backup"
+	podExecOptions.Command = command
+	logger.Info(strings.Join(command, " "))
 
 	podExecRequest.VersionedParams(podExecOptions, scheme.ParameterCodec)
 	return podExecRequest, err
 }
 
-func (e *kubeExecClient) runPodExec(podExecRequest *rest.Request, resourceName string) error {
+func (e *kubeExecClient) runPodExec(ctx context.Context, podExecRequest *rest.Request, resourceName string, stop func() error) error {
 	stdout := &bytes.Buffer{}
 	stderr := &bytes.Buffer{}
 
@@ -122,15 +162,7 @@ func (e *kubeExecClient) runPodExec(podExecRequest *rest.Request, resourceName s
 		Stderr: stderr,
 		Tty:    false,
 	}
-	go func() {
-		err = remoteCommand.Stream(streamOptions)
-		e.execErr <- err
-		e.execComplete <- true
-	}()
-	// Running each exec in a goroutine as goclient REST SPDYRExecutor stream does not cancel
-	// https://github.com/kubernetes/client-go/issues/554#issuecomment-578886198
-	<-e.execComplete
-	err = <-e.execErr
+	err = stream(ctx, remoteCommand, streamOptions, stop)
 	if err != nil {
 		logger.Info(fmt.Sprintf("Error while executing script %s", err.Error()))
 		logger.Info(fmt.Sprintf("'%s' Execution STDERR\n\t%s", resourceName, stderr.String()))
@@ -140,3 +172,92 @@ func (e *kubeExecClient) runPodExec(podExecRequest *rest.Request, resourceName s
 
 	return err
 }
+
+// stream runs the remote command until it completes or the context is done. The goclient REST SPDYExecutor stream
+// does not cancel (https://github.com/kubernetes/client-go/issues/554#issuecomment-578886198): once the context is
+// done, the remote processes are stopped and the stream is waited for until they exit. It is abandoned if they don't
+// exit within stopTimeout.
+func stream(ctx context.Context, remoteCommand remotecommand.Executor, streamOptions remotecommand.StreamOptions, stop func() error) error {
+	execErr := make(chan error, 1)
+	go func() {
+		execErr <- remoteCommand.Stream(streamOptions)
+	}()
+	select {
+	case err := <-execErr:
+		return err
+	case <-ctx.Done():
+	}
+	if err := stop(); err != nil {
+		logger.Info(fmt.Sprintf("Failed to stop the remote processes: %s", err))
+	}
+	select {
+	case <-execErr:
+		return fmt.Errorf("exec stopped: %s", ctx.Err())
+	case <-time.After(stopTimeout):
+		return fmt.Errorf("exec abandoned: %s, the remote processes did not exit", ctx.Err())
+	}
+}
+
+// stopper returns the function stopping the processes of the script whose PID is written to the PID file
+func (e *kubeExecClient) stopper(jenkinsPod *corev1.Pod, pidFile string) func() error {
+	return func() error {
+		request, err := e.newRequest(jenkinsPod, []string{"sh", "-c", getStopScript(pidFile)}, &corev1.PodExecOptions{
+			Stdout: true,
+			Stderr: true,
+		})
+		if err != nil {
+			return err
+		}
+		remoteCommand, err := remotecommand.NewSPDYExecutor(e.client, "POST", request.URL())
+		if err != nil {
+			return err
+		}
+		stderr := &bytes.Buffer{}
+		ctx, cancel := context.WithTimeout(context.Background(), stopTimeout)
+		defer cancel()
+		err = stream(ctx, remoteCommand, remotecommand.StreamOptions{Stdout: ioutil.Discard, Stderr: stderr}, func() error { return nil })
+		if err != nil {
+			return fmt.Errorf("%s: %s", err, stderr.String())
+		}
+		return nil
+	}
+}
+
+// newPIDFile returns the path of the file where the PID of a script is written in the backup container
+func newPIDFile() string {
+	return fmt.Sprintf("%s/jenkins-operator-exec-%d.pid", pidFileDirectory, time.Now().UnixNano())
+}
+
+// getStoppableCommand returns the command running the script in a shell whose PID is written to the PID file, so that
+// the script and the processes it started can be stopped from another exec
+func getStoppableCommand(script, pidFile string) []string {
+	wrapper := fmt.Sprintf(`echo $$ > '%[1]s'; sh -c "$1"; status=$?; rm -f '%[1]s'; exit $status`, pidFile)
+	return []string{"sh", "-c", wrapper, "sh", script}
+}
+
+// getStopScript returns the script terminating the shell whose PID is in the PID file along with all its descendants,
+// found through the parent PIDs in /proc
+func getStopScript(pidFile string) string {
+	return fmt.Sprintf(`pids=$(cat '%[1]s' 2>/dev/null) || exit 0
+all=$pids
+while [ -n "$pids" ]; do
+  children=""
+  for stat in /proc/[0-9]*/stat; do
+    fields=$(cat "$stat" 2>/dev/null) || continue
+    fields=${fields##*) }
+    ppid=${fields#* }
+    ppid=${ppid%%%% *}
+    for pid in $pids; do
+      if [ "$ppid" = "$pid" ]; then
+        child=${stat#/proc/}
+        children="$children ${child%%/stat}"
+      fi
+    done
+  done
+  all="$all $children"
+  pids=$children
+done
+kill -TERM $all 2>/dev/null
+rm -f '%[1]s'
+exit 0`, pidFile)
+}
@@ -0,0 +1,84 @@
+package exec
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// blockingExecutor streams until it is stopped
+type blockingExecutor struct {
+	stopped chan struct{}
+}
+
+func (e *blockingExecutor) Stream(remotecommand.StreamOptions) error {
+	<-e.stopped
+	return errors.New("terminated")
+}
+
+func TestStream(t *testing.T) {
+	t.Run("completed", func(t *testing.T) {
+		executor := &blockingExecutor{stopped: make(chan struct{})}
+		close(executor.stopped)
+
+		err := stream(context.Background(), executor, remotecommand.StreamOptions{}, func() error {
+			t.Fatal("the remote processes were stopped")
+			return nil
+		})
+
+		assert.EqualError(t, err, "terminated")
+	})
+	t.Run("stopped once the context is done", func(t *testing.T) {
+		executor := &blockingExecutor{stopped: make(chan struct{})}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		err := stream(ctx, executor, remotecommand.StreamOptions{}, func() error {
+			close(executor.stopped)
+			return nil
+		})
+
+		assert.EqualError(t, err, "exec stopped: context canceled")
+	})
+}
+
+func TestGetStopScript(t *testing.T) {
+	if _, err := os.Stat("/proc/self/stat"); err != nil {
+		t.Skip("no /proc file system")
+	}
+	dir, err := ioutil.TempDir("", "exec")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	pidFile := filepath.Join(dir, "script.pid")
+	command := getStoppableCommand("sleep 60 | cat", pidFile)
+	script := osexec.Command(command[0], command[1:]...)
+	require.NoError(t, script.Start())
+	exited := make(chan error, 1)
+	go func() {
+		exited <- script.Wait()
+	}()
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(pidFile)
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, osexec.Command("sh", "-c", getStopScript(pidFile)).Run())
+
+	select {
+	case err := <-exited:
+		assert.Error(t, err)
+	case <-time.After(5 * time.Second):
+		_ = script.Process.Kill()
+		t.Fatal("the script was not stopped")
+	}
+	assert.NoFileExists(t, pidFile)
+}
@@ -0,0 +1,284 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultBranch is used when no branch is given
+	DefaultBranch = "main"
+
+	// askPassScript answers the username and password prompts of git with the credentials of the environment
+	askPassScript = `#!/bin/sh
+case "$1" in
+Username*) echo "$GIT_EXPORT_USERNAME" ;;
+*) echo "$GIT_EXPORT_PASSWORD" ;;
+esac
+`
+)
+
+// Repository defines the operations used on a Git repository
+type Repository interface {
+	Export(ctx context.Context, directory string, files map[string][]byte, subject string) (*Commit, error)
+}
+
+// Credentials authenticate to the remote repository, with a username and a password or a token over HTTPS, or with
+// a private key over SSH. The host keys of the SSH server are checked against KnownHosts, which is required along with
+// the private key.
+type Credentials struct {
+	Username      string
+	Password      string
+	SSHPrivateKey []byte
+	KnownHosts    []byte
+}
+
+// Author is the author and committer of the commits
+type Author struct {
+	Name  string
+	Email string
+}
+
+// Commit is a commit pushed to the remote repository
+type Commit struct {
+	Hash string
+	// Changes are the changed files, one per line as "<status>\t<path>" with the status A, M or D
+	Changes []string
+}
+
+type cliRepository struct {
+	url         string
+	branch      string
+	credentials Credentials
+	author      Author
+}
+
+var _ Repository = (*cliRepository)(nil)
+
+// NewRepository returns a Repository for a branch of the remote repository at url, which is operated with the git
+// command line. The url is anything git clones from, such as an HTTPS or an SSH url, or the path of a local bare
+// repository.
+func NewRepository(url, branch string, credentials Credentials, author Author) (Repository, error) {
+	if len(url) == 0 {
+		return nil, errors.New("url is required")
+	}
+	if len(branch) == 0 {
+		branch = DefaultBranch
+	}
+	if len(author.Name) == 0 || len(author.Email) == 0 {
+		return nil, errors.New("author name and email are required")
+	}
+	if len(credentials.SSHPrivateKey) > 0 && len(credentials.KnownHosts) == 0 {
+		return nil, errors.New("known hosts are required along with the SSH private key to check the host keys of the server")
+	}
+	return &cliRepository{url: url, branch: branch, credentials: credentials, author: author}, nil
+}
+
+// Export replaces the content of the directory of the branch by the files, keyed by their slash separated paths
+// relative to the directory, then commits the changes with the subject and pushes the commit. The branch is created if
+// it doesn't exist. No commit is made if nothing changed, the returned Commit is then nil.
+func (r *cliRepository) Export(ctx context.Context, directory string, files map[string][]byte, subject string) (*Commit, error) {
+	directory, err := cleanPath(directory)
+	if err != nil {
+		return nil, err
+	}
+	workDir, err := ioutil.TempDir("", "git-export")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(workDir)
+	git, err := r.newCommand(workDir)
+	if err != nil {
+		return nil, err
+	}
+	checkout := filepath.Join(workDir, "checkout")
+	if err = os.Mkdir(checkout, 0700); err != nil {
+		return nil, err
+	}
+
+	// Only the head of the branch is fetched, the new commit is its child
+	if _, err = git(ctx, checkout, "init", "-q"); err != nil {
+		return nil, err
+	}
+	if _, err = git(ctx, checkout, "remote", "add", "origin", r.url); err != nil {
+		return nil, err
+	}
+	ref := "refs/heads/" + r.branch
+	heads, err := git(ctx, checkout, "ls-remote", "--heads", "origin", ref)
+	if err != nil {
+		return nil, err
+	}
+	if len(strings.TrimSpace(heads)) > 0 {
+		if _, err = git(ctx, checkout, "fetch", "-q", "--depth", "1", "origin", ref); err != nil {
+			return nil, err
+		}
+		if _, err = git(ctx, checkout, "checkout", "-q", "-B", r.branch, "FETCH_HEAD"); err != nil {
+			return nil, err
+		}
+	} else if _, err = git(ctx, checkout, "symbolic-ref", "HEAD", ref); err != nil {
+		return nil, err
+	}
+
+	// The files which are not exported anymore are deleted
+	target := filepath.Join(checkout, filepath.FromSlash(directory))
+	if err = removeContent(target); err != nil {
+		return nil, err
+	}
+	for name, content := range files {
+		name, err = cleanPath(name)
+		if err != nil {
+			return nil, err
+		}
+		if len(name) == 0 {
+			return nil, errors.New("file path is required")
+		}
+		file := filepath.Join(target, filepath.FromSlash(name))
+		if err = os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+			return nil, err
+		}
+		if err = ioutil.WriteFile(file, content, 0600); err != nil {
+			return nil, err
+		}
+	}
+	pathspec := directory
+	if len(pathspec) == 0 {
+		pathspec = "."
+	}
+	if _, err = git(ctx, checkout, "add", "-A", "--", pathspec); err != nil {
+		return nil, err
+	}
+	status, err := git(ctx, checkout, "diff", "--cached", "--name-status", "--no-renames")
+	if err != nil {
+		return nil, err
+	}
+	changes := splitLines(status)
+	if len(changes) == 0 {
+		return nil, nil
+	}
+
+	// The changed files are listed in the message, so that the history tells which configurations each commit changed
+	message := filepath.Join(workDir, "message")
+	if err = ioutil.WriteFile(message, []byte(subject+"\n\n"+strings.Join(changes, "\n")+"\n"), 0600); err != nil {
+		return nil, err
+	}
+	if _, err = git(ctx, checkout, "commit", "-q", "-F", message); err != nil {
+		return nil, err
+	}
+	if _, err = git(ctx, checkout, "push", "-q", "origin", "HEAD:"+ref); err != nil {
+		return nil, err
+	}
+	hash, err := git(ctx, checkout, "rev-parse", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	return &Commit{Hash: strings.TrimSpace(hash), Changes: changes}, nil
+}
+
+// gitCommand runs git with its arguments in a directory and returns its output
+type gitCommand func(ctx context.Context, dir string, args ...string) (string, error)
+
+// newCommand returns the gitCommand running git with the credentials and the author of the repository. The files
+// holding the credentials are written to workDir.
+func (r *cliRepository) newCommand(workDir string) (gitCommand, error) {
+	env := append(os.Environ(),
+		"GIT_TERMINAL_PROMPT=0",
+		"GIT_CONFIG_NOSYSTEM=1",
+		"HOME="+workDir,
+		"GIT_AUTHOR_NAME="+r.author.Name,
+		"GIT_AUTHOR_EMAIL="+r.author.Email,
+		"GIT_COMMITTER_NAME="+r.author.Name,
+		"GIT_COMMITTER_EMAIL="+r.author.Email,
+	)
+	if len(r.credentials.Username) > 0 || len(r.credentials.Password) > 0 {
+		askPass := filepath.Join(workDir, "askpass.sh")
+		if err := ioutil.WriteFile(askPass, []byte(askPassScript), 0700); err != nil {
+			return nil, err
+		}
+		env = append(env, "GIT_ASKPASS="+askPass,
+			"GIT_EXPORT_USERNAME="+r.credentials.Username,
+			"GIT_EXPORT_PASSWORD="+r.credentials.Password)
+	}
+	if len(r.credentials.SSHPrivateKey) > 0 {
+		identity := filepath.Join(workDir, "identity")
+		if err := ioutil.WriteFile(identity, r.credentials.SSHPrivateKey, 0600); err != nil {
+			return nil, err
+		}
+		knownHosts := filepath.Join(workDir, "known_hosts")
+		if err := ioutil.WriteFile(knownHosts, r.credentials.KnownHosts, 0600); err != nil {
+			return nil, err
+		}
+		sshCommand := fmt.Sprintf("ssh -i %s -o IdentitiesOnly=yes -o UserKnownHostsFile=%s -o StrictHostKeyChecking=yes", identity, knownHosts)
+		env = append(env, "GIT_SSH_COMMAND="+sshCommand)
+	}
+
+	return func(ctx context.Context, dir string, args ...string) (string, error) {
+		var stdout, stderr bytes.Buffer
+		cmd := exec.CommandContext(ctx, "git", args...)
+		cmd.Dir = dir
+		cmd.Env = env
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return "", errors.Errorf("git %s failed: %s: %s", args[0], err, strings.TrimSpace(stderr.String()))
+		}
+		return stdout.String(), nil
+	}, nil
+}
+
+// removeContent removes the content of the directory, except the .git directory of the repository
+func removeContent(directory string) error {
+	entries, err := ioutil.ReadDir(directory)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.Name() == ".git" {
+			continue
+		}
+		if err = os.RemoveAll(filepath.Join(directory, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cleanPath returns the slash separated path relative to the repository, or an error if it leaves the repository or
+// enters its .git directory
+func cleanPath(name string) (string, error) {
+	name = strings.Trim(name, "/")
+	if len(name) == 0 || name == "." {
+		return "", nil
+	}
+	cleaned := path.Clean(name)
+	if cleaned != name {
+		return "", errors.Errorf("invalid path '%s'", name)
+	}
+	for _, element := range strings.Split(cleaned, "/") {
+		if element == ".." || element == ".git" {
+			return "", errors.Errorf("invalid path '%s'", name)
+		}
+	}
+	return cleaned, nil
+}
+
+func splitLines(output string) []string {
+	lines := []string{}
+	for _, line := range strings.Split(output, "\n") {
+		if len(line) > 0 {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,155 @@
+package git
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testAuthor = Author{Name: "Jenkins Operator", Email: "jenkins-operator@example.com"}
+
+func newBareRepository(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "git-export-test")
+	require.NoError(t, err)
+	bare := filepath.Join(dir, "config.git")
+	require.NoError(t, exec.Command("git", "init", "-q", "--bare", bare).Run())
+	return bare
+}
+
+func gitOutput(t *testing.T, repository string, args ...string) string {
+	output, err := exec.Command("git", append([]string{"--git-dir", repository}, args...)...).Output()
+	require.NoError(t, err)
+	return strings.TrimSpace(string(output))
+}
+
+func TestNewRepository(t *testing.T) {
+	t.Run("default branch", func(t *testing.T) {
+		repository, err := NewRepository("/srv/git/config.git", "", Credentials{}, testAuthor)
+
+		require.NoError(t, err)
+		assert.Equal(t, DefaultBranch, repository.(*cliRepository).branch)
+	})
+	t.Run("missing url", func(t *testing.T) {
+		_, err := NewRepository("", "main", Credentials{}, testAuthor)
+
+		assert.EqualError(t, err, "url is required")
+	})
+	t.Run("missing author", func(t *testing.T) {
+		_, err := NewRepository("/srv/git/config.git", "main", Credentials{}, Author{Name: "Jenkins Operator"})
+
+		assert.EqualError(t, err, "author name and email are required")
+	})
+	t.Run("SSH private key without known hosts", func(t *testing.T) {
+		_, err := NewRepository("git@git.example.com:jenkins-config.git", "main", Credentials{SSHPrivateKey: []byte("key")}, testAuthor)
+
+		assert.EqualError(t, err, "known hosts are required along with the SSH private key to check the host keys of the server")
+	})
+}
+
+func TestExport(t *testing.T) {
+	ctx := context.Background()
+	bare := newBareRepository(t)
+	defer os.RemoveAll(filepath.Dir(bare))
+	repository, err := NewRepository(bare, "", Credentials{}, testAuthor)
+	require.NoError(t, err)
+
+	t.Run("first export creates the branch", func(t *testing.T) {
+		commit, err := repository.Export(ctx, "jenkins", map[string][]byte{
+			"config.xml":               []byte("<hudson/>"),
+			"jobs/a/config.xml":        []byte("<project/>"),
+			"jobs/folder/config.xml":   []byte("<folder/>"),
+			"jobs/folder/jobs/b/c.xml": []byte("<c/>"),
+		}, "Export of Jenkins 'example'")
+
+		require.NoError(t, err)
+		require.NotNil(t, commit)
+		assert.Equal(t, []string{
+			"A\tjenkins/config.xml",
+			"A\tjenkins/jobs/a/config.xml",
+			"A\tjenkins/jobs/folder/config.xml",
+			"A\tjenkins/jobs/folder/jobs/b/c.xml",
+		}, commit.Changes)
+		assert.Equal(t, commit.Hash, gitOutput(t, bare, "rev-parse", "refs/heads/main"))
+		assert.Equal(t, "<project/>", gitOutput(t, bare, "show", "main:jenkins/jobs/a/config.xml"))
+		assert.Equal(t, "Jenkins Operator <jenkins-operator@example.com>", gitOutput(t, bare, "log", "-1", "--format=%an <%ae>", "main"))
+	})
+	t.Run("nothing changed", func(t *testing.T) {
+		commit, err := repository.Export(ctx, "jenkins", map[string][]byte{
+			"config.xml":               []byte("<hudson/>"),
+			"jobs/a/config.xml":        []byte("<project/>"),
+			"jobs/folder/config.xml":   []byte("<folder/>"),
+			"jobs/folder/jobs/b/c.xml": []byte("<c/>"),
+		}, "Export of Jenkins 'example'")
+
+		require.NoError(t, err)
+		assert.Nil(t, commit)
+		assert.Equal(t, "1", gitOutput(t, bare, "rev-list", "--count", "main"))
+	})
+	t.Run("changed and deleted files", func(t *testing.T) {
+		commit, err := repository.Export(ctx, "jenkins", map[string][]byte{
+			"config.xml":        []byte("<hudson/>"),
+			"jobs/a/config.xml": []byte("<project><disabled>true</disabled></project>"),
+		}, "Export of Jenkins 'example'")
+
+		require.NoError(t, err)
+		require.NotNil(t, commit)
+		assert.Equal(t, []string{
+			"M\tjenkins/jobs/a/config.xml",
+			"D\tjenkins/jobs/folder/config.xml",
+			"D\tjenkins/jobs/folder/jobs/b/c.xml",
+		}, commit.Changes)
+		assert.Equal(t, "2", gitOutput(t, bare, "rev-list", "--count", "main"))
+		assert.Equal(t, "Export of Jenkins 'example'\n\nM\tjenkins/jobs/a/config.xml\nD\tjenkins/jobs/folder/config.xml\nD\tjenkins/jobs/folder/jobs/b/c.xml",
+			gitOutput(t, bare, "log", "-1", "--format=%B", "main"))
+	})
+	t.Run("other directories are kept", func(t *testing.T) {
+		commit, err := repository.Export(ctx, "other", map[string][]byte{"config.xml": []byte("<other/>")}, "Export of Jenkins 'other'")
+
+		require.NoError(t, err)
+		require.NotNil(t, commit)
+		assert.Equal(t, []string{"A\tother/config.xml"}, commit.Changes)
+		assert.Equal(t, "<hudson/>", gitOutput(t, bare, "show", "main:jenkins/config.xml"))
+	})
+	t.Run("invalid path", func(t *testing.T) {
+		_, err := repository.Export(ctx, "jenkins", map[string][]byte{"../config.xml": []byte("<hudson/>")}, "Export")
+
+		assert.EqualError(t, err, "invalid path '../config.xml'")
+	})
+	t.Run("missing repository", func(t *testing.T) {
+		missing, err := NewRepository(filepath.Join(filepath.Dir(bare), "missing.git"), "", Credentials{}, testAuthor)
+		require.NoError(t, err)
+
+		_, err = missing.Export(ctx, "", map[string][]byte{"config.xml": []byte("<hudson/>")}, "Export")
+
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "git ls-remote failed")
+	})
+}
+
+func TestCleanPath(t *testing.T) {
+	for name, expected := range map[string]string{
+		"":                "",
+		"/":               "",
+		".":               "",
+		"jenkins/":        "jenkins",
+		"/jenkins/prod":   "jenkins/prod",
+		"jobs/config.xml": "jobs/config.xml",
+	} {
+		cleaned, err := cleanPath(name)
+
+		assert.NoError(t, err, name)
+		assert.Equal(t, expected, cleaned, name)
+	}
+	for _, name := range []string{"..", "jobs/../../config.xml", "jobs//config.xml", ".git/config", "jobs/.git/config"} {
+		_, err := cleanPath(name)
+
+		assert.Error(t, err, name)
+	}
+}
@@ -0,0 +1,473 @@
+package objectstorage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultRegion is used when no region is given
+	DefaultRegion = "us-east-1"
+
+	signingAlgorithm = "AWS4-HMAC-SHA256"
+	amzDateFormat    = "20060102T150405Z"
+	shortDateFormat  = "20060102"
+	emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+	// DefaultPartSize is the size of the parts of the multipart uploads, objects smaller than it are sent in a
+	// single request. With at most 10000 parts per upload, objects up to ~156 GiB can be stored.
+	DefaultPartSize = 16 * 1024 * 1024
+	// maxParts is the maximum number of parts of a multipart upload
+	maxParts = 10000
+
+	// connectionTimeout bounds the dial and TLS handshake with the object storage
+	connectionTimeout = 30 * time.Second
+	// responseHeaderTimeout bounds the wait for the response once a request has been sent, the body itself is
+	// streamed and only bounded by the context of the request
+	responseHeaderTimeout = 2 * time.Minute
+)
+
+// Client defines the operations used on an object storage bucket
+type Client interface {
+	PutObject(ctx context.Context, key string, body io.Reader) error
+	GetObject(ctx context.Context, key string) (io.ReadCloser, error)
+	DeleteObject(ctx context.Context, key string) error
+	ListPrefixes(ctx context.Context, prefix string) ([]string, error)
+}
+
+// Credentials are the access keys used to sign the requests
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	// SessionToken is set for temporary credentials, e.g. from AWS STS
+	SessionToken string
+}
+
+type s3Client struct {
+	httpClient  *http.Client
+	endpoint    *url.URL
+	region      string
+	bucket      string
+	pathStyle   bool
+	credentials Credentials
+	partSize    int
+	now         func() time.Time
+}
+
+var _ Client = (*s3Client)(nil)
+
+// NewS3Client returns a Client for a bucket of an S3 compatible object storage.
+// When endpoint is empty, the AWS S3 endpoint of the region is used with virtual hosted-style requests,
+// otherwise path-style requests are sent to the endpoint, as expected by MinIO and most compatible storages.
+func NewS3Client(endpoint, region, bucket string, credentials Credentials) (Client, error) {
+	if len(bucket) == 0 {
+		return nil, errors.New("bucket is required")
+	}
+	if len(region) == 0 {
+		region = DefaultRegion
+	}
+	pathStyle := true
+	if len(endpoint) == 0 {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", region)
+		pathStyle = false
+	}
+	endpointURL, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid endpoint '%s'", endpoint)
+	}
+	if endpointURL.Scheme != "http" && endpointURL.Scheme != "https" {
+		return nil, errors.Errorf("invalid endpoint '%s', scheme must be http or https", endpoint)
+	}
+	return &s3Client{
+		httpClient:  newHTTPClient(),
+		endpoint:    endpointURL,
+		region:      region,
+		bucket:      bucket,
+		pathStyle:   pathStyle,
+		credentials: credentials,
+		partSize:    DefaultPartSize,
+		now:         time.Now,
+	}, nil
+}
+
+// newHTTPClient returns a client which doesn't wait forever for an unreachable or unresponsive object storage.
+// http.Client.Timeout is not used as it would also bound the transfer of the objects, whatever their size.
+func newHTTPClient() *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   connectionTimeout,
+				KeepAlive: connectionTimeout,
+			}).DialContext,
+			TLSHandshakeTimeout:   connectionTimeout,
+			ResponseHeaderTimeout: responseHeaderTimeout,
+			ExpectContinueTimeout: time.Second,
+			IdleConnTimeout:       90 * time.Second,
+			MaxIdleConns:          10,
+		},
+	}
+}
+
+// PutObject uploads the body to the key. The body is read part by part, so only one part is held in memory:
+// a body smaller than a part is sent in a single request, a larger one with a multipart upload.
+func (c *s3Client) PutObject(ctx context.Context, key string, body io.Reader) error {
+	part, err := readPart(body, c.partSize)
+	if err != nil {
+		return err
+	}
+	if len(part) < c.partSize {
+		_, err = c.put(ctx, key, nil, part)
+		return err
+	}
+
+	uploadID, err := c.createMultipartUpload(ctx, key)
+	if err != nil {
+		return err
+	}
+	err = c.uploadParts(ctx, key, uploadID, part, body)
+	if err != nil {
+		// The parts already uploaded are billed until the upload is aborted
+		if abortErr := c.abortMultipartUpload(context.Background(), key, uploadID); abortErr != nil {
+			return errors.Wrapf(err, "failed to abort the upload: %s", abortErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// completedPart is a part of a multipart upload, as listed in the CompleteMultipartUpload request
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+// completeMultipartUpload is the body of the CompleteMultipartUpload request
+type completeMultipartUpload struct {
+	XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+	Parts   []completedPart `xml:"Part"`
+}
+
+// initiateMultipartUploadResult is the response of CreateMultipartUpload
+type initiateMultipartUploadResult struct {
+	UploadID string `xml:"UploadId"`
+}
+
+func (c *s3Client) uploadParts(ctx context.Context, key, uploadID string, firstPart []byte, body io.Reader) error {
+	completed := completeMultipartUpload{}
+	part := firstPart
+	for partNumber := 1; len(part) > 0; partNumber++ {
+		if partNumber > maxParts {
+			return errors.Errorf("object is larger than %d parts of %d bytes", maxParts, c.partSize)
+		}
+		query := url.Values{"partNumber": {fmt.Sprint(partNumber)}, "uploadId": {uploadID}}
+		header, err := c.put(ctx, key, query, part)
+		if err != nil {
+			return err
+		}
+		completed.Parts = append(completed.Parts, completedPart{PartNumber: partNumber, ETag: header.Get("ETag")})
+		if len(part) < c.partSize {
+			break
+		}
+		if part, err = readPart(body, c.partSize); err != nil {
+			return err
+		}
+	}
+
+	content, err := xml.Marshal(completed)
+	if err != nil {
+		return err
+	}
+	request, err := c.newRequest(ctx, http.MethodPost, key, url.Values{"uploadId": {uploadID}}, ioutil.NopCloser(bytes.NewReader(content)), hashHex(string(content)))
+	if err != nil {
+		return err
+	}
+	request.ContentLength = int64(len(content))
+	response, err := c.do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	// CompleteMultipartUpload may fail after its 200 OK status, the error is then in the body
+	result, err := ioutil.ReadAll(io.LimitReader(response.Body, 64*1024))
+	if err != nil {
+		return err
+	}
+	if bytes.Contains(result, []byte("<Error>")) {
+		return errors.Errorf("%s %s failed: %s", request.Method, request.URL.Path, result)
+	}
+	return nil
+}
+
+func (c *s3Client) createMultipartUpload(ctx context.Context, key string) (string, error) {
+	request, err := c.newRequest(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, nil, emptyPayloadHash)
+	if err != nil {
+		return "", err
+	}
+	response, err := c.do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	result := &initiateMultipartUploadResult{}
+	if err = xml.NewDecoder(response.Body).Decode(result); err != nil {
+		return "", errors.Wrap(err, "invalid response to the creation of the multipart upload")
+	}
+	if len(result.UploadID) == 0 {
+		return "", errors.New("no upload ID in the response to the creation of the multipart upload")
+	}
+	return result.UploadID, nil
+}
+
+func (c *s3Client) abortMultipartUpload(ctx context.Context, key, uploadID string) error {
+	request, err := c.newRequest(ctx, http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil, emptyPayloadHash)
+	if err != nil {
+		return err
+	}
+	response, err := c.do(request)
+	if err != nil {
+		return err
+	}
+	return response.Body.Close()
+}
+
+// put sends a PUT request with the content, either a whole object or a part of a multipart upload,
+// and returns the headers of the response
+func (c *s3Client) put(ctx context.Context, key string, query url.Values, content []byte) (http.Header, error) {
+	hash := sha256.Sum256(content)
+	request, err := c.newRequest(ctx, http.MethodPut, key, query, ioutil.NopCloser(bytes.NewReader(content)), hex.EncodeToString(hash[:]))
+	if err != nil {
+		return nil, err
+	}
+	request.ContentLength = int64(len(content))
+	response, err := c.do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, response.Body)
+	return response.Header, nil
+}
+
+// readPart reads up to size bytes of the body, it only returns less at the end of the body
+func readPart(body io.Reader, size int) ([]byte, error) {
+	part := make([]byte, size)
+	n, err := io.ReadFull(body, part)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return part[:n], nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return part, nil
+}
+
+// GetObject downloads the object of the key, the caller has to close the returned reader
+func (c *s3Client) GetObject(ctx context.Context, key string) (io.ReadCloser, error) {
+	request, err := c.newRequest(ctx, http.MethodGet, key, nil, nil, emptyPayloadHash)
+	if err != nil {
+		return nil, err
+	}
+	response, err := c.do(request)
+	if err != nil {
+		return nil, err
+	}
+	return response.Body, nil
+}
+
+// DeleteObject deletes the object of the key, deleting a missing object is not an error
+func (c *s3Client) DeleteObject(ctx context.Context, key string) error {
+	request, err := c.newRequest(ctx, http.MethodDelete, key, nil, nil, emptyPayloadHash)
+	if err != nil {
+		return err
+	}
+	response, err := c.do(request)
+	if err != nil {
+		return err
+	}
+	return response.Body.Close()
+}
+
+// listBucketResult is the response of ListObjectsV2, only the common prefixes are read
+type listBucketResult struct {
+	CommonPrefixes []struct {
+		Prefix string `xml:"Prefix"`
+	} `xml:"CommonPrefixes"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// ListPrefixes returns the distinct prefixes of the keys under the prefix up to their next "/", like the directories
+// of a file system, with their trailing "/"
+func (c *s3Client) ListPrefixes(ctx context.Context, prefix string) ([]string, error) {
+	prefixes := []string{}
+	continuationToken := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}, "delimiter": {"/"}}
+		if len(continuationToken) > 0 {
+			query.Set("continuation-token", continuationToken)
+		}
+		request, err := c.newRequest(ctx, http.MethodGet, "", query, nil, emptyPayloadHash)
+		if err != nil {
+			return nil, err
+		}
+		response, err := c.do(request)
+		if err != nil {
+			return nil, err
+		}
+		result := &listBucketResult{}
+		err = xml.NewDecoder(response.Body).Decode(result)
+		_ = response.Body.Close()
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid response to the listing of the objects")
+		}
+		for _, commonPrefix := range result.CommonPrefixes {
+			prefixes = append(prefixes, commonPrefix.Prefix)
+		}
+		if !result.IsTruncated || len(result.NextContinuationToken) == 0 {
+			return prefixes, nil
+		}
+		continuationToken = result.NextContinuationToken
+	}
+}
+
+func (c *s3Client) newRequest(ctx context.Context, method, key string, query url.Values, body io.ReadCloser, payloadHash string) (*http.Request, error) {
+	objectURL := *c.endpoint
+	objectPath := "/" + strings.TrimPrefix(key, "/")
+	if c.pathStyle {
+		objectPath = strings.TrimSuffix(objectURL.Path, "/") + "/" + c.bucket + objectPath
+	} else {
+		objectURL.Host = c.bucket + "." + objectURL.Host
+	}
+	objectURL.Path = objectPath
+	objectURL.RawPath = encodePath(objectPath)
+	objectURL.RawQuery = canonicalQuery(query)
+
+	request, err := http.NewRequest(method, objectURL.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	request = request.WithContext(ctx)
+	request.Header.Set("x-amz-content-sha256", payloadHash)
+	if len(c.credentials.SessionToken) > 0 {
+		request.Header.Set("x-amz-security-token", c.credentials.SessionToken)
+	}
+	c.sign(request, payloadHash, c.now().UTC())
+	return request, nil
+}
+
+func (c *s3Client) do(request *http.Request) (*http.Response, error) {
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		return response, nil
+	}
+	defer response.Body.Close()
+	message, _ := ioutil.ReadAll(io.LimitReader(response.Body, 1024))
+	return nil, errors.Errorf("%s %s failed with status %d: %s", request.Method, request.URL.Path, response.StatusCode, message)
+}
+
+// sign adds the AWS Signature Version 4 Authorization header to the request
+func (c *s3Client) sign(request *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.Format(amzDateFormat)
+	shortDate := now.Format(shortDateFormat)
+	request.Header.Set("x-amz-date", amzDate)
+
+	headerNames := []string{"host"}
+	headers := map[string]string{"host": request.URL.Host}
+	for name, values := range request.Header {
+		lowerName := strings.ToLower(name)
+		headerNames = append(headerNames, lowerName)
+		headers[lowerName] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	sort.Strings(headerNames)
+	canonicalHeaders := &strings.Builder{}
+	for _, name := range headerNames {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(headerNames, ";")
+
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		request.URL.EscapedPath(),
+		canonicalQuery(request.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := strings.Join([]string{shortDate, c.region, "s3", "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{signingAlgorithm, amzDate, scope, hashHex(canonicalRequest)}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+c.credentials.SecretAccessKey), shortDate)
+	signingKey = hmacSHA256(signingKey, c.region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	request.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		signingAlgorithm, c.credentials.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func canonicalQuery(values url.Values) string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parameters := []string{}
+	for _, key := range keys {
+		vals := values[key]
+		sort.Strings(vals)
+		for _, value := range vals {
+			parameters = append(parameters, uriEncode(key, true)+"="+uriEncode(value, true))
+		}
+	}
+	return strings.Join(parameters, "&")
+}
+
+// encodePath URI encodes each segment of the path
+func encodePath(path string) string {
+	return uriEncode(path, false)
+}
+
+// uriEncode encodes everything but the unreserved characters, as required by the signature
+func uriEncode(value string, encodeSlash bool) string {
+	encoded := &strings.Builder{}
+	for _, b := range []byte(value) {
+		if (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z') || (b >= '0' && b <= '9') ||
+			b == '-' || b == '.' || b == '_' || b == '~' || (b == '/' && !encodeSlash) {
+			encoded.WriteByte(b)
+		} else {
+			fmt.Fprintf(encoded, "%%%02X", b)
+		}
+	}
+	return encoded.String()
+}
+
+func hashHex(value string) string {
+	hash := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(hash[:])
+}
+
+func hmacSHA256(key []byte, value string) []byte {
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
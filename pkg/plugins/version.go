@@ -0,0 +1,69 @@
+package plugins
+
+import (
+	"strconv"
+	"strings"
+)
+
+// CompareVersions compares two Jenkins or plugin versions, for example "2.263.1" and "2.263.10" or "1.0-beta-1".
+// It returns -1 if first is older than second, 1 if it is newer and 0 if they are equal. The numeric parts are
+// compared as numbers and the other parts as strings, a release is newer than its qualified versions ("1.0" > "1.0-rc1").
+func CompareVersions(first, second string) int {
+	firstParts, firstQualifier := splitVersion(first)
+	secondParts, secondQualifier := splitVersion(second)
+	for i := 0; i < len(firstParts) || i < len(secondParts); i++ {
+		firstPart, secondPart := "0", "0"
+		if i < len(firstParts) {
+			firstPart = firstParts[i]
+		}
+		if i < len(secondParts) {
+			secondPart = secondParts[i]
+		}
+		if result := comparePart(firstPart, secondPart); result != 0 {
+			return result
+		}
+	}
+	switch {
+	case firstQualifier == secondQualifier:
+		return 0
+	case len(firstQualifier) == 0:
+		return 1
+	case len(secondQualifier) == 0:
+		return -1
+	}
+	return CompareVersions(firstQualifier, secondQualifier)
+}
+
+// splitVersion returns the dot separated parts of the version and its qualifier, after the first "-" or "+"
+func splitVersion(version string) ([]string, string) {
+	qualifier := ""
+	if index := strings.IndexAny(version, "-+"); index >= 0 {
+		version, qualifier = version[:index], version[index+1:]
+	}
+	return strings.Split(version, "."), qualifier
+}
+
+func comparePart(first, second string) int {
+	firstNumber, firstErr := strconv.Atoi(first)
+	secondNumber, secondErr := strconv.Atoi(second)
+	switch {
+	case firstErr == nil && secondErr == nil:
+		return compareInts(firstNumber, secondNumber)
+	case firstErr == nil:
+		// A number is newer than a label, like "1.0.1" > "1.0.beta"
+		return 1
+	case secondErr == nil:
+		return -1
+	}
+	return strings.Compare(first, second)
+}
+
+func compareInts(first, second int) int {
+	switch {
+	case first < second:
+		return -1
+	case first > second:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,30 @@
+package plugins
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		first, second string
+		want          int
+	}{
+		{"2.263.1", "2.263.1", 0},
+		{"2.263", "2.263.0", 0},
+		{"2.263.1", "2.263.10", -1},
+		{"2.277", "2.263.4", 1},
+		{"4.4.5", "4.10", -1},
+		{"1.0", "1.0-rc1", 1},
+		{"1.0-rc1", "1.0-rc2", -1},
+		{"1.0-beta-1", "1.0-beta-10", -1},
+		{"1.0.1", "1.0.beta", 1},
+		{"1.8+build.201601050116", "1.8+build.201601050115", 1},
+		{"20.810504d7462", "20.810504d7462", 0},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.want, CompareVersions(test.first, test.second), "%s <=> %s", test.first, test.second)
+		assert.Equal(t, -test.want, CompareVersions(test.second, test.first), "%s <=> %s", test.second, test.first)
+	}
+}